@@ -4,8 +4,11 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+	"github.com/haxorport/haxorport-go-client/internal/infrastructure/httpauth"
+	"github.com/haxorport/haxorport-go-client/internal/infrastructure/transport"
 	"github.com/spf13/cobra"
 )
 
@@ -49,10 +52,83 @@ var configShowCmd = &cobra.Command{
 					fmt.Printf("     Subdomain: %s\n", tunnel.Subdomain)
 				} else if tunnel.Type == model.TunnelTypeTCP {
 					fmt.Printf("     Remote Port: %d\n", tunnel.RemotePort)
+					if tunnel.LocalListen != "" {
+						fmt.Printf("     Local Listen: %s\n", tunnel.LocalListen)
+					}
+					if tunnel.ProxyProtocol != model.ProxyProtocolNone {
+						fmt.Printf("     PROXY Protocol: %s\n", tunnel.ProxyProtocol)
+					}
+					if tunnel.Private {
+						fmt.Printf("     Private: yes (secret %s)\n", maskString(tunnel.Secret))
+					}
 				}
 				if tunnel.Auth != nil {
 					fmt.Printf("     Auth: %s\n", tunnel.Auth.Type)
 				}
+				if tunnel.OIDC != nil {
+					fmt.Printf("     OpenID Connect: %s (client %s)\n", tunnel.OIDC.Issuer, tunnel.OIDC.ClientID)
+					if len(tunnel.OIDC.AllowedDomains) > 0 {
+						fmt.Printf("     Allowed Domains: %s\n", strings.Join(tunnel.OIDC.AllowedDomains, ", "))
+					}
+				}
+				if tunnel.ErrorPages != nil {
+					if tunnel.ErrorPages.HTMLFile != "" {
+						fmt.Printf("     HTML Error Page: %s\n", tunnel.ErrorPages.HTMLFile)
+					}
+					if tunnel.ErrorPages.JSONFile != "" {
+						fmt.Printf("     JSON Error Page: %s\n", tunnel.ErrorPages.JSONFile)
+					}
+				}
+				if tunnel.UpstreamTimeout > 0 {
+					fmt.Printf("     Upstream Timeout: %s\n", tunnel.UpstreamTimeout)
+				}
+				if len(tunnel.Upstreams) > 0 {
+					strategy := model.LoadBalancingRoundRobin
+					if tunnel.LoadBalancing != nil && tunnel.LoadBalancing.Strategy != "" {
+						strategy = tunnel.LoadBalancing.Strategy
+					}
+					fmt.Printf("     Upstreams: %s (%s)\n", strings.Join(tunnel.Upstreams, ", "), strategy)
+					if tunnel.LoadBalancing != nil && tunnel.LoadBalancing.HealthCheck != nil {
+						fmt.Printf("     Health Check: %s\n", tunnel.LoadBalancing.HealthCheck.Path)
+					}
+				}
+				for _, route := range tunnel.Routes {
+					strip := ""
+					if route.StripPrefix {
+						strip = " (strip prefix)"
+					}
+					fmt.Printf("     Route: %s → %s%s\n", route, strings.Join(route.Upstreams, ", "), strip)
+				}
+				if tunnel.Rewrite != nil {
+					if tunnel.Rewrite.Host != "" {
+						fmt.Printf("     Host Header: %s\n", tunnel.Rewrite.Host)
+					}
+					for _, path := range tunnel.Rewrite.Paths {
+						fmt.Printf("     Rewrite Path: %s → %s\n", path.Match, path.Replace)
+					}
+					if tunnel.Rewrite.RequestHeaders != nil || tunnel.Rewrite.ResponseHeaders != nil {
+						fmt.Printf("     Header Rewrites: yes\n")
+					}
+					if tunnel.Rewrite.Location {
+						fmt.Printf("     Rewrite Location: yes\n")
+					}
+					if tunnel.Rewrite.CookieDomain != "" {
+						fmt.Printf("     Cookie Domain: %s\n", tunnel.Rewrite.CookieDomain)
+					}
+					if tunnel.Rewrite.BodyURLs {
+						contentTypes := "HTML, CSS, JavaScript, JSON"
+						if len(tunnel.Rewrite.BodyContentTypes) > 0 {
+							contentTypes = strings.Join(tunnel.Rewrite.BodyContentTypes, ", ")
+						}
+						fmt.Printf("     Rewrite URLs: %s\n", contentTypes)
+					}
+				}
+				if len(tunnel.AllowCIDRs) > 0 {
+					fmt.Printf("     Allow: %s\n", strings.Join(tunnel.AllowCIDRs, ", "))
+				}
+				if len(tunnel.DenyCIDRs) > 0 {
+					fmt.Printf("     Deny: %s\n", strings.Join(tunnel.DenyCIDRs, ", "))
+				}
 			}
 		}
 	},
@@ -130,18 +206,34 @@ Examples:
 				auth.Type = model.AuthTypeBasic
 				auth.Username = httpUsername
 				auth.Password = httpPassword
-				if auth.Username == "" || auth.Password == "" {
-					fmt.Println("Error: Username and password are required for basic auth")
+				auth.HtpasswdFile = httpHtpasswd
+				if auth.HtpasswdFile == "" && (auth.Username == "" || auth.Password == "") {
+					fmt.Println("Error: Username and password or an htpasswd file are required for basic auth")
 					os.Exit(1)
 				}
 			case "header":
 				auth.Type = model.AuthTypeHeader
 				auth.HeaderName = httpHeader
 				auth.HeaderValue = httpValue
-				if auth.HeaderName == "" || auth.HeaderValue == "" {
-					fmt.Println("Error: Header name and value are required for header auth")
+				auth.HeaderValues = httpAPIKeys
+				if auth.HeaderName == "" || (auth.HeaderValue == "" && len(auth.HeaderValues) == 0) {
+					fmt.Println("Error: Header name and at least one value are required for header auth")
 					os.Exit(1)
 				}
+			case "form":
+				form, err := formAuthFromFlags()
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(1)
+				}
+				auth = form
+			case "jwt":
+				jwt, err := jwtAuthFromFlags()
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(1)
+				}
+				auth = jwt
 			default:
 				fmt.Printf("Error: Invalid auth type: %s\n", httpAuthType)
 				os.Exit(1)
@@ -160,16 +252,65 @@ Examples:
 		case "http":
 			tunnelConfig.Type = model.TunnelTypeHTTP
 			tunnelConfig.Subdomain = httpSubdomain
+			oidc, err := oidcFromFlags()
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			tunnelConfig.OIDC = oidc
+			if oidc != nil && auth != nil && auth.Type == model.AuthTypeForm {
+				fmt.Println("Error: OpenID Connect cannot be combined with form auth")
+				os.Exit(1)
+			}
+			errorPages, err := errorPagesFromFlags()
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			tunnelConfig.ErrorPages = errorPages
+			tunnelConfig.UpstreamTimeout = httpUpstreamTimeout
+			routes, err := routesFromFlags()
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			loadBalancing, err := loadBalancingFromFlags(len(routes) > 0)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			tunnelConfig.Upstreams = httpUpstreams
+			tunnelConfig.LoadBalancing = loadBalancing
+			tunnelConfig.Routes = routes
+			if tunnelConfig.Rewrite, err = rewriteFromFlags(); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
 		case "tcp":
 			tunnelConfig.Type = model.TunnelTypeTCP
 			tunnelConfig.RemotePort = tcpRemotePort
+			tunnelConfig.LocalListen = tcpLocalListen
+			tunnelConfig.Private = tcpPrivate
+			tunnelConfig.Secret = tcpSecret
+			proxyProtocol, err := model.ParseProxyProtocolVersion(tcpProxyProto)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			tunnelConfig.ProxyProtocol = proxyProtocol
 		default:
 			fmt.Printf("Error: Invalid tunnel type: %s\n", tunnelType)
 			os.Exit(1)
 		}
 
-		// Set auth
+		// Set auth and access lists
 		tunnelConfig.Auth = auth
+		tunnelConfig.AllowCIDRs = httpAllow
+		tunnelConfig.DenyCIDRs = httpDeny
+		if err := transport.ValidateAccessList(httpAllow, httpDeny); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
 
 		// Add tunnel to configuration
 		Container.ConfigService.AddTunnel(Container.Config, tunnelConfig)
@@ -181,6 +322,12 @@ Examples:
 		}
 
 		fmt.Println("Tunnel successfully added to configuration")
+		if auth != nil && auth.TOTPSecret != "" && httpTOTPKey == "" {
+			uri := httpauth.TOTPURI(auth.TOTPSecret, tunnelConfig.Name)
+			fmt.Printf("TOTP secret: %s\n", auth.TOTPSecret)
+			fmt.Printf("Scan with your authenticator app or use %s\n", uri)
+			printQRCode(os.Stdout, uri)
+		}
 	},
 }
 
@@ -232,11 +379,50 @@ func init() {
 	configAddTunnelCmd.Flags().IntVarP(&httpLocalPort, "port", "p", 0, "Local port to tunnel")
 	configAddTunnelCmd.Flags().StringVarP(&httpSubdomain, "subdomain", "s", "", "Requested subdomain (for HTTP)")
 	configAddTunnelCmd.Flags().IntVarP(&tcpRemotePort, "remote-port", "r", 0, "Requested remote port (for TCP)")
-	configAddTunnelCmd.Flags().StringVarP(&httpAuthType, "auth", "a", "", "Authentication type (basic, header)")
+	configAddTunnelCmd.Flags().StringVar(&tcpLocalListen, "local-listen", "", "Local forwarding address (for TCP, optional)")
+	configAddTunnelCmd.Flags().BoolVar(&tcpPrivate, "private", false, "Register without a public port (for TCP)")
+	configAddTunnelCmd.Flags().StringVar(&tcpSecret, "secret", "", "Shared secret of a private tunnel (for TCP)")
+	configAddTunnelCmd.Flags().StringVar(&tcpProxyProto, "proxy-protocol", "", "PROXY protocol header sent to the local service: v1 or v2 (for TCP)")
+	configAddTunnelCmd.Flags().StringSliceVar(&httpAllow, "allow", nil, "Only allow visitors from these CIDRs or IPs")
+	configAddTunnelCmd.Flags().StringSliceVar(&httpDeny, "deny", nil, "Reject visitors from these CIDRs or IPs")
+	configAddTunnelCmd.Flags().StringVarP(&httpAuthType, "auth", "a", "", "Authentication type (basic, header, form, jwt)")
 	configAddTunnelCmd.Flags().StringVarP(&httpUsername, "username", "u", "", "Username for basic authentication")
-	configAddTunnelCmd.Flags().StringVarP(&httpPassword, "password", "w", "", "Password for basic authentication")
+	configAddTunnelCmd.Flags().StringVarP(&httpPassword, "password", "w", "", "Password for basic or form authentication")
 	configAddTunnelCmd.Flags().StringVar(&httpHeader, "header", "", "Header name for header authentication")
 	configAddTunnelCmd.Flags().StringVar(&httpValue, "value", "", "Header value for header authentication")
+	configAddTunnelCmd.Flags().StringVar(&httpHtpasswd, "htpasswd", "", "htpasswd file with the users accepted by basic authentication")
+	configAddTunnelCmd.Flags().StringSliceVar(&httpAPIKeys, "api-key", nil, "Accepted header value or API key for header authentication (repeatable)")
+	configAddTunnelCmd.Flags().BoolVar(&httpTOTP, "totp", false, "Generate a TOTP secret for form authentication")
+	configAddTunnelCmd.Flags().StringVar(&httpTOTPKey, "totp-secret", "", "Base32 TOTP secret for form authentication")
+	configAddTunnelCmd.Flags().StringVar(&httpJWKSFile, "jwks", "", "JWKS file for JWT authentication")
+	configAddTunnelCmd.Flags().StringVar(&httpJWTKeyFile, "jwt-key", "", "PEM public key for JWT authentication")
+	configAddTunnelCmd.Flags().StringVar(&httpJWTIssuer, "jwt-issuer", "", "Required iss claim for JWT authentication")
+	configAddTunnelCmd.Flags().StringVar(&httpJWTAudience, "jwt-audience", "", "Required aud claim for JWT authentication")
+	configAddTunnelCmd.Flags().StringSliceVar(&httpJWTClaims, "jwt-require-claim", nil, "Claim tokens must contain, as name or name=value")
+	configAddTunnelCmd.Flags().StringSliceVar(&httpJWTClaimHeader, "jwt-claim-header", nil, "Pass a claim to the local service as a header, as claim=Header-Name")
+	configAddTunnelCmd.Flags().StringVar(&httpOIDCIssuer, "oidc-issuer", "", "OpenID Connect issuer URL (for HTTP)")
+	configAddTunnelCmd.Flags().StringVar(&httpOIDCClientID, "oidc-client-id", "", "OpenID Connect client ID (for HTTP)")
+	configAddTunnelCmd.Flags().StringVar(&httpOIDCClientSecret, "oidc-client-secret", "", "OpenID Connect client secret (for HTTP)")
+	configAddTunnelCmd.Flags().StringSliceVar(&httpOIDCAllowedDomains, "oidc-allowed-domain", nil, "Only allow verified email addresses of these domains (for HTTP)")
+	configAddTunnelCmd.Flags().StringVar(&httpErrorPageHTML, "error-page-html", "", "html/template file for the error and maintenance pages (for HTTP)")
+	configAddTunnelCmd.Flags().StringVar(&httpErrorPageJSON, "error-page-json", "", "text/template file for the JSON errors (for HTTP)")
+	configAddTunnelCmd.Flags().DurationVar(&httpUpstreamTimeout, "upstream-timeout", 0, "Answer with 504 if the local service takes longer (for HTTP)")
+	configAddTunnelCmd.Flags().StringArrayVar(&httpUpstreams, "upstream", nil, "Balance requests over this local service, as port or host:port (for HTTP, repeatable)")
+	configAddTunnelCmd.Flags().StringVar(&httpLBStrategy, "lb-strategy", "", "Load balancing strategy: round_robin, least_connections, sticky_cookie or ip_hash (for HTTP)")
+	configAddTunnelCmd.Flags().StringVar(&httpHealthCheck, "health-check", "", "Path requested to check the health of the upstreams (for HTTP)")
+	configAddTunnelCmd.Flags().DurationVar(&httpHealthInterval, "health-interval", 0, "Time between health checks (for HTTP)")
+	configAddTunnelCmd.Flags().IntVar(&httpMaxFails, "max-fails", 0, "Connection errors in a row that take an upstream out (for HTTP)")
+	configAddTunnelCmd.Flags().DurationVar(&httpFailTimeout, "fail-timeout", 0, "How long an upstream stays out after connection errors (for HTTP)")
+	configAddTunnelCmd.Flags().StringArrayVar(&httpRoutes, "route", nil, "Send requests matching a path prefix or host to other upstreams, as PATTERN=UPSTREAM (for HTTP, repeatable)")
+	configAddTunnelCmd.Flags().StringArrayVar(&httpRoutesStrip, "route-strip", nil, "Like --route, but remove the path prefix before forwarding (for HTTP, repeatable)")
+	configAddTunnelCmd.Flags().StringVar(&httpHostHeader, "host-header", "", "Host header sent to the local service (for HTTP)")
+	configAddTunnelCmd.Flags().StringArrayVar(&httpRewritePaths, "rewrite-path", nil, "Rewrite request paths, as REGEX=REPLACEMENT (for HTTP, repeatable)")
+	configAddTunnelCmd.Flags().StringArrayVar(&httpRequestHeaders, "request-header", nil, "Set a request header, as \"Name: value\", or remove it, as -Name (for HTTP, repeatable)")
+	configAddTunnelCmd.Flags().StringArrayVar(&httpResponseHeaders, "response-header", nil, "Set a response header, as \"Name: value\", or remove it, as -Name (for HTTP, repeatable)")
+	configAddTunnelCmd.Flags().BoolVar(&httpRewriteLocation, "rewrite-location", false, "Point redirects to the local service at the public URL (for HTTP)")
+	configAddTunnelCmd.Flags().StringVar(&httpCookieDomain, "cookie-domain", "", "Replace the Domain of cookies set by the local service (for HTTP)")
+	configAddTunnelCmd.Flags().BoolVar(&httpRewriteURLs, "rewrite-urls", false, "Point URLs to the local service in responses at the public URL (for HTTP)")
+	configAddTunnelCmd.Flags().StringArrayVar(&httpRewriteTypes, "rewrite-content-type", nil, "Only rewrite URLs in responses of this content type (for HTTP, repeatable)")
 
 	// Mark required flags
 	configAddTunnelCmd.MarkFlagRequired("type")
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"github.com/haxorport/haxorport-go-client/internal/infrastructure/transport"
+	"github.com/spf13/cobra"
+)
+
+var (
+	connectLocal  string
+	connectP2P    bool
+	connectSecret string
+)
+
+// connectCmd is the command to connect to a TCP tunnel of another client
+var connectCmd = &cobra.Command{
+	Use:   "connect [remote_port | tunnel_name]",
+	Short: "Connect to a TCP tunnel",
+	Long: `Connect to a TCP tunnel exposed by another client and make it available on a local port.
+A private tunnel is selected by name and requires its shared secret; its traffic is
+encrypted end to end between the two clients, so the server only relays ciphertext.
+With --p2p, a direct peer-to-peer connection is tried first; if NAT traversal fails,
+traffic goes through the server relay. The tunnel owner must also enable P2P.
+Examples:
+  haxorport connect 2222 --local 127.0.0.1:2222
+  haxorport connect 2222 --local 127.0.0.1:2222 --p2p
+  haxorport connect db --local 127.0.0.1:15432 --secret <shared-secret>`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// A numeric argument is the remote port of a public tunnel, anything else names a private tunnel
+		remotePort, err := strconv.Atoi(args[0])
+		privateName := ""
+		if err != nil {
+			privateName = args[0]
+			if connectSecret == "" {
+				fmt.Printf("Error: --secret is required to connect to private tunnel %s\n", privateName)
+				os.Exit(1)
+			}
+		} else if remotePort <= 0 || remotePort > 65535 {
+			fmt.Printf("Error: Invalid remote port: %s\n", args[0])
+			os.Exit(1)
+		}
+
+		if Container.Config.AuthToken == "" {
+			fmt.Println("Error: Authentication token is required to connect to a tunnel")
+			fmt.Printf("Please add your token in the configuration file: %s\n", Container.Config.GetConfigFilePath())
+			os.Exit(1)
+		}
+
+		localAddr, err := transport.NormalizeListenAddr(connectLocal)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		if connectP2P {
+			Container.Config.DirectP2PEnabled = true
+		}
+		var visitor *transport.Visitor
+		if privateName != "" {
+			visitor, err = transport.NewPrivateVisitorFromConfig(Container.Config, Container.Logger, privateName, connectSecret)
+		} else {
+			visitor, err = transport.NewVisitorFromConfig(Container.Config, Container.Logger, remotePort)
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		listener, err := net.Listen("tcp", localAddr)
+		if err != nil {
+			fmt.Printf("Error: Failed to listen on %s: %v\n", localAddr, err)
+			os.Exit(1)
+		}
+		defer listener.Close()
+
+		fmt.Println("=================================================")
+		fmt.Println("✅ CONNECTED TO TCP TUNNEL")
+		fmt.Println("=================================================")
+		if privateName != "" {
+			fmt.Printf("🔒 Private   : %s (end-to-end encrypted)\n", privateName)
+		} else {
+			fmt.Printf("🌐 Remote    : %s:%d\n", Container.Config.ServerAddress, remotePort)
+		}
+		fmt.Printf("🖥️ Local     : %s\n", listener.Addr())
+		if Container.Config.DirectP2PEnabled {
+			fmt.Printf("🔀 Mode      : P2P with relay fallback\n")
+		} else {
+			fmt.Printf("🔀 Mode      : Relay\n")
+		}
+		fmt.Println("=================================================")
+		fmt.Println("📋 Press Ctrl+C to disconnect")
+		fmt.Println("=================================================")
+
+		go func() {
+			if err := visitor.Serve(listener); err != nil {
+				Container.Logger.Debug("Stopped accepting local connections: %v", err)
+			}
+		}()
+
+		// Wait for interrupt signal
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+		<-sigCh
+		fmt.Println("\nDisconnected")
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(connectCmd)
+
+	connectCmd.Flags().StringVarP(&connectLocal, "local", "l", "", "Local address to make the tunnel available on, e.g. 127.0.0.1:2222 (required)")
+	connectCmd.Flags().BoolVar(&connectP2P, "p2p", false, "Try a direct peer-to-peer connection before using the server relay")
+	connectCmd.Flags().StringVar(&connectSecret, "secret", "", "Shared secret of the private tunnel")
+
+	connectCmd.MarkFlagRequired("local")
+}
@@ -7,8 +7,10 @@ import (
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
 	"github.com/haxorport/haxorport-go-client/internal/infrastructure/transport"
 	"github.com/spf13/viper"
 )
@@ -46,12 +48,27 @@ func main() {
 	}
 	
 	// Parse command line arguments
-	localPort := flag.Int("local-port", 2222, "Local port to listen on")
+	localListen := flag.String("local-listen", "", "Optional local address forwarding to the target, e.g. 127.0.0.1:2222 (disabled by default)")
 	serverAddr := flag.String("server", "", "Server address (host:port)")
 	remoteHost := flag.String("remote-host", "localhost", "Remote host to connect to")
 	authToken := flag.String("auth-token", "", "Authentication token for server")
 	authEnabled := flag.Bool("auth", true, "Enable authentication")
 	remotePort := flag.Int("remote-port", 22, "Remote port to connect to (SSH port)")
+	authMode := flag.String("auth-mode", "token", "Authentication mode (token, challenge)")
+	poolMinIdle := flag.Int("pool-min-idle", 2, "Minimum number of idle control connections")
+	poolMaxIdle := flag.Int("pool-max-idle", 8, "Maximum number of idle control connections")
+	relayListen := flag.String("relay-listen", "", "Enable relay mode and accept relay back-connections on this address, e.g. 0.0.0.0:7100")
+	relayAdvertise := flag.String("relay-advertise", "", "Back-connection address announced to the relay (derived from -relay-listen if empty)")
+	p2p := flag.Bool("p2p", false, "Allow visitors to connect peer-to-peer (relayed if NAT traversal fails)")
+	privateName := flag.String("private", "", "Register a private tunnel with this name and no public port")
+	privateSecret := flag.String("secret", "", "Shared secret visitors of the private tunnel must know")
+	proxyProtocol := flag.String("proxy-protocol", "", "Send a PROXY protocol header (v1 or v2) with the visitor address to the target")
+	allowCIDRs := flag.String("allow", "", "Comma-separated CIDRs or IPs allowed to connect (empty to allow all)")
+	denyCIDRs := flag.String("deny", "", "Comma-separated CIDRs or IPs rejected before the target is contacted")
+	legacyHandshake := flag.Bool("legacy-handshake", false, "Use the old unframed text handshake for older servers")
+	tlsEnabled := flag.Bool("tls", false, "Enable TLS for connections to the server")
+	tlsCA := flag.String("tls-ca", "", "Path to CA bundle used to verify the server certificate")
+	tlsInsecure := flag.Bool("tls-insecure", false, "Skip server certificate verification")
 	flag.Parse()
 
 	// Create target address
@@ -140,30 +157,66 @@ func main() {
 
 	// Log connection information
 	log.Printf("Creating direct tunnel with configuration:")
-	log.Printf("- Local address: 0.0.0.0:%d", *localPort)
+	if *localListen != "" {
+		log.Printf("- Local listen address: %s", *localListen)
+	}
 	log.Printf("- Server address: %s", *serverAddr)
 	log.Printf("- Target address: %s:%d", *remoteHost, *remotePort)
 
 	// Create and start direct tunnel
 	directTunnel := transport.NewDirectTunnel(
-		"0.0.0.0",
+		*localListen,
 		*serverAddr,
 		*remoteHost+":"+strconv.Itoa(*remotePort),
-		*localPort,
 		0, // Remote port will be determined by the server
 		0, // Control port is no longer used
 		logger,
 		*authEnabled, // Use auth enabled flag from command line
 		*authToken, // Use auth token from command line
 	)
+	directTunnel.SetLegacyHandshake(*legacyHandshake)
+	if err := model.AuthMode(*authMode).Validate(); err != nil {
+		log.Fatalf("Invalid authentication mode: %v", err)
+	}
+	directTunnel.SetAuthMode(model.AuthMode(*authMode))
+	directTunnel.SetControlPoolSize(*poolMinIdle, *poolMaxIdle)
+	directTunnel.SetP2PEnabled(*p2p)
+	if *relayListen != "" {
+		directTunnel.SetRelayMode(*relayListen, *relayAdvertise)
+	}
+	if *privateName != "" {
+		if err := directTunnel.SetPrivate(*privateName, *privateSecret); err != nil {
+			log.Fatalf("Invalid private tunnel: %v", err)
+		}
+	}
+	proxyVersion, err := model.ParseProxyProtocolVersion(*proxyProtocol)
+	if err != nil {
+		log.Fatalf("Invalid PROXY protocol version: %v", err)
+	}
+	directTunnel.SetProxyProtocol(proxyVersion)
+	if err := directTunnel.SetAccessList(strings.Split(*allowCIDRs, ","), strings.Split(*denyCIDRs, ",")); err != nil {
+		log.Fatalf("Invalid access list: %v", err)
+	}
+
+	// Enable TLS if requested on the command line
+	if *tlsEnabled {
+		tlsConfig, err := transport.NewTLSConfig(&model.Config{
+			TLSCA:                 *tlsCA,
+			TLSInsecureSkipVerify: *tlsInsecure,
+		})
+		if err != nil {
+			log.Fatalf("Invalid TLS configuration: %v", err)
+		}
+		directTunnel.SetTLSConfig(tlsConfig)
+	}
 
 	// In debug mode, display IP information used for connection
 	if os.Getenv("LOG_LEVEL") == "debug" {
 		ip := directTunnel.GetOutboundIP()
 		log.Printf("Using IP for outbound connection: %s", ip)
-
-		// Example of using HandleRelayConnection if needed in the future
-		log.Printf("HandleRelayConnection available for relay mode implementation")
+	}
+	if *relayListen != "" {
+		log.Printf("- Relay mode: accepting back-connections on %s", *relayListen)
 	}
 
 	// Handle graceful shutdown
@@ -178,7 +231,10 @@ func main() {
 
 	// Print usage information
 	log.Printf("[INFO] Direct tunnel successfully started:")
-	log.Printf("[INFO] Local port %d -> %s through %s", *localPort, targetAddr, *serverAddr)
+	log.Printf("[INFO] Visitors through %s -> %s", *serverAddr, targetAddr)
+	if *localListen != "" {
+		log.Printf("[INFO] Local forwarding %s -> %s", *localListen, targetAddr)
+	}
 	log.Printf("[INFO] Press Ctrl+C to stop the tunnel")
 
 	// Wait for signal or error
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/haxorport/haxorport-go-client/internal/infrastructure/har"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// HAR replay flags
+	harReplayPort    int
+	harReplayHost    string
+	harReplayTimeout time.Duration
+)
+
+// harCmd is the command to work with HAR files
+var harCmd = &cobra.Command{
+	Use:   "har",
+	Short: "Work with HAR files",
+	Long:  `Work with HAR files recorded with haxorport http --har.`,
+}
+
+// harReplayCmd is the command to send the requests of a HAR file to a local service
+var harReplayCmd = &cobra.Command{
+	Use:   "replay <file>",
+	Short: "Send the requests of a HAR file to a local service",
+	Long: `Send the requests of a HAR file to a local service, in order, and compare the
+status codes with the recorded ones. Redacted headers are not sent.
+The command exits with status 1 if any request fails or gets another status.
+Examples:
+  haxorport har replay traffic.har --port 3000
+  haxorport har replay traffic.har --port 8080 --host 127.0.0.1 --timeout 10s`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if harReplayPort <= 0 || harReplayPort > 65535 {
+			fmt.Println("Error: A valid --port is required")
+			os.Exit(1)
+		}
+		file, err := har.Load(args[0])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if len(file.Log.Entries) == 0 {
+			fmt.Println("No requests in HAR file")
+			return
+		}
+
+		player := har.NewPlayer(harReplayHost, harReplayPort, harReplayTimeout)
+		mismatches := 0
+		for i, entry := range file.Log.Entries {
+			result := player.Play(entry)
+			switch {
+			case result.Err != nil:
+				mismatches++
+				fmt.Printf("✗ %3d %s %s: %v\n", i+1, result.Method, result.Path, result.Err)
+			case !result.Matches():
+				mismatches++
+				fmt.Printf("✗ %3d %s %s: %d, recorded %d (%.1f ms)\n", i+1, result.Method, result.Path,
+					result.Status, result.Expected, float64(result.Duration.Microseconds())/1000)
+			default:
+				fmt.Printf("✓ %3d %s %s: %d (%.1f ms)\n", i+1, result.Method, result.Path,
+					result.Status, float64(result.Duration.Microseconds())/1000)
+			}
+		}
+
+		fmt.Printf("\n%d requests, %d matched, %d mismatched\n", len(file.Log.Entries), len(file.Log.Entries)-mismatches, mismatches)
+		if mismatches > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(harCmd)
+	harCmd.AddCommand(harReplayCmd)
+
+	harReplayCmd.Flags().IntVarP(&harReplayPort, "port", "p", 0, "Local port to send the requests to")
+	harReplayCmd.Flags().StringVar(&harReplayHost, "host", "localhost", "Local host to send the requests to")
+	harReplayCmd.Flags().DurationVar(&harReplayTimeout, "timeout", 30*time.Second, "Timeout per request")
+	harReplayCmd.MarkFlagRequired("port")
+}
@@ -3,15 +3,23 @@ package cmd
 import (
 	"fmt"
 	"log"
+	"net"
 	"net/url"
 	"os"
 	"os/signal"
+	"reflect"
 	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+	"github.com/haxorport/haxorport-go-client/internal/infrastructure/errorpage"
+	"github.com/haxorport/haxorport-go-client/internal/infrastructure/har"
+	"github.com/haxorport/haxorport-go-client/internal/infrastructure/httpauth"
+	"github.com/haxorport/haxorport-go-client/internal/infrastructure/inspector"
+	"github.com/haxorport/haxorport-go-client/internal/infrastructure/mock"
+	"github.com/haxorport/haxorport-go-client/internal/infrastructure/process"
 	"github.com/spf13/cobra"
 )
 
@@ -24,6 +32,69 @@ var (
 	httpPassword  string
 	httpHeader    string
 	httpValue     string
+	httpName      string
+	httpFresh     bool
+	httpAllow     []string
+	httpDeny      []string
+	httpHtpasswd  string
+	httpAPIKeys   []string
+	httpTOTP      bool
+	httpTOTPKey   string
+
+	// JWT auth flags
+	httpJWKSFile       string
+	httpJWTKeyFile     string
+	httpJWTIssuer      string
+	httpJWTAudience    string
+	httpJWTClaims      []string
+	httpJWTClaimHeader []string
+
+	// Inspector flags
+	httpInspect        bool
+	httpInspectAddr    string
+	httpInspectMaxBody int
+
+	// HAR recording flags
+	httpHARFile       string
+	httpHARRedact     []string
+	httpHARMaxEntries int
+
+	// Mock fallback flags
+	httpFallbackMock bool
+	httpMockFile     string
+
+	// Error page flags
+	httpErrorPageHTML   string
+	httpErrorPageJSON   string
+	httpUpstreamTimeout time.Duration
+
+	// Load balancing flags
+	httpUpstreams      []string
+	httpLBStrategy     string
+	httpHealthCheck    string
+	httpHealthInterval time.Duration
+	httpMaxFails       int
+	httpFailTimeout    time.Duration
+
+	// Routing flags
+	httpRoutes      []string
+	httpRoutesStrip []string
+
+	// Rewrite flags
+	httpHostHeader      string
+	httpRewritePaths    []string
+	httpRequestHeaders  []string
+	httpResponseHeaders []string
+	httpRewriteLocation bool
+	httpCookieDomain    string
+	httpRewriteURLs     bool
+	httpRewriteTypes    []string
+
+	// OpenID Connect login flags
+	httpOIDCIssuer         string
+	httpOIDCClientID       string
+	httpOIDCClientSecret   string
+	httpOIDCAllowedDomains []string
 )
 
 // httpCmd is the command to create an HTTP tunnel
@@ -34,7 +105,25 @@ var httpCmd = &cobra.Command{
 Examples:
   haxorport http -p 2712
   haxorport http --port 8080 --subdomain myapp
-  haxorport http --port 3000 --auth basic --username user --password pass`,
+  haxorport http --port 8080 --name webhooks
+  haxorport http --port 8080 --fresh
+  haxorport http --port 3000 --auth basic --username user --password pass
+  haxorport http --port 3000 --auth basic --htpasswd ./users.htpasswd
+  haxorport http --port 3000 --auth header --header X-API-Key --api-key key1 --api-key key2
+  haxorport http --port 3000 --auth form --password pass
+  haxorport http --port 3000 --auth form --totp
+  haxorport http --port 3000 --auth jwt --jwks ./jwks.json --jwt-issuer https://auth.example.com --jwt-audience api
+  haxorport http --port 3000 --auth jwt --jwt-key ./public.pem --jwt-require-claim role=admin --jwt-claim-header sub=X-User-Id
+  haxorport http --port 8080 --allow 10.0.0.0/8 --deny 10.0.5.0/24
+  haxorport http --port 8080 --inspect
+  haxorport http --port 8080 --har traffic.har --har-redact X-Session-Id
+  haxorport http --port 8080 --fallback-mock --mock-file traffic.har
+  haxorport http --port 8080 --error-page-html ./502.html --upstream-timeout 30s
+  haxorport http --upstream 3001 --upstream 3002 --lb-strategy least_connections --health-check /healthz
+  haxorport http --port 3000 --route /api=8080 --route-strip /auth=9000 --route admin.example.com=4000
+  haxorport http --port 8080 --rewrite-urls --rewrite-content-type text/html
+  haxorport http --port 8080 --host-header app.local --rewrite-location --request-header 'X-Real-IP: ${remote_addr}' --response-header -Server
+  haxorport http --port 8080 --oidc-issuer https://accounts.google.com --oidc-client-id ID --oidc-client-secret SECRET --oidc-allowed-domain example.com`,
 	Run: func(cmd *cobra.Command, args []string) {
 		// Check if URL argument is provided
 		if len(args) > 0 {
@@ -68,13 +157,33 @@ Examples:
 
 			// Set local port
 			httpLocalPort = portInt
+		}
 
-			// Generate automatic subdomain if not specified
-			if httpSubdomain == "" {
-				// Use timestamp to create unique subdomain without "haxor-" prefix
-				timestamp := time.Now().UnixNano() / int64(time.Millisecond)
-				httpSubdomain = fmt.Sprintf("%x", timestamp%0xFFFFFF)
-			}
+		// A balanced tunnel registers with the port of its first upstream, and a routed
+		// tunnel without default port with the port of its first route
+		routes, err := routesFromFlags()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		loadBalancing, err := loadBalancingFromFlags(len(routes) > 0)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		rewrite, err := rewriteFromFlags()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		defaultUpstreams := httpUpstreams
+		if len(defaultUpstreams) == 0 && len(routes) > 0 {
+			defaultUpstreams = routes[0].Upstreams
+		}
+		if httpLocalPort <= 0 && len(defaultUpstreams) > 0 {
+			address, _ := model.NormalizeUpstream(defaultUpstreams[0])
+			_, port, _ := net.SplitHostPort(address)
+			httpLocalPort, _ = strconv.Atoi(port)
 		}
 
 		// Validate parameters
@@ -83,6 +192,22 @@ Examples:
 			os.Exit(1)
 		}
 
+		// Request the subdomain used the last time this tunnel ran, unless --fresh is given
+		stateKey := Container.StateService.HTTPKey(httpName, httpLocalPort)
+		usingSavedSubdomain := false
+		if httpSubdomain == "" && !httpFresh {
+			if saved := Container.StateService.Lookup(stateKey, model.TunnelTypeHTTP); saved != nil {
+				httpSubdomain = saved.Subdomain
+				usingSavedSubdomain = true
+				Container.Logger.Info("Requesting saved subdomain %s for %s", httpSubdomain, stateKey)
+			}
+		}
+
+		// Generate automatic subdomain if not specified
+		if httpSubdomain == "" && len(args) > 0 {
+			httpSubdomain = generateSubdomain()
+		}
+
 		// Create auth if needed
 		var auth *model.TunnelAuth
 		if httpAuthType != "" {
@@ -92,24 +217,56 @@ Examples:
 				auth.Type = model.AuthTypeBasic
 				auth.Username = httpUsername
 				auth.Password = httpPassword
-				if auth.Username == "" || auth.Password == "" {
-					fmt.Println("Error: Username and password are required for basic auth")
+				auth.HtpasswdFile = httpHtpasswd
+				if auth.HtpasswdFile == "" && (auth.Username == "" || auth.Password == "") {
+					fmt.Println("Error: Username and password or an htpasswd file are required for basic auth")
 					os.Exit(1)
 				}
 			case "header":
 				auth.Type = model.AuthTypeHeader
 				auth.HeaderName = httpHeader
 				auth.HeaderValue = httpValue
-				if auth.HeaderName == "" || auth.HeaderValue == "" {
-					fmt.Println("Error: Header name and value are required for header auth")
+				auth.HeaderValues = httpAPIKeys
+				if auth.HeaderName == "" || (auth.HeaderValue == "" && len(auth.HeaderValues) == 0) {
+					fmt.Println("Error: Header name and at least one value are required for header auth")
+					os.Exit(1)
+				}
+			case "form":
+				form, err := formAuthFromFlags()
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
 					os.Exit(1)
 				}
+				auth = form
+			case "jwt":
+				jwt, err := jwtAuthFromFlags()
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(1)
+				}
+				auth = jwt
 			default:
 				fmt.Printf("Error: Invalid auth type: %s\n", httpAuthType)
 				os.Exit(1)
 			}
 		}
 
+		// Put an OpenID Connect login in front of the tunnel if requested
+		oidc, err := oidcFromFlags()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if oidc != nil && auth != nil && auth.Type == model.AuthTypeForm {
+			fmt.Println("Error: OpenID Connect cannot be combined with form auth")
+			os.Exit(1)
+		}
+		errorPages, err := errorPagesFromFlags()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
 		// Check token configuration first
 		if Container.Config.AuthEnabled {
 			if Container.Config.AuthToken == "" {
@@ -214,6 +371,60 @@ Examples:
 		// Log connection information
 		Container.Logger.Info("Active connection mode: WebSocket to %s", Container.Config.ServerAddress)
 
+		// Show proxied requests in the local inspector if requested
+		var requestInspector *inspector.Inspector
+		if httpInspect && Container.Client != nil {
+			requestInspector = inspector.NewInspector(inspector.DefaultCapacity, httpInspectMaxBody, Container.Logger)
+			if err := requestInspector.Start(httpInspectAddr); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			defer requestInspector.Close()
+			Container.Client.AddHTTPObserver(requestInspector)
+			requestInspector.SetReplayer(Container.Client)
+		}
+
+		// Record proxied requests to a HAR file if requested
+		var harRecorder *har.Recorder
+		if httpHARFile != "" && Container.Client != nil {
+			redacted := httpHARRedact
+			if auth != nil && auth.Type == model.AuthTypeHeader {
+				// The header of header auth carries the secret
+				redacted = append(append([]string{}, redacted...), auth.HeaderName)
+			}
+			recorder, err := har.NewRecorder(httpHARFile, redacted, httpHARMaxEntries, Version, Container.Logger)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			harRecorder = recorder
+			defer func() {
+				if err := harRecorder.Close(); err != nil {
+					fmt.Printf("Error: %v\n", err)
+				}
+			}()
+			Container.Client.AddHTTPObserver(harRecorder)
+		}
+
+		// Serve recorded responses when the local service is down if requested
+		var mockStore *mock.Store
+		if httpMockFile != "" && !httpFallbackMock {
+			fmt.Println("Error: --mock-file requires --fallback-mock")
+			os.Exit(1)
+		}
+		if httpFallbackMock && Container.Client != nil {
+			mockStore = mock.NewStore(mock.DefaultCapacity)
+			if httpMockFile != "" {
+				count, err := mockStore.LoadHAR(httpMockFile)
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(1)
+				}
+				Container.Logger.Info("Loaded %d recorded responses from %s", count, httpMockFile)
+			}
+			Container.Client.SetHTTPFallback(mockStore)
+		}
+
 		// Run client with automatic reconnection
 		if Container.Client != nil {
 			Container.Client.RunWithReconnect()
@@ -223,12 +434,73 @@ Examples:
 		}
 
 		// Create tunnel
-		tunnel, err := Container.TunnelService.CreateHTTPTunnel(httpLocalPort, httpSubdomain, auth)
+		tunnelConfig := model.TunnelConfig{
+			Name:            httpName,
+			LocalPort:       httpLocalPort,
+			Subdomain:       httpSubdomain,
+			Auth:            auth,
+			AllowCIDRs:      httpAllow,
+			DenyCIDRs:       httpDeny,
+			OIDC:            oidc,
+			ErrorPages:      errorPages,
+			UpstreamTimeout: httpUpstreamTimeout,
+			Upstreams:       httpUpstreams,
+			LoadBalancing:   loadBalancing,
+			Routes:          routes,
+			Rewrite:         rewrite,
+		}
+		tunnel, err := Container.TunnelService.CreateHTTPTunnel(tunnelConfig)
+		if err != nil && usingSavedSubdomain {
+			// The saved subdomain may have been taken in the meantime, fall back to a new one
+			fmt.Printf("Warning: Saved subdomain %s is not available (%v), using a new subdomain\n", httpSubdomain, err)
+			httpSubdomain = ""
+			if len(args) > 0 {
+				httpSubdomain = generateSubdomain()
+			}
+			tunnelConfig.Subdomain = httpSubdomain
+			tunnel, err = Container.TunnelService.CreateHTTPTunnel(tunnelConfig)
+		}
 		if err != nil {
 			fmt.Printf("Error: Failed to create tunnel: %v\n", err)
 			os.Exit(1)
 		}
 
+		// Remember the subdomain so the next start gets the same URL
+		Container.StateService.Remember(stateKey, tunnel)
+
+		// Let `haxorport pause`, `haxorport resume` and `haxorport status` find this process
+		registration, err := process.Register(process.Instance{
+			Name:      httpName,
+			Subdomain: tunnel.Config.Subdomain,
+			URL:       tunnel.URL,
+			LocalPort: tunnel.Config.LocalPort,
+			Started:   time.Now(),
+			Upstreams: Container.Client.HTTPUpstreamStatus(tunnel.ID),
+		})
+		if err != nil {
+			Container.Logger.Warn("Failed to register the tunnel for pause, resume and status: %v", err)
+		} else {
+			defer registration.Remove()
+			if len(httpUpstreams) > 0 || len(routes) > 0 {
+				stopPublishing := publishUpstreamStatus(registration, tunnel.ID)
+				defer stopPublishing()
+			}
+		}
+		stopWatching := process.WatchMaintenance(func(on bool) {
+			Container.Client.SetMaintenance(on)
+			if on {
+				Container.Logger.Info("Maintenance mode on, visitors get the maintenance page")
+			} else {
+				Container.Logger.Info("Maintenance mode off, forwarding requests again")
+			}
+			if registration != nil {
+				registration.Update(func(instance *process.Instance) {
+					instance.Maintenance = on
+				})
+			}
+		})
+		defer stopWatching()
+
 		// Write to log file for debugging
 		if os.Getenv("LOG_LEVEL") == "debug" {
 			logFile, err := os.OpenFile("output.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
@@ -255,6 +527,49 @@ Examples:
 		// Display additional information
 		if auth != nil {
 			fmt.Fprintf(os.Stderr, "🔒 Authentication: %s\n", auth.Type)
+			if auth.Type == model.AuthTypeForm {
+				fmt.Fprintf(os.Stderr, "   Login: %s%s (logout: %s)\n", strings.TrimRight(tunnel.URL, "/"), httpauth.LoginPath, httpauth.LogoutPath)
+			}
+			if auth.TOTPSecret != "" {
+				printTOTPSecret(auth.TOTPSecret, tunnel.URL)
+			}
+		}
+		if oidc != nil {
+			fmt.Fprintf(os.Stderr, "🪪 OpenID Connect: %s\n", oidc.Issuer)
+			fmt.Fprintf(os.Stderr, "   Redirect URI: %s%s\n", strings.TrimRight(tunnel.URL, "/"), httpauth.OIDCCallbackPath)
+			if len(oidc.AllowedDomains) > 0 {
+				fmt.Fprintf(os.Stderr, "   Allowed domains: %s\n", strings.Join(oidc.AllowedDomains, ", "))
+			}
+		}
+		if requestInspector != nil {
+			fmt.Fprintf(os.Stderr, "🔍 Inspector: http://%s\n", httpInspectAddr)
+		}
+		if harRecorder != nil {
+			fmt.Fprintf(os.Stderr, "📼 Recording HAR: %s\n", httpHARFile)
+		}
+		if upstreams := Container.Client.HTTPUpstreamStatus(tunnel.ID); len(upstreams) > 0 {
+			strategy := model.LoadBalancingRoundRobin
+			if loadBalancing != nil {
+				strategy = loadBalancing.Strategy
+			}
+			fmt.Fprintf(os.Stderr, "⚖️ Upstreams (%s):\n", strategy)
+			for _, upstream := range upstreams {
+				if upstream.Route != "" {
+					fmt.Fprintf(os.Stderr, "   %s → %s\n", upstream.Route, upstream.Address)
+				} else {
+					fmt.Fprintf(os.Stderr, "   %s\n", upstream.Address)
+				}
+			}
+			fmt.Fprintf(os.Stderr, "   Health: haxorport status\n")
+		}
+		if mockStore != nil {
+			fmt.Fprintf(os.Stderr, "🎭 Fallback mock: on (%d recorded responses)\n", mockStore.Len())
+		}
+		if len(httpAllow) > 0 {
+			fmt.Fprintf(os.Stderr, "✅ Allowed: %s\n", strings.Join(httpAllow, ", "))
+		}
+		if len(httpDeny) > 0 {
+			fmt.Fprintf(os.Stderr, "⛔ Denied: %s\n", strings.Join(httpDeny, ", "))
 		}
 
 		// Add instructions for accessing the URL
@@ -286,17 +601,297 @@ Examples:
 	},
 }
 
+// formAuthFromFlags returns the form auth settings given on the command line. A TOTP
+// secret is generated if --totp is given without --totp-secret.
+func formAuthFromFlags() (*model.TunnelAuth, error) {
+	auth := &model.TunnelAuth{
+		Type:       model.AuthTypeForm,
+		Username:   httpUsername,
+		Password:   httpPassword,
+		TOTPSecret: httpTOTPKey,
+	}
+	if httpTOTP && auth.TOTPSecret == "" {
+		secret, err := httpauth.GenerateTOTPSecret()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate TOTP secret: %v", err)
+		}
+		auth.TOTPSecret = secret
+	}
+	if auth.Password == "" && auth.TOTPSecret == "" {
+		return nil, fmt.Errorf("a password or --totp is required for form auth")
+	}
+	return auth, nil
+}
+
+// jwtAuthFromFlags returns the JWT auth settings given on the command line, after
+// checking that the keys can be loaded
+func jwtAuthFromFlags() (*model.TunnelAuth, error) {
+	auth := &model.TunnelAuth{
+		Type:           model.AuthTypeJWT,
+		JWKSFile:       httpJWKSFile,
+		PublicKeyFile:  httpJWTKeyFile,
+		Issuer:         httpJWTIssuer,
+		Audience:       httpJWTAudience,
+		RequiredClaims: httpJWTClaims,
+		ClaimHeaders:   httpJWTClaimHeader,
+	}
+	if _, err := httpauth.NewVerifier(auth); err != nil {
+		return nil, err
+	}
+	return auth, nil
+}
+
+// printTOTPSecret prints a TOTP secret and its QR code for authenticator apps
+func printTOTPSecret(secret, tunnelURL string) {
+	account := tunnelURL
+	if u, err := url.Parse(tunnelURL); err == nil && u.Host != "" {
+		account = u.Host
+	}
+	uri := httpauth.TOTPURI(secret, account)
+	fmt.Fprintf(os.Stderr, "🔑 TOTP Secret: %s\n", secret)
+	if httpTOTPKey == "" {
+		fmt.Fprintf(os.Stderr, "   Pass --totp-secret %s to keep this secret on the next start\n", secret)
+	}
+	fmt.Fprintf(os.Stderr, "   Scan with your authenticator app or use %s\n", uri)
+	if err := printQRCode(os.Stderr, uri); err != nil {
+		fmt.Fprintf(os.Stderr, "   (failed to render QR code: %v)\n", err)
+	}
+}
+
+// oidcFromFlags returns the OpenID Connect settings given on the command line, or nil
+func oidcFromFlags() (*model.TunnelOIDC, error) {
+	if httpOIDCIssuer == "" && httpOIDCClientID == "" {
+		if httpOIDCClientSecret != "" || len(httpOIDCAllowedDomains) > 0 {
+			return nil, fmt.Errorf("--oidc-issuer and --oidc-client-id are required for OpenID Connect")
+		}
+		return nil, nil
+	}
+	if httpOIDCIssuer == "" || httpOIDCClientID == "" {
+		return nil, fmt.Errorf("--oidc-issuer and --oidc-client-id are required for OpenID Connect")
+	}
+	return &model.TunnelOIDC{
+		Issuer:         httpOIDCIssuer,
+		ClientID:       httpOIDCClientID,
+		ClientSecret:   httpOIDCClientSecret,
+		AllowedDomains: httpOIDCAllowedDomains,
+	}, nil
+}
+
+// errorPagesFromFlags returns the error page templates given on the command line, or nil.
+// The templates are checked now, so that mistakes are reported before connecting.
+func errorPagesFromFlags() (*model.TunnelErrorPages, error) {
+	if httpErrorPageHTML == "" && httpErrorPageJSON == "" {
+		return nil, nil
+	}
+	pages := &model.TunnelErrorPages{
+		HTMLFile: httpErrorPageHTML,
+		JSONFile: httpErrorPageJSON,
+	}
+	if _, err := errorpage.Load(pages); err != nil {
+		return nil, err
+	}
+	return pages, nil
+}
+
+// publishUpstreamStatus copies the upstream status of a balanced tunnel to its run file
+// for `haxorport status` until the returned function is called
+func publishUpstreamStatus(registration *process.Registration, tunnelID string) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(2 * time.Second)
+		defer ticker.Stop()
+		var published []model.UpstreamStatus
+		for {
+			select {
+			case <-ticker.C:
+				status := Container.Client.HTTPUpstreamStatus(tunnelID)
+				if reflect.DeepEqual(status, published) {
+					continue
+				}
+				if err := registration.Update(func(instance *process.Instance) {
+					instance.Upstreams = status
+				}); err == nil {
+					published = status
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// loadBalancingFromFlags checks the upstreams given on the command line and returns
+// their load balancing settings, or nil if neither upstreams nor routes are given
+func loadBalancingFromFlags(routed bool) (*model.TunnelLoadBalancing, error) {
+	if len(httpUpstreams) == 0 && !routed {
+		if httpLBStrategy != "" || httpHealthCheck != "" {
+			return nil, fmt.Errorf("--lb-strategy and --health-check require --upstream or --route")
+		}
+		return nil, nil
+	}
+	for _, upstream := range httpUpstreams {
+		if _, err := model.NormalizeUpstream(upstream); err != nil {
+			return nil, err
+		}
+	}
+	strategy, err := model.ParseLoadBalancingStrategy(httpLBStrategy)
+	if err != nil {
+		return nil, err
+	}
+	loadBalancing := &model.TunnelLoadBalancing{
+		Strategy:    strategy,
+		MaxFails:    httpMaxFails,
+		FailTimeout: httpFailTimeout,
+	}
+	if httpHealthCheck != "" {
+		if !strings.HasPrefix(httpHealthCheck, "/") {
+			return nil, fmt.Errorf("the health check path must start with /")
+		}
+		loadBalancing.HealthCheck = &model.TunnelHealthCheck{
+			Path:     httpHealthCheck,
+			Interval: httpHealthInterval,
+		}
+	}
+	return loadBalancing, nil
+}
+
+// routesFromFlags parses the routes given on the command line
+func routesFromFlags() ([]model.TunnelRoute, error) {
+	var routes []model.TunnelRoute
+	for _, value := range httpRoutes {
+		route, err := model.ParseRoute(value, false)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, route)
+	}
+	for _, value := range httpRoutesStrip {
+		route, err := model.ParseRoute(value, true)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+// rewriteFromFlags returns the rewrite rules given on the command line, or nil if none
+// are given. Headers are given as "Name: value" to set them or "-Name" to remove them.
+func rewriteFromFlags() (*model.TunnelRewrite, error) {
+	rewrite := &model.TunnelRewrite{
+		Host:             httpHostHeader,
+		Location:         httpRewriteLocation,
+		CookieDomain:     httpCookieDomain,
+		BodyURLs:         httpRewriteURLs,
+		BodyContentTypes: httpRewriteTypes,
+	}
+	for _, value := range httpRewritePaths {
+		path, err := model.ParsePathRewrite(value)
+		if err != nil {
+			return nil, err
+		}
+		rewrite.Paths = append(rewrite.Paths, path)
+	}
+	var err error
+	if rewrite.RequestHeaders, err = headerRewriteFromFlags(httpRequestHeaders); err != nil {
+		return nil, err
+	}
+	if rewrite.ResponseHeaders, err = headerRewriteFromFlags(httpResponseHeaders); err != nil {
+		return nil, err
+	}
+	if reflect.DeepEqual(*rewrite, model.TunnelRewrite{}) {
+		return nil, nil
+	}
+	if err := rewrite.Validate(); err != nil {
+		return nil, err
+	}
+	return rewrite, nil
+}
+
+// headerRewriteFromFlags parses header flags given as "Name: value" or "-Name"
+func headerRewriteFromFlags(values []string) (*model.TunnelHeaderRewrite, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	rewrite := &model.TunnelHeaderRewrite{Set: make(map[string]string)}
+	for _, value := range values {
+		if strings.HasPrefix(value, "-") {
+			rewrite.Remove = append(rewrite.Remove, strings.TrimSpace(value[1:]))
+			continue
+		}
+		name, headerValue, ok := strings.Cut(value, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid header %q, use \"Name: value\" or -Name", value)
+		}
+		rewrite.Set[strings.TrimSpace(name)] = strings.TrimSpace(headerValue)
+	}
+	return rewrite, nil
+}
+
+// generateSubdomain generates an automatic subdomain from the current time
+func generateSubdomain() string {
+	// Use timestamp to create unique subdomain without "haxor-" prefix
+	timestamp := time.Now().UnixNano() / int64(time.Millisecond)
+	return fmt.Sprintf("%x", timestamp%0xFFFFFF)
+}
+
 func init() {
 	RootCmd.AddCommand(httpCmd)
 
 	// Add flags
 	httpCmd.Flags().IntVarP(&httpLocalPort, "port", "p", 0, "Local port to tunnel")
 	httpCmd.Flags().StringVarP(&httpSubdomain, "subdomain", "s", "", "Requested subdomain (optional)")
-	httpCmd.Flags().StringVarP(&httpAuthType, "auth", "a", "", "Authentication type (basic, header)")
+	httpCmd.Flags().StringVarP(&httpAuthType, "auth", "a", "", "Authentication type (basic, header, form, jwt)")
 	httpCmd.Flags().StringVarP(&httpUsername, "username", "u", "", "Username for basic authentication")
-	httpCmd.Flags().StringVarP(&httpPassword, "password", "w", "", "Password for basic authentication")
+	httpCmd.Flags().StringVarP(&httpPassword, "password", "w", "", "Password for basic or form authentication")
 	httpCmd.Flags().StringVar(&httpHeader, "header", "", "Header name for header authentication")
 	httpCmd.Flags().StringVar(&httpValue, "value", "", "Header value for header authentication")
+	httpCmd.Flags().StringVar(&httpHtpasswd, "htpasswd", "", "htpasswd file (bcrypt or SHA) with the users accepted by basic authentication")
+	httpCmd.Flags().StringSliceVar(&httpAPIKeys, "api-key", nil, "Accepted header value or API key for header authentication (repeatable)")
+	httpCmd.Flags().BoolVar(&httpTOTP, "totp", false, "Accept TOTP codes for form authentication; a secret is generated and printed if --totp-secret is not given")
+	httpCmd.Flags().StringVar(&httpTOTPKey, "totp-secret", "", "Base32 TOTP secret for form authentication")
+	httpCmd.Flags().StringVar(&httpJWKSFile, "jwks", "", "JWKS file with the keys accepted by JWT authentication")
+	httpCmd.Flags().StringVar(&httpJWTKeyFile, "jwt-key", "", "PEM public key or certificate accepted by JWT authentication")
+	httpCmd.Flags().StringVar(&httpJWTIssuer, "jwt-issuer", "", "Required iss claim for JWT authentication")
+	httpCmd.Flags().StringVar(&httpJWTAudience, "jwt-audience", "", "Required aud claim for JWT authentication")
+	httpCmd.Flags().StringSliceVar(&httpJWTClaims, "jwt-require-claim", nil, "Claim tokens must contain, as name or name=value (repeatable)")
+	httpCmd.Flags().StringSliceVar(&httpJWTClaimHeader, "jwt-claim-header", nil, "Pass a claim to the local service as a header, as claim=Header-Name (repeatable)")
+	httpCmd.Flags().StringVarP(&httpName, "name", "n", "", "Tunnel name used to remember its subdomain between runs (optional)")
+	httpCmd.Flags().BoolVar(&httpFresh, "fresh", false, "Ignore the saved subdomain and request a new one")
+	httpCmd.Flags().StringSliceVar(&httpAllow, "allow", nil, "Only allow visitors from these CIDRs or IPs (repeatable or comma-separated)")
+	httpCmd.Flags().StringSliceVar(&httpDeny, "deny", nil, "Reject visitors from these CIDRs or IPs (repeatable or comma-separated)")
+	httpCmd.Flags().StringVar(&httpOIDCIssuer, "oidc-issuer", "", "OpenID Connect issuer URL; visitors must log in there")
+	httpCmd.Flags().StringVar(&httpOIDCClientID, "oidc-client-id", "", "OpenID Connect client ID")
+	httpCmd.Flags().StringVar(&httpOIDCClientSecret, "oidc-client-secret", "", "OpenID Connect client secret (if required by the provider)")
+	httpCmd.Flags().BoolVar(&httpInspect, "inspect", false, "Show proxied requests in a local web UI")
+	httpCmd.Flags().StringVar(&httpInspectAddr, "inspect-addr", inspector.DefaultAddress, "Address of the request inspector web UI")
+	httpCmd.Flags().IntVar(&httpInspectMaxBody, "inspect-max-body", inspector.DefaultMaxBodySize, "Body bytes kept per request and response by the inspector")
+	httpCmd.Flags().StringVar(&httpHARFile, "har", "", "Record proxied requests to a HAR file")
+	httpCmd.Flags().StringArrayVar(&httpHARRedact, "har-redact", nil, "Also redact this header in the HAR file (repeatable)")
+	httpCmd.Flags().IntVar(&httpHARMaxEntries, "har-max-entries", har.DefaultMaxEntries, "Keep only the latest entries in the HAR file")
+	httpCmd.Flags().BoolVar(&httpFallbackMock, "fallback-mock", false, "Serve recorded responses when the local service cannot be reached")
+	httpCmd.Flags().StringVar(&httpMockFile, "mock-file", "", "Load recorded responses for --fallback-mock from a HAR file")
+	httpCmd.Flags().StringVar(&httpErrorPageHTML, "error-page-html", "", "html/template file for the error and maintenance pages shown to browsers")
+	httpCmd.Flags().StringVar(&httpErrorPageJSON, "error-page-json", "", "text/template file for the JSON errors returned to other clients")
+	httpCmd.Flags().DurationVar(&httpUpstreamTimeout, "upstream-timeout", 0, "Answer with 504 if the local service takes longer (0 for no limit)")
+	httpCmd.Flags().StringArrayVar(&httpUpstreams, "upstream", nil, "Balance requests over this local service, as port or host:port (repeatable)")
+	httpCmd.Flags().StringVar(&httpLBStrategy, "lb-strategy", "", "Load balancing strategy: round_robin, least_connections, sticky_cookie or ip_hash")
+	httpCmd.Flags().StringVar(&httpHealthCheck, "health-check", "", "Path requested to check the health of the upstreams")
+	httpCmd.Flags().DurationVar(&httpHealthInterval, "health-interval", 0, "Time between health checks (default 10s)")
+	httpCmd.Flags().IntVar(&httpMaxFails, "max-fails", 0, "Connection errors in a row that take an upstream out (default 3)")
+	httpCmd.Flags().DurationVar(&httpFailTimeout, "fail-timeout", 0, "How long an upstream stays out after connection errors (default 30s)")
+	httpCmd.Flags().StringArrayVar(&httpRoutes, "route", nil, "Send requests matching a path prefix or host to other upstreams, as PATTERN=UPSTREAM[,UPSTREAM] (repeatable)")
+	httpCmd.Flags().StringArrayVar(&httpRoutesStrip, "route-strip", nil, "Like --route, but remove the path prefix before forwarding (repeatable)")
+	httpCmd.Flags().StringVar(&httpHostHeader, "host-header", "", "Host header sent to the local service, e.g. app.local or ${public_host}")
+	httpCmd.Flags().StringArrayVar(&httpRewritePaths, "rewrite-path", nil, "Rewrite request paths, as REGEX=REPLACEMENT (repeatable)")
+	httpCmd.Flags().StringArrayVar(&httpRequestHeaders, "request-header", nil, "Set a request header, as \"Name: value\", or remove it, as -Name (repeatable)")
+	httpCmd.Flags().StringArrayVar(&httpResponseHeaders, "response-header", nil, "Set a response header, as \"Name: value\", or remove it, as -Name (repeatable)")
+	httpCmd.Flags().BoolVar(&httpRewriteLocation, "rewrite-location", false, "Point redirects to the local service at the public URL")
+	httpCmd.Flags().StringVar(&httpCookieDomain, "cookie-domain", "", "Replace the Domain of cookies set by the local service, e.g. ${public_host}")
+	httpCmd.Flags().BoolVar(&httpRewriteURLs, "rewrite-urls", false, "Point URLs to the local service in HTML, CSS, JavaScript and JSON responses at the public URL")
+	httpCmd.Flags().StringArrayVar(&httpRewriteTypes, "rewrite-content-type", nil, "Only rewrite URLs in responses of this content type, e.g. text/html or text/* (repeatable)")
+	httpCmd.Flags().StringSliceVar(&httpOIDCAllowedDomains, "oidc-allowed-domain", nil, "Only allow verified email addresses of these domains (repeatable)")
 
 	// Port is only required if URL is not provided
 	// httpCmd.MarkFlagRequired("port")
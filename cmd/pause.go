@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/haxorport/haxorport-go-client/internal/infrastructure/process"
+	"github.com/spf13/cobra"
+)
+
+// pauseCmd is the command to put running HTTP tunnels into maintenance mode
+var pauseCmd = &cobra.Command{
+	Use:   "pause [name|subdomain|url|pid]",
+	Short: "Put running HTTP tunnels into maintenance mode",
+	Long: `Put a running HTTP tunnel into maintenance mode. The tunnel stays registered and
+keeps its URL, but visitors get a 503 maintenance page instead of the local service
+until the tunnel is resumed. Without an argument, all running HTTP tunnels are paused.
+The running process can also be paused with SIGUSR1 and resumed with SIGUSR2.
+Examples:
+  haxorport pause
+  haxorport pause myapp`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		signalInstances(args, "Paused", process.Pause)
+	},
+}
+
+// resumeCmd is the command to end the maintenance mode of running HTTP tunnels
+var resumeCmd = &cobra.Command{
+	Use:   "resume [name|subdomain|url|pid]",
+	Short: "End the maintenance mode of running HTTP tunnels",
+	Long: `Forward requests of a paused HTTP tunnel to the local service again.
+Without an argument, all running HTTP tunnels are resumed.
+Examples:
+  haxorport resume
+  haxorport resume myapp`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		signalInstances(args, "Resumed", process.Resume)
+	},
+}
+
+// signalInstances applies action to the running tunnels selected by args, or to all
+func signalInstances(args []string, done string, action func(instance process.Instance) error) {
+	instances, err := process.Instances()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	found := false
+	failed := false
+	for _, instance := range instances {
+		if len(args) > 0 && !instance.Matches(args[0]) {
+			continue
+		}
+		found = true
+		if err := action(instance); err != nil {
+			fmt.Printf("Error: %s (pid %d): %v\n", instance.URL, instance.PID, err)
+			failed = true
+			continue
+		}
+		fmt.Printf("%s %s (pid %d)\n", done, instance.URL, instance.PID)
+	}
+
+	if !found {
+		if len(args) > 0 {
+			fmt.Printf("Error: No running HTTP tunnel matches %s\n", args[0])
+		} else {
+			fmt.Println("Error: No running HTTP tunnels")
+		}
+		os.Exit(1)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(pauseCmd)
+	RootCmd.AddCommand(resumeCmd)
+}
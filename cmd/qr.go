@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"rsc.io/qr"
+)
+
+// printQRCode prints text as a QR code using half block characters, two modules per
+// line, so that it can be scanned from the terminal
+func printQRCode(w io.Writer, text string) error {
+	code, err := qr.Encode(text, qr.M)
+	if err != nil {
+		return err
+	}
+
+	// Keep a quiet zone around the code, scanners need it
+	const quiet = 2
+	black := func(x, y int) bool {
+		return code.Black(x-quiet, y-quiet)
+	}
+	size := code.Size + 2*quiet
+	for y := 0; y < size; y += 2 {
+		var line strings.Builder
+		for x := 0; x < size; x++ {
+			// Light text on a dark terminal: print the light modules
+			top, bottom := !black(x, y), !black(x, y+1) && y+1 < size
+			switch {
+			case top && bottom:
+				line.WriteString("█")
+			case top:
+				line.WriteString("▀")
+			case bottom:
+				line.WriteString("▄")
+			default:
+				line.WriteString(" ")
+			}
+		}
+		fmt.Fprintln(w, line.String())
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/haxorport/haxorport-go-client/internal/infrastructure/inspector"
+	"github.com/spf13/cobra"
+)
+
+var (
+	replayHeaders       []string
+	replayRemoveHeaders []string
+	replayBody          string
+	replayBodyFile      string
+	replayPort          int
+	replayInspectAddr   string
+)
+
+// replayCmd is the command to replay a captured request against the local service
+var replayCmd = &cobra.Command{
+	Use:   "replay <id>",
+	Short: "Replay a captured HTTP request",
+	Long: `Send a request captured by the inspector of a running HTTP tunnel to the local service again.
+The tunnel must run with --inspect; the ID is shown in the inspector web UI.
+The request goes through the same forwarding code as live traffic and is marked as
+a replay in the logs and in the inspector.
+Examples:
+  haxorport replay 42
+  haxorport replay 42 --header "X-Debug: 1" --remove-header Authorization
+  haxorport replay 42 --body-file fixed-payload.json --port 3001`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		id, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil || id <= 0 {
+			fmt.Printf("Error: Invalid exchange ID: %s\n", args[0])
+			os.Exit(1)
+		}
+
+		options := inspector.ReplayOptions{
+			RemoveHeaders: replayRemoveHeaders,
+			Port:          replayPort,
+		}
+		if len(replayHeaders) > 0 {
+			options.Headers = make(map[string]string)
+			for _, header := range replayHeaders {
+				name, value, ok := strings.Cut(header, ":")
+				if !ok || strings.TrimSpace(name) == "" {
+					fmt.Printf("Error: Invalid header %q, use \"Name: value\"\n", header)
+					os.Exit(1)
+				}
+				options.Headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+			}
+		}
+		switch {
+		case replayBodyFile != "":
+			body, err := os.ReadFile(replayBodyFile)
+			if err != nil {
+				fmt.Printf("Error: Failed to read body file: %v\n", err)
+				os.Exit(1)
+			}
+			options.Body = body
+			options.ReplaceBody = true
+		case cmd.Flags().Changed("body"):
+			options.Body = []byte(replayBody)
+			options.ReplaceBody = true
+		}
+
+		summary, err := inspector.RequestReplay(replayInspectAddr, id, options)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if summary.Error != "" {
+			fmt.Printf("Replay #%d of %s %s failed after %.1f ms: %s\n", summary.ID, summary.Method, summary.URL, summary.DurationMs, summary.Error)
+			os.Exit(1)
+		}
+		fmt.Printf("Replay #%d of %s %s: %d in %.1f ms\n", summary.ID, summary.Method, summary.URL, summary.Status, summary.DurationMs)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(replayCmd)
+
+	replayCmd.Flags().StringArrayVarP(&replayHeaders, "header", "H", nil, "Set a request header, as \"Name: value\" (repeatable)")
+	replayCmd.Flags().StringArrayVar(&replayRemoveHeaders, "remove-header", nil, "Remove a request header (repeatable)")
+	replayCmd.Flags().StringVar(&replayBody, "body", "", "Replace the request body")
+	replayCmd.Flags().StringVar(&replayBodyFile, "body-file", "", "Replace the request body with the content of a file")
+	replayCmd.Flags().IntVarP(&replayPort, "port", "p", 0, "Send the request to another local port, bypassing the routes and upstreams of the tunnel")
+	replayCmd.Flags().StringVar(&replayInspectAddr, "inspect-addr", inspector.DefaultAddress, "Address of the inspector of the running tunnel")
+}
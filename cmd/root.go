@@ -47,8 +47,8 @@ With Haxorport, you can expose local services to the internet.`,
 			
 			// Select configuration file automatically if not explicitly specified
 			if ConfigPath == "" && AutoConfigPath {
-				if CommandType == "tcp" {
-					// Use config_tcp.yaml for TCP command
+				if CommandType == "tcp" || CommandType == "connect" {
+					// Use config_tcp.yaml for TCP and connect commands
 					homeDir, err := os.UserHomeDir()
 					if err == nil {
 						ConfigPath = homeDir + "/.haxorport/config_tcp.yaml"
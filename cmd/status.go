@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/haxorport/haxorport-go-client/internal/infrastructure/process"
+	"github.com/spf13/cobra"
+)
+
+// statusCmd is the command to show the running HTTP tunnels
+var statusCmd = &cobra.Command{
+	Use:   "status [name|subdomain|url|pid]",
+	Short: "Show the running HTTP tunnels",
+	Long: `Show the HTTP tunnels running on this machine, whether they are paused, and the
+health of the upstreams of balanced tunnels.
+Examples:
+  haxorport status
+  haxorport status myapp`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		instances, err := process.Instances()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		shown := 0
+		for _, instance := range instances {
+			if len(args) > 0 && !instance.Matches(args[0]) {
+				continue
+			}
+			if shown > 0 {
+				fmt.Println()
+			}
+			shown++
+
+			state := "running"
+			if instance.Maintenance {
+				state = "paused (maintenance)"
+			}
+			fmt.Printf("🌐 %s\n", instance.URL)
+			if instance.Name != "" {
+				fmt.Printf("   Name: %s\n", instance.Name)
+			}
+			fmt.Printf("   State: %s\n", state)
+			fmt.Printf("   PID: %d, up %s\n", instance.PID, time.Since(instance.Started).Round(time.Second))
+			if len(instance.Upstreams) == 0 {
+				fmt.Printf("   Local Port: %d\n", instance.LocalPort)
+				continue
+			}
+			if instance.Upstreams[0].Route != "" {
+				// Requests matching no route go to the local port
+				fmt.Printf("   Local Port: %d\n", instance.LocalPort)
+			}
+			fmt.Println("   Upstreams:")
+			route := ""
+			for _, upstream := range instance.Upstreams {
+				if upstream.Route != route {
+					route = upstream.Route
+					fmt.Printf("   Route %s:\n", route)
+				}
+				health := "✅ healthy"
+				if !upstream.Healthy {
+					health = "❌ unhealthy"
+				}
+				fmt.Printf("     %-21s %s  active %d, requests %d, errors %d\n",
+					upstream.Address, health, upstream.Active, upstream.Requests, upstream.Failures)
+				if !upstream.Healthy && upstream.LastError != "" {
+					fmt.Printf("     %-21s last error: %s\n", "", upstream.LastError)
+				}
+			}
+		}
+
+		if shown == 0 {
+			if len(args) > 0 {
+				fmt.Printf("No running HTTP tunnel matches %s\n", args[0])
+			} else {
+				fmt.Println("No running HTTP tunnels")
+			}
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(statusCmd)
+}
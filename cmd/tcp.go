@@ -1,24 +1,41 @@
 package cmd
 
 import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"log"
 	"net"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
 	"syscall"
 
 	"github.com/haxorport/haxorport-go-client/internal/domain/model"
 	"github.com/haxorport/haxorport-go-client/internal/domain/port"
 	"github.com/haxorport/haxorport-go-client/internal/domain/service"
+	"github.com/haxorport/haxorport-go-client/internal/infrastructure/transport"
 	"github.com/spf13/cobra"
 )
 
 var (
-	tcpLocalPort  int
-	tcpRemotePort int
-	tcpLocalAddr  string
+	tcpLocalPort   int
+	tcpRemotePort  int
+	tcpLocalAddr   string
+	tcpName        string
+	tcpFresh       bool
+	tcpLocalListen string
+	tcpP2P         bool
+	tcpPrivate     bool
+	tcpSecret      string
+	// tcpSecretFile is the file the secret was loaded from or saved to
+	tcpSecretFile   string
+	tcpRotateSecret bool
+	tcpProxyProto   string
+	tcpAllow        []string
+	tcpDeny         []string
 )
 
 var tcpCmd = &cobra.Command{
@@ -28,12 +45,57 @@ var tcpCmd = &cobra.Command{
 Examples:
   haxorport tcp -p 22
   haxorport tcp --port 22 --remote-port 2222
-  haxorport tcp --port 5432`,
+  haxorport tcp --port 5432
+  haxorport tcp --port 22 --name ssh --fresh
+  haxorport tcp --port 22 --local-listen 127.0.0.1:2222
+  haxorport tcp --port 5432 --name db --private --secret <shared-secret>
+  haxorport tcp --port 5432 --name db --private --rotate-secret
+  haxorport tcp --port 443 --proxy-protocol v2
+  haxorport tcp --port 22 --allow 203.0.113.0/24`,
 	Run: func(cmd *cobra.Command, args []string) {
 		if tcpLocalPort <= 0 {
 			fmt.Println("Error: Local port must be greater than 0")
 			os.Exit(1)
 		}
+
+		// Private tunnels are reached by name, so a name is required
+		if tcpPrivate {
+			if tcpName == "" {
+				fmt.Println("Error: --name is required for private tunnels")
+				os.Exit(1)
+			}
+			if tcpRemotePort != 0 {
+				fmt.Println("Error: --remote-port cannot be used with --private, private tunnels have no public port")
+				os.Exit(1)
+			}
+			if tcpSecret != "" && tcpRotateSecret {
+				fmt.Println("Error: --rotate-secret cannot be used with --secret")
+				os.Exit(1)
+			}
+			if tcpSecret == "" {
+				// Reuse the saved secret so that visitors keep access across restarts
+				path := secretPath(tcpName)
+				secret, err := loadSecret(path)
+				if err != nil {
+					fmt.Printf("Error: Failed to read saved secret: %v\n", err)
+					os.Exit(1)
+				}
+				if secret == "" || tcpRotateSecret {
+					if secret, err = generateSecret(); err != nil {
+						fmt.Printf("Error: Failed to generate secret: %v\n", err)
+						os.Exit(1)
+					}
+					if err := saveSecret(path, secret); err != nil {
+						fmt.Printf("Error: Failed to save generated secret: %v\n", err)
+						os.Exit(1)
+					}
+				}
+				tcpSecret, tcpSecretFile = secret, path
+			}
+		} else if tcpRotateSecret {
+			fmt.Println("Error: --rotate-secret can only be used with --private")
+			os.Exit(1)
+		}
 		
 		// Always force DirectTCP mode for TCP tunnels
 		if Container.Config.ConnectionMode != model.ConnectionModeDirectTCP {
@@ -178,14 +240,57 @@ Examples:
 			}
 		}
 
+		// Request the remote port used the last time this tunnel ran, unless --fresh is given
+		stateKey := Container.StateService.TCPKey(tcpName, localHost, localPort)
+		usingSavedPort := false
+		if tcpRemotePort == 0 && !tcpFresh && !tcpPrivate {
+			if saved := Container.StateService.Lookup(stateKey, model.TunnelTypeTCP); saved != nil {
+				remotePort = saved.RemotePort
+				usingSavedPort = true
+				Container.Logger.Info("Requesting saved remote port %d for %s", remotePort, stateKey)
+			}
+		}
+
+		// Let visitors that ask for it connect peer-to-peer
+		if tcpP2P {
+			Container.Config.DirectP2PEnabled = true
+		}
+
+		proxyProtocol, err := model.ParseProxyProtocolVersion(tcpProxyProto)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		// Validate the optional local forwarding address before connecting
+		if tcpLocalListen != "" {
+			if _, err := transport.NormalizeListenAddr(tcpLocalListen); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
 		tunnelConfig := model.TunnelConfig{
-			Type:       model.TunnelTypeTCP,
-			LocalAddr:  localHost,
-			LocalPort:  localPort,
-			RemotePort: remotePort,
+			Name:          tcpName,
+			Type:          model.TunnelTypeTCP,
+			LocalAddr:     localHost,
+			LocalPort:     localPort,
+			RemotePort:    remotePort,
+			LocalListen:   tcpLocalListen,
+			Private:       tcpPrivate,
+			Secret:        tcpSecret,
+			ProxyProtocol: proxyProtocol,
+			AllowCIDRs:    tcpAllow,
+			DenyCIDRs:     tcpDeny,
 		}
 
 		tunnel, err := Container.TunnelService.CreateTCPTunnel(tunnelConfig)
+		if err != nil && usingSavedPort && errors.Is(err, transport.ErrPortTaken) {
+			// The saved port has been taken in the meantime, let the server pick another one
+			fmt.Printf("Warning: Saved remote port %d is already in use, requesting a new port\n", tunnelConfig.RemotePort)
+			tunnelConfig.RemotePort = 0
+			tunnel, err = Container.TunnelService.CreateTCPTunnel(tunnelConfig)
+		}
 		if err != nil {
 			fmt.Printf("Error: Failed to create tunnel: %v\n", err)
 			os.Exit(1)
@@ -206,9 +311,36 @@ Examples:
 			fmt.Println("=================================================")
 			fmt.Printf("🔌 Status    : Connected\n")
 			fmt.Printf("🖥️ Local     : %s:%d\n", tunnelConfig.LocalAddr, tunnelConfig.LocalPort)
-			fmt.Printf("🌐 Remote    : %s:%d\n", Container.Config.ServerAddress, remotePort)
+			if tunnelConfig.Private {
+				fmt.Printf("🔒 Private   : %s (no public port, end-to-end encrypted)\n", tunnelConfig.Name)
+			} else {
+				fmt.Printf("🌐 Remote    : %s:%d\n", Container.Config.ServerAddress, remotePort)
+			}
 			fmt.Printf("🔄 Type      : TCP\n")
-			fmt.Printf("🔑 SSH Access: ssh -p %d username@%s\n", remotePort, Container.Config.ServerAddress)
+			if tunnel.LocalListen != "" {
+				fmt.Printf("🔁 Local Listen: %s\n", tunnel.LocalListen)
+			}
+			if len(tunnelConfig.AllowCIDRs) > 0 {
+				fmt.Printf("✅ Allowed   : %s\n", strings.Join(tunnelConfig.AllowCIDRs, ", "))
+			}
+			if len(tunnelConfig.DenyCIDRs) > 0 {
+				fmt.Printf("⛔ Denied    : %s\n", strings.Join(tunnelConfig.DenyCIDRs, ", "))
+			}
+			if tunnelConfig.ProxyProtocol != model.ProxyProtocolNone {
+				fmt.Printf("🧾 PROXY Protocol: %s\n", tunnelConfig.ProxyProtocol)
+			}
+			if tunnelConfig.Private {
+				// The secret is never printed; a generated one is read from its file
+				secretArg := maskSecret(tunnelConfig.Secret)
+				if tcpSecretFile != "" {
+					fmt.Printf("🗝️  Secret    : saved to %s\n", tcpSecretFile)
+					secretArg = fmt.Sprintf("\"$(cat %s)\"", tcpSecretFile)
+				}
+				fmt.Printf("🔑 Visitors  : haxorport connect %s --local 127.0.0.1:%d --secret %s\n",
+					tunnelConfig.Name, tunnelConfig.LocalPort, secretArg)
+			} else {
+				fmt.Printf("🔑 SSH Access: ssh -p %d username@%s\n", remotePort, Container.Config.ServerAddress)
+			}
 			fmt.Printf("🔌 Connection Mode: %s\n", Container.Config.ConnectionMode)
 			fmt.Printf("📝 Log File: %s\n", Container.Config.LogFile)
 			fmt.Println("=================================================")
@@ -221,6 +353,9 @@ Examples:
 			}
 		}
 		
+		// Remember the remote port so the next start gets the same address
+		Container.StateService.Remember(stateKey, tunnel)
+
 		// Display tunnel information with simple format
 		printTunnelInfo(tunnel.RemotePort)
 		
@@ -236,6 +371,7 @@ Examples:
 					// Update tunnel model
 					tunnel.RemotePort = newPort
 					tunnel.Config.RemotePort = newPort
+					Container.StateService.Remember(stateKey, tunnel)
 					
 					// Display updated tunnel information
 					printTunnelInfo(newPort)
@@ -270,6 +406,62 @@ func init() {
 	tcpCmd.Flags().IntVarP(&tcpLocalPort, "port", "p", 0, "Local port to tunnel")
 	tcpCmd.Flags().IntVarP(&tcpRemotePort, "remote-port", "r", 0, "Requested remote port (optional, will be automatically selected if not specified)")
 	tcpCmd.Flags().StringVarP(&tcpLocalAddr, "local-addr", "l", "127.0.0.1", "Local address to forward to (default: 127.0.0.1)")
+	tcpCmd.Flags().StringVar(&tcpLocalListen, "local-listen", "", "Also forward a local address to the service, e.g. 127.0.0.1:2222 (disabled by default, binds to loopback if no host is given)")
+	tcpCmd.Flags().BoolVar(&tcpP2P, "p2p", false, "Allow visitors using 'haxorport connect --p2p' to connect peer-to-peer (relayed if NAT traversal fails)")
+	tcpCmd.Flags().StringVarP(&tcpName, "name", "n", "", "Tunnel name used to remember its remote port between runs (optional)")
+	tcpCmd.Flags().BoolVar(&tcpFresh, "fresh", false, "Ignore the saved remote port and request a new one")
+	tcpCmd.Flags().BoolVar(&tcpPrivate, "private", false, "Register a private tunnel without a public port, reachable only with 'haxorport connect <name>' (requires --name)")
+	tcpCmd.Flags().StringVar(&tcpSecret, "secret", "", "Shared secret of a private tunnel (the saved one, or a generated one, if not given)")
+	tcpCmd.Flags().BoolVar(&tcpRotateSecret, "rotate-secret", false, "Replace the saved secret of a private tunnel with a new one")
+	tcpCmd.Flags().StringSliceVar(&tcpAllow, "allow", nil, "Only allow visitors from these CIDRs or IPs (repeatable or comma-separated)")
+	tcpCmd.Flags().StringSliceVar(&tcpDeny, "deny", nil, "Reject visitors from these CIDRs or IPs (repeatable or comma-separated)")
+	tcpCmd.Flags().StringVar(&tcpProxyProto, "proxy-protocol", "", "Send a PROXY protocol header (v1 or v2) with the visitor address to the local service")
 
 	tcpCmd.MarkFlagRequired("port")
 }
+
+// generateSecret creates a random shared secret for a private tunnel
+func generateSecret() (string, error) {
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// secretPath returns the file the secret of a private tunnel is saved to
+func secretPath(name string) string {
+	dir := "."
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		dir = filepath.Join(homeDir, ".haxorport", "secrets")
+	}
+	return filepath.Join(dir, filepath.Base(name)+".secret")
+}
+
+// loadSecret reads a saved secret, or returns "" if none was saved
+func loadSecret(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// saveSecret writes the secret of a private tunnel to a file only the user can read
+func saveSecret(path, secret string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(secret+"\n"), 0600)
+}
+
+// maskSecret hides all but the first characters of a secret for display
+func maskSecret(secret string) string {
+	if len(secret) <= 8 {
+		return strings.Repeat("*", len(secret))
+	}
+	return secret[:4] + strings.Repeat("*", len(secret)-4)
+}
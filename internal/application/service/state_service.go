@@ -0,0 +1,113 @@
+package service
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+	"github.com/haxorport/haxorport-go-client/internal/domain/port"
+)
+
+// StateService remembers the subdomain or remote port assigned to each tunnel,
+// so that the same public address can be requested again after a restart
+type StateService struct {
+	stateRepo port.StateRepository
+	logger    port.Logger
+	mutex     sync.Mutex
+}
+
+// NewStateService creates a new StateService instance
+func NewStateService(stateRepo port.StateRepository, logger port.Logger) *StateService {
+	return &StateService{
+		stateRepo: stateRepo,
+		logger:    logger,
+	}
+}
+
+// HTTPKey returns the state key of an HTTP tunnel: its name if given, otherwise the local port
+func (s *StateService) HTTPKey(name string, localPort int) string {
+	if name != "" {
+		return name
+	}
+	return fmt.Sprintf("http:%d", localPort)
+}
+
+// TCPKey returns the state key of a TCP tunnel: its name if given, otherwise the local address and port
+func (s *StateService) TCPKey(name, localAddr string, localPort int) string {
+	if name != "" {
+		return name
+	}
+	if localAddr == "" {
+		localAddr = "127.0.0.1"
+	}
+	return fmt.Sprintf("tcp:%s:%d", localAddr, localPort)
+}
+
+// Lookup returns the saved state of the tunnel with the given key and type, or nil if there is none
+func (s *StateService) Lookup(key string, tunnelType model.TunnelType) *model.TunnelState {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	state, err := s.stateRepo.Load()
+	if err != nil {
+		s.logger.Warn("Failed to load tunnel state: %v", err)
+		return nil
+	}
+
+	tunnelState, ok := state.Tunnels[key]
+	if !ok || tunnelState.Type != tunnelType {
+		return nil
+	}
+	return &tunnelState
+}
+
+// Remember saves the public address assigned to a tunnel under the given key
+func (s *StateService) Remember(key string, tunnel *model.Tunnel) {
+	tunnelState := model.TunnelState{
+		Type:      tunnel.Config.Type,
+		UpdatedAt: time.Now(),
+	}
+	switch tunnel.Config.Type {
+	case model.TunnelTypeHTTP:
+		tunnelState.Subdomain = subdomainOf(tunnel)
+		if tunnelState.Subdomain == "" {
+			return
+		}
+	case model.TunnelTypeTCP:
+		tunnelState.RemotePort = tunnel.RemotePort
+		if tunnelState.RemotePort == 0 {
+			return
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	state, err := s.stateRepo.Load()
+	if err != nil {
+		s.logger.Warn("Failed to load tunnel state, starting a new state file: %v", err)
+		state = model.NewState()
+	}
+
+	state.Tunnels[key] = tunnelState
+	if err := s.stateRepo.Save(state); err != nil {
+		s.logger.Warn("Failed to save tunnel state: %v", err)
+		return
+	}
+	s.logger.Info("Saved tunnel state for %s", key)
+}
+
+// subdomainOf returns the subdomain of an HTTP tunnel, taken from the tunnel URL if available
+func subdomainOf(tunnel *model.Tunnel) string {
+	if tunnel.URL != "" {
+		if u, err := url.Parse(tunnel.URL); err == nil && u.Hostname() != "" {
+			if i := strings.Index(u.Hostname(), "."); i > 0 {
+				return u.Hostname()[:i]
+			}
+		}
+	}
+	return tunnel.Config.Subdomain
+}
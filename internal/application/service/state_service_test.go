@@ -0,0 +1,162 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+)
+
+// testLogger discards log messages
+type testLogger struct{}
+
+func (testLogger) Debug(string, ...interface{}) {}
+func (testLogger) Info(string, ...interface{})  {}
+func (testLogger) Warn(string, ...interface{})  {}
+func (testLogger) Error(string, ...interface{}) {}
+func (testLogger) SetLevel(string)              {}
+func (testLogger) Close() error                 { return nil }
+
+// memoryStateRepository keeps the state in memory and fails if err is set
+type memoryStateRepository struct {
+	state *model.State
+	err   error
+	saves int
+}
+
+func (r *memoryStateRepository) Load() (*model.State, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	state := model.NewState()
+	if r.state != nil {
+		for key, tunnel := range r.state.Tunnels {
+			state.Tunnels[key] = tunnel
+		}
+	}
+	return state, nil
+}
+
+func (r *memoryStateRepository) Save(state *model.State) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.state = state
+	r.saves++
+	return nil
+}
+
+func TestStateServiceKeys(t *testing.T) {
+	s := NewStateService(&memoryStateRepository{}, testLogger{})
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"named HTTP tunnel", s.HTTPKey("web", 8080), "web"},
+		{"unnamed HTTP tunnel", s.HTTPKey("", 8080), "http:8080"},
+		{"named TCP tunnel", s.TCPKey("db", "10.0.0.5", 5432), "db"},
+		{"unnamed TCP tunnel", s.TCPKey("", "10.0.0.5", 5432), "tcp:10.0.0.5:5432"},
+		{"TCP tunnel without address", s.TCPKey("", "", 22), "tcp:127.0.0.1:22"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("key = %q, want %q", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStateServiceRemember(t *testing.T) {
+	tests := []struct {
+		name   string
+		tunnel *model.Tunnel
+		want   *model.TunnelState
+	}{
+		{
+			"subdomain from URL",
+			&model.Tunnel{Config: model.TunnelConfig{Type: model.TunnelTypeHTTP, Subdomain: "requested"}, URL: "https://assigned.haxorport.online"},
+			&model.TunnelState{Type: model.TunnelTypeHTTP, Subdomain: "assigned"},
+		},
+		{
+			"subdomain from config",
+			&model.Tunnel{Config: model.TunnelConfig{Type: model.TunnelTypeHTTP, Subdomain: "requested"}},
+			&model.TunnelState{Type: model.TunnelTypeHTTP, Subdomain: "requested"},
+		},
+		{
+			"HTTP tunnel without subdomain",
+			&model.Tunnel{Config: model.TunnelConfig{Type: model.TunnelTypeHTTP}, URL: "http://localhost"},
+			nil,
+		},
+		{
+			"TCP tunnel",
+			&model.Tunnel{Config: model.TunnelConfig{Type: model.TunnelTypeTCP}, RemotePort: 4000},
+			&model.TunnelState{Type: model.TunnelTypeTCP, RemotePort: 4000},
+		},
+		{
+			"TCP tunnel without remote port",
+			&model.Tunnel{Config: model.TunnelConfig{Type: model.TunnelTypeTCP}},
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &memoryStateRepository{}
+			s := NewStateService(repo, testLogger{})
+			s.Remember("key", tt.tunnel)
+
+			got := s.Lookup("key", tt.tunnel.Config.Type)
+			if tt.want == nil {
+				if got != nil || repo.saves != 0 {
+					t.Errorf("saved %+v, want nothing", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatal("nothing was saved")
+			}
+			if got.Type != tt.want.Type || got.Subdomain != tt.want.Subdomain || got.RemotePort != tt.want.RemotePort || got.UpdatedAt.IsZero() {
+				t.Errorf("saved %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStateServiceLookup(t *testing.T) {
+	repo := &memoryStateRepository{state: model.NewState()}
+	repo.state.Tunnels["web"] = model.TunnelState{Type: model.TunnelTypeHTTP, Subdomain: "app"}
+
+	tests := []struct {
+		name       string
+		key        string
+		tunnelType model.TunnelType
+		err        error
+		found      bool
+	}{
+		{"known tunnel", "web", model.TunnelTypeHTTP, nil, true},
+		{"unknown tunnel", "db", model.TunnelTypeHTTP, nil, false},
+		{"other tunnel type", "web", model.TunnelTypeTCP, nil, false},
+		{"unreadable state", "web", model.TunnelTypeHTTP, errors.New("broken"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo.err = tt.err
+			s := NewStateService(repo, testLogger{})
+			if got := s.Lookup(tt.key, tt.tunnelType); (got != nil) != tt.found {
+				t.Errorf("Lookup() = %+v, want found %v", got, tt.found)
+			}
+		})
+	}
+}
+
+func TestStateServiceRememberKeepsOtherTunnels(t *testing.T) {
+	repo := &memoryStateRepository{state: model.NewState()}
+	repo.state.Tunnels["web"] = model.TunnelState{Type: model.TunnelTypeHTTP, Subdomain: "app"}
+	s := NewStateService(repo, testLogger{})
+
+	s.Remember("db", &model.Tunnel{Config: model.TunnelConfig{Type: model.TunnelTypeTCP}, RemotePort: 4000})
+	if s.Lookup("web", model.TunnelTypeHTTP) == nil || s.Lookup("db", model.TunnelTypeTCP) == nil {
+		t.Errorf("state after Remember = %+v", repo.state.Tunnels)
+	}
+}
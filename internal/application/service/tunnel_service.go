@@ -22,21 +22,16 @@ func NewTunnelService(tunnelRepo port.TunnelRepository, logger port.Logger) *Tun
 }
 
 
-func (s *TunnelService) CreateHTTPTunnel(localPort int, subdomain string, auth *model.TunnelAuth) (*model.Tunnel, error) {
-	s.logger.Info("Creating HTTP tunnel for local port %d with subdomain %s", localPort, subdomain)
+func (s *TunnelService) CreateHTTPTunnel(config model.TunnelConfig) (*model.Tunnel, error) {
+	s.logger.Info("Creating HTTP tunnel for local port %d with subdomain %s", config.LocalPort, config.Subdomain)
 
 
-	tunnelConfig := model.TunnelConfig{
-		Type:      model.TunnelTypeHTTP,
-		LocalPort: localPort,
-		Subdomain: subdomain,
-		Auth:      auth,
-	}
+	config.Type = model.TunnelTypeHTTP
 
 	// Register tunnel
-	tunnel, err := s.tunnelRepo.Register(tunnelConfig)
+	tunnel, err := s.tunnelRepo.Register(config)
 	if err != nil {
-		return nil, fmt.Errorf("failed to register HTTP tunnel: %v", err)
+		return nil, fmt.Errorf("failed to register HTTP tunnel: %w", err)
 	}
 
 	s.logger.Info("HTTP tunnel created successfully with URL: %s", tunnel.URL)
@@ -61,7 +56,7 @@ func (s *TunnelService) CreateTCPTunnel(config model.TunnelConfig) (*model.Tunne
 	// Register tunnel
 	tunnel, err := s.tunnelRepo.Register(config)
 	if err != nil {
-		return nil, fmt.Errorf("failed to register TCP tunnel: %v", err)
+		return nil, fmt.Errorf("failed to register TCP tunnel: %w", err)
 	}
 
 	s.logger.Info("TCP tunnel created successfully with remote port: %d", tunnel.RemotePort)
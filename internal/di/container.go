@@ -9,6 +9,7 @@ import (
 	"github.com/haxorport/haxorport-go-client/internal/domain/port"
 	"github.com/haxorport/haxorport-go-client/internal/infrastructure/config"
 	"github.com/haxorport/haxorport-go-client/internal/infrastructure/logger"
+	"github.com/haxorport/haxorport-go-client/internal/infrastructure/state"
 	"github.com/haxorport/haxorport-go-client/internal/infrastructure/transport"
 )
 
@@ -19,10 +20,12 @@ type Container struct {
 
 	// Repositories
 	ConfigRepository *config.ConfigRepository
+	StateRepository  *state.StateRepository
 
 	// Services
 	ConfigService *service.ConfigService
 	TunnelService *service.TunnelService
+	StateService  *service.StateService
 
 	// Client
 	Client *transport.Client
@@ -97,6 +100,13 @@ func (c *Container) Initialize(configPath string) error {
 	// Initialize tunnel service
 	c.TunnelService = service.NewTunnelService(c.TunnelRepository, c.Logger)
 
+	// Initialize state service to keep subdomains and ports stable across restarts
+	c.StateRepository, err = state.NewStateRepository("")
+	if err != nil {
+		return err
+	}
+	c.StateService = service.NewStateService(c.StateRepository, c.Logger)
+
 	// Register handler for HTTP request messages if using WebSocket
 	if c.Config.ConnectionMode == model.ConnectionModeWebSocket && c.Client != nil {
 		c.Client.RegisterHandler(model.MessageTypeHTTPRequest, c.Client.HandleHTTPRequestMessage)
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 )
@@ -29,6 +30,25 @@ const (
 	ConnectionModeDirectTCP ConnectionMode = "direct_tcp"
 )
 
+// AuthMode defines how the client proves its token to the server
+type AuthMode string
+
+const (
+	// AuthModeToken sends the token to the server on every connection
+	AuthModeToken AuthMode = "token"
+	// AuthModeChallenge answers a server nonce with an HMAC derived from the token
+	AuthModeChallenge AuthMode = "challenge"
+)
+
+// Validate returns an error if the authentication mode is unknown
+func (m AuthMode) Validate() error {
+	switch m {
+	case AuthModeToken, AuthModeChallenge:
+		return nil
+	}
+	return fmt.Errorf("unknown auth mode %q, expected %s or %s", m, AuthModeToken, AuthModeChallenge)
+}
+
 // Config is the configuration structure for haxorport client
 type Config struct {
 	// ServerAddress is the haxorport server address
@@ -39,10 +59,24 @@ type Config struct {
 	DataPort int
 	// ConnectionMode is the connection mode to server (websocket or direct_tcp)
 	ConnectionMode ConnectionMode
+	// DirectLegacyHandshake uses the old unframed text handshake in direct_tcp mode
+	DirectLegacyHandshake bool
+	// ControlPoolMinIdle is the minimum number of idle control connections in direct_tcp mode
+	ControlPoolMinIdle int
+	// ControlPoolMaxIdle is the maximum number of idle control connections in direct_tcp mode
+	ControlPoolMaxIdle int
+	// DirectRelayListen enables relay mode in direct_tcp mode; the relay opens back-connections to this address
+	DirectRelayListen string
+	// DirectRelayAdvertise is the back-connection address announced to the relay (derived from the listener if empty)
+	DirectRelayAdvertise string
+	// DirectP2PEnabled enables peer-to-peer connections between clients with relay fallback in direct_tcp mode
+	DirectP2PEnabled bool
 	// AuthEnabled is a flag to enable authentication
 	AuthEnabled bool
 	// AuthToken is the token for server authentication
 	AuthToken string
+	// AuthMode is the authentication mode (token or challenge)
+	AuthMode AuthMode
 	// AuthValidationURL is the URL for token validation (empty to use default)
 	AuthValidationURL string
 	// TLSEnabled is a flag to enable TLS
@@ -51,6 +85,16 @@ type Config struct {
 	TLSCert string
 	// TLSKey is the path to TLS key file
 	TLSKey string
+	// TLSCA is the path to a PEM bundle of CA certificates used to verify the server (empty for system roots)
+	TLSCA string
+	// TLSServerName overrides the server name used for certificate verification
+	TLSServerName string
+	// TLSInsecureSkipVerify disables server certificate verification (pins are still checked)
+	TLSInsecureSkipVerify bool
+	// TLSPinnedSHA256 is a list of base64 SHA-256 hashes of accepted server public keys (SPKI)
+	TLSPinnedSHA256 []string
+	// DirectTLSEnabled enables TLS for direct_tcp connections (defaults to TLSEnabled)
+	DirectTLSEnabled bool
 	// LogLevel is the logging level (debug, info, warn, error)
 	LogLevel LogLevel
 	// LogFile is the path to log file (empty for stdout)
@@ -67,12 +111,16 @@ func NewConfig() *Config {
 		ServerAddress:     "control.haxorport.online",
 		ControlPort:       443,
 		DataPort:          8081,
+		ControlPoolMinIdle: 2,
+		ControlPoolMaxIdle: 8,
 		AuthEnabled:       false,
 		AuthToken:         "",
+		AuthMode:          AuthModeToken,
 		AuthValidationURL: "https://haxorport.online/AuthToken/validate",
 		TLSEnabled:        false,
 		TLSCert:           "",
 		TLSKey:            "",
+		TLSPinnedSHA256:   []string{},
 		LogLevel:          LogLevelWarn,
 		LogFile:           "",
 		BaseDomain:        "haxorport.online",
@@ -0,0 +1,196 @@
+package model
+
+// DirectProtocolVersion is the version of the framed direct TCP control protocol
+const DirectProtocolVersion uint8 = 1
+
+// DirectFrameType defines frame types of the direct TCP control protocol
+type DirectFrameType uint8
+
+const (
+	// DirectFrameHello is sent by the client to register a connection
+	DirectFrameHello DirectFrameType = 1
+	// DirectFrameHelloResult is the server response to a hello frame
+	DirectFrameHelloResult DirectFrameType = 2
+	// DirectFrameConnect is sent by the server to request a connection to the target
+	DirectFrameConnect DirectFrameType = 3
+	// DirectFrameConnectResult is the client response to a connect frame
+	DirectFrameConnectResult DirectFrameType = 4
+	// DirectFrameChallenge carries the server nonce for challenge-response authentication
+	DirectFrameChallenge DirectFrameType = 5
+	// DirectFrameChallengeResponse carries the client answer to a challenge
+	DirectFrameChallengeResponse DirectFrameType = 6
+	// DirectFrameP2PAnswer carries the candidates of the tunnel owner in answer to a P2P offer
+	DirectFrameP2PAnswer DirectFrameType = 7
+	// DirectFrameP2PResult reports to the server whether hole punching succeeded
+	DirectFrameP2PResult DirectFrameType = 8
+	// DirectFrameP2PPunch proves knowledge of the P2P nonce on a punched connection
+	DirectFrameP2PPunch DirectFrameType = 9
+	// DirectFrameE2EHello opens the end-to-end encrypted session of a private tunnel (visitor to owner)
+	DirectFrameE2EHello DirectFrameType = 10
+	// DirectFrameE2EHelloResult is the tunnel owner answer to an end-to-end hello
+	DirectFrameE2EHelloResult DirectFrameType = 11
+)
+
+// DirectConnectionMode defines the purpose of a direct TCP connection
+type DirectConnectionMode string
+
+const (
+	// DirectModeForward registers the tunnel on the server
+	DirectModeForward DirectConnectionMode = "DIRECT_TCP_FORWARD"
+	// DirectModeControl opens a control connection used to serve visitors
+	DirectModeControl DirectConnectionMode = "CONTROL_CONNECTION"
+	// DirectModeRelay registers a relay session; the relay opens back-connections to the client for visitors
+	DirectModeRelay DirectConnectionMode = "RELAY_SESSION"
+	// DirectModeVisitor connects a client to a tunnel through the server, optionally peer-to-peer
+	DirectModeVisitor DirectConnectionMode = "VISITOR_CONNECTION"
+)
+
+// DirectStatus is the status code returned by the server or client in result frames
+type DirectStatus int
+
+const (
+	// DirectStatusOK indicates success
+	DirectStatusOK DirectStatus = 0
+	// DirectStatusAuthFailed indicates the authentication token was rejected
+	DirectStatusAuthFailed DirectStatus = 1
+	// DirectStatusPortTaken indicates the requested remote port is already in use
+	DirectStatusPortTaken DirectStatus = 2
+	// DirectStatusLimitReached indicates the subscription limit has been reached
+	DirectStatusLimitReached DirectStatus = 3
+	// DirectStatusBadRequest indicates a malformed or unexpected frame
+	DirectStatusBadRequest DirectStatus = 4
+	// DirectStatusUnsupportedVersion indicates the protocol version is not supported
+	DirectStatusUnsupportedVersion DirectStatus = 5
+	// DirectStatusTargetUnreachable indicates the client could not reach the target
+	DirectStatusTargetUnreachable DirectStatus = 6
+	// DirectStatusInternalError indicates an unexpected server or client error
+	DirectStatusInternalError DirectStatus = 7
+	// DirectStatusP2PFailed indicates hole punching failed and traffic must be relayed
+	DirectStatusP2PFailed DirectStatus = 8
+)
+
+// String returns the string representation of the status
+func (s DirectStatus) String() string {
+	switch s {
+	case DirectStatusOK:
+		return "ok"
+	case DirectStatusAuthFailed:
+		return "auth_failed"
+	case DirectStatusPortTaken:
+		return "port_taken"
+	case DirectStatusLimitReached:
+		return "limit_reached"
+	case DirectStatusBadRequest:
+		return "bad_request"
+	case DirectStatusUnsupportedVersion:
+		return "unsupported_version"
+	case DirectStatusTargetUnreachable:
+		return "target_unreachable"
+	case DirectStatusInternalError:
+		return "internal_error"
+	case DirectStatusP2PFailed:
+		return "p2p_failed"
+	default:
+		return "unknown"
+	}
+}
+
+// DirectHelloPayload is sent by the client when opening a direct TCP connection
+type DirectHelloPayload struct {
+	// Mode is the purpose of the connection
+	Mode DirectConnectionMode `json:"mode"`
+	// Token is the authentication token (optional, empty in challenge mode)
+	Token string `json:"token,omitempty"`
+	// AuthMode is the authentication mode (empty for plain token authentication)
+	AuthMode AuthMode `json:"auth_mode,omitempty"`
+	// TargetAddr is the local target address being tunneled
+	TargetAddr string `json:"target_addr"`
+	// RemotePort is the requested remote port (0 to let the server reserve a free port)
+	RemotePort int `json:"remote_port"`
+	// ReservationID binds the connection to a port reserved earlier (optional)
+	ReservationID string `json:"reservation_id,omitempty"`
+	// RelayAddr is the address where the client accepts back-connections (relay mode only)
+	RelayAddr string `json:"relay_addr,omitempty"`
+	// P2P asks for a peer-to-peer connection with the given candidates (visitor mode only, optional)
+	P2P *DirectP2POfferPayload `json:"p2p,omitempty"`
+	// Private registers the tunnel without a public port (forward mode only)
+	Private bool `json:"private,omitempty"`
+	// TunnelName is the name of the private tunnel being registered or connected to
+	TunnelName string `json:"tunnel_name,omitempty"`
+	// SecretID identifies the shared secret of a private tunnel; the secret itself is never sent
+	SecretID string `json:"secret_id,omitempty"`
+}
+
+// DirectHelloResultPayload is the server response to a hello frame
+type DirectHelloResultPayload struct {
+	// Status is the result status code
+	Status DirectStatus `json:"status"`
+	// RemotePort is the remote port assigned by the server
+	RemotePort int `json:"remote_port,omitempty"`
+	// ReservationID identifies the port reservation held by the server for the tunnel
+	ReservationID string `json:"reservation_id,omitempty"`
+	// Message contains details about the result
+	Message string `json:"message,omitempty"`
+	// Session is the short-lived credential issued after challenge authentication (optional)
+	Session *AuthSession `json:"session,omitempty"`
+	// RelaySessionID identifies the relay session; back-connections must present it (relay mode only)
+	RelaySessionID string `json:"relay_session_id,omitempty"`
+	// P2P contains the tunnel owner candidates if it accepted a P2P offer (visitor mode only)
+	P2P *DirectP2POfferPayload `json:"p2p,omitempty"`
+}
+
+// DirectConnectPayload is sent by the server to request a connection to the target
+type DirectConnectPayload struct {
+	// TargetAddr is the target address (empty to use the registered target)
+	TargetAddr string `json:"target_addr,omitempty"`
+	// RemoteAddr is the address of the visitor connected to the server
+	RemoteAddr string `json:"remote_addr,omitempty"`
+	// RelaySessionID is the relay session the back-connection belongs to (relay mode only)
+	RelaySessionID string `json:"relay_session_id,omitempty"`
+	// P2P contains the visitor candidates if the visitor asked for a peer-to-peer connection
+	P2P *DirectP2POfferPayload `json:"p2p,omitempty"`
+}
+
+// DirectConnectResultPayload is the client response to a connect frame
+type DirectConnectResultPayload struct {
+	// Status is the result status code
+	Status DirectStatus `json:"status"`
+	// Message contains details about the result
+	Message string `json:"message,omitempty"`
+}
+
+// DirectP2POfferPayload carries the candidate endpoints of one side of a P2P connection
+type DirectP2POfferPayload struct {
+	// Nonce is the secret both peers prove on punched connections (set by the server)
+	Nonce string `json:"nonce,omitempty"`
+	// Candidates are the host:port endpoints the peer can be reached at
+	Candidates []string `json:"candidates"`
+}
+
+// DirectP2PResultPayload reports the outcome of hole punching to the server
+type DirectP2PResultPayload struct {
+	// Status is DirectStatusOK if a direct connection was established, otherwise DirectStatusP2PFailed
+	Status DirectStatus `json:"status"`
+	// Message contains details about the result
+	Message string `json:"message,omitempty"`
+}
+
+// DirectP2PPunchPayload is exchanged on a punched connection to authenticate the peer
+type DirectP2PPunchPayload struct {
+	// Role is the role of the sender ("visitor" or "owner")
+	Role string `json:"role"`
+	// Proof is the HMAC of the role keyed with the P2P nonce
+	Proof string `json:"proof"`
+}
+
+// DirectE2EHelloPayload is exchanged between the two clients of a private tunnel to
+// prove knowledge of the shared secret and agree on the session keys
+type DirectE2EHelloPayload struct {
+	// Nonce is the random nonce of the sender (base64)
+	Nonce string `json:"nonce"`
+	// PublicKey is the ephemeral X25519 public key of the sender (base64)
+	PublicKey string `json:"public_key"`
+	// MAC is the HMAC of the sender role, the nonces and the public keys keyed with
+	// the key derived from the shared secret
+	MAC string `json:"mac"`
+}
@@ -0,0 +1,31 @@
+package model
+
+import (
+	"net/http"
+	"time"
+)
+
+// HTTPExchange is a request proxied through an HTTP tunnel together with its response
+type HTTPExchange struct {
+	// Request is the request as received from the server, before client-side policies ran
+	Request *HTTPRequest `json:"request"`
+	// Response is the response sent back to the server
+	Response *HTTPResponse `json:"response"`
+	// Started is when the request was received
+	Started time.Time `json:"started"`
+	// Duration is the time taken to produce the response
+	Duration time.Duration `json:"duration"`
+	// Replay is set for requests replayed locally instead of received from a visitor
+	Replay bool `json:"replay,omitempty"`
+}
+
+// Clone returns a copy of the request whose headers can be changed independently.
+// The body is shared, as it is never modified in place.
+func (r *HTTPRequest) Clone() *HTTPRequest {
+	clone := *r
+	clone.Headers = r.Headers.Clone()
+	if clone.Headers == nil {
+		clone.Headers = http.Header{}
+	}
+	return &clone
+}
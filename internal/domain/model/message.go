@@ -24,6 +24,12 @@ const (
 	MessageTypePong MessageType = "pong"
 	// MessageTypeError indicates an error message
 	MessageTypeError MessageType = "error"
+	// MessageTypeAuthChallenge carries the server nonce for challenge-response authentication
+	MessageTypeAuthChallenge MessageType = "auth_challenge"
+	// MessageTypeAuthResponse carries the client answer to an authentication challenge
+	MessageTypeAuthResponse MessageType = "auth_response"
+	// MessageTypeAuthResult is the server verdict on an authentication attempt
+	MessageTypeAuthResult MessageType = "auth_result"
 )
 
 // Message represents the base structure for all client-server messages
@@ -68,8 +74,46 @@ func (m *Message) ParsePayload(v interface{}) error {
 
 // AuthPayload is for authentication messages
 type AuthPayload struct {
-	// Token is the authentication token
+	// Token is the authentication token (empty in challenge mode)
 	Token string `json:"token"`
+	// Mode is the authentication mode (empty for plain token authentication)
+	Mode AuthMode `json:"mode,omitempty"`
+}
+
+// AuthChallengePayload is sent by the server to start challenge-response authentication
+type AuthChallengePayload struct {
+	// Nonce is the single-use base64 server nonce
+	Nonce string `json:"nonce"`
+}
+
+// AuthResponsePayload is the client answer to an authentication challenge
+type AuthResponsePayload struct {
+	// KeyID identifies the token or session used to sign the challenge
+	KeyID string `json:"key_id"`
+	// ClientNonce is a fresh base64 nonce chosen by the client
+	ClientNonce string `json:"client_nonce"`
+	// Signature is the hex HMAC-SHA256 over the challenge
+	Signature string `json:"signature"`
+}
+
+// AuthSession is a short-lived credential issued by the server after authentication
+type AuthSession struct {
+	// ID identifies the session
+	ID string `json:"id"`
+	// Key is the secret used to sign later challenges instead of the token
+	Key string `json:"key"`
+	// ExpiresAt is when the session expires (in seconds since epoch)
+	ExpiresAt int64 `json:"expires_at"`
+}
+
+// AuthResultPayload is the server verdict on an authentication attempt
+type AuthResultPayload struct {
+	// Success indicates if authentication was successful
+	Success bool `json:"success"`
+	// Session is the short-lived credential issued by the server (optional)
+	Session *AuthSession `json:"session,omitempty"`
+	// Error contains the error message if authentication failed
+	Error string `json:"error,omitempty"`
 }
 
 // RegisterPayload is for tunnel registration messages
@@ -102,6 +146,8 @@ type DataPayload struct {
 	ConnectionID string `json:"connection_id"`
 	// Data is the actual data being sent
 	Data []byte `json:"data"`
+	// RemoteAddr is the address of the visitor, sent with the first data of a TCP connection
+	RemoteAddr string `json:"remote_addr,omitempty"`
 }
 
 // ErrorPayload is for error messages
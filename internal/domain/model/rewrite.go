@@ -0,0 +1,174 @@
+package model
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// RewriteVariables are the variables rewrite rules can use as ${name}
+var RewriteVariables = []string{"public_host", "scheme", "remote_addr", "tunnel_id", "request_id"}
+
+// RewriteVariablePattern matches a variable in a rewrite rule
+var RewriteVariablePattern = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+// TunnelRewrite contains the rewrite rules of an HTTP tunnel, applied by the client to
+// the requests sent to the local service and to its responses
+type TunnelRewrite struct {
+	// Host replaces the Host header sent to the local service (variables allowed)
+	Host string `mapstructure:"host" yaml:"host,omitempty"`
+
+	// Paths rewrite the request path; the first matching rule is applied
+	Paths []TunnelPathRewrite `mapstructure:"paths" yaml:"paths,omitempty"`
+
+	// RequestHeaders change the headers sent to the local service
+	RequestHeaders *TunnelHeaderRewrite `mapstructure:"request_headers" yaml:"request_headers,omitempty"`
+
+	// ResponseHeaders change the headers returned to visitors
+	ResponseHeaders *TunnelHeaderRewrite `mapstructure:"response_headers" yaml:"response_headers,omitempty"`
+
+	// Location rewrites Location headers pointing at the local service to the public host
+	Location bool `mapstructure:"location" yaml:"location,omitempty"`
+
+	// CookieDomain replaces the Domain attribute of the cookies set by the local service
+	// (variables allowed, e.g. ${public_host})
+	CookieDomain string `mapstructure:"cookie_domain" yaml:"cookie_domain,omitempty"`
+
+	// BodyURLs rewrites URLs pointing at the local service in response bodies to the
+	// public URL (off by default)
+	BodyURLs bool `mapstructure:"body_urls" yaml:"body_urls,omitempty"`
+
+	// BodyContentTypes are the content types whose bodies are rewritten, such as text/html
+	// or text/* (HTML, CSS, JavaScript and JSON if empty)
+	BodyContentTypes []string `mapstructure:"body_content_types" yaml:"body_content_types,omitempty"`
+}
+
+// TunnelPathRewrite replaces request paths matching a regular expression. Replace can
+// refer to groups as $1 or ${name}; a ? in it replaces the query as well.
+type TunnelPathRewrite struct {
+	Match   string `mapstructure:"match" yaml:"match"`
+	Replace string `mapstructure:"replace" yaml:"replace"`
+}
+
+// TunnelHeaderRewrite changes headers: Remove is applied first, then Set replaces and
+// Add appends values (variables allowed in values)
+type TunnelHeaderRewrite struct {
+	Set    map[string]string `mapstructure:"set" yaml:"set,omitempty"`
+	Add    map[string]string `mapstructure:"add" yaml:"add,omitempty"`
+	Remove []string          `mapstructure:"remove" yaml:"remove,omitempty"`
+}
+
+// ParsePathRewrite parses a path rewrite given as REGEX=REPLACEMENT
+func ParsePathRewrite(value string) (TunnelPathRewrite, error) {
+	match, replace, ok := strings.Cut(value, "=")
+	if !ok || match == "" {
+		return TunnelPathRewrite{}, fmt.Errorf("invalid path rewrite %q, use REGEX=REPLACEMENT, e.g. ^/old/(.*)=/new/$1", value)
+	}
+	rule := TunnelPathRewrite{Match: match, Replace: replace}
+	if _, err := rule.Compile(); err != nil {
+		return TunnelPathRewrite{}, err
+	}
+	return rule, nil
+}
+
+// Compile compiles the expression of a path rewrite
+func (r TunnelPathRewrite) Compile() (*regexp.Regexp, error) {
+	expression, err := regexp.Compile(r.Match)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path rewrite %q: %v", r.Match, err)
+	}
+	if !strings.HasPrefix(r.Replace, "/") {
+		return nil, fmt.Errorf("invalid path rewrite %q: the replacement must start with /", r.Match)
+	}
+	return expression, nil
+}
+
+// Validate checks the expressions, header names and variables of the rules
+func (r *TunnelRewrite) Validate() error {
+	if err := checkRewriteVariables(r.Host); err != nil {
+		return err
+	}
+	if strings.ContainsAny(r.Host, " /") {
+		return fmt.Errorf("invalid host %q", r.Host)
+	}
+	for _, path := range r.Paths {
+		if _, err := path.Compile(); err != nil {
+			return err
+		}
+	}
+	if err := r.RequestHeaders.validate(); err != nil {
+		return fmt.Errorf("request_headers: %v", err)
+	}
+	if err := r.ResponseHeaders.validate(); err != nil {
+		return fmt.Errorf("response_headers: %v", err)
+	}
+	for _, contentType := range r.BodyContentTypes {
+		kind, subtype, ok := strings.Cut(contentType, "/")
+		if !ok || kind == "" || subtype == "" || strings.ContainsAny(contentType, " ;,") {
+			return fmt.Errorf("invalid body content type %q", contentType)
+		}
+	}
+	if strings.ContainsAny(r.CookieDomain, " ;,") {
+		return fmt.Errorf("invalid cookie_domain %q", r.CookieDomain)
+	}
+	return checkRewriteVariables(r.CookieDomain)
+}
+
+// validate checks the header names and values of a header rewrite
+func (h *TunnelHeaderRewrite) validate() error {
+	if h == nil {
+		return nil
+	}
+	names := make([]string, 0, len(h.Set)+len(h.Add)+len(h.Remove))
+	names = append(names, h.Remove...)
+	for _, values := range []map[string]string{h.Set, h.Add} {
+		for name, value := range values {
+			if strings.ContainsAny(value, "\r\n") {
+				return fmt.Errorf("the value of %s must not contain line breaks", name)
+			}
+			if err := checkRewriteVariables(value); err != nil {
+				return err
+			}
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		if !validHeaderName(name) {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+		if http.CanonicalHeaderKey(name) == "Host" {
+			return fmt.Errorf("use host to rewrite the Host header")
+		}
+	}
+	return nil
+}
+
+// checkRewriteVariables checks that a value only uses known variables
+func checkRewriteVariables(value string) error {
+	for _, match := range RewriteVariablePattern.FindAllStringSubmatch(value, -1) {
+		known := false
+		for _, name := range RewriteVariables {
+			if match[1] == name {
+				known = true
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown variable %s, use %s", match[0], "${"+strings.Join(RewriteVariables, "}, ${")+"}")
+		}
+	}
+	return nil
+}
+
+// validHeaderName reports whether name is a valid HTTP header name (an RFC 7230 token)
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if c > 0x7e || c <= ' ' || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, c) {
+			return false
+		}
+	}
+	return true
+}
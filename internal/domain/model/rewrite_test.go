@@ -0,0 +1,68 @@
+package model
+
+import "testing"
+
+func TestParsePathRewrite(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    TunnelPathRewrite
+		wantErr bool
+	}{
+		{"^/old/(.*)=/new/$1", TunnelPathRewrite{Match: "^/old/(.*)", Replace: "/new/$1"}, false},
+		{"^/api=/v2/api?version=2", TunnelPathRewrite{Match: "^/api", Replace: "/v2/api?version=2"}, false},
+		{"^/old", TunnelPathRewrite{}, true},
+		{"=/new", TunnelPathRewrite{}, true},
+		{"^/old=new", TunnelPathRewrite{}, true},
+		{"^/old=", TunnelPathRewrite{}, true},
+		{"^/(old=/new", TunnelPathRewrite{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParsePathRewrite(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePathRewrite() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParsePathRewrite() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTunnelRewriteValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rewrite TunnelRewrite
+		wantErr bool
+	}{
+		{"empty", TunnelRewrite{}, false},
+		{"host with variable", TunnelRewrite{Host: "${public_host}"}, false},
+		{"host with unknown variable", TunnelRewrite{Host: "${host}"}, true},
+		{"host with path", TunnelRewrite{Host: "example.com/app"}, true},
+		{"valid path", TunnelRewrite{Paths: []TunnelPathRewrite{{Match: "^/a", Replace: "/b"}}}, false},
+		{"invalid path expression", TunnelRewrite{Paths: []TunnelPathRewrite{{Match: "(", Replace: "/b"}}}, true},
+		{"relative path replacement", TunnelRewrite{Paths: []TunnelPathRewrite{{Match: "^/a", Replace: "b"}}}, true},
+		{"valid headers", TunnelRewrite{
+			RequestHeaders:  &TunnelHeaderRewrite{Set: map[string]string{"X-Forwarded-Host": "${public_host}"}, Remove: []string{"Cookie"}},
+			ResponseHeaders: &TunnelHeaderRewrite{Add: map[string]string{"X-Request-Id": "${request_id}"}},
+		}, false},
+		{"invalid header name", TunnelRewrite{RequestHeaders: &TunnelHeaderRewrite{Set: map[string]string{"X Bad": "1"}}}, true},
+		{"invalid removed header", TunnelRewrite{ResponseHeaders: &TunnelHeaderRewrite{Remove: []string{"Bad:Name"}}}, true},
+		{"header value with line break", TunnelRewrite{RequestHeaders: &TunnelHeaderRewrite{Add: map[string]string{"X-A": "1\r\nX-B: 2"}}}, true},
+		{"header value with unknown variable", TunnelRewrite{ResponseHeaders: &TunnelHeaderRewrite{Set: map[string]string{"X-A": "${nope}"}}}, true},
+		{"Host header", TunnelRewrite{RequestHeaders: &TunnelHeaderRewrite{Set: map[string]string{"host": "example.com"}}}, true},
+		{"body content types", TunnelRewrite{BodyContentTypes: []string{"text/html", "text/*", "application/json"}}, false},
+		{"body content type without subtype", TunnelRewrite{BodyContentTypes: []string{"text"}}, true},
+		{"body content type with parameters", TunnelRewrite{BodyContentTypes: []string{"text/html; charset=utf-8"}}, true},
+		{"cookie domain with variable", TunnelRewrite{CookieDomain: "${public_host}"}, false},
+		{"cookie domain with attribute", TunnelRewrite{CookieDomain: "example.com; Secure"}, true},
+		{"cookie domain with unknown variable", TunnelRewrite{CookieDomain: "${domain}"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rewrite.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
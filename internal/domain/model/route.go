@@ -0,0 +1,84 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TunnelRoute sends the requests of an HTTP tunnel that match a host pattern and/or a
+// path prefix to other local services than the default one
+type TunnelRoute struct {
+	// Host matches the Host header of the request: a host name, or *.domain for its
+	// subdomains (empty for any host)
+	Host string `mapstructure:"host" yaml:"host,omitempty"`
+
+	// Path matches requests whose path starts with this prefix; /api matches /api and
+	// /api/users but not /apis (empty for any path)
+	Path string `mapstructure:"path" yaml:"path,omitempty"`
+
+	// Upstreams receive the matching requests, given as ports or host:port; several
+	// upstreams are balanced with the load balancing settings of the tunnel
+	Upstreams []string `mapstructure:"upstreams" yaml:"upstreams"`
+
+	// StripPrefix removes Path from the request path before forwarding, so that /api/users
+	// reaches the upstream as /users
+	StripPrefix bool `mapstructure:"strip_prefix" yaml:"strip_prefix,omitempty"`
+}
+
+// ParseRoute parses a route given as PATTERN=UPSTREAM[,UPSTREAM...]. The pattern is a
+// path prefix (/api), a host pattern (api.example.com, *.example.com) or both
+// (api.example.com/v1).
+func ParseRoute(value string, stripPrefix bool) (TunnelRoute, error) {
+	pattern, upstreams, ok := strings.Cut(value, "=")
+	if !ok || strings.TrimSpace(pattern) == "" || strings.TrimSpace(upstreams) == "" {
+		return TunnelRoute{}, fmt.Errorf("invalid route %q, use PATTERN=UPSTREAM, e.g. /api=8080", value)
+	}
+	route := TunnelRoute{StripPrefix: stripPrefix}
+	pattern = strings.TrimSpace(pattern)
+	if index := strings.Index(pattern, "/"); index >= 0 {
+		route.Host, route.Path = pattern[:index], pattern[index:]
+	} else {
+		route.Host = pattern
+	}
+	for _, upstream := range strings.Split(upstreams, ",") {
+		route.Upstreams = append(route.Upstreams, strings.TrimSpace(upstream))
+	}
+	if err := route.Validate(); err != nil {
+		return TunnelRoute{}, err
+	}
+	return route, nil
+}
+
+// Validate checks the patterns and upstreams of a route
+func (r TunnelRoute) Validate() error {
+	if r.Host == "" && r.Path == "" {
+		return fmt.Errorf("a route needs a host or a path")
+	}
+	if r.Path != "" && r.Path[0] != '/' {
+		return fmt.Errorf("invalid route path %q, it must start with /", r.Path)
+	}
+	if strings.ContainsAny(r.Path, "?#") {
+		return fmt.Errorf("invalid route path %q, it must not contain a query", r.Path)
+	}
+	if r.StripPrefix && strings.Trim(r.Path, "/") == "" {
+		return fmt.Errorf("strip_prefix requires a route path other than /")
+	}
+	host := strings.TrimPrefix(r.Host, "*.")
+	if strings.ContainsAny(host, "*/:@ ") {
+		return fmt.Errorf("invalid route host %q, use a host name or *.domain", r.Host)
+	}
+	if len(r.Upstreams) == 0 {
+		return fmt.Errorf("route %s has no upstreams", r)
+	}
+	for _, upstream := range r.Upstreams {
+		if _, err := NormalizeUpstream(upstream); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// String returns the pattern of the route as it is written on the command line
+func (r TunnelRoute) String() string {
+	return r.Host + r.Path
+}
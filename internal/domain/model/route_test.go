@@ -0,0 +1,40 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRoute(t *testing.T) {
+	tests := []struct {
+		value   string
+		strip   bool
+		want    TunnelRoute
+		wantErr bool
+	}{
+		{"/api=8080", false, TunnelRoute{Path: "/api", Upstreams: []string{"8080"}}, false},
+		{"/api=8080", true, TunnelRoute{Path: "/api", Upstreams: []string{"8080"}, StripPrefix: true}, false},
+		{"api.example.com=8080", false, TunnelRoute{Host: "api.example.com", Upstreams: []string{"8080"}}, false},
+		{"*.example.com=8080", false, TunnelRoute{Host: "*.example.com", Upstreams: []string{"8080"}}, false},
+		{"api.example.com/v1=8081, 10.0.0.2:8081", false, TunnelRoute{Host: "api.example.com", Path: "/v1", Upstreams: []string{"8081", "10.0.0.2:8081"}}, false},
+		{"/api", false, TunnelRoute{}, true},
+		{"=8080", false, TunnelRoute{}, true},
+		{"/api=", false, TunnelRoute{}, true},
+		{"/api=70000", false, TunnelRoute{}, true},
+		{"/api?x=1=8080", false, TunnelRoute{}, true},
+		{"/=8080", true, TunnelRoute{}, true},
+		{"api.*.com=8080", false, TunnelRoute{}, true},
+		{"user@example.com=8080", false, TunnelRoute{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseRoute(tt.value, tt.strip)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRoute() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseRoute() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
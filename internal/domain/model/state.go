@@ -0,0 +1,28 @@
+package model
+
+import "time"
+
+// TunnelState contains the public address last assigned to a tunnel
+type TunnelState struct {
+	// Type is the tunnel type
+	Type TunnelType `json:"type"`
+	// Subdomain is the subdomain assigned to an HTTP tunnel
+	Subdomain string `json:"subdomain,omitempty"`
+	// RemotePort is the remote port assigned to a TCP tunnel
+	RemotePort int `json:"remote_port,omitempty"`
+	// UpdatedAt is when the tunnel state was last saved
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// State is the local client state kept between restarts
+type State struct {
+	// Tunnels maps a tunnel key (tunnel name or local target) to its last assigned address
+	Tunnels map[string]TunnelState `json:"tunnels"`
+}
+
+// NewState creates a new empty State
+func NewState() *State {
+	return &State{
+		Tunnels: make(map[string]TunnelState),
+	}
+}
@@ -1,5 +1,11 @@
 package model
 
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
 
 type TunnelType string
 
@@ -18,8 +24,41 @@ const (
 	AuthTypeBasic AuthType = "basic"
 
 	AuthTypeHeader AuthType = "header"
+
+	// AuthTypeForm serves a login page (password or TOTP code) from the client and uses session cookies
+	AuthTypeForm AuthType = "form"
+
+	// AuthTypeJWT accepts bearer tokens signed by a key from a JWKS or PEM file
+	AuthTypeJWT AuthType = "jwt"
+)
+
+
+// ProxyProtocolVersion selects the PROXY protocol header sent to the local service of a TCP tunnel
+type ProxyProtocolVersion string
+
+const (
+	// ProxyProtocolNone sends no PROXY protocol header
+	ProxyProtocolNone ProxyProtocolVersion = ""
+	// ProxyProtocolV1 sends the human-readable version 1 header
+	ProxyProtocolV1 ProxyProtocolVersion = "v1"
+	// ProxyProtocolV2 sends the binary version 2 header
+	ProxyProtocolV2 ProxyProtocolVersion = "v2"
 )
 
+// ParseProxyProtocolVersion parses a PROXY protocol version ("v1", "v2", or empty for none)
+func ParseProxyProtocolVersion(value string) (ProxyProtocolVersion, error) {
+	switch version := ProxyProtocolVersion(strings.ToLower(strings.TrimSpace(value))); version {
+	case ProxyProtocolNone, ProxyProtocolV1, ProxyProtocolV2:
+		return version, nil
+	case "1":
+		return ProxyProtocolV1, nil
+	case "2":
+		return ProxyProtocolV2, nil
+	default:
+		return ProxyProtocolNone, fmt.Errorf("invalid PROXY protocol version %q, use v1 or v2", value)
+	}
+}
+
 
 type TunnelAuth struct {
 
@@ -32,6 +71,34 @@ type TunnelAuth struct {
 	HeaderName string
 
 	HeaderValue string
+
+	// HtpasswdFile is an htpasswd file (bcrypt or SHA) with the users accepted by basic auth.
+	// It is checked by the client only and never sent to the server.
+	HtpasswdFile string `json:"-" mapstructure:"htpasswd_file" yaml:"htpasswd_file,omitempty"`
+
+	// HeaderValues are further accepted header values or API keys, checked by the client only
+	HeaderValues []string `json:"-" mapstructure:"header_values" yaml:"header_values,omitempty"`
+
+	// TOTPSecret is the base32 secret of the authenticator app accepted by form auth
+	TOTPSecret string `json:"-" mapstructure:"totp_secret" yaml:"totp_secret,omitempty"`
+
+	// JWKSFile is a JWKS file with the keys accepted by JWT auth
+	JWKSFile string `json:"-" mapstructure:"jwks_file" yaml:"jwks_file,omitempty"`
+
+	// PublicKeyFile is a PEM public key or certificate accepted by JWT auth
+	PublicKeyFile string `json:"-" mapstructure:"public_key_file" yaml:"public_key_file,omitempty"`
+
+	// Issuer is the required iss claim of JWT auth (empty to accept any)
+	Issuer string `json:"-" mapstructure:"issuer" yaml:"issuer,omitempty"`
+
+	// Audience is the audience that must be contained in the aud claim of JWT auth (empty to accept any)
+	Audience string `json:"-" mapstructure:"audience" yaml:"audience,omitempty"`
+
+	// RequiredClaims are claims tokens must contain for JWT auth, as "name" or "name=value"
+	RequiredClaims []string `json:"-" mapstructure:"required_claims" yaml:"required_claims,omitempty"`
+
+	// ClaimHeaders passes claims to the local service for JWT auth, as "claim=Header-Name"
+	ClaimHeaders []string `json:"-" mapstructure:"claim_headers" yaml:"claim_headers,omitempty"`
 }
 
 
@@ -50,6 +117,76 @@ type TunnelConfig struct {
 	RemotePort int
 
 	Auth *TunnelAuth
+
+	// LocalListen is an optional local address that also forwards to the service (direct TCP only).
+	// A bare port or an address without a host is bound to loopback.
+	LocalListen string
+
+	// Private registers the tunnel without a public port (direct TCP only). Visitors connect
+	// by Name with `haxorport connect` and must know Secret.
+	Private bool
+
+	// Secret is the shared secret of a private tunnel; it also encrypts visitor traffic end to end
+	Secret string
+
+	// ProxyProtocol sends a PROXY protocol header with the visitor address to the local service (TCP only)
+	ProxyProtocol ProxyProtocolVersion `mapstructure:"proxy_protocol" yaml:"proxy_protocol,omitempty"`
+
+	// AllowCIDRs restricts visitors to these networks (empty to allow all); checked by the client
+	AllowCIDRs []string `mapstructure:"allow_cidrs" yaml:"allow_cidrs,omitempty"`
+
+	// DenyCIDRs rejects visitors from these networks, even if they are allowed by AllowCIDRs
+	DenyCIDRs []string `mapstructure:"deny_cidrs" yaml:"deny_cidrs,omitempty"`
+
+	// OIDC puts an OpenID Connect login in front of the tunnel (HTTP only); checked by the client
+	OIDC *TunnelOIDC `json:"-" mapstructure:"oidc" yaml:"oidc,omitempty"`
+
+	// ErrorPages replaces the built-in pages served for failures of the local service and
+	// in maintenance mode (HTTP only); rendered by the client
+	ErrorPages *TunnelErrorPages `json:"-" mapstructure:"error_pages" yaml:"error_pages,omitempty"`
+
+	// UpstreamTimeout limits how long the local service may take to answer (HTTP only, 0 for
+	// no limit); requests taking longer get a 504
+	UpstreamTimeout time.Duration `json:"-" mapstructure:"upstream_timeout" yaml:"upstream_timeout,omitempty"`
+
+	// Upstreams spreads requests over several local services, given as ports or host:port,
+	// instead of LocalPort (HTTP only); balanced by the client
+	Upstreams []string `json:"-" mapstructure:"upstreams" yaml:"upstreams,omitempty"`
+
+	// LoadBalancing selects the upstream of a request and takes unhealthy upstreams out
+	LoadBalancing *TunnelLoadBalancing `json:"-" mapstructure:"load_balancing" yaml:"load_balancing,omitempty"`
+
+	// Routes send requests matching a host or path prefix to other local services than
+	// LocalPort or Upstreams (HTTP only); the most specific matching route wins
+	Routes []TunnelRoute `json:"-" mapstructure:"routes" yaml:"routes,omitempty"`
+
+	// Rewrite changes the requests sent to the local service and its responses (HTTP
+	// only); applied by the client
+	Rewrite *TunnelRewrite `json:"-" mapstructure:"rewrite" yaml:"rewrite,omitempty"`
+}
+
+// TunnelErrorPages contains the templates of the error pages of an HTTP tunnel
+type TunnelErrorPages struct {
+	// HTMLFile is an html/template file rendered for browsers
+	HTMLFile string `mapstructure:"html_file" yaml:"html_file,omitempty"`
+
+	// JSONFile is a text/template file rendered for other clients; it must produce JSON
+	JSONFile string `mapstructure:"json_file" yaml:"json_file,omitempty"`
+}
+
+// TunnelOIDC contains the OpenID Connect settings of an HTTP tunnel
+type TunnelOIDC struct {
+	// Issuer is the issuer URL of the identity provider, used for discovery
+	Issuer string `mapstructure:"issuer" yaml:"issuer"`
+
+	// ClientID is the client ID registered at the identity provider
+	ClientID string `mapstructure:"client_id" yaml:"client_id"`
+
+	// ClientSecret is the client secret, if the identity provider requires one
+	ClientSecret string `mapstructure:"client_secret" yaml:"client_secret,omitempty"`
+
+	// AllowedDomains restricts logins to verified email addresses of these domains (empty to allow all)
+	AllowedDomains []string `mapstructure:"allowed_domains" yaml:"allowed_domains,omitempty"`
 }
 
 
@@ -64,6 +201,36 @@ type Tunnel struct {
 	RemotePort int
 
 	Active bool
+
+	// LocalListen is the address of the local forwarding listener (empty if disabled)
+	LocalListen string
+
+	// ControlPool contains the control connection pool metrics (direct TCP only)
+	ControlPool *ControlPoolStats
+}
+
+// ControlPoolStats contains metrics of the direct TCP control connection pool
+type ControlPoolStats struct {
+	// Idle is the number of control connections waiting for visitors
+	Idle int
+	// Active is the number of control connections serving visitors
+	Active int
+	// Dialing is the number of control connections being established
+	Dialing int
+	// Target is the current number of idle connections the pool aims for
+	Target int
+	// MinIdle is the configured minimum number of idle connections
+	MinIdle int
+	// MaxIdle is the configured maximum number of idle connections
+	MaxIdle int
+	// Dialed is the total number of control connections established
+	Dialed uint64
+	// DialFailures is the total number of failed dial or handshake attempts
+	DialFailures uint64
+	// Served is the total number of visitor connections served
+	Served uint64
+	// Exhaustions is the number of times a visitor took the last idle connection
+	Exhaustions uint64
 }
 
 
@@ -0,0 +1,113 @@
+package model
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LoadBalancingStrategy selects the upstream a request of an HTTP tunnel is sent to
+type LoadBalancingStrategy string
+
+const (
+	// LoadBalancingRoundRobin sends requests to the upstreams in turn
+	LoadBalancingRoundRobin LoadBalancingStrategy = "round_robin"
+	// LoadBalancingLeastConnections sends requests to the upstream with the fewest requests in flight
+	LoadBalancingLeastConnections LoadBalancingStrategy = "least_connections"
+	// LoadBalancingStickyCookie keeps visitors on one upstream with a cookie
+	LoadBalancingStickyCookie LoadBalancingStrategy = "sticky_cookie"
+	// LoadBalancingIPHash keeps visitors on one upstream by their address
+	LoadBalancingIPHash LoadBalancingStrategy = "ip_hash"
+)
+
+// ParseLoadBalancingStrategy parses a strategy name; empty selects round robin
+func ParseLoadBalancingStrategy(value string) (LoadBalancingStrategy, error) {
+	normalized := strings.ReplaceAll(strings.ToLower(strings.TrimSpace(value)), "-", "_")
+	switch strategy := LoadBalancingStrategy(normalized); strategy {
+	case "":
+		return LoadBalancingRoundRobin, nil
+	case LoadBalancingRoundRobin, LoadBalancingLeastConnections, LoadBalancingStickyCookie, LoadBalancingIPHash:
+		return strategy, nil
+	case "sticky", "cookie":
+		return LoadBalancingStickyCookie, nil
+	default:
+		return "", fmt.Errorf("invalid load balancing strategy %q, use round_robin, least_connections, sticky_cookie or ip_hash", value)
+	}
+}
+
+// TunnelLoadBalancing contains the load balancing settings of an HTTP tunnel with upstreams
+type TunnelLoadBalancing struct {
+	// Strategy selects the upstream of a request (round robin if empty)
+	Strategy LoadBalancingStrategy `mapstructure:"strategy" yaml:"strategy,omitempty"`
+
+	// HealthCheck probes the upstreams periodically (nil to disable)
+	HealthCheck *TunnelHealthCheck `mapstructure:"health_check" yaml:"health_check,omitempty"`
+
+	// MaxFails is the number of connection errors in a row after which an upstream is
+	// taken out for FailTimeout (0 for the default)
+	MaxFails int `mapstructure:"max_fails" yaml:"max_fails,omitempty"`
+
+	// FailTimeout is how long an upstream stays out after MaxFails connection errors (0 for the default)
+	FailTimeout time.Duration `mapstructure:"fail_timeout" yaml:"fail_timeout,omitempty"`
+}
+
+// TunnelHealthCheck contains the active health check of the upstreams of an HTTP tunnel
+type TunnelHealthCheck struct {
+	// Path is requested with GET; 2xx and 3xx responses are healthy
+	Path string `mapstructure:"path" yaml:"path"`
+
+	// Interval between checks (0 for the default)
+	Interval time.Duration `mapstructure:"interval" yaml:"interval,omitempty"`
+
+	// Timeout of a check (0 for the default)
+	Timeout time.Duration `mapstructure:"timeout" yaml:"timeout,omitempty"`
+
+	// HealthyThreshold is the number of passed checks in a row that bring an upstream back (0 for the default)
+	HealthyThreshold int `mapstructure:"healthy_threshold" yaml:"healthy_threshold,omitempty"`
+
+	// UnhealthyThreshold is the number of failed checks in a row that take an upstream out (0 for the default)
+	UnhealthyThreshold int `mapstructure:"unhealthy_threshold" yaml:"unhealthy_threshold,omitempty"`
+}
+
+// UpstreamStatus is the state of an upstream of an HTTP tunnel
+type UpstreamStatus struct {
+	Address string `json:"address"`
+	// Route is the pattern of the route the upstream serves (empty for the default upstreams)
+	Route string `json:"route,omitempty"`
+	// Healthy is false while the upstream fails health checks or is ejected after connection errors
+	Healthy bool `json:"healthy"`
+	// Active is the number of requests in flight
+	Active int `json:"active"`
+	// Requests and Failures count the requests sent and the connection errors
+	Requests int64 `json:"requests"`
+	Failures int64 `json:"failures"`
+	// LastError is the last connection or health check error
+	LastError string `json:"last_error,omitempty"`
+}
+
+// NormalizeUpstream validates an upstream address, given as a port or host:port, and
+// returns it as host:port. A bare port refers to localhost.
+func NormalizeUpstream(value string) (string, error) {
+	address := strings.TrimSpace(value)
+	address = strings.TrimPrefix(address, "http://")
+	address = strings.TrimSuffix(address, "/")
+	if port, err := strconv.Atoi(address); err == nil {
+		if port <= 0 || port > 65535 {
+			return "", fmt.Errorf("invalid upstream %q: port out of range", value)
+		}
+		return net.JoinHostPort("localhost", address), nil
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", fmt.Errorf("invalid upstream %q, use a port or host:port", value)
+	}
+	if number, err := strconv.Atoi(port); err != nil || number <= 0 || number > 65535 {
+		return "", fmt.Errorf("invalid upstream %q: port out of range", value)
+	}
+	if host == "" {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, port), nil
+}
@@ -0,0 +1,14 @@
+package port
+
+import "github.com/haxorport/haxorport-go-client/internal/domain/model"
+
+// HTTPFallback keeps responses of the local service and answers for it when it cannot
+// be reached
+type HTTPFallback interface {
+	// RecordHTTPResponse receives a response of the local service. It is called on the
+	// request path and must not modify the request or the response.
+	RecordHTTPResponse(request *model.HTTPRequest, response *model.HTTPResponse)
+	// FallbackHTTPResponse returns a response for a request the local service could
+	// not be reached for, if one is known
+	FallbackHTTPResponse(request *model.HTTPRequest) (*model.HTTPResponse, bool)
+}
@@ -0,0 +1,10 @@
+package port
+
+import "github.com/haxorport/haxorport-go-client/internal/domain/model"
+
+// HTTPObserver is notified of every exchange proxied through an HTTP tunnel
+type HTTPObserver interface {
+	// ObserveHTTPExchange receives a completed exchange. It is called on the request
+	// path, so implementations must return quickly and must not modify the exchange.
+	ObserveHTTPExchange(exchange *model.HTTPExchange)
+}
@@ -0,0 +1,12 @@
+package port
+
+import "github.com/haxorport/haxorport-go-client/internal/domain/model"
+
+// StateRepository defines operations on the local client state
+type StateRepository interface {
+	// Load loads the state from storage
+	Load() (*model.State, error)
+
+	// Save saves the state to storage
+	Save(state *model.State) error
+}
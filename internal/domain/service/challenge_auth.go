@@ -0,0 +1,47 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// challengeAuthVersion is mixed into every signature so that signatures of
+// future protocol versions can never be replayed against this one
+const challengeAuthVersion = "haxorport-auth-v1"
+
+// minNonceSize is the minimum size of a decoded server nonce in bytes
+const minNonceSize = 16
+
+// TokenKeyID returns the public identifier of a token, which lets the server
+// find the token without the token itself being sent
+func TokenKeyID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "tok_" + hex.EncodeToString(sum[:16])
+}
+
+// NewNonce creates a random base64 nonce for a challenge-response exchange
+func NewNonce() (string, error) {
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(nonce), nil
+}
+
+// SignChallenge computes the HMAC-SHA256 answer to a server challenge.
+// The signature covers the purpose of the connection and both nonces, so a
+// captured answer is useless for any other challenge or connection type.
+func SignChallenge(secret, purpose, serverNonce, clientNonce string) (string, error) {
+	decoded, err := base64.StdEncoding.DecodeString(serverNonce)
+	if err != nil || len(decoded) < minNonceSize {
+		return "", fmt.Errorf("invalid server nonce")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s", challengeAuthVersion, purpose, serverNonce, clientNonce)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestSignChallenge(t *testing.T) {
+	serverNonce := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef"))
+
+	// The signature is an HMAC-SHA256 of the version, purpose and both nonces, one per line
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("haxorport-auth-v1\ncontrol\n" + serverNonce + "\nclient"))
+	want := hex.EncodeToString(mac.Sum(nil))
+
+	got, err := SignChallenge("secret", "control", serverNonce, "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("SignChallenge() = %s, want %s", got, want)
+	}
+
+	tests := []struct {
+		name        string
+		secret      string
+		purpose     string
+		serverNonce string
+		clientNonce string
+	}{
+		{"other secret", "other", "control", serverNonce, "client"},
+		{"other purpose", "secret", "data", serverNonce, "client"},
+		{"other server nonce", "secret", "control", base64.StdEncoding.EncodeToString([]byte("fedcba9876543210")), "client"},
+		{"other client nonce", "secret", "control", serverNonce, "other"},
+		// Moving the separator between fields must not give the same signature
+		{"shifted fields", "secret", "control\n" + serverNonce, "", "client"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			other, err := SignChallenge(tt.secret, tt.purpose, tt.serverNonce, tt.clientNonce)
+			if err == nil && other == want {
+				t.Error("signature is the same as for the original challenge")
+			}
+		})
+	}
+}
+
+func TestSignChallengeRejectsInvalidNonce(t *testing.T) {
+	tests := []struct {
+		name        string
+		serverNonce string
+	}{
+		{"empty", ""},
+		{"not base64", "not a nonce!"},
+		{"too short", base64.StdEncoding.EncodeToString([]byte("0123456789abcde"))},
+		{"URL encoding", strings.Repeat("-_", 12)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := SignChallenge("secret", "control", tt.serverNonce, "client"); err == nil {
+				t.Error("SignChallenge() accepted an invalid server nonce")
+			}
+		})
+	}
+}
+
+func TestNewNonce(t *testing.T) {
+	first, err := NewNonce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewNonce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second {
+		t.Error("NewNonce() returned the same nonce twice")
+	}
+	// A client nonce is also accepted as a server nonce
+	if _, err := SignChallenge("secret", "control", first, second); err != nil {
+		t.Errorf("nonce %q rejected: %v", first, err)
+	}
+}
+
+func TestTokenKeyID(t *testing.T) {
+	id := TokenKeyID("token")
+	if !strings.HasPrefix(id, "tok_") || len(id) != len("tok_")+32 {
+		t.Errorf("TokenKeyID() = %q, want tok_ and 32 hex digits", id)
+	}
+	if strings.Contains(id, "token") || TokenKeyID("other") == id {
+		t.Errorf("TokenKeyID() = %q does not identify the token safely", id)
+	}
+}
@@ -48,12 +48,37 @@ func (r *ConfigRepository) Load(configPath string) (*model.Config, error) {
 	config.ControlPort = viper.GetInt("control_port")
 	config.DataPort = viper.GetInt("data_port")
 	config.ConnectionMode = model.ConnectionMode(viper.GetString("connection_mode"))
+	config.DirectLegacyHandshake = viper.GetBool("direct_legacy_handshake")
+	if viper.IsSet("control_pool_min_idle") {
+		config.ControlPoolMinIdle = viper.GetInt("control_pool_min_idle")
+	}
+	if viper.IsSet("control_pool_max_idle") {
+		config.ControlPoolMaxIdle = viper.GetInt("control_pool_max_idle")
+	}
+	config.DirectRelayListen = viper.GetString("direct_relay_listen")
+	config.DirectRelayAdvertise = viper.GetString("direct_relay_advertise")
+	config.DirectP2PEnabled = viper.GetBool("direct_p2p_enabled")
 	config.AuthEnabled = viper.GetBool("auth_enabled")
 	config.AuthToken = viper.GetString("auth_token")
+	if authMode := viper.GetString("auth_mode"); authMode != "" {
+		config.AuthMode = model.AuthMode(authMode)
+		if err := config.AuthMode.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid auth_mode: %v", err)
+		}
+	}
 	config.AuthValidationURL = viper.GetString("auth_validation_url")
 	config.TLSEnabled = viper.GetBool("tls_enabled")
 	config.TLSCert = viper.GetString("tls_cert")
 	config.TLSKey = viper.GetString("tls_key")
+	config.TLSCA = viper.GetString("tls_ca")
+	config.TLSServerName = viper.GetString("tls_server_name")
+	config.TLSInsecureSkipVerify = viper.GetBool("tls_insecure_skip_verify")
+	config.TLSPinnedSHA256 = viper.GetStringSlice("tls_pinned_sha256")
+	// TLS for direct_tcp follows tls_enabled unless explicitly configured
+	config.DirectTLSEnabled = config.TLSEnabled
+	if viper.IsSet("direct_tls_enabled") {
+		config.DirectTLSEnabled = viper.GetBool("direct_tls_enabled")
+	}
 	config.BaseDomain = viper.GetString("base_domain")
 	config.LogLevel = model.LogLevel(viper.GetString("log_level"))
 	config.LogFile = viper.GetString("log_file")
@@ -63,6 +88,18 @@ func (r *ConfigRepository) Load(configPath string) (*model.Config, error) {
 	if err := viper.UnmarshalKey("tunnels", &tunnelConfigs); err != nil {
 		return nil, fmt.Errorf("error parsing tunnel configuration: %v", err)
 	}
+	for i, tunnel := range tunnelConfigs {
+		if tunnel.Rewrite == nil {
+			continue
+		}
+		if err := tunnel.Rewrite.Validate(); err != nil {
+			name := tunnel.Name
+			if name == "" {
+				name = fmt.Sprintf("#%d", i+1)
+			}
+			return nil, fmt.Errorf("invalid rewrite rules of tunnel %s: %v", name, err)
+		}
+	}
 	config.Tunnels = tunnelConfigs
 
 	return config, nil
@@ -93,12 +130,27 @@ func (r *ConfigRepository) Save(config *model.Config, configPath string) error {
 	viper.Set("control_port", config.ControlPort)
 	viper.Set("data_port", config.DataPort)
 	viper.Set("connection_mode", string(config.ConnectionMode))
+	viper.Set("direct_legacy_handshake", config.DirectLegacyHandshake)
+	viper.Set("control_pool_min_idle", config.ControlPoolMinIdle)
+	viper.Set("control_pool_max_idle", config.ControlPoolMaxIdle)
+	viper.Set("direct_relay_listen", config.DirectRelayListen)
+	viper.Set("direct_relay_advertise", config.DirectRelayAdvertise)
+	viper.Set("direct_p2p_enabled", config.DirectP2PEnabled)
 	viper.Set("auth_enabled", config.AuthEnabled)
 	viper.Set("auth_token", config.AuthToken)
+	viper.Set("auth_mode", string(config.AuthMode))
 	viper.Set("auth_validation_url", config.AuthValidationURL)
 	viper.Set("tls_enabled", config.TLSEnabled)
 	viper.Set("tls_cert", config.TLSCert)
 	viper.Set("tls_key", config.TLSKey)
+	viper.Set("tls_ca", config.TLSCA)
+	viper.Set("tls_server_name", config.TLSServerName)
+	viper.Set("tls_insecure_skip_verify", config.TLSInsecureSkipVerify)
+	viper.Set("tls_pinned_sha256", config.TLSPinnedSHA256)
+	// direct_tls_enabled is only written when it no longer follows tls_enabled
+	if config.DirectTLSEnabled != config.TLSEnabled || viper.IsSet("direct_tls_enabled") {
+		viper.Set("direct_tls_enabled", config.DirectTLSEnabled)
+	}
 	viper.Set("base_domain", config.BaseDomain)
 	viper.Set("log_level", string(config.LogLevel))
 	viper.Set("log_file", config.LogFile)
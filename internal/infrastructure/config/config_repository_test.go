@@ -0,0 +1,118 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+	"github.com/spf13/viper"
+)
+
+// writeConfigFile writes content to a config file in a temporary directory and returns its path
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	// The repository works on the global viper instance
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadAuthMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    model.AuthMode
+		wantErr bool
+	}{
+		{"default", "server_address: example.net\n", model.AuthModeToken, false},
+		{"token", "auth_mode: token\n", model.AuthModeToken, false},
+		{"challenge", "auth_mode: challenge\n", model.AuthModeChallenge, false},
+		{"unknown", "auth_mode: hmac\n", "", true},
+		{"wrong case", "auth_mode: Challenge\n", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := NewConfigRepository().Load(writeConfigFile(t, tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && config.AuthMode != tt.want {
+				t.Errorf("AuthMode = %q, want %q", config.AuthMode, tt.want)
+			}
+		})
+	}
+}
+
+func TestSaveDirectTLSEnabled(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		tls        bool
+		directTLS  bool
+		wantStored bool
+	}{
+		{"follows tls_enabled", "", true, true, false},
+		{"follows disabled TLS", "", false, false, false},
+		{"differs from tls_enabled", "", true, false, true},
+		{"enabled without tls_enabled", "", false, true, true},
+		{"explicitly set before", "tls_enabled: true\ndirect_tls_enabled: true\n", true, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := NewConfigRepository()
+			path := writeConfigFile(t, tt.content)
+			config, err := repository.Load(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			config.TLSEnabled = tt.tls
+			config.DirectTLSEnabled = tt.directTLS
+			if err := repository.Save(config, path); err != nil {
+				t.Fatal(err)
+			}
+
+			saved := viper.New()
+			saved.SetConfigFile(path)
+			if err := saved.ReadInConfig(); err != nil {
+				t.Fatal(err)
+			}
+			if saved.IsSet("direct_tls_enabled") != tt.wantStored {
+				t.Errorf("direct_tls_enabled stored = %v, want %v", saved.IsSet("direct_tls_enabled"), tt.wantStored)
+			}
+			if tt.wantStored && saved.GetBool("direct_tls_enabled") != tt.directTLS {
+				t.Errorf("direct_tls_enabled = %v, want %v", saved.GetBool("direct_tls_enabled"), tt.directTLS)
+			}
+		})
+	}
+}
+
+func TestDirectTLSEnabledFollowsTLSEnabled(t *testing.T) {
+	repository := NewConfigRepository()
+	path := writeConfigFile(t, "")
+	config := model.NewConfig()
+	config.TLSEnabled = true
+	config.DirectTLSEnabled = true
+	if err := repository.Save(config, path); err != nil {
+		t.Fatal(err)
+	}
+
+	// Turning TLS off in the file later also turns it off for direct_tcp
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path = writeConfigFile(t, strings.Replace(string(data), "tls_enabled: true", "tls_enabled: false", 1))
+	loaded, err := repository.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.TLSEnabled || loaded.DirectTLSEnabled {
+		t.Errorf("TLSEnabled = %v, DirectTLSEnabled = %v, want both disabled", loaded.TLSEnabled, loaded.DirectTLSEnabled)
+	}
+}
@@ -0,0 +1,208 @@
+package errorpage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+)
+
+// Messages shown to visitors. They never contain error details of the local service.
+const (
+	MessageUnreachable = "The service behind this tunnel is not reachable right now. Please try again in a moment."
+	MessageTimeout     = "The service behind this tunnel did not answer in time. Please try again in a moment."
+	MessageBadRequest  = "The request could not be forwarded to the service behind this tunnel."
+	MessageMaintenance = "This service is down for maintenance. Please try again later."
+)
+
+// Data is passed to the templates
+type Data struct {
+	// StatusCode is the HTTP status code, such as 502
+	StatusCode int
+	// Status is the text of the status code, such as "Bad Gateway"
+	Status string
+	// Message explains the error to visitors
+	Message string
+	// Maintenance is set for the page served in maintenance mode
+	Maintenance bool
+	// RequestID identifies the request in the logs of the client
+	RequestID string
+	Method    string
+	Path      string
+	Host      string
+	// Time is the time of the error in RFC 3339 format
+	Time string
+}
+
+// defaultHTML is the built-in page for browsers
+const defaultHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{if .Maintenance}}Down for maintenance{{else}}{{.StatusCode}} {{.Status}}{{end}}</title>
+<style>
+body{font-family:system-ui,sans-serif;background:#f4f5f7;display:flex;align-items:center;justify-content:center;min-height:100vh;margin:0}
+main{background:#fff;padding:2rem;border-radius:8px;box-shadow:0 2px 8px rgba(0,0,0,.1);width:100%;max-width:420px}
+h1{font-size:1.25rem;margin:0 0 1rem}
+p{color:#444;line-height:1.5}
+small{color:#888}
+</style>
+</head>
+<body>
+<main>
+<h1>{{if .Maintenance}}Down for maintenance{{else}}{{.StatusCode}} {{.Status}}{{end}}</h1>
+<p>{{.Message}}</p>
+<small>Request ID: {{.RequestID}}</small>
+</main>
+</body>
+</html>
+`
+
+// defaultJSON is the built-in document for other clients
+const defaultJSON = `{"error": {{json .Status}}, "status": {{.StatusCode}}, "message": {{json .Message}}, "maintenance": {{.Maintenance}}, "request_id": {{json .RequestID}}}
+`
+
+// executor is implemented by HTML and text templates
+type executor interface {
+	Execute(w io.Writer, data interface{}) error
+}
+
+// Pages renders error pages as HTML for browsers and as JSON for other clients
+type Pages struct {
+	html executor
+	json executor
+}
+
+// builtIn are the pages used if no templates are configured, and if a template fails
+var builtIn = func() *Pages {
+	pages, err := Load(nil)
+	if err != nil {
+		panic(err)
+	}
+	return pages
+}()
+
+// Default returns the built-in pages
+func Default() *Pages {
+	return builtIn
+}
+
+// Load parses the templates of a tunnel. The built-in templates are used for the formats
+// without a file, and for all formats if config is nil.
+func Load(config *model.TunnelErrorPages) (*Pages, error) {
+	htmlText, jsonText := defaultHTML, defaultJSON
+	if config != nil && config.HTMLFile != "" {
+		data, err := os.ReadFile(config.HTMLFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read HTML error page: %v", err)
+		}
+		htmlText = string(data)
+	}
+	if config != nil && config.JSONFile != "" {
+		data, err := os.ReadFile(config.JSONFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JSON error page: %v", err)
+		}
+		jsonText = string(data)
+	}
+
+	html, err := htmltemplate.New("html").Parse(htmlText)
+	if err != nil {
+		return nil, fmt.Errorf("invalid HTML error page: %v", err)
+	}
+	jsonTemplate, err := texttemplate.New("json").Funcs(texttemplate.FuncMap{"json": jsonValue}).Parse(jsonText)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON error page: %v", err)
+	}
+
+	// Catch templates that fail or produce invalid JSON now rather than on the first error
+	sample := Data{
+		StatusCode: http.StatusBadGateway,
+		Status:     http.StatusText(http.StatusBadGateway),
+		Message:    MessageUnreachable,
+		RequestID:  "sample",
+		Method:     http.MethodGet,
+		Path:       "/",
+		Host:       "example.com",
+		Time:       time.Now().UTC().Format(time.RFC3339),
+	}
+	if err := html.Execute(io.Discard, sample); err != nil {
+		return nil, fmt.Errorf("invalid HTML error page: %v", err)
+	}
+	var body bytes.Buffer
+	if err := jsonTemplate.Execute(&body, sample); err != nil {
+		return nil, fmt.Errorf("invalid JSON error page: %v", err)
+	}
+	if !json.Valid(body.Bytes()) {
+		return nil, fmt.Errorf("invalid JSON error page: the template does not produce valid JSON")
+	}
+	return &Pages{html: html, json: jsonTemplate}, nil
+}
+
+// Error returns the page for a failed request. If the template fails, the built-in page
+// is served and the error returned.
+func (p *Pages) Error(request *model.HTTPRequest, statusCode int, message string) (*model.HTTPResponse, error) {
+	return p.render(request, newData(request, statusCode, message))
+}
+
+// Maintenance returns the 503 page served in maintenance mode
+func (p *Pages) Maintenance(request *model.HTTPRequest) (*model.HTTPResponse, error) {
+	data := newData(request, http.StatusServiceUnavailable, MessageMaintenance)
+	data.Maintenance = true
+	return p.render(request, data)
+}
+
+// render executes the template of the format the visitor accepts: HTML for browsers and
+// JSON otherwise
+func (p *Pages) render(request *model.HTTPRequest, data Data) (*model.HTTPResponse, error) {
+	template, fallback, contentType := p.json, builtIn.json, "application/json"
+	if strings.Contains(request.Headers.Get("Accept"), "text/html") {
+		template, fallback, contentType = p.html, builtIn.html, "text/html; charset=utf-8"
+	}
+	var body bytes.Buffer
+	err := template.Execute(&body, data)
+	if err != nil {
+		body.Reset()
+		fallback.Execute(&body, data)
+	}
+
+	headers := http.Header{}
+	headers.Set("Content-Type", contentType)
+	headers.Set("Cache-Control", "no-store")
+	return &model.HTTPResponse{
+		ID:         request.ID,
+		StatusCode: data.StatusCode,
+		Headers:    headers,
+		Body:       body.Bytes(),
+	}, err
+}
+
+// newData returns the template data for a request
+func newData(request *model.HTTPRequest, statusCode int, message string) Data {
+	return Data{
+		StatusCode: statusCode,
+		Status:     http.StatusText(statusCode),
+		Message:    message,
+		RequestID:  request.ID,
+		Method:     request.Method,
+		Path:       request.URL,
+		Host:       request.Headers.Get("Host"),
+		Time:       time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+// jsonValue encodes a value as JSON for the JSON template
+func jsonValue(value interface{}) (string, error) {
+	data, err := json.Marshal(value)
+	return string(data), err
+}
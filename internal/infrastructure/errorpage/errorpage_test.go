@@ -0,0 +1,166 @@
+package errorpage
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+)
+
+// writeTemplate writes a template to a file in a temporary directory and returns its path
+func writeTemplate(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func testRequest(accept string) *model.HTTPRequest {
+	headers := http.Header{"Host": {"app.example.net"}}
+	if accept != "" {
+		headers.Set("Accept", accept)
+	}
+	return &model.HTTPRequest{ID: "req-1", Method: http.MethodGet, URL: "/orders", Headers: headers}
+}
+
+func TestLoadValidatesTemplates(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  func(t *testing.T) *model.TunnelErrorPages
+		wantErr string
+	}{
+		{"built-in", func(t *testing.T) *model.TunnelErrorPages { return nil }, ""},
+		{"custom HTML", func(t *testing.T) *model.TunnelErrorPages {
+			return &model.TunnelErrorPages{HTMLFile: writeTemplate(t, "page.html", "<h1>{{.StatusCode}}</h1>")}
+		}, ""},
+		{"custom JSON", func(t *testing.T) *model.TunnelErrorPages {
+			return &model.TunnelErrorPages{JSONFile: writeTemplate(t, "page.json", `{"code": {{.StatusCode}}, "path": {{json .Path}}}`)}
+		}, ""},
+		{"missing HTML file", func(t *testing.T) *model.TunnelErrorPages {
+			return &model.TunnelErrorPages{HTMLFile: filepath.Join(t.TempDir(), "missing.html")}
+		}, "failed to read HTML"},
+		{"missing JSON file", func(t *testing.T) *model.TunnelErrorPages {
+			return &model.TunnelErrorPages{JSONFile: filepath.Join(t.TempDir(), "missing.json")}
+		}, "failed to read JSON"},
+		{"HTML syntax error", func(t *testing.T) *model.TunnelErrorPages {
+			return &model.TunnelErrorPages{HTMLFile: writeTemplate(t, "page.html", "<h1>{{.StatusCode</h1>")}
+		}, "invalid HTML"},
+		{"HTML unknown field", func(t *testing.T) *model.TunnelErrorPages {
+			return &model.TunnelErrorPages{HTMLFile: writeTemplate(t, "page.html", "<h1>{{.Secret}}</h1>")}
+		}, "invalid HTML"},
+		{"JSON syntax error", func(t *testing.T) *model.TunnelErrorPages {
+			return &model.TunnelErrorPages{JSONFile: writeTemplate(t, "page.json", `{"code": {{.StatusCode}`)}
+		}, "invalid JSON"},
+		{"JSON output invalid", func(t *testing.T) *model.TunnelErrorPages {
+			// The message is not quoted, so the output is not JSON
+			return &model.TunnelErrorPages{JSONFile: writeTemplate(t, "page.json", `{"message": {{.Message}}}`)}
+		}, "does not produce valid JSON"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pages, err := Load(tt.config(t))
+			if tt.wantErr == "" {
+				if err != nil || pages == nil {
+					t.Fatalf("Load() = %v, %v, want pages", pages, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPagesFormatByAccept(t *testing.T) {
+	tests := []struct {
+		accept          string
+		wantContentType string
+	}{
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "text/html; charset=utf-8"},
+		{"text/html", "text/html; charset=utf-8"},
+		{"application/json", "application/json"},
+		{"*/*", "application/json"},
+		{"", "application/json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			response, err := Default().Error(testRequest(tt.accept), http.StatusBadGateway, MessageUnreachable)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := response.Headers.Get("Content-Type"); got != tt.wantContentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantContentType)
+			}
+			if response.StatusCode != http.StatusBadGateway || response.ID != "req-1" {
+				t.Errorf("response = %d %q, want 502 for req-1", response.StatusCode, response.ID)
+			}
+			if response.Headers.Get("Cache-Control") != "no-store" {
+				t.Error("error page may be cached")
+			}
+			if !strings.Contains(string(response.Body), "req-1") {
+				t.Errorf("body %q does not contain the request ID", response.Body)
+			}
+		})
+	}
+}
+
+func TestPagesJSON(t *testing.T) {
+	response, err := Default().Maintenance(testRequest("application/json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var document struct {
+		Error       string `json:"error"`
+		Status      int    `json:"status"`
+		Message     string `json:"message"`
+		Maintenance bool   `json:"maintenance"`
+		RequestID   string `json:"request_id"`
+	}
+	if err := json.Unmarshal(response.Body, &document); err != nil {
+		t.Fatalf("invalid JSON %q: %v", response.Body, err)
+	}
+	if document.Status != http.StatusServiceUnavailable || !document.Maintenance || document.Message != MessageMaintenance ||
+		document.Error != "Service Unavailable" || document.RequestID != "req-1" {
+		t.Errorf("document = %+v", document)
+	}
+}
+
+func TestPagesEscapeHTML(t *testing.T) {
+	request := testRequest("text/html")
+	request.ID = "<script>alert(1)</script>"
+	response, err := Default().Error(request, http.StatusBadGateway, MessageUnreachable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(response.Body), "<script>") {
+		t.Errorf("request ID is not escaped: %s", response.Body)
+	}
+}
+
+func TestPagesFallBackToBuiltIn(t *testing.T) {
+	// The template only fails for maintenance pages, after passing the check of Load
+	pages, err := Load(&model.TunnelErrorPages{
+		HTMLFile: writeTemplate(t, "page.html", `{{if .Maintenance}}{{index .Path 99}}{{end}}custom`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := pages.Error(testRequest("text/html"), http.StatusBadGateway, MessageUnreachable)
+	if err != nil || string(response.Body) != "custom" {
+		t.Errorf("Error() = %q, %v, want the custom page", response.Body, err)
+	}
+	response, err = pages.Maintenance(testRequest("text/html"))
+	if err == nil {
+		t.Error("Maintenance() did not return the template error")
+	}
+	if response.StatusCode != http.StatusServiceUnavailable || !strings.Contains(string(response.Body), "Down for maintenance") {
+		t.Errorf("Maintenance() = %d %q, want the built-in page", response.StatusCode, response.Body)
+	}
+}
@@ -0,0 +1,364 @@
+package har
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+	"github.com/haxorport/haxorport-go-client/internal/infrastructure/httpauth"
+)
+
+// Redacted replaces the values of sensitive headers
+const Redacted = "[REDACTED]"
+
+// DefaultRedactedHeaders are the headers whose values are never written to HAR files
+var DefaultRedactedHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"X-Api-Key",
+	"X-Auth-Token",
+}
+
+// DefaultRedactedQueryParameters are the query parameters and form fields whose values
+// are never written to HAR files (compared case-insensitively)
+var DefaultRedactedQueryParameters = []string{
+	"access_token",
+	"api_key",
+	"apikey",
+	"auth",
+	"client_secret",
+	"code",
+	"id_token",
+	"key",
+	"password",
+	"refresh_token",
+	"secret",
+	"sig",
+	"signature",
+	"token",
+}
+
+// redactedQueryParameters is the set of DefaultRedactedQueryParameters
+var redactedQueryParameters = func() map[string]bool {
+	set := make(map[string]bool, len(DefaultRedactedQueryParameters))
+	for _, name := range DefaultRedactedQueryParameters {
+		set[name] = true
+	}
+	return set
+}()
+
+// File is the root of a HAR 1.2 document
+type File struct {
+	Log Log `json:"log"`
+}
+
+// Log contains the recorded entries
+type Log struct {
+	Version string  `json:"version"`
+	Creator Creator `json:"creator"`
+	Entries []Entry `json:"entries"`
+}
+
+// Creator names the application that wrote the file
+type Creator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// Entry is a recorded exchange
+type Entry struct {
+	StartedDateTime string   `json:"startedDateTime"`
+	Time            float64  `json:"time"`
+	Request         Request  `json:"request"`
+	Response        Response `json:"response"`
+	Cache           struct{} `json:"cache"`
+	Timings         Timings  `json:"timings"`
+	ServerIPAddress string   `json:"serverIPAddress,omitempty"`
+	Comment         string   `json:"comment,omitempty"`
+}
+
+// Request is a recorded request
+type Request struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []NameValue `json:"cookies"`
+	Headers     []NameValue `json:"headers"`
+	QueryString []NameValue `json:"queryString"`
+	PostData    *PostData   `json:"postData,omitempty"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int         `json:"bodySize"`
+}
+
+// Response is a recorded response
+type Response struct {
+	Status      int         `json:"status"`
+	StatusText  string      `json:"statusText"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []NameValue `json:"cookies"`
+	Headers     []NameValue `json:"headers"`
+	Content     Content     `json:"content"`
+	RedirectURL string      `json:"redirectURL"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int         `json:"bodySize"`
+	Comment     string      `json:"comment,omitempty"`
+}
+
+// NameValue is a header, cookie or query parameter
+type NameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// PostData is a request body. Binary bodies are base64 encoded and marked with the
+// custom _encoding field, as HAR 1.2 has no encoding for request bodies.
+type PostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Encoding string `json:"_encoding,omitempty"`
+}
+
+// Content is a response body
+type Content struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// Timings are the phases of an exchange in milliseconds
+type Timings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// NewFile returns an empty HAR document
+func NewFile(creatorVersion string) *File {
+	return &File{Log: Log{
+		Version: "1.2",
+		Creator: Creator{Name: "haxorport", Version: creatorVersion},
+		Entries: []Entry{},
+	}}
+}
+
+// Load reads a HAR file
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read HAR file: %v", err)
+	}
+	var file File
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid HAR file %s: %v", path, err)
+	}
+	return &file, nil
+}
+
+// NewEntry converts an exchange to a HAR entry. The values of the redacted headers
+// (canonical names), of sensitive query parameters and form fields, and the body of
+// form auth logins are replaced.
+func NewEntry(exchange *model.HTTPExchange, redact map[string]bool) Entry {
+	entry := Entry{
+		StartedDateTime: exchange.Started.Format(time.RFC3339Nano),
+		Time:            milliseconds(exchange.Duration),
+		Timings:         Timings{Wait: milliseconds(exchange.Duration)},
+	}
+	if exchange.Replay {
+		entry.Comment = "replay"
+	}
+
+	if request := exchange.Request; request != nil {
+		entry.Request = Request{
+			Method:      request.Method,
+			URL:         absoluteURL(request),
+			HTTPVersion: "HTTP/1.1",
+			Cookies:     []NameValue{},
+			Headers:     headerList(request.Headers, redact),
+			QueryString: queryList(request.URL),
+			HeadersSize: -1,
+			BodySize:    len(request.Body),
+		}
+		if len(request.Body) > 0 {
+			entry.Request.PostData = postData(request)
+		}
+	}
+
+	if response := exchange.Response; response != nil {
+		entry.Response = Response{
+			Status:      response.StatusCode,
+			StatusText:  http.StatusText(response.StatusCode),
+			HTTPVersion: "HTTP/1.1",
+			Cookies:     []NameValue{},
+			Headers:     headerList(response.Headers, redact),
+			RedirectURL: response.Headers.Get("Location"),
+			HeadersSize: -1,
+			BodySize:    len(response.Body),
+			Comment:     response.Error,
+		}
+		entry.Response.Content = Content{
+			Size:     len(response.Body),
+			MimeType: response.Headers.Get("Content-Type"),
+		}
+		if len(response.Body) > 0 {
+			entry.Response.Content.Text, entry.Response.Content.Encoding = encodeBody(response.Body)
+		}
+	}
+	return entry
+}
+
+// RedactionSet returns the canonical names of the default redacted headers and extra
+func RedactionSet(extra []string) map[string]bool {
+	redact := make(map[string]bool)
+	for _, name := range append(append([]string{}, DefaultRedactedHeaders...), extra...) {
+		if name = strings.TrimSpace(name); name != "" {
+			redact[http.CanonicalHeaderKey(name)] = true
+		}
+	}
+	return redact
+}
+
+// Body returns the decoded request body of an entry
+func (r Request) Body() ([]byte, error) {
+	if r.PostData == nil {
+		return nil, nil
+	}
+	if r.PostData.Encoding == "base64" {
+		return base64.StdEncoding.DecodeString(r.PostData.Text)
+	}
+	return []byte(r.PostData.Text), nil
+}
+
+// Body returns the decoded response body of an entry
+func (r Response) Body() ([]byte, error) {
+	if r.Content.Encoding == "base64" {
+		return base64.StdEncoding.DecodeString(r.Content.Text)
+	}
+	return []byte(r.Content.Text), nil
+}
+
+// headerList converts headers to a sorted list, redacting sensitive values
+func headerList(headers http.Header, redact map[string]bool) []NameValue {
+	list := []NameValue{}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range headers[name] {
+			if redact[http.CanonicalHeaderKey(name)] {
+				value = Redacted
+			}
+			list = append(list, NameValue{Name: name, Value: value})
+		}
+	}
+	return list
+}
+
+// queryList returns the query parameters of a request URL, redacting sensitive values
+func queryList(requestURL string) []NameValue {
+	list := []NameValue{}
+	u, err := url.ParseRequestURI(requestURL)
+	if err != nil {
+		return list
+	}
+	for _, pair := range strings.Split(u.RawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(pair, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if unescaped, err := url.QueryUnescape(value); err == nil {
+			value = unescaped
+		}
+		if redactedQueryParameters[strings.ToLower(name)] {
+			value = Redacted
+		}
+		list = append(list, NameValue{Name: name, Value: value})
+	}
+	return list
+}
+
+// redactQuery replaces the values of sensitive query parameters in a request URL
+func redactQuery(requestURL string) string {
+	path, query, ok := strings.Cut(requestURL, "?")
+	if !ok {
+		return requestURL
+	}
+	fragment := ""
+	if index := strings.IndexByte(query, '#'); index >= 0 {
+		query, fragment = query[:index], query[index:]
+	}
+	return path + "?" + redactPairs(query) + fragment
+}
+
+// redactPairs replaces the values of sensitive names in URL-encoded name=value pairs
+func redactPairs(encoded string) string {
+	pairs := strings.Split(encoded, "&")
+	for i, pair := range pairs {
+		name, _, _ := strings.Cut(pair, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil && redactedQueryParameters[strings.ToLower(unescaped)] {
+			pairs[i] = name + "=" + url.QueryEscape(Redacted)
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// postData returns the body of a request. The credentials posted to the login page of
+// form auth are dropped and sensitive fields of URL-encoded forms are redacted.
+func postData(request *model.HTTPRequest) *PostData {
+	data := &PostData{MimeType: request.Headers.Get("Content-Type")}
+	if path, _, _ := strings.Cut(request.URL, "?"); path == httpauth.LoginPath {
+		data.Text = Redacted
+		return data
+	}
+	body := request.Body
+	if mediaType, _, _ := mime.ParseMediaType(data.MimeType); mediaType == "application/x-www-form-urlencoded" {
+		body = []byte(redactPairs(string(body)))
+	}
+	data.Text, data.Encoding = encodeBody(body)
+	return data
+}
+
+// absoluteURL returns the URL the visitor requested, without sensitive query values
+func absoluteURL(request *model.HTTPRequest) string {
+	scheme := request.Scheme
+	if scheme == "" {
+		scheme = "https"
+	}
+	host := request.Headers.Get("Host")
+	if host == "" {
+		host = request.Headers.Get("X-Forwarded-Host")
+	}
+	if host == "" {
+		host = fmt.Sprintf("localhost:%d", request.LocalPort)
+	}
+	return scheme + "://" + host + redactQuery(request.URL)
+}
+
+// encodeBody returns a body as text, or base64 encoded if it is binary
+func encodeBody(body []byte) (string, string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
+
+// milliseconds converts a duration to fractional milliseconds
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
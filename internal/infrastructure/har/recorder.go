@@ -0,0 +1,175 @@
+package har
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+	"github.com/haxorport/haxorport-go-client/internal/domain/port"
+)
+
+const (
+	// flushInterval is how often recorded entries are written to the file
+	flushInterval = time.Second
+	// DefaultMaxEntries is the number of entries kept in a HAR file by default
+	DefaultMaxEntries = 1000
+)
+
+// Recorder writes every proxied exchange to a HAR file. The file is rewritten at most
+// once per second if entries were added and when the recorder is closed, so it stays a
+// valid document. Only the latest maxEntries entries are kept; each is encoded once.
+type Recorder struct {
+	path       string
+	redact     map[string]bool
+	logger     port.Logger
+	version    string
+	maxEntries int
+
+	mutex sync.Mutex
+	// entries is a ring of encoded entries; first is the index of the oldest
+	entries []json.RawMessage
+	first   int
+	dropped int
+	dirty   bool
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// encodedFile is a File whose entries are already encoded
+type encodedFile struct {
+	Log encodedLog `json:"log"`
+}
+
+type encodedLog struct {
+	Version string            `json:"version"`
+	Creator Creator           `json:"creator"`
+	Entries []json.RawMessage `json:"entries"`
+}
+
+// NewRecorder creates a recorder writing to path that keeps the latest maxEntries
+// entries (DefaultMaxEntries if 0). The values of the default sensitive headers and
+// query parameters and of the headers in extraRedacted are replaced.
+func NewRecorder(path string, extraRedacted []string, maxEntries int, version string, logger port.Logger) (*Recorder, error) {
+	if maxEntries < 0 {
+		return nil, fmt.Errorf("the maximum number of HAR entries must not be negative")
+	}
+	if maxEntries == 0 {
+		maxEntries = DefaultMaxEntries
+	}
+	r := &Recorder{
+		path:       path,
+		redact:     RedactionSet(extraRedacted),
+		logger:     logger,
+		version:    version,
+		maxEntries: maxEntries,
+		done:       make(chan struct{}),
+	}
+	// Fail early if the file cannot be written
+	if err := r.write(); err != nil {
+		return nil, err
+	}
+
+	r.wg.Add(1)
+	go r.flushLoop()
+	return r, nil
+}
+
+// ObserveHTTPExchange implements port.HTTPObserver
+func (r *Recorder) ObserveHTTPExchange(exchange *model.HTTPExchange) {
+	data, err := json.Marshal(NewEntry(exchange, r.redact))
+	if err != nil {
+		r.logger.Error("Failed to encode HAR entry: %v", err)
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if len(r.entries) < r.maxEntries {
+		r.entries = append(r.entries, data)
+	} else {
+		if r.dropped == 0 {
+			r.logger.Warn("HAR file %s reached %d entries, dropping the oldest ones", r.path, r.maxEntries)
+		}
+		r.entries[r.first] = data
+		r.first = (r.first + 1) % len(r.entries)
+		r.dropped++
+	}
+	r.dirty = true
+}
+
+// Close writes the remaining entries and stops the recorder
+func (r *Recorder) Close() error {
+	close(r.done)
+	r.wg.Wait()
+	return r.flush()
+}
+
+// flushLoop writes new entries periodically
+func (r *Recorder) flushLoop() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.flush(); err != nil {
+				r.logger.Error("Failed to write HAR file: %v", err)
+			}
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// flush writes the file if entries were added since the last write
+func (r *Recorder) flush() error {
+	r.mutex.Lock()
+	dirty := r.dirty
+	r.mutex.Unlock()
+	if !dirty {
+		return nil
+	}
+	return r.write()
+}
+
+// write replaces the file atomically with the current document
+func (r *Recorder) write() error {
+	r.mutex.Lock()
+	entries := make([]json.RawMessage, 0, len(r.entries))
+	entries = append(entries, r.entries[r.first:]...)
+	entries = append(entries, r.entries[:r.first]...)
+	r.dirty = false
+	r.mutex.Unlock()
+
+	log := NewFile(r.version).Log
+	data, err := json.MarshalIndent(encodedFile{Log: encodedLog{
+		Version: log.Version,
+		Creator: log.Creator,
+		Entries: entries,
+	}}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(r.path), ".har-*")
+	if err != nil {
+		return fmt.Errorf("failed to write HAR file: %v", err)
+	}
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		os.Remove(temp.Name())
+		return fmt.Errorf("failed to write HAR file: %v", err)
+	}
+	if err := temp.Close(); err != nil {
+		os.Remove(temp.Name())
+		return fmt.Errorf("failed to write HAR file: %v", err)
+	}
+	if err := os.Rename(temp.Name(), r.path); err != nil {
+		os.Remove(temp.Name())
+		return fmt.Errorf("failed to write HAR file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package har
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+	"github.com/haxorport/haxorport-go-client/internal/infrastructure/httpauth"
+)
+
+// testLogger discards log messages
+type testLogger struct{}
+
+func (testLogger) Debug(string, ...interface{}) {}
+func (testLogger) Info(string, ...interface{})  {}
+func (testLogger) Warn(string, ...interface{})  {}
+func (testLogger) Error(string, ...interface{}) {}
+func (testLogger) SetLevel(string)              {}
+func (testLogger) Close() error                 { return nil }
+
+func testExchange(url string, headers http.Header) *model.HTTPExchange {
+	if headers == nil {
+		headers = http.Header{}
+	}
+	headers.Set("Host", "app.example.net")
+	return &model.HTTPExchange{
+		Request:  &model.HTTPRequest{Method: http.MethodGet, URL: url, Scheme: "https", Headers: headers},
+		Response: &model.HTTPResponse{StatusCode: http.StatusOK, Headers: http.Header{}},
+		Started:  time.Now(),
+	}
+}
+
+func TestRecorderKeepsLatestEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traffic.har")
+	recorder, err := NewRecorder(path, nil, 3, "test", testLogger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		recorder.ObserveHTTPExchange(testExchange(fmt.Sprintf("/%d", i), nil))
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var urls []string
+	for _, entry := range file.Log.Entries {
+		urls = append(urls, entry.Request.URL)
+	}
+	want := []string{"https://app.example.net/2", "https://app.example.net/3", "https://app.example.net/4"}
+	if fmt.Sprint(urls) != fmt.Sprint(want) {
+		t.Errorf("entries = %v, want %v", urls, want)
+	}
+	if file.Log.Version != "1.2" || file.Log.Creator.Version != "test" {
+		t.Errorf("log = %s %+v", file.Log.Version, file.Log.Creator)
+	}
+}
+
+func TestRecorderRejectsNegativeLimit(t *testing.T) {
+	if _, err := NewRecorder(filepath.Join(t.TempDir(), "traffic.har"), nil, -1, "test", testLogger{}); err == nil {
+		t.Error("NewRecorder accepted a negative limit")
+	}
+}
+
+func TestNewEntryRedacts(t *testing.T) {
+	headers := http.Header{}
+	headers.Set("Authorization", "Bearer secret")
+	headers.Set("X-Secret", "secret")
+	headers.Set("Accept", "text/html")
+	entry := NewEntry(testExchange("/callback?code=secret&state=1&Access_Token=secret#top", headers), RedactionSet([]string{"x-secret"}))
+
+	if want := "https://app.example.net/callback?code=%5BREDACTED%5D&state=1&Access_Token=%5BREDACTED%5D#top"; entry.Request.URL != want {
+		t.Errorf("URL = %s, want %s", entry.Request.URL, want)
+	}
+	tests := []struct {
+		list  []NameValue
+		name  string
+		value string
+	}{
+		{entry.Request.Headers, "Authorization", Redacted},
+		{entry.Request.Headers, "X-Secret", Redacted},
+		{entry.Request.Headers, "Accept", "text/html"},
+		{entry.Request.QueryString, "code", Redacted},
+		{entry.Request.QueryString, "Access_Token", Redacted},
+		{entry.Request.QueryString, "state", "1"},
+	}
+	for _, tt := range tests {
+		found := false
+		for _, pair := range tt.list {
+			if pair.Name == tt.name {
+				found = true
+				if pair.Value != tt.value {
+					t.Errorf("%s = %q, want %q", tt.name, pair.Value, tt.value)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("%s is missing", tt.name)
+		}
+	}
+}
+
+func TestRecorderRedactsPostedCredentials(t *testing.T) {
+	post := func(url, contentType, body string) *model.HTTPExchange {
+		exchange := testExchange(url, http.Header{"Content-Type": {contentType}})
+		exchange.Request.Method = http.MethodPost
+		exchange.Request.Body = []byte(body)
+		return exchange
+	}
+	tests := []struct {
+		name     string
+		exchange *model.HTTPExchange
+		want     string
+	}{
+		{"form auth login", post(httpauth.LoginPath, "application/x-www-form-urlencoded", "next=%2F&secret=123456"), Redacted},
+		{"form auth login with query", post(httpauth.LoginPath+"?next=/", "text/plain", "hunter2"), Redacted},
+		{"sensitive form fields", post("/signup", "application/x-www-form-urlencoded; charset=utf-8", "user=alice&Password=hunter2&api_key=k&note=hi"),
+			"user=alice&Password=%5BREDACTED%5D&api_key=%5BREDACTED%5D&note=hi"},
+		{"other content type", post("/api", "application/json", `{"password":"hunter2"}`), `{"password":"hunter2"}`},
+	}
+
+	path := filepath.Join(t.TempDir(), "traffic.har")
+	recorder, err := NewRecorder(path, nil, 0, "test", testLogger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		recorder.ObserveHTTPExchange(tt.exchange)
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+	file, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(file.Log.Entries) != len(tests) {
+		t.Fatalf("%d entries, want %d", len(file.Log.Entries), len(tests))
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := file.Log.Entries[i].Request.PostData
+			if data == nil || data.Text != tt.want {
+				t.Errorf("post data = %+v, want %q", data, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package har
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// skippedHeaders are not sent when replaying, the HTTP client sets them itself
+var skippedHeaders = map[string]bool{
+	"Connection":        true,
+	"Content-Length":    true,
+	"Keep-Alive":        true,
+	"Proxy-Connection":  true,
+	"Te":                true,
+	"Trailer":           true,
+	"Transfer-Encoding": true,
+	"Upgrade":           true,
+	"Accept-Encoding":   true,
+}
+
+// Result is the outcome of replaying an entry
+type Result struct {
+	Method   string
+	Path     string
+	Expected int
+	Status   int
+	Duration time.Duration
+	Err      error
+}
+
+// Matches reports whether the replayed request got the recorded status
+func (r Result) Matches() bool {
+	return r.Err == nil && r.Status == r.Expected
+}
+
+// Player sends the requests of HAR entries to a local service
+type Player struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewPlayer creates a player sending requests to host:port
+func NewPlayer(host string, port int, timeout time.Duration) *Player {
+	return &Player{
+		baseURL: fmt.Sprintf("http://%s:%d", host, port),
+		client: &http.Client{
+			Timeout: timeout,
+			// Compare the recorded redirect, not its target
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// Play sends the request of an entry and returns the outcome. Redacted headers are
+// left out, as their original values are not in the file.
+func (p *Player) Play(entry Entry) Result {
+	result := Result{Method: entry.Request.Method, Expected: entry.Response.Status}
+
+	u, err := url.Parse(entry.Request.URL)
+	if err != nil {
+		result.Err = fmt.Errorf("invalid URL %q: %v", entry.Request.URL, err)
+		return result
+	}
+	result.Path = u.RequestURI()
+
+	body, err := entry.Request.Body()
+	if err != nil {
+		result.Err = fmt.Errorf("invalid request body: %v", err)
+		return result
+	}
+	request, err := http.NewRequest(entry.Request.Method, p.baseURL+result.Path, bytes.NewReader(body))
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	for _, header := range entry.Request.Headers {
+		name := http.CanonicalHeaderKey(header.Name)
+		switch {
+		case header.Value == Redacted, skippedHeaders[name]:
+		case name == "Host":
+			// Like live traffic, the local service sees the public host in X-Forwarded-Host
+			request.Header.Set("X-Forwarded-Host", header.Value)
+		default:
+			request.Header.Add(name, header.Value)
+		}
+	}
+
+	started := time.Now()
+	response, err := p.client.Do(request)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	io.Copy(io.Discard, response.Body)
+	response.Body.Close()
+	result.Status = response.StatusCode
+	result.Duration = time.Since(started)
+	return result
+}
@@ -0,0 +1,230 @@
+package httpauth
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+)
+
+// claimRequirement is a claim a token must contain, optionally with a given value
+type claimRequirement struct {
+	name  string
+	value string
+	exact bool
+}
+
+// claimHeader passes a claim to the local service as a request header
+type claimHeader struct {
+	claim  string
+	header string
+}
+
+// bearerVerifier checks JWT bearer tokens against local keys
+type bearerVerifier struct {
+	keys     keySet
+	issuer   string
+	audience string
+	required []claimRequirement
+	headers  []claimHeader
+}
+
+// newBearerVerifier loads the keys and parses the claim settings of JWT auth
+func newBearerVerifier(auth *model.TunnelAuth) (*bearerVerifier, error) {
+	var keys keySet
+	var err error
+	switch {
+	case auth.JWKSFile != "" && auth.PublicKeyFile != "":
+		return nil, errors.New("JWT auth accepts either a JWKS file or a public key file, not both")
+	case auth.JWKSFile != "":
+		keys, err = loadJWKSFile(auth.JWKSFile)
+	case auth.PublicKeyFile != "":
+		keys, err = loadPublicKeyFile(auth.PublicKeyFile)
+	default:
+		return nil, errors.New("JWT auth requires a JWKS file or a public key file")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	b := &bearerVerifier{
+		keys:     keys,
+		issuer:   auth.Issuer,
+		audience: auth.Audience,
+	}
+	for _, entry := range auth.RequiredClaims {
+		name, value, exact := strings.Cut(strings.TrimSpace(entry), "=")
+		if name == "" {
+			return nil, fmt.Errorf("invalid required claim %q, use name or name=value", entry)
+		}
+		b.required = append(b.required, claimRequirement{name: name, value: value, exact: exact})
+	}
+	for _, entry := range auth.ClaimHeaders {
+		claim, header, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || claim == "" || header == "" {
+			return nil, fmt.Errorf("invalid claim header %q, use claim=Header-Name", entry)
+		}
+		b.headers = append(b.headers, claimHeader{claim: claim, header: http.CanonicalHeaderKey(header)})
+	}
+	return b, nil
+}
+
+// verify checks the bearer token of a request and sets the claim headers. It returns
+// the subject of the token.
+func (b *bearerVerifier) verify(header http.Header) (string, error) {
+	// Never forward claim headers sent by the visitor
+	for _, h := range b.headers {
+		header.Del(h.header)
+	}
+
+	authorization := header.Get("Authorization")
+	scheme, raw, ok := strings.Cut(authorization, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(raw) == "" {
+		return "", ErrMissingCredentials
+	}
+
+	token, err := parseJWT(strings.TrimSpace(raw))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	subject := token.stringClaim("sub")
+	if err := b.keys.verify(token); err != nil {
+		return subject, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	if err := token.validateTimes(time.Now(), tokenLeeway, true); err != nil {
+		return subject, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	if b.issuer != "" && token.stringClaim("iss") != b.issuer {
+		return subject, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidCredentials, token.stringClaim("iss"))
+	}
+	if b.audience != "" && !containsString(token.audience(), b.audience) {
+		return subject, fmt.Errorf("%w: token is not issued for audience %q", ErrInvalidCredentials, b.audience)
+	}
+	for _, requirement := range b.required {
+		if !requirement.satisfiedBy(token.claims[requirement.name]) {
+			return subject, fmt.Errorf("%w: required claim %q is missing or does not match", ErrInvalidCredentials, requirement.name)
+		}
+	}
+
+	for _, h := range b.headers {
+		if value, ok := claimString(token.claims[h.claim]); ok {
+			header.Set(h.header, value)
+		}
+	}
+	return subject, nil
+}
+
+// satisfiedBy reports whether a claim value meets the requirement. For list claims
+// (such as roles or groups) one of the entries must match.
+func (r claimRequirement) satisfiedBy(claim interface{}) bool {
+	if claim == nil {
+		return false
+	}
+	if !r.exact {
+		return true
+	}
+	if list, ok := claim.([]interface{}); ok {
+		for _, entry := range list {
+			if value, ok := claimString(entry); ok && value == r.value {
+				return true
+			}
+		}
+		return false
+	}
+	value, ok := claimString(claim)
+	return ok && value == r.value
+}
+
+// claimString formats a claim value for a comparison or a header. Lists are joined
+// with commas, objects are encoded as JSON.
+func claimString(claim interface{}) (string, bool) {
+	var value string
+	switch v := claim.(type) {
+	case nil:
+		return "", false
+	case string:
+		value = v
+	case json.Number:
+		value = v.String()
+	case bool:
+		value = fmt.Sprint(v)
+	case []interface{}:
+		parts := make([]string, 0, len(v))
+		for _, entry := range v {
+			if s, ok := claimString(entry); ok {
+				parts = append(parts, s)
+			}
+		}
+		value = strings.Join(parts, ",")
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", false
+		}
+		value = string(data)
+	}
+	// Header values cannot contain line breaks
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(value), true
+}
+
+// loadJWKSFile reads the keys of a JWKS file
+func loadJWKSFile(path string) (keySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS file: %v", err)
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return keys, nil
+}
+
+// loadPublicKeyFile reads the keys of a PEM file with public keys (PKIX or PKCS #1)
+// or certificates
+func loadPublicKeyFile(path string) (keySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key file: %v", err)
+	}
+
+	var keys keySet
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		switch block.Type {
+		case "PUBLIC KEY":
+			key, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid public key: %v", path, err)
+			}
+			keys = append(keys, verificationKey{key: key})
+		case "RSA PUBLIC KEY":
+			key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid RSA public key: %v", path, err)
+			}
+			keys = append(keys, verificationKey{key: key})
+		case "CERTIFICATE":
+			certificate, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid certificate: %v", path, err)
+			}
+			keys = append(keys, verificationKey{key: certificate.PublicKey})
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s contains no PEM public key", path)
+	}
+	return keys, nil
+}
@@ -0,0 +1,196 @@
+package httpauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+)
+
+// writePublicKeyFile writes the public key of key to a PEM file and returns its path
+func writePublicKeyFile(t *testing.T, key *ecdsa.PrivateKey) string {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newTestBearerVerifier creates a verifier for the public key of key with the settings of auth
+func newTestBearerVerifier(t *testing.T, key *ecdsa.PrivateKey, auth model.TunnelAuth) *bearerVerifier {
+	t.Helper()
+	auth.PublicKeyFile = writePublicKeyFile(t, key)
+	verifier, err := newBearerVerifier(&auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return verifier
+}
+
+func TestBearerVerifierClaims(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := newTestBearerVerifier(t, key, model.TunnelAuth{
+		Issuer:         "https://issuer.example.net",
+		Audience:       "api",
+		RequiredClaims: []string{"email", "roles=admin", "tenant=acme"},
+	})
+
+	// claims returns valid claims with the given changes; a nil value removes a claim
+	claims := func(changes map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub":    "alice",
+			"iss":    "https://issuer.example.net",
+			"aud":    "api",
+			"exp":    time.Now().Add(time.Hour).Unix(),
+			"email":  "alice@example.net",
+			"roles":  []string{"user", "admin"},
+			"tenant": "acme",
+		}
+		for name, value := range changes {
+			if value == nil {
+				delete(c, name)
+			} else {
+				c[name] = value
+			}
+		}
+		return c
+	}
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+		valid  bool
+	}{
+		{"valid", claims(nil), true},
+		{"audience in list", claims(map[string]interface{}{"aud": []string{"other", "api"}}), true},
+		{"other issuer", claims(map[string]interface{}{"iss": "https://evil.example.net"}), false},
+		{"missing issuer", claims(map[string]interface{}{"iss": nil}), false},
+		{"other audience", claims(map[string]interface{}{"aud": "web"}), false},
+		{"audience list without api", claims(map[string]interface{}{"aud": []string{"web", "mobile"}}), false},
+		{"missing audience", claims(map[string]interface{}{"aud": nil}), false},
+		{"missing required claim", claims(map[string]interface{}{"email": nil}), false},
+		{"required list value missing", claims(map[string]interface{}{"roles": []string{"user"}}), false},
+		{"required list value as string", claims(map[string]interface{}{"roles": "admin"}), true},
+		{"required value differs", claims(map[string]interface{}{"tenant": "other"}), false},
+		{"expired", claims(map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()}), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set("Authorization", "Bearer "+signES(t, key, "ES256", crypto.SHA256, tt.claims))
+			subject, err := verifier.verify(header)
+			if (err == nil) != tt.valid {
+				t.Fatalf("verify() error = %v, want valid %v", err, tt.valid)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidCredentials) {
+				t.Errorf("verify() error = %v, want ErrInvalidCredentials", err)
+			}
+			if subject != "alice" {
+				t.Errorf("subject = %q, want alice", subject)
+			}
+		})
+	}
+}
+
+func TestBearerVerifierClaimHeaders(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := newTestBearerVerifier(t, key, model.TunnelAuth{
+		ClaimHeaders: []string{"sub=X-User", "roles=x-roles", "level=X-Level", "team=X-Team"},
+	})
+	token := signES(t, key, "ES256", crypto.SHA256, map[string]interface{}{
+		"sub":   "alice",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"roles": []string{"user", "admin"},
+		"level": 3,
+	})
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantErr       error
+		want          map[string]string
+	}{
+		{"valid token", "Bearer " + token, nil, map[string]string{
+			"X-User":  "alice",
+			"X-Roles": "user,admin",
+			"X-Level": "3",
+			// The token has no team claim, so the header sent by the visitor is removed
+			"X-Team": "",
+		}},
+		{"lower case scheme", "bearer " + token, nil, map[string]string{"X-User": "alice"}},
+		{"missing token", "", ErrMissingCredentials, map[string]string{"X-User": "", "X-Roles": "", "X-Team": ""}},
+		{"other scheme", "Basic YWxpY2U6c2VjcmV0", ErrMissingCredentials, map[string]string{"X-User": ""}},
+		{"invalid token", "Bearer " + token + "x", ErrInvalidCredentials, map[string]string{"X-User": "", "X-Level": ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Claim headers sent by the visitor must never reach the local service
+			header := http.Header{}
+			for _, name := range []string{"X-User", "X-Roles", "X-Level", "X-Team"} {
+				header.Set(name, "forged")
+			}
+			if tt.authorization != "" {
+				header.Set("Authorization", tt.authorization)
+			}
+			_, err := verifier.verify(header)
+			if tt.wantErr == nil && err != nil || tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("verify() error = %v, want %v", err, tt.wantErr)
+			}
+			for name, want := range tt.want {
+				if got := header.Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewBearerVerifierRejectsInvalidSettings(t *testing.T) {
+	tests := []struct {
+		name string
+		auth model.TunnelAuth
+	}{
+		{"no keys", model.TunnelAuth{}},
+		{"JWKS and public key", model.TunnelAuth{JWKSFile: "keys.json", PublicKeyFile: "key.pem"}},
+		{"missing key file", model.TunnelAuth{PublicKeyFile: filepath.Join(t.TempDir(), "missing.pem")}},
+		{"required claim without name", model.TunnelAuth{RequiredClaims: []string{"=admin"}}},
+		{"claim header without header", model.TunnelAuth{ClaimHeaders: []string{"sub"}}},
+		{"claim header without claim", model.TunnelAuth{ClaimHeaders: []string{"=X-User"}}},
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := writePublicKeyFile(t, key)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := tt.auth
+			if len(auth.RequiredClaims) > 0 || len(auth.ClaimHeaders) > 0 {
+				auth.PublicKeyFile = keyFile
+			}
+			if _, err := newBearerVerifier(&auth); err == nil {
+				t.Error("newBearerVerifier() accepted invalid settings")
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package httpauth
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"html/template"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+)
+
+// LoginPath serves the login page of form auth
+const LoginPath = ReservedPathPrefix + "login"
+
+const (
+	// maxLoginFailures is the number of failed logins after which a visitor address is blocked
+	maxLoginFailures = 5
+	// loginFailureWindow is how long failed logins are counted and an address stays blocked
+	loginFailureWindow = 15 * time.Minute
+	// maxLoginForm limits the size of a login form submission
+	maxLoginForm = 4096
+)
+
+// loginPage is the login page served by form auth
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Login required</title>
+<style>
+body{font-family:system-ui,sans-serif;background:#f4f5f7;display:flex;align-items:center;justify-content:center;min-height:100vh;margin:0}
+form{background:#fff;padding:2rem;border-radius:8px;box-shadow:0 2px 8px rgba(0,0,0,.1);width:100%;max-width:320px}
+h1{font-size:1.25rem;margin:0 0 1rem}
+label{display:block;margin-bottom:.5rem;color:#444}
+input{box-sizing:border-box;width:100%;padding:.6rem;font-size:1rem;border:1px solid #ccc;border-radius:4px}
+button{margin-top:1rem;width:100%;padding:.6rem;font-size:1rem;border:0;border-radius:4px;background:#2563eb;color:#fff}
+.error{color:#b91c1c;margin:0 0 1rem}
+</style>
+</head>
+<body>
+<form method="post" action="{{.Action}}">
+<h1>Login required</h1>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<input type="hidden" name="next" value="{{.Next}}">
+<label for="secret">{{.Label}}</label>
+<input id="secret" name="secret" type="password" autocomplete="{{.Autocomplete}}"{{if .Numeric}} inputmode="numeric"{{end}} autofocus required>
+<button type="submit">Log in</button>
+</form>
+</body>
+</html>
+`))
+
+// totpUse is a TOTP code accepted for a time step
+type totpUse struct {
+	code string
+	step uint64
+}
+
+// loginFailures counts the failed logins of a visitor address
+type loginFailures struct {
+	count int
+	first time.Time
+}
+
+// FormGate serves a login page at LoginPath that accepts a password, a TOTP code or
+// both, and remembers visitors with a session cookie until they log out.
+type FormGate struct {
+	user     string
+	password string
+	totpKey  []byte
+	sessions *sessionCodec
+
+	mutex    sync.Mutex
+	usedTOTP map[totpUse]struct{}
+	failures map[string]*loginFailures
+}
+
+// NewFormGate creates a form auth gate from the auth settings of a tunnel
+func NewFormGate(auth *model.TunnelAuth) (*FormGate, error) {
+	if auth == nil || auth.Type != model.AuthTypeForm {
+		return nil, errors.New("form gate requires form auth")
+	}
+	if auth.Password == "" && auth.TOTPSecret == "" {
+		return nil, errors.New("form auth requires a password or a TOTP secret")
+	}
+
+	g := &FormGate{
+		user:     auth.Username,
+		password: auth.Password,
+		usedTOTP: make(map[totpUse]struct{}),
+		failures: make(map[string]*loginFailures),
+	}
+	if g.user == "" {
+		g.user = "visitor"
+	}
+	if auth.TOTPSecret != "" {
+		key, err := decodeTOTPSecret(auth.TOTPSecret)
+		if err != nil {
+			return nil, err
+		}
+		g.totpKey = key
+	}
+
+	sessions, err := newSessionCodec(DefaultSessionTTL)
+	if err != nil {
+		return nil, err
+	}
+	g.sessions = sessions
+	return g, nil
+}
+
+// Authorize implements Gate
+func (g *FormGate) Authorize(r *http.Request) (string, *Response, error) {
+	defer removeCookies(r.Header, SessionCookie)
+
+	switch r.URL.Path {
+	case LoginPath:
+		if r.Method == http.MethodPost {
+			return g.login(r)
+		}
+		return "", g.page(http.StatusOK, r.URL.Query().Get("next"), ""), nil
+	case LogoutPath:
+		return "", redirectResponse(LoginPath, g.sessions.clear(r)), nil
+	}
+
+	if user, ok := g.sessions.user(r); ok {
+		return user, nil, nil
+	}
+	if strings.HasPrefix(r.URL.Path, ReservedPathPrefix) {
+		return "", textResponse(http.StatusNotFound, ""), nil
+	}
+	if !wantsHTML(r) {
+		return "", textResponse(http.StatusUnauthorized, "Login required"), ErrMissingCredentials
+	}
+	return "", redirectResponse(LoginPath + "?next=" + url.QueryEscape(r.URL.RequestURI())), nil
+}
+
+// login checks a submitted password or TOTP code
+func (g *FormGate) login(r *http.Request) (string, *Response, error) {
+	address := visitorAddress(r.RemoteAddr)
+	if g.blocked(address) {
+		return "", textResponse(http.StatusTooManyRequests, "Too many failed logins, try again later"),
+			errors.New("too many failed logins")
+	}
+	if origin := r.Header.Get("Origin"); origin != "" && origin != "null" && origin != publicBaseURL(r) {
+		return "", textResponse(http.StatusForbidden, ""), errors.New("login form posted from another origin")
+	}
+
+	r.Body = http.MaxBytesReader(nil, r.Body, maxLoginForm)
+	if err := r.ParseForm(); err != nil {
+		return "", textResponse(http.StatusBadRequest, ""), err
+	}
+	next := r.PostForm.Get("next")
+	secret := r.PostForm.Get("secret")
+	if secret == "" {
+		return "", g.page(http.StatusUnauthorized, next, "Please enter your credentials"), ErrMissingCredentials
+	}
+	if !g.check(secret, time.Now()) {
+		g.recordFailure(address)
+		return g.user, g.page(http.StatusUnauthorized, next, "Invalid credentials"), ErrInvalidCredentials
+	}
+
+	g.clearFailures(address)
+	return g.user, redirectResponse(safeReturnPath(next), g.sessions.issue(r, g.user)), nil
+}
+
+// check verifies a password or a TOTP code not used before
+func (g *FormGate) check(secret string, now time.Time) bool {
+	if g.password != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(g.password)) == 1 {
+		return true
+	}
+	if g.totpKey == nil {
+		return false
+	}
+	step, ok := matchTOTP(g.totpKey, secret, now)
+	if !ok {
+		return false
+	}
+
+	// A code may only be used once, so that an observed code cannot be replayed. Other
+	// codes still within the allowed clock skew stay valid.
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	oldest := uint64(now.Unix())/totpPeriod - totpSkew
+	for use := range g.usedTOTP {
+		if use.step < oldest {
+			// The code no longer matches, so it need not be remembered
+			delete(g.usedTOTP, use)
+		}
+	}
+	use := totpUse{code: totpCode(g.totpKey, step), step: step}
+	if _, used := g.usedTOTP[use]; used {
+		return false
+	}
+	g.usedTOTP[use] = struct{}{}
+	return true
+}
+
+// page renders the login page
+func (g *FormGate) page(statusCode int, next, message string) *Response {
+	data := struct {
+		Action       string
+		Next         string
+		Error        string
+		Label        string
+		Autocomplete string
+		Numeric      bool
+	}{
+		Action:       LoginPath,
+		Next:         safeReturnPath(next),
+		Error:        message,
+		Label:        "Password",
+		Autocomplete: "current-password",
+	}
+	switch {
+	case g.totpKey != nil && g.password != "":
+		data.Label = "Password or authentication code"
+	case g.totpKey != nil:
+		data.Label = "Authentication code"
+		data.Autocomplete = "one-time-code"
+		data.Numeric = true
+	}
+
+	var body bytes.Buffer
+	if err := loginPage.Execute(&body, data); err != nil {
+		return textResponse(http.StatusInternalServerError, "")
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "text/html; charset=utf-8")
+	header.Set("Cache-Control", "no-store")
+	header.Set("X-Frame-Options", "DENY")
+	return &Response{StatusCode: statusCode, Header: header, Body: body.Bytes()}
+}
+
+// blocked reports whether an address has failed to log in too often
+func (g *FormGate) blocked(address string) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	failures, ok := g.failures[address]
+	if !ok {
+		return false
+	}
+	if time.Since(failures.first) > loginFailureWindow {
+		delete(g.failures, address)
+		return false
+	}
+	return failures.count >= maxLoginFailures
+}
+
+// recordFailure counts a failed login of an address
+func (g *FormGate) recordFailure(address string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	for key, failures := range g.failures {
+		if time.Since(failures.first) > loginFailureWindow {
+			delete(g.failures, key)
+		}
+	}
+	failures, ok := g.failures[address]
+	if !ok {
+		failures = &loginFailures{first: time.Now()}
+		g.failures[address] = failures
+	}
+	failures.count++
+}
+
+// clearFailures forgets the failed logins of an address after a successful login
+func (g *FormGate) clearFailures(address string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	delete(g.failures, address)
+}
+
+// visitorAddress returns the IP of a visitor address, without the port
+func visitorAddress(remoteAddr string) string {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host
+	}
+	return remoteAddr
+}
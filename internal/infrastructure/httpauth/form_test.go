@@ -0,0 +1,65 @@
+package httpauth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+)
+
+func TestFormGateTOTPCodesUsedOnce(t *testing.T) {
+	gate, err := NewFormGate(&model.TunnelAuth{Type: model.AuthTypeForm, TOTPSecret: totpEncoding.EncodeToString(rfc6238Key)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1234567890, 0)
+	current := uint64(now.Unix()) / totpPeriod
+	code := func(step uint64) string { return totpCode(rfc6238Key, step) }
+
+	steps := []struct {
+		name  string
+		code  string
+		at    time.Time
+		valid bool
+	}{
+		{"current code", code(current), now, true},
+		{"current code again", code(current), now, false},
+		{"current code with spaces", code(current)[:3] + " " + code(current)[3:], now, false},
+		// A code of an earlier step is still unused, for example from a visitor whose clock is late
+		{"previous code", code(current - 1), now, true},
+		{"previous code again", code(current - 1), now, false},
+		{"next code", code(current + 1), now, true},
+		{"wrong code", "000000", now, false},
+		// Once the step has passed, the used code is forgotten but no longer matches either
+		{"current code later", code(current), now.Add(3 * totpPeriod * time.Second), false},
+		{"new code later", code(current + 3), now.Add(3 * totpPeriod * time.Second), true},
+	}
+	for _, step := range steps {
+		if got := gate.check(step.code, step.at); got != step.valid {
+			t.Errorf("%s: check() = %v, want %v", step.name, got, step.valid)
+		}
+	}
+
+	// Only the codes that can still match are remembered
+	gate.mutex.Lock()
+	defer gate.mutex.Unlock()
+	if len(gate.usedTOTP) != 1 {
+		t.Errorf("%d used codes remembered, want 1", len(gate.usedTOTP))
+	}
+}
+
+func TestFormGatePasswordReusable(t *testing.T) {
+	gate, err := NewFormGate(&model.TunnelAuth{Type: model.AuthTypeForm, Password: "secret", TOTPSecret: totpEncoding.EncodeToString(rfc6238Key)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1234567890, 0)
+	for i := 0; i < 2; i++ {
+		if !gate.check("secret", now) {
+			t.Errorf("password rejected on login %d", i+1)
+		}
+	}
+	if gate.check("wrong", now) {
+		t.Error("wrong password accepted")
+	}
+}
@@ -0,0 +1,132 @@
+package httpauth
+
+import (
+	"net/http"
+	"strings"
+)
+
+// ReservedPathPrefix is the path prefix of the endpoints served by the client itself.
+// Requests below it are never forwarded to the local service while a gate is active.
+const ReservedPathPrefix = "/.haxorport/"
+
+// LogoutPath clears the session cookie of a gate
+const LogoutPath = ReservedPathPrefix + "logout"
+
+// Response is a response produced by the client instead of the local service
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// Gate authenticates visitors with a login flow run by the client, such as an
+// OpenID Connect redirect, and remembers them with a session cookie.
+type Gate interface {
+	// Authorize returns the user of an authenticated request. Otherwise it returns the
+	// response to send instead of forwarding the request (a redirect to the login, the
+	// result of a callback...) and, for failed attempts, the error to log. Authorize
+	// removes the cookies of the gate from the request headers.
+	Authorize(r *http.Request) (user string, response *Response, err error)
+}
+
+// publicBaseURL returns the scheme and host the visitor used to reach the tunnel
+func publicBaseURL(r *http.Request) string {
+	scheme := "https"
+	if r.URL != nil && r.URL.Scheme != "" {
+		scheme = r.URL.Scheme
+	} else if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	host := r.Host
+	if host == "" {
+		host = r.Header.Get("X-Forwarded-Host")
+	}
+	return scheme + "://" + host
+}
+
+// isSecure reports whether the visitor uses HTTPS, so that cookies can be marked Secure
+func isSecure(r *http.Request) bool {
+	return strings.HasPrefix(publicBaseURL(r), "https://")
+}
+
+// wantsHTML reports whether the visitor is a browser that can follow a login redirect
+func wantsHTML(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	accept := r.Header.Get("Accept")
+	return accept == "" || strings.Contains(accept, "text/html") || strings.Contains(accept, "*/*")
+}
+
+// safeReturnPath only accepts local paths as the target after a login, so that the
+// login cannot be used as an open redirect
+func safeReturnPath(path string) string {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.HasPrefix(path, "/\\") ||
+		strings.HasPrefix(path, ReservedPathPrefix) {
+		return "/"
+	}
+	return path
+}
+
+// redirectResponse returns a 302 response to location
+func redirectResponse(location string, cookies ...*http.Cookie) *Response {
+	header := http.Header{}
+	header.Set("Location", location)
+	header.Set("Cache-Control", "no-store")
+	for _, cookie := range cookies {
+		header.Add("Set-Cookie", cookie.String())
+	}
+	return &Response{StatusCode: http.StatusFound, Header: header}
+}
+
+// textResponse returns a plain text response with the given status code
+func textResponse(statusCode int, message string) *Response {
+	header := http.Header{}
+	header.Set("Content-Type", "text/plain; charset=utf-8")
+	header.Set("Cache-Control", "no-store")
+	if message == "" {
+		message = http.StatusText(statusCode)
+	}
+	return &Response{StatusCode: statusCode, Header: header, Body: []byte(message + "\n")}
+}
+
+// removeCookies removes the named cookies from the Cookie headers of a request, so
+// that the local service never sees the session of the client
+func removeCookies(header http.Header, names ...string) {
+	values := header.Values("Cookie")
+	if len(values) == 0 {
+		return
+	}
+	header.Del("Cookie")
+	for _, value := range values {
+		var kept []string
+		for _, part := range strings.Split(value, ";") {
+			name, _, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if name == "" || containsString(names, name) {
+				continue
+			}
+			kept = append(kept, strings.TrimSpace(part))
+		}
+		if len(kept) > 0 {
+			header.Add("Cookie", strings.Join(kept, "; "))
+		}
+	}
+}
+
+// RemoveGateHeaders removes what only a gate may set or read from the headers of a
+// request forwarded without one, such as a replay: the session cookies of the client
+// and the X-Forwarded-User header set for the local service
+func RemoveGateHeaders(header http.Header) {
+	removeCookies(header, SessionCookie, oidcStateCookie)
+	header.Del("X-Forwarded-User")
+}
+
+// containsString reports whether values contains value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package httpauth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// LoadHtpasswd reads the users of an htpasswd file. Only bcrypt ($2y$, $2a$, $2b$)
+// and SHA ({SHA}) hashes are supported, as created by `htpasswd -B` and `htpasswd -s`.
+func LoadHtpasswd(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open htpasswd file: %v", err)
+	}
+	defer file.Close()
+
+	users := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		username, hash, ok := strings.Cut(line, ":")
+		if !ok || username == "" || hash == "" {
+			return nil, fmt.Errorf("%s:%d: invalid htpasswd entry", path, lineNumber)
+		}
+		if !supportedHash(hash) {
+			return nil, fmt.Errorf("%s:%d: unsupported password hash for user %q, use bcrypt (htpasswd -B) or SHA (htpasswd -s)",
+				path, lineNumber, username)
+		}
+		users[username] = hash
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read htpasswd file: %v", err)
+	}
+	if len(users) == 0 {
+		return nil, fmt.Errorf("htpasswd file %s contains no users", path)
+	}
+	return users, nil
+}
+
+// supportedHash reports whether an htpasswd hash can be verified
+func supportedHash(hash string) bool {
+	return isBcrypt(hash) || strings.HasPrefix(hash, "{SHA}")
+}
+
+// isBcrypt reports whether hash is a bcrypt hash
+func isBcrypt(hash string) bool {
+	return strings.HasPrefix(hash, "$2y$") || strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$")
+}
+
+// verifyHash checks a password against an htpasswd hash
+func verifyHash(hash, password string) bool {
+	switch {
+	case isBcrypt(hash):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+		expected := "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+		return subtle.ConstantTimeCompare([]byte(hash), []byte(expected)) == 1
+	default:
+		return false
+	}
+}
@@ -0,0 +1,77 @@
+package httpauth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// shaPassword is the {SHA} hash of "password" as created by htpasswd -s
+const shaPassword = "{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g="
+
+func TestLoadHtpasswd(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		users   int
+		wantErr bool
+	}{
+		{"users", "# team\nalice:" + shaPassword + "\n\nbob:$2y$05$abcdefghijklmnopqrstuu\n", 2, false},
+		{"missing hash", "alice:\n", 0, true},
+		{"missing separator", "alice\n", 0, true},
+		{"unsupported hash", "alice:$apr1$salt$hash\n", 0, true},
+		{"crypt hash", "alice:rl0uE5Gq1xMZo\n", 0, true},
+		{"no users", "# empty\n", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), ".htpasswd")
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			users, err := LoadHtpasswd(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadHtpasswd() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(users) != tt.users {
+				t.Errorf("LoadHtpasswd() returned %d users, want %d", len(users), tt.users)
+			}
+		})
+	}
+
+	if _, err := LoadHtpasswd(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("LoadHtpasswd() accepted a missing file")
+	}
+}
+
+func TestVerifyHash(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		hash     string
+		password string
+		want     bool
+	}{
+		{"bcrypt", string(bcryptHash), "password", true},
+		{"bcrypt wrong password", string(bcryptHash), "Password", false},
+		{"bcrypt $2a$", "$2a$" + string(bcryptHash[4:]), "password", true},
+		{"SHA", shaPassword, "password", true},
+		{"SHA wrong password", shaPassword, "secret", false},
+		{"SHA empty password", shaPassword, "", false},
+		{"unsupported", "$apr1$salt$hash", "password", false},
+		{"plain text", "password", "password", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifyHash(tt.hash, tt.password); got != tt.want {
+				t.Errorf("verifyHash() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
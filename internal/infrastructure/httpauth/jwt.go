@@ -0,0 +1,206 @@
+package httpauth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	_ "crypto/sha256" // register SHA-256 for crypto.Hash
+	_ "crypto/sha512" // register SHA-384 and SHA-512 for crypto.Hash
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// jwtHeader is the JOSE header of a JWT
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+// jwtToken is a parsed, not yet verified JWT
+type jwtToken struct {
+	header       jwtHeader
+	claims       map[string]interface{}
+	signingInput string
+	signature    []byte
+}
+
+// parseJWT splits and decodes a compact JWS. The signature is not checked.
+func parseJWT(token string) (*jwtToken, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	headerData, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token header: %v", err)
+	}
+	var header jwtHeader
+	if err := json.Unmarshal(headerData, &header); err != nil {
+		return nil, fmt.Errorf("malformed token header: %v", err)
+	}
+
+	claimsData, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token claims: %v", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(claimsData))
+	decoder.UseNumber()
+	var claims map[string]interface{}
+	if err := decoder.Decode(&claims); err != nil {
+		return nil, fmt.Errorf("malformed token claims: %v", err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token signature: %v", err)
+	}
+
+	return &jwtToken{
+		header:       header,
+		claims:       claims,
+		signingInput: parts[0] + "." + parts[1],
+		signature:    signature,
+	}, nil
+}
+
+// verify checks the signature of the token with key
+func (t *jwtToken) verify(key crypto.PublicKey) error {
+	alg := t.header.Alg
+	if alg == "EdDSA" {
+		edKey, ok := key.(ed25519.PublicKey)
+		if !ok || !ed25519.Verify(edKey, []byte(t.signingInput), t.signature) {
+			return errors.New("invalid token signature")
+		}
+		return nil
+	}
+
+	hash, ok := jwtHash(alg)
+	if !ok {
+		return fmt.Errorf("unsupported token algorithm %q", alg)
+	}
+	h := hash.New()
+	h.Write([]byte(t.signingInput))
+	digest := h.Sum(nil)
+
+	switch alg[:2] {
+	case "RS", "PS":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("token algorithm does not match the key")
+		}
+		var err error
+		if alg[:2] == "RS" {
+			err = rsa.VerifyPKCS1v15(rsaKey, hash, digest, t.signature)
+		} else {
+			err = rsa.VerifyPSS(rsaKey, hash, digest, t.signature, nil)
+		}
+		if err != nil {
+			return errors.New("invalid token signature")
+		}
+	case "ES":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || ecKey.Curve.Params().Name != jwtCurve(alg) {
+			return errors.New("token algorithm does not match the key")
+		}
+		size := (ecKey.Curve.Params().BitSize + 7) / 8
+		if len(t.signature) != 2*size {
+			return errors.New("invalid token signature")
+		}
+		r := new(big.Int).SetBytes(t.signature[:size])
+		s := new(big.Int).SetBytes(t.signature[size:])
+		if !ecdsa.Verify(ecKey, digest, r, s) {
+			return errors.New("invalid token signature")
+		}
+	}
+	return nil
+}
+
+// jwtHash returns the hash of an asymmetric JWS algorithm. "none" and HMAC algorithms
+// are not supported.
+func jwtHash(alg string) (crypto.Hash, bool) {
+	switch alg {
+	case "RS256", "PS256", "ES256":
+		return crypto.SHA256, true
+	case "RS384", "PS384", "ES384":
+		return crypto.SHA384, true
+	case "RS512", "PS512", "ES512":
+		return crypto.SHA512, true
+	default:
+		return 0, false
+	}
+}
+
+// jwtCurve returns the name of the curve an ECDSA algorithm requires
+func jwtCurve(alg string) string {
+	switch alg {
+	case "ES256":
+		return "P-256"
+	case "ES384":
+		return "P-384"
+	case "ES512":
+		return "P-521"
+	default:
+		return ""
+	}
+}
+
+// stringClaim returns a string claim, or "" if it is missing
+func (t *jwtToken) stringClaim(name string) string {
+	value, _ := t.claims[name].(string)
+	return value
+}
+
+// audience returns the aud claim, which may be a string or a list
+func (t *jwtToken) audience() []string {
+	switch aud := t.claims["aud"].(type) {
+	case string:
+		return []string{aud}
+	case []interface{}:
+		var audience []string
+		for _, value := range aud {
+			if s, ok := value.(string); ok {
+				audience = append(audience, s)
+			}
+		}
+		return audience
+	default:
+		return nil
+	}
+}
+
+// timeClaim returns a NumericDate claim such as exp or nbf
+func (t *jwtToken) timeClaim(name string) (time.Time, bool) {
+	number, ok := t.claims[name].(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	seconds, err := number.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(seconds), 0), true
+}
+
+// validateTimes checks the exp and nbf claims. exp is required if requireExp is set.
+func (t *jwtToken) validateTimes(now time.Time, leeway time.Duration, requireExp bool) error {
+	exp, ok := t.timeClaim("exp")
+	if !ok && requireExp {
+		return errors.New("token has no expiry")
+	}
+	if ok && !now.Before(exp.Add(leeway)) {
+		return errors.New("token has expired")
+	}
+	if nbf, ok := t.timeClaim("nbf"); ok && now.Add(leeway).Before(nbf) {
+		return errors.New("token is not valid yet")
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package httpauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// signES returns a JWT signed with an ECDSA key, using alg and hash whatever the curve
+func signES(t *testing.T, key *ecdsa.PrivateKey, alg string, hash crypto.Hash, claims map[string]interface{}) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	h := hash.New()
+	h.Write([]byte(input))
+	r, s, err := ecdsa.Sign(rand.Reader, key, h.Sum(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := (key.Curve.Params().BitSize + 7) / 8
+	signature := make([]byte, 2*size)
+	r.FillBytes(signature[:size])
+	s.FillBytes(signature[size:])
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestJWTVerifyECDSACurve(t *testing.T) {
+	keys := map[string]*ecdsa.PrivateKey{}
+	for name, curve := range map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()} {
+		key, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[name] = key
+	}
+
+	tests := []struct {
+		alg   string
+		hash  crypto.Hash
+		curve string
+		valid bool
+	}{
+		{"ES256", crypto.SHA256, "P-256", true},
+		{"ES384", crypto.SHA384, "P-384", true},
+		{"ES512", crypto.SHA512, "P-521", true},
+		{"ES256", crypto.SHA256, "P-384", false},
+		{"ES384", crypto.SHA384, "P-256", false},
+		{"ES512", crypto.SHA512, "P-384", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.alg+" with "+tt.curve, func(t *testing.T) {
+			key := keys[tt.curve]
+			token, err := parseJWT(signES(t, key, tt.alg, tt.hash, map[string]interface{}{"sub": "1"}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := token.verify(&key.PublicKey); (err == nil) != tt.valid {
+				t.Errorf("verify() error = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestJWTValidateTimes(t *testing.T) {
+	tests := []struct {
+		name       string
+		claims     string
+		requireExp bool
+		valid      bool
+	}{
+		{"valid", `{"exp": 2000}`, true, true},
+		{"expired", `{"exp": 900}`, false, false},
+		{"expired within leeway", `{"exp": 990}`, true, true},
+		{"missing expiry", `{}`, true, false},
+		{"optional expiry", `{}`, false, true},
+		{"not valid yet", `{"nbf": 1200}`, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"ES256"}`))
+			claims := base64.RawURLEncoding.EncodeToString([]byte(tt.claims))
+			token, err := parseJWT(header + "." + claims + ".")
+			if err != nil {
+				t.Fatal(err)
+			}
+			at := time.Unix(1000, 0)
+			if err := token.validateTimes(at, time.Minute, tt.requireExp); (err == nil) != tt.valid {
+				t.Errorf("validateTimes() error = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
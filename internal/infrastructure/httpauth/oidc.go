@@ -0,0 +1,419 @@
+package httpauth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+)
+
+// OIDCCallbackPath is the redirect URI path that must be registered at the identity provider
+const OIDCCallbackPath = ReservedPathPrefix + "oidc/callback"
+
+const (
+	// oidcStateCookie carries a login in progress, signed, in the browser that started it
+	oidcStateCookie = "haxorport_oidc_state"
+	// oidcLoginTTL is how long a visitor has to complete the login at the identity provider
+	oidcLoginTTL = 10 * time.Minute
+	// jwksRefreshInterval limits how often the JWKS is fetched again for unknown key IDs
+	jwksRefreshInterval = time.Minute
+	// tokenLeeway is the allowed clock skew when checking token times
+	tokenLeeway = time.Minute
+	// maxProviderResponse limits the size of discovery, JWKS and token responses
+	maxProviderResponse = 1 << 20
+)
+
+// oidcProvider contains the endpoints of an identity provider, from its discovery document
+type oidcProvider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// pendingLogin is a login waiting for the callback of the identity provider. It is
+// kept in the signed state cookie, so that logins in progress take no memory; the PKCE
+// verifier and the nonce are derived from the state with the key of the gate.
+type pendingLogin struct {
+	State    string `json:"s"`
+	ReturnTo string `json:"r"`
+	Created  int64  `json:"c"`
+}
+
+// OIDCGate sends unauthenticated visitors to an OpenID Connect provider (authorization
+// code flow with PKCE), validates the returned ID token against the JWKS of the issuer
+// and remembers the visitor with a session cookie.
+type OIDCGate struct {
+	config     model.TunnelOIDC
+	issuer     string
+	domains    []string
+	sessions   *sessionCodec
+	httpClient *http.Client
+
+	// mutex guards the cached provider documents; they are fetched without holding it
+	mutex       sync.Mutex
+	provider    *oidcProvider
+	keys        keySet
+	keysFetched time.Time
+}
+
+// NewOIDCGate creates an OIDC gate. The discovery document of the issuer is fetched on
+// the first login, so that the tunnel can start while the provider is unreachable.
+func NewOIDCGate(config *model.TunnelOIDC) (*OIDCGate, error) {
+	if config == nil || config.Issuer == "" || config.ClientID == "" {
+		return nil, errors.New("OIDC requires an issuer and a client ID")
+	}
+	issuer := strings.TrimRight(config.Issuer, "/")
+	u, err := url.Parse(issuer)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid OIDC issuer %q", config.Issuer)
+	}
+	if u.Scheme != "https" && !(u.Scheme == "http" && isLoopbackHost(u.Hostname())) {
+		return nil, fmt.Errorf("OIDC issuer %q must use https", config.Issuer)
+	}
+
+	var domains []string
+	for _, domain := range config.AllowedDomains {
+		domain = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "@"))
+		if domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+
+	sessions, err := newSessionCodec(DefaultSessionTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OIDCGate{
+		config:     *config,
+		issuer:     issuer,
+		domains:    domains,
+		sessions:   sessions,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// Authorize implements Gate
+func (g *OIDCGate) Authorize(r *http.Request) (string, *Response, error) {
+	defer removeCookies(r.Header, SessionCookie, oidcStateCookie)
+
+	switch r.URL.Path {
+	case OIDCCallbackPath:
+		return g.callback(r)
+	case LogoutPath:
+		response := textResponse(http.StatusOK, "Logged out")
+		response.Header.Add("Set-Cookie", g.sessions.clear(r).String())
+		return "", response, nil
+	}
+
+	if user, ok := g.sessions.user(r); ok {
+		return user, nil, nil
+	}
+	if strings.HasPrefix(r.URL.Path, ReservedPathPrefix) {
+		return "", textResponse(http.StatusNotFound, ""), nil
+	}
+	if !wantsHTML(r) {
+		return "", textResponse(http.StatusUnauthorized, "Login required"), ErrMissingCredentials
+	}
+	return g.startLogin(r)
+}
+
+// startLogin redirects the visitor to the authorization endpoint of the provider
+func (g *OIDCGate) startLogin(r *http.Request) (string, *Response, error) {
+	provider, err := g.discover()
+	if err != nil {
+		return "", textResponse(http.StatusBadGateway, "Identity provider unavailable"), err
+	}
+
+	state := randomToken()
+	login := pendingLogin{
+		State:    state,
+		ReturnTo: safeReturnPath(r.URL.RequestURI()),
+		Created:  time.Now().Unix(),
+	}
+
+	challenge := sha256.Sum256([]byte(g.loginSecret("verifier", state)))
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", g.config.ClientID)
+	params.Set("redirect_uri", publicBaseURL(r)+OIDCCallbackPath)
+	params.Set("scope", "openid email profile")
+	params.Set("state", state)
+	params.Set("nonce", g.loginSecret("nonce", state))
+	params.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	params.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(provider.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	stateCookie := &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    g.sessions.seal(login),
+		Path:     OIDCCallbackPath,
+		MaxAge:   int(oidcLoginTTL / time.Second),
+		HttpOnly: true,
+		Secure:   isSecure(r),
+		SameSite: http.SameSiteLaxMode,
+	}
+	return "", redirectResponse(provider.AuthorizationEndpoint+separator+params.Encode(), stateCookie), nil
+}
+
+// callback completes a login: it exchanges the authorization code for an ID token,
+// validates the token and sets the session cookie
+func (g *OIDCGate) callback(r *http.Request) (string, *Response, error) {
+	query := r.URL.Query()
+	if code := query.Get("error"); code != "" {
+		return "", textResponse(http.StatusUnauthorized, "Login failed"),
+			fmt.Errorf("identity provider returned %s: %s", code, query.Get("error_description"))
+	}
+
+	state := query.Get("state")
+	var login pendingLogin
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || state == "" || !g.sessions.open(cookie.Value, &login) ||
+		subtle.ConstantTimeCompare([]byte(login.State), []byte(state)) != 1 {
+		return "", textResponse(http.StatusBadRequest, "Invalid login state, please try again"),
+			errors.New("login state does not match the browser")
+	}
+	if time.Since(time.Unix(login.Created, 0)) > oidcLoginTTL {
+		return "", textResponse(http.StatusBadRequest, "Login expired, please try again"),
+			errors.New("expired login state")
+	}
+
+	provider, err := g.discover()
+	if err != nil {
+		return "", textResponse(http.StatusBadGateway, "Identity provider unavailable"), err
+	}
+	idToken, err := g.exchange(provider, query.Get("code"), g.loginSecret("verifier", state), publicBaseURL(r)+OIDCCallbackPath)
+	if err != nil {
+		return "", textResponse(http.StatusBadGateway, "Login failed"), err
+	}
+	user, err := g.validateIDToken(provider, idToken, g.loginSecret("nonce", state))
+	if err != nil {
+		return user, textResponse(http.StatusForbidden, "Access denied"), err
+	}
+
+	clearState := &http.Cookie{
+		Name:     oidcStateCookie,
+		Path:     OIDCCallbackPath,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   isSecure(r),
+	}
+	return user, redirectResponse(safeReturnPath(login.ReturnTo), g.sessions.issue(r, user), clearState), nil
+}
+
+// exchange redeems an authorization code at the token endpoint and returns the ID token
+func (g *OIDCGate) exchange(provider *oidcProvider, code, verifier, redirectURI string) (string, error) {
+	if code == "" {
+		return "", errors.New("callback without authorization code")
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURI)
+	form.Set("client_id", g.config.ClientID)
+	form.Set("code_verifier", verifier)
+	if g.config.ClientSecret != "" {
+		form.Set("client_secret", g.config.ClientSecret)
+	}
+
+	resp, err := g.httpClient.PostForm(provider.TokenEndpoint, form)
+	if err != nil {
+		return "", fmt.Errorf("token request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxProviderResponse)).Decode(&result); err != nil {
+		return "", fmt.Errorf("invalid token response (status %d): %v", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || result.Error != "" {
+		return "", fmt.Errorf("token request rejected (status %d): %s %s", resp.StatusCode, result.Error, result.ErrorDescription)
+	}
+	if result.IDToken == "" {
+		return "", errors.New("token response contains no ID token")
+	}
+	return result.IDToken, nil
+}
+
+// validateIDToken checks the signature and claims of an ID token and returns the user
+// it identifies (the email address if present, otherwise the subject)
+func (g *OIDCGate) validateIDToken(provider *oidcProvider, idToken, nonce string) (string, error) {
+	token, err := parseJWT(idToken)
+	if err != nil {
+		return "", err
+	}
+	if err := g.verifySignature(provider, token); err != nil {
+		return "", err
+	}
+
+	if iss := token.stringClaim("iss"); iss != provider.Issuer {
+		return "", fmt.Errorf("unexpected token issuer %q", iss)
+	}
+	audience := token.audience()
+	if !containsString(audience, g.config.ClientID) {
+		return "", errors.New("token is not issued for this client")
+	}
+	if azp := token.stringClaim("azp"); len(audience) > 1 && azp != g.config.ClientID {
+		return "", fmt.Errorf("unexpected authorized party %q", azp)
+	}
+	if err := token.validateTimes(time.Now(), tokenLeeway, true); err != nil {
+		return "", err
+	}
+	if subtle.ConstantTimeCompare([]byte(token.stringClaim("nonce")), []byte(nonce)) != 1 {
+		return "", errors.New("token nonce does not match")
+	}
+
+	email := strings.ToLower(token.stringClaim("email"))
+	user := email
+	if user == "" {
+		user = token.stringClaim("sub")
+	}
+	if user == "" {
+		return "", errors.New("token identifies no user")
+	}
+	if len(g.domains) == 0 {
+		return user, nil
+	}
+
+	if email == "" {
+		return user, errors.New("token contains no email address to check the allowed domains")
+	}
+	// Providers may let users enter any address, so only verified ones are trusted
+	verified, _ := token.claims["email_verified"].(bool)
+	if value, ok := token.claims["email_verified"].(string); ok {
+		verified = value == "true"
+	}
+	if !verified {
+		return user, errors.New("email address is not verified")
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 || !containsString(g.domains, email[at+1:]) {
+		return user, fmt.Errorf("email domain of %s is not allowed", email)
+	}
+	return user, nil
+}
+
+// verifySignature checks the token against the JWKS of the provider. The JWKS is
+// fetched again if no key matches, as providers rotate their keys.
+func (g *OIDCGate) verifySignature(provider *oidcProvider, token *jwtToken) error {
+	keys, err := g.signingKeys(provider, false)
+	if err != nil {
+		return err
+	}
+	if len(keys.candidates(token.header)) == 0 {
+		if keys, err = g.signingKeys(provider, true); err != nil {
+			return err
+		}
+	}
+	return keys.verify(token)
+}
+
+// signingKeys returns the cached JWKS of the provider, fetching it if needed
+func (g *OIDCGate) signingKeys(provider *oidcProvider, refresh bool) (keySet, error) {
+	g.mutex.Lock()
+	keys, fetched := g.keys, g.keysFetched
+	g.mutex.Unlock()
+	if keys != nil && (!refresh || time.Since(fetched) < jwksRefreshInterval) {
+		return keys, nil
+	}
+
+	data, err := g.fetch(provider.JWKSURI)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %v", err)
+	}
+	if keys, err = parseJWKS(data); err != nil {
+		return nil, err
+	}
+	g.mutex.Lock()
+	g.keys = keys
+	g.keysFetched = time.Now()
+	g.mutex.Unlock()
+	return keys, nil
+}
+
+// discover returns the endpoints of the provider, fetching the discovery document once
+func (g *OIDCGate) discover() (*oidcProvider, error) {
+	g.mutex.Lock()
+	cached := g.provider
+	g.mutex.Unlock()
+	if cached != nil {
+		return cached, nil
+	}
+
+	data, err := g.fetch(g.issuer + "/.well-known/openid-configuration")
+	if err != nil {
+		return nil, fmt.Errorf("OIDC discovery failed: %v", err)
+	}
+	var provider oidcProvider
+	if err := json.Unmarshal(data, &provider); err != nil {
+		return nil, fmt.Errorf("invalid OIDC discovery document: %v", err)
+	}
+	if strings.TrimRight(provider.Issuer, "/") != g.issuer {
+		return nil, fmt.Errorf("OIDC discovery document is for issuer %q", provider.Issuer)
+	}
+	if provider.AuthorizationEndpoint == "" || provider.TokenEndpoint == "" || provider.JWKSURI == "" {
+		return nil, errors.New("OIDC discovery document is missing endpoints")
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.provider == nil {
+		g.provider = &provider
+	}
+	return g.provider, nil
+}
+
+// fetch downloads a document of the provider
+func (g *OIDCGate) fetch(url string) ([]byte, error) {
+	resp, err := g.httpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned status %d", url, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxProviderResponse))
+}
+
+// loginSecret derives the PKCE verifier or the nonce of a login from its state
+func (g *OIDCGate) loginSecret(purpose, state string) string {
+	return base64.RawURLEncoding.EncodeToString(g.sessions.sign("oidc\n" + purpose + "\n" + state))
+}
+
+// randomToken returns 32 random bytes encoded as base64url
+func randomToken() string {
+	data := make([]byte, 32)
+	if _, err := rand.Read(data); err != nil {
+		panic(fmt.Sprintf("failed to read random bytes: %v", err))
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// isLoopbackHost reports whether host is localhost or a loopback address
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,229 @@
+package httpauth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+)
+
+// mockIssuer is an OpenID Connect provider that answers the token request with an ID
+// token built by the test from the nonce of the login
+type mockIssuer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mutex  sync.Mutex
+	claims func(nonce string) map[string]interface{}
+	nonce  string
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIssuer{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.server.URL,
+			"authorization_endpoint": m.server.URL + "/authorize",
+			"token_endpoint":         m.server.URL + "/token",
+			"jwks_uri":               m.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		m.mutex.Lock()
+		claims := m.claims(m.nonce)
+		m.mutex.Unlock()
+		json.NewEncoder(w).Encode(map[string]string{"id_token": signRS256(t, key, claims)})
+	})
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+// signRS256 returns a JWT with the given claims signed by key
+func signRS256(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(input))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// login runs a login through the gate and returns the result of the callback
+func (m *mockIssuer) login(t *testing.T, g *OIDCGate) (string, *Response, error) {
+	t.Helper()
+	start := httptest.NewRequest(http.MethodGet, "https://app.example.net/private?x=1", nil)
+	start.Header.Set("Accept", "text/html")
+	_, response, err := g.Authorize(start)
+	if err != nil || response == nil || response.StatusCode != http.StatusFound {
+		t.Fatalf("start of login: response %+v, error %v", response, err)
+	}
+	location, err := url.Parse(response.Header.Get("Location"))
+	if err != nil || !strings.HasPrefix(location.String(), m.server.URL+"/authorize?") {
+		t.Fatalf("login redirects to %s", response.Header.Get("Location"))
+	}
+	query := location.Query()
+	m.mutex.Lock()
+	m.nonce = query.Get("nonce")
+	m.mutex.Unlock()
+
+	callback := httptest.NewRequest(http.MethodGet, "https://app.example.net"+OIDCCallbackPath+
+		"?code=code&state="+url.QueryEscape(query.Get("state")), nil)
+	callback.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: responseCookie(response, oidcStateCookie)})
+	return g.Authorize(callback)
+}
+
+// responseCookie returns the value of a cookie set by a response
+func responseCookie(response *Response, name string) string {
+	for _, cookie := range (&http.Response{Header: response.Header}).Cookies() {
+		if cookie.Name == name {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+func TestOIDCGateLogin(t *testing.T) {
+	issuer := newMockIssuer(t)
+	valid := func(nonce string) map[string]interface{} {
+		return map[string]interface{}{
+			"iss":            issuer.server.URL,
+			"aud":            "client",
+			"sub":            "42",
+			"email":          "Jane@Example.com",
+			"email_verified": true,
+			"exp":            time.Now().Add(time.Hour).Unix(),
+			"nonce":          nonce,
+		}
+	}
+	with := func(name string, value interface{}) func(string) map[string]interface{} {
+		return func(nonce string) map[string]interface{} {
+			claims := valid(nonce)
+			if value == nil {
+				delete(claims, name)
+			} else {
+				claims[name] = value
+			}
+			return claims
+		}
+	}
+
+	tests := []struct {
+		name    string
+		domains []string
+		claims  func(nonce string) map[string]interface{}
+		user    string
+		status  int
+	}{
+		{"valid token", nil, valid, "jane@example.com", http.StatusFound},
+		{"allowed domain", []string{"example.com"}, valid, "jane@example.com", http.StatusFound},
+		{"expired token", nil, with("exp", time.Now().Add(-time.Hour).Unix()), "", http.StatusForbidden},
+		{"wrong audience", nil, with("aud", "other"), "", http.StatusForbidden},
+		{"wrong nonce", nil, with("nonce", "other"), "", http.StatusForbidden},
+		{"wrong issuer", nil, with("iss", "https://issuer.example.org"), "", http.StatusForbidden},
+		{"other domain", []string{"example.org"}, valid, "jane@example.com", http.StatusForbidden},
+		{"unverified email", []string{"example.com"}, with("email_verified", false), "jane@example.com", http.StatusForbidden},
+		{"email not known to be verified", []string{"example.com"}, with("email_verified", nil), "jane@example.com", http.StatusForbidden},
+		{"unverified email without restriction", nil, with("email_verified", nil), "jane@example.com", http.StatusFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := NewOIDCGate(&model.TunnelOIDC{Issuer: issuer.server.URL, ClientID: "client", AllowedDomains: tt.domains})
+			if err != nil {
+				t.Fatal(err)
+			}
+			issuer.mutex.Lock()
+			issuer.claims = tt.claims
+			issuer.mutex.Unlock()
+
+			user, response, err := issuer.login(t, g)
+			if response == nil || response.StatusCode != tt.status {
+				t.Fatalf("callback: response %+v, error %v, want status %d", response, err, tt.status)
+			}
+			if user != tt.user {
+				t.Errorf("user = %q, want %q", user, tt.user)
+			}
+			if tt.status != http.StatusFound {
+				if err == nil {
+					t.Error("failed login returned no error")
+				}
+				return
+			}
+			if location := response.Header.Get("Location"); location != "/private?x=1" {
+				t.Errorf("login returns to %s", location)
+			}
+			// The session cookie lets the visitor in
+			request := httptest.NewRequest(http.MethodGet, "https://app.example.net/private", nil)
+			request.AddCookie(&http.Cookie{Name: SessionCookie, Value: responseCookie(response, SessionCookie)})
+			if sessionUser, response, _ := g.Authorize(request); sessionUser != tt.user || response != nil {
+				t.Errorf("session: user %q, response %+v", sessionUser, response)
+			}
+		})
+	}
+}
+
+func TestOIDCGateRejectsForeignState(t *testing.T) {
+	issuer := newMockIssuer(t)
+	g, err := NewOIDCGate(&model.TunnelOIDC{Issuer: issuer.server.URL, ClientID: "client"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewOIDCGate(&model.TunnelOIDC{Issuer: issuer.server.URL, ClientID: "client"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		cookie string
+	}{
+		{"no cookie", ""},
+		{"unsigned cookie", "state"},
+		{"cookie of another gate", other.sessions.seal(pendingLogin{State: "state", Created: time.Now().Unix()})},
+		{"expired login", g.sessions.seal(pendingLogin{State: "state", Created: time.Now().Add(-time.Hour).Unix()})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "https://app.example.net"+OIDCCallbackPath+"?code=code&state=state", nil)
+			if tt.cookie != "" {
+				request.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: tt.cookie})
+			}
+			user, response, err := g.Authorize(request)
+			if user != "" || err == nil || response == nil || response.StatusCode != http.StatusBadRequest {
+				t.Errorf("callback: user %q, response %+v, error %v", user, response, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package httpauth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SessionCookie is the name of the session cookie set by gates
+const SessionCookie = "haxorport_session"
+
+// DefaultSessionTTL is how long a session stays valid after a login
+const DefaultSessionTTL = 12 * time.Hour
+
+// sessionClaims is the content of a session cookie
+type sessionClaims struct {
+	User    string `json:"u"`
+	Expires int64  `json:"e"`
+}
+
+// sessionCodec issues and checks HMAC-signed, expiring session cookies. The key is
+// random, so sessions end when the client restarts.
+type sessionCodec struct {
+	key []byte
+	ttl time.Duration
+}
+
+// newSessionCodec creates a session codec with a random key
+func newSessionCodec(ttl time.Duration) (*sessionCodec, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if ttl <= 0 {
+		ttl = DefaultSessionTTL
+	}
+	return &sessionCodec{key: key, ttl: ttl}, nil
+}
+
+// issue returns a session cookie for user
+func (s *sessionCodec) issue(r *http.Request, user string) *http.Cookie {
+	expires := time.Now().Add(s.ttl)
+	return &http.Cookie{
+		Name:     SessionCookie,
+		Value:    s.seal(sessionClaims{User: user, Expires: expires.Unix()}),
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   isSecure(r),
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// clear returns a cookie that removes the session
+func (s *sessionCodec) clear(r *http.Request) *http.Cookie {
+	return &http.Cookie{
+		Name:     SessionCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   isSecure(r),
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// user returns the user of a valid, unexpired session cookie
+func (s *sessionCodec) user(r *http.Request) (string, bool) {
+	cookie, err := r.Cookie(SessionCookie)
+	if err != nil {
+		return "", false
+	}
+	var claims sessionClaims
+	if !s.open(cookie.Value, &claims) || claims.User == "" {
+		return "", false
+	}
+	if time.Now().Unix() >= claims.Expires {
+		return "", false
+	}
+	return claims.User, true
+}
+
+// seal encodes a value as JSON and signs it, for a cookie
+func (s *sessionCodec) seal(value interface{}) string {
+	data, _ := json.Marshal(value)
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(s.sign(payload))
+}
+
+// open checks the signature of a sealed cookie value and decodes it into value
+func (s *sessionCodec) open(sealed string, value interface{}) bool {
+	payload, signature, ok := strings.Cut(sealed, ".")
+	if !ok {
+		return false
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, s.sign(payload)) {
+		return false
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(data, value) == nil
+}
+
+// sign returns the HMAC of a cookie payload
+func (s *sessionCodec) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,109 @@
+package httpauth
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Key is the SHA-1 key of the test vectors of RFC 6238
+var rfc6238Key = []byte("12345678901234567890")
+
+func TestTOTPCode(t *testing.T) {
+	// The last six digits of the SHA-1 test vectors of RFC 6238, appendix B
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			if got := totpCode(rfc6238Key, uint64(tt.unix)/totpPeriod); got != tt.code {
+				t.Errorf("totpCode() = %s, want %s", got, tt.code)
+			}
+		})
+	}
+}
+
+func TestMatchTOTP(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	current := uint64(now.Unix()) / totpPeriod
+
+	tests := []struct {
+		name  string
+		code  string
+		step  uint64
+		match bool
+	}{
+		{"current step", totpCode(rfc6238Key, current), current, true},
+		{"previous step", totpCode(rfc6238Key, current-1), current - 1, true},
+		{"next step", totpCode(rfc6238Key, current+1), current + 1, true},
+		{"with spaces", " " + totpCode(rfc6238Key, current)[:3] + " " + totpCode(rfc6238Key, current)[3:], current, true},
+		{"too old", totpCode(rfc6238Key, current-2), 0, false},
+		{"too new", totpCode(rfc6238Key, current+2), 0, false},
+		{"too short", totpCode(rfc6238Key, current)[:5], 0, false},
+		{"empty", "", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := matchTOTP(rfc6238Key, tt.code, now)
+			if ok != tt.match || step != tt.step {
+				t.Errorf("matchTOTP() = %d, %v, want %d, %v", step, ok, tt.step, tt.match)
+			}
+		})
+	}
+}
+
+func TestDecodeTOTPSecret(t *testing.T) {
+	tests := []struct {
+		secret  string
+		want    string
+		wantErr bool
+	}{
+		{"GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", string(rfc6238Key), false},
+		{"gezd gnbv gy3t qojq gezd gnbv gy3t qojq", string(rfc6238Key), false},
+		{"MZXW6===", "foo", false},
+		{"", "", true},
+		{"not base32!", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.secret, func(t *testing.T) {
+			key, err := decodeTOTPSecret(tt.secret)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeTOTPSecret() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(key) != tt.want {
+				t.Errorf("decodeTOTPSecret() = %q, want %q", key, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := decodeTOTPSecret(secret)
+	if err != nil || len(key) != 20 {
+		t.Fatalf("generated secret %q decodes to %d bytes, %v", secret, len(key), err)
+	}
+
+	uri, err := url.Parse(TOTPURI(secret, "app.example.net"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || !strings.HasSuffix(uri.Path, "Haxorport:app.example.net") {
+		t.Errorf("TOTPURI() = %s", uri)
+	}
+	if uri.Query().Get("secret") != secret || uri.Query().Get("digits") != "6" || uri.Query().Get("period") != "30" {
+		t.Errorf("TOTPURI() parameters = %v", uri.Query())
+	}
+}
@@ -0,0 +1,149 @@
+package httpauth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+)
+
+var (
+	// ErrMissingCredentials is returned when a request carries no credentials
+	ErrMissingCredentials = errors.New("missing credentials")
+	// ErrInvalidCredentials is returned when the credentials of a request are wrong
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Realm is the realm announced to browsers for basic authentication
+const Realm = "haxorport"
+
+// Verifier checks the credentials of HTTP requests against the auth settings of a tunnel.
+// It is used by the client as a second line of defense next to the server.
+type Verifier struct {
+	authType model.AuthType
+	// users maps usernames to htpasswd hashes (basic auth)
+	users map[string]string
+	// plainUser and plainPassword are the single configured user (basic auth, optional)
+	plainUser     string
+	plainPassword string
+	// headerName and headerValues are the accepted header values or API keys (header auth)
+	headerName   string
+	headerValues []string
+	// bearer checks JWT bearer tokens (JWT auth)
+	bearer *bearerVerifier
+}
+
+// NewVerifier creates a Verifier for the auth settings of a tunnel. It returns nil if
+// auth is nil. The htpasswd file, if any, is read once when the verifier is created.
+func NewVerifier(auth *model.TunnelAuth) (*Verifier, error) {
+	if auth == nil {
+		return nil, nil
+	}
+
+	v := &Verifier{authType: auth.Type}
+	switch auth.Type {
+	case model.AuthTypeBasic:
+		if auth.HtpasswdFile != "" {
+			users, err := LoadHtpasswd(auth.HtpasswdFile)
+			if err != nil {
+				return nil, err
+			}
+			v.users = users
+		}
+		v.plainUser = auth.Username
+		v.plainPassword = auth.Password
+		if len(v.users) == 0 && (v.plainUser == "" || v.plainPassword == "") {
+			return nil, fmt.Errorf("basic auth requires a username and password or an htpasswd file")
+		}
+	case model.AuthTypeHeader:
+		if auth.HeaderName == "" {
+			return nil, fmt.Errorf("header auth requires a header name")
+		}
+		v.headerName = auth.HeaderName
+		if auth.HeaderValue != "" {
+			v.headerValues = append(v.headerValues, auth.HeaderValue)
+		}
+		for _, value := range auth.HeaderValues {
+			if value = strings.TrimSpace(value); value != "" {
+				v.headerValues = append(v.headerValues, value)
+			}
+		}
+		if len(v.headerValues) == 0 {
+			return nil, fmt.Errorf("header auth requires at least one accepted value")
+		}
+	case model.AuthTypeJWT:
+		bearer, err := newBearerVerifier(auth)
+		if err != nil {
+			return nil, err
+		}
+		v.bearer = bearer
+	default:
+		return nil, fmt.Errorf("unsupported auth type: %s", auth.Type)
+	}
+	return v, nil
+}
+
+// Verify checks the credentials in the request headers. It returns the authenticated
+// username for basic auth or the subject for JWT auth, or an error wrapping
+// ErrMissingCredentials / ErrInvalidCredentials. For JWT auth the configured claim
+// headers are set in header, replacing any sent by the visitor.
+func (v *Verifier) Verify(header http.Header) (string, error) {
+	if v.authType == model.AuthTypeJWT {
+		return v.bearer.verify(header)
+	}
+	if v.authType == model.AuthTypeHeader {
+		value := header.Get(v.headerName)
+		if value == "" {
+			return "", ErrMissingCredentials
+		}
+		// Compare against every value so that the time does not reveal which one matched
+		matched := 0
+		for _, accepted := range v.headerValues {
+			matched |= subtle.ConstantTimeCompare([]byte(value), []byte(accepted))
+		}
+		if matched != 1 {
+			return "", ErrInvalidCredentials
+		}
+		return "", nil
+	}
+
+	request := http.Request{Header: header}
+	username, password, ok := request.BasicAuth()
+	if !ok {
+		return "", ErrMissingCredentials
+	}
+	if hash, exists := v.users[username]; exists && verifyHash(hash, password) {
+		return username, nil
+	}
+	if v.plainUser != "" &&
+		subtle.ConstantTimeCompare([]byte(username), []byte(v.plainUser)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(password), []byte(v.plainPassword)) == 1 {
+		return username, nil
+	}
+	return username, ErrInvalidCredentials
+}
+
+// Challenge returns the headers of a 401 response asking for credentials
+func (v *Verifier) Challenge() http.Header {
+	header := http.Header{}
+	header.Set("Content-Type", "text/plain; charset=utf-8")
+	switch v.authType {
+	case model.AuthTypeBasic:
+		header.Set("WWW-Authenticate", fmt.Sprintf(`Basic realm="%s", charset="UTF-8"`, Realm))
+	case model.AuthTypeJWT:
+		header.Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s"`, Realm))
+	}
+	return header
+}
+
+// ServerEnforceable reports whether the server can enforce auth by itself. Multiple
+// users, extra header values, form logins and JWT keys are only known to the client.
+func ServerEnforceable(auth *model.TunnelAuth) bool {
+	if auth == nil || auth.Type == model.AuthTypeForm || auth.Type == model.AuthTypeJWT {
+		return false
+	}
+	return auth.HtpasswdFile == "" && len(auth.HeaderValues) == 0
+}
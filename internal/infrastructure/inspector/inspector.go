@@ -0,0 +1,279 @@
+package inspector
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+	"github.com/haxorport/haxorport-go-client/internal/domain/port"
+)
+
+const (
+	// DefaultAddress is the address of the inspector web UI
+	DefaultAddress = "127.0.0.1:4040"
+	// DefaultCapacity is the number of exchanges kept
+	DefaultCapacity = 200
+	// DefaultMaxBodySize is the number of body bytes kept per request and response
+	DefaultMaxBodySize = 64 * 1024
+	// subscriberBuffer is the number of events buffered per live subscriber
+	subscriberBuffer = 64
+)
+
+// Record is an exchange kept by the inspector
+type Record struct {
+	ID                int64
+	Exchange          *model.HTTPExchange
+	RequestSize       int
+	ResponseSize      int
+	RequestTruncated  bool
+	ResponseTruncated bool
+}
+
+// Summary describes a record in lists and live updates
+type Summary struct {
+	ID         int64     `json:"id"`
+	Started    time.Time `json:"started"`
+	DurationMs float64   `json:"duration_ms"`
+	Method     string    `json:"method"`
+	URL        string    `json:"url"`
+	Path       string    `json:"path"`
+	Status     int       `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	RemoteAddr string    `json:"remote_addr"`
+	Replay     bool      `json:"replay,omitempty"`
+}
+
+// Detail is a record with headers and bodies
+type Detail struct {
+	Summary
+	TunnelID string  `json:"tunnel_id"`
+	Request  Message `json:"request"`
+	Response Message `json:"response"`
+}
+
+// Message contains the headers and body of a request or response
+type Message struct {
+	Headers   http.Header `json:"headers"`
+	Body      string      `json:"body"`
+	Binary    bool        `json:"binary,omitempty"`
+	Size      int         `json:"size"`
+	Truncated bool        `json:"truncated,omitempty"`
+}
+
+// Inspector keeps the recent exchanges of HTTP tunnels in a ring buffer and shows them
+// in a local web UI
+type Inspector struct {
+	logger      port.Logger
+	capacity    int
+	maxBodySize int
+
+	mutex       sync.Mutex
+	records     []*Record
+	next        int
+	lastID      int64
+	subscribers map[chan Summary]struct{}
+	server      *http.Server
+	replayer    Replayer
+}
+
+// NewInspector creates an inspector keeping capacity exchanges with bodies of up to
+// maxBodySize bytes
+func NewInspector(capacity, maxBodySize int, logger port.Logger) *Inspector {
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+	if maxBodySize < 0 {
+		maxBodySize = DefaultMaxBodySize
+	}
+	return &Inspector{
+		logger:      logger,
+		capacity:    capacity,
+		maxBodySize: maxBodySize,
+		subscribers: make(map[chan Summary]struct{}),
+	}
+}
+
+// ObserveHTTPExchange implements port.HTTPObserver
+func (i *Inspector) ObserveHTTPExchange(exchange *model.HTTPExchange) {
+	record := &Record{Exchange: &model.HTTPExchange{
+		Started:  exchange.Started,
+		Duration: exchange.Duration,
+		Replay:   exchange.Replay,
+	}}
+
+	// Keep copies with limited bodies, the exchange belongs to the caller
+	if exchange.Request != nil {
+		request := *exchange.Request
+		record.RequestSize = len(request.Body)
+		request.Body, record.RequestTruncated = i.limitBody(request.Body)
+		record.Exchange.Request = &request
+	}
+	if exchange.Response != nil {
+		response := *exchange.Response
+		record.ResponseSize = len(response.Body)
+		response.Body, record.ResponseTruncated = i.limitBody(response.Body)
+		record.Exchange.Response = &response
+	}
+
+	i.mutex.Lock()
+	i.lastID++
+	record.ID = i.lastID
+	if len(i.records) < i.capacity {
+		i.records = append(i.records, record)
+	} else {
+		i.records[i.next] = record
+		i.next = (i.next + 1) % i.capacity
+	}
+	summary := record.Summary()
+	for subscriber := range i.subscribers {
+		select {
+		case subscriber <- summary:
+		default:
+			// A slow browser must not block requests, it misses this update
+		}
+	}
+	i.mutex.Unlock()
+}
+
+// limitBody returns a copy of body of at most maxBodySize bytes
+func (i *Inspector) limitBody(body []byte) ([]byte, bool) {
+	if len(body) > i.maxBodySize {
+		return append([]byte(nil), body[:i.maxBodySize]...), true
+	}
+	return append([]byte(nil), body...), false
+}
+
+// Records returns the kept records matching the filter, newest first
+func (i *Inspector) Records(filter Filter) []*Record {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	records := make([]*Record, 0, len(i.records))
+	for n := len(i.records) - 1; n >= 0; n-- {
+		record := i.records[(i.next+n)%len(i.records)]
+		if filter.Matches(record.Summary()) {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// Record returns a kept record by ID
+func (i *Inspector) Record(id int64) (*Record, bool) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	for _, record := range i.records {
+		if record.ID == id {
+			return record, true
+		}
+	}
+	return nil, false
+}
+
+// subscribe registers a channel receiving the summaries of new records
+func (i *Inspector) subscribe() chan Summary {
+	ch := make(chan Summary, subscriberBuffer)
+	i.mutex.Lock()
+	i.subscribers[ch] = struct{}{}
+	i.mutex.Unlock()
+	return ch
+}
+
+// unsubscribe removes a channel registered with subscribe
+func (i *Inspector) unsubscribe(ch chan Summary) {
+	i.mutex.Lock()
+	delete(i.subscribers, ch)
+	i.mutex.Unlock()
+}
+
+// Summary returns the summary of a record
+func (r *Record) Summary() Summary {
+	summary := Summary{
+		ID:         r.ID,
+		Started:    r.Exchange.Started,
+		DurationMs: float64(r.Exchange.Duration.Microseconds()) / 1000,
+		Replay:     r.Exchange.Replay,
+	}
+	if request := r.Exchange.Request; request != nil {
+		summary.Method = request.Method
+		summary.URL = request.URL
+		summary.Path = request.URL
+		if u, err := url.ParseRequestURI(request.URL); err == nil {
+			summary.Path = u.Path
+		}
+		summary.RemoteAddr = request.RemoteAddr
+	}
+	if response := r.Exchange.Response; response != nil {
+		summary.Status = response.StatusCode
+		summary.Error = response.Error
+	}
+	return summary
+}
+
+// Detail returns the record with headers and bodies
+func (r *Record) Detail() Detail {
+	detail := Detail{Summary: r.Summary()}
+	if request := r.Exchange.Request; request != nil {
+		detail.TunnelID = request.TunnelID
+		detail.Request = newMessage(request.Headers, request.Body, r.RequestSize, r.RequestTruncated)
+	}
+	if response := r.Exchange.Response; response != nil {
+		detail.Response = newMessage(response.Headers, response.Body, r.ResponseSize, r.ResponseTruncated)
+	}
+	return detail
+}
+
+// newMessage describes headers and a body for the UI. Binary bodies are not shown.
+func newMessage(headers http.Header, body []byte, size int, truncated bool) Message {
+	message := Message{Headers: headers, Size: size, Truncated: truncated}
+	if message.Headers == nil {
+		message.Headers = http.Header{}
+	}
+	if truncated {
+		body = trimPartialRune(body)
+	}
+	if utf8.Valid(body) {
+		message.Body = string(body)
+	} else {
+		message.Binary = true
+	}
+	return message
+}
+
+// trimPartialRune removes a UTF-8 sequence cut off by truncation
+func trimPartialRune(body []byte) []byte {
+	for n := 0; n < utf8.UTFMax && len(body) > 0; n++ {
+		if utf8.Valid(body) {
+			break
+		}
+		body = body[:len(body)-1]
+	}
+	return body
+}
+
+// Filter selects records by path and status
+type Filter struct {
+	// Path is a substring of the request path (empty for all)
+	Path string
+	// Status is an exact status code such as 404 or a class such as 5xx (empty for all)
+	Status string
+}
+
+// Matches reports whether a record summary matches the filter
+func (f Filter) Matches(summary Summary) bool {
+	if f.Path != "" && !strings.Contains(summary.Path, f.Path) {
+		return false
+	}
+	status := strings.ToLower(strings.TrimSpace(f.Status))
+	if status == "" {
+		return true
+	}
+	if len(status) == 3 && strings.HasSuffix(status, "xx") {
+		return strconv.Itoa(summary.Status/100) == status[:1]
+	}
+	return strconv.Itoa(summary.Status) == status
+}
@@ -0,0 +1,192 @@
+package inspector
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+)
+
+type testLogger struct{}
+
+func (testLogger) Debug(string, ...interface{}) {}
+func (testLogger) Info(string, ...interface{})  {}
+func (testLogger) Warn(string, ...interface{})  {}
+func (testLogger) Error(string, ...interface{}) {}
+func (testLogger) SetLevel(string)              {}
+func (testLogger) Close() error                 { return nil }
+
+func testExchange(url string, statusCode int, requestBody, responseBody string) *model.HTTPExchange {
+	return &model.HTTPExchange{
+		Request:  &model.HTTPRequest{ID: url, Method: "POST", URL: url, Headers: http.Header{"Content-Type": {"text/plain"}}, Body: []byte(requestBody)},
+		Response: &model.HTTPResponse{StatusCode: statusCode, Headers: http.Header{}, Body: []byte(responseBody)},
+		Started:  time.Now(),
+		Duration: 1500 * time.Microsecond,
+	}
+}
+
+// recordIDs returns the IDs of records in order
+func recordIDs(records []*Record) []int64 {
+	ids := make([]int64, 0, len(records))
+	for _, record := range records {
+		ids = append(ids, record.ID)
+	}
+	return ids
+}
+
+func TestInspectorRingBuffer(t *testing.T) {
+	inspector := NewInspector(3, DefaultMaxBodySize, testLogger{})
+	for n := 1; n <= 5; n++ {
+		inspector.ObserveHTTPExchange(testExchange("/"+strconv.Itoa(n), http.StatusOK, "", ""))
+		// The newest record comes first and only the last three are kept
+		want := []int64{}
+		for id := int64(n); id >= 1 && id > int64(n)-3; id-- {
+			want = append(want, id)
+		}
+		if got := recordIDs(inspector.Records(Filter{})); !equalIDs(got, want) {
+			t.Fatalf("after %d exchanges Records() = %v, want %v", n, got, want)
+		}
+	}
+
+	if _, ok := inspector.Record(2); ok {
+		t.Error("Record(2) was kept after being overwritten")
+	}
+	record, ok := inspector.Record(4)
+	if !ok || record.Exchange.Request.URL != "/4" {
+		t.Errorf("Record(4) = %+v, %v, want /4", record, ok)
+	}
+}
+
+func equalIDs(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for n := range a {
+		if a[n] != b[n] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestInspectorCopiesExchange(t *testing.T) {
+	inspector := NewInspector(0, DefaultMaxBodySize, testLogger{})
+	exchange := testExchange("/hook", http.StatusOK, "request", "response")
+	inspector.ObserveHTTPExchange(exchange)
+
+	// The caller may reuse the body buffers after the exchange was observed
+	copy(exchange.Request.Body, "XXXXXXX")
+	copy(exchange.Response.Body, "XXXXXXXX")
+	record, _ := inspector.Record(1)
+	if detail := record.Detail(); detail.Request.Body != "request" || detail.Response.Body != "response" {
+		t.Errorf("bodies = %q, %q, want the observed bodies", detail.Request.Body, detail.Response.Body)
+	}
+}
+
+func TestInspectorTruncatesBodies(t *testing.T) {
+	tests := []struct {
+		name          string
+		maxBodySize   int
+		body          string
+		wantBody      string
+		wantTruncated bool
+		wantBinary    bool
+	}{
+		{"short body", 8, "hello", "hello", false, false},
+		{"exact size", 5, "hello", "hello", false, false},
+		{"long body", 4, "hello world", "hell", true, false},
+		{"no bodies kept", 0, "hello", "", true, false},
+		// A multi-byte character cut by the limit is dropped instead of shown as binary
+		{"cut character", 7, "héllo wörld", "héllo ", true, false},
+		{"cut four byte character", 6, "abcd😀", "abcd", true, false},
+		{"binary body", 8, "\xff\xfe\x00\x01", "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inspector := NewInspector(0, tt.maxBodySize, testLogger{})
+			inspector.ObserveHTTPExchange(testExchange("/", http.StatusOK, tt.body, tt.body))
+			record, ok := inspector.Record(1)
+			if !ok {
+				t.Fatal("the exchange was not kept")
+			}
+			if record.RequestSize != len(tt.body) || record.ResponseSize != len(tt.body) {
+				t.Errorf("sizes = %d, %d, want %d", record.RequestSize, record.ResponseSize, len(tt.body))
+			}
+			if len(record.Exchange.Request.Body) > tt.maxBodySize {
+				t.Errorf("kept %d body bytes, limit is %d", len(record.Exchange.Request.Body), tt.maxBodySize)
+			}
+			detail := record.Detail()
+			for _, message := range []Message{detail.Request, detail.Response} {
+				if message.Body != tt.wantBody || message.Truncated != tt.wantTruncated || message.Binary != tt.wantBinary {
+					t.Errorf("message = %q truncated %v binary %v, want %q truncated %v binary %v",
+						message.Body, message.Truncated, message.Binary, tt.wantBody, tt.wantTruncated, tt.wantBinary)
+				}
+				if message.Size != len(tt.body) {
+					t.Errorf("Size = %d, want %d", message.Size, len(tt.body))
+				}
+			}
+		})
+	}
+}
+
+func TestRecordSummary(t *testing.T) {
+	exchange := testExchange("/hooks/github?delivery=1", http.StatusBadGateway, "", "")
+	exchange.Request.RemoteAddr = "192.0.2.1:4000"
+	exchange.Response.Error = "connection refused"
+	exchange.Replay = true
+	summary := (&Record{ID: 7, Exchange: exchange}).Summary()
+
+	want := Summary{
+		ID:         7,
+		Started:    exchange.Started,
+		DurationMs: 1.5,
+		Method:     "POST",
+		URL:        "/hooks/github?delivery=1",
+		Path:       "/hooks/github",
+		Status:     http.StatusBadGateway,
+		Error:      "connection refused",
+		RemoteAddr: "192.0.2.1:4000",
+		Replay:     true,
+	}
+	if summary != want {
+		t.Errorf("Summary() = %+v, want %+v", summary, want)
+	}
+}
+
+func TestFilterMatches(t *testing.T) {
+	summary := Summary{Path: "/hooks/github", Status: http.StatusNotFound}
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{"empty", Filter{}, true},
+		{"path substring", Filter{Path: "github"}, true},
+		{"other path", Filter{Path: "/api"}, false},
+		{"exact status", Filter{Status: "404"}, true},
+		{"other status", Filter{Status: "200"}, false},
+		{"status class", Filter{Status: "4xx"}, true},
+		{"upper case class", Filter{Status: " 4XX "}, true},
+		{"other class", Filter{Status: "5xx"}, false},
+		{"path and status", Filter{Path: "hooks", Status: "4xx"}, true},
+		{"path but not status", Filter{Path: "hooks", Status: "5xx"}, false},
+		{"invalid status", Filter{Status: "abc"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Matches(summary); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	inspector := NewInspector(0, DefaultMaxBodySize, testLogger{})
+	inspector.ObserveHTTPExchange(testExchange("/ok", http.StatusOK, "", ""))
+	inspector.ObserveHTTPExchange(testExchange("/missing", http.StatusNotFound, "", ""))
+	inspector.ObserveHTTPExchange(testExchange("/down", http.StatusBadGateway, "", ""))
+	if got := recordIDs(inspector.Records(Filter{Status: "4xx"})); !equalIDs(got, []int64{2}) {
+		t.Errorf("Records(4xx) = %v, want [2]", got)
+	}
+}
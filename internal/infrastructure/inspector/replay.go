@@ -0,0 +1,142 @@
+package inspector
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+)
+
+// Replayer sends captured requests to the local service again
+type Replayer interface {
+	// ReplayHTTPRequest forwards a request like live traffic and returns the exchange.
+	// A port other than 0 sends it to that local port, bypassing routes and upstreams.
+	ReplayHTTPRequest(request *model.HTTPRequest, port int) *model.HTTPExchange
+}
+
+// ReplayOptions are optional edits applied to a captured request before it is replayed
+type ReplayOptions struct {
+	// Headers are set on the request, replacing existing values
+	Headers map[string]string `json:"headers,omitempty"`
+	// RemoveHeaders are removed from the request
+	RemoveHeaders []string `json:"remove_headers,omitempty"`
+	// Body replaces the request body if ReplaceBody is set
+	Body        []byte `json:"body,omitempty"`
+	ReplaceBody bool   `json:"replace_body,omitempty"`
+	// Port sends the request to another local port, bypassing the routes and upstreams
+	// of the tunnel (0 to forward it like live traffic)
+	Port int `json:"port,omitempty"`
+}
+
+// SetReplayer enables replays through the API
+func (i *Inspector) SetReplayer(replayer Replayer) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.replayer = replayer
+}
+
+// Replay sends a kept request to the local service again and returns the summary of
+// the new exchange
+func (i *Inspector) Replay(id int64, options ReplayOptions) (Summary, error) {
+	i.mutex.Lock()
+	replayer := i.replayer
+	i.mutex.Unlock()
+	if replayer == nil {
+		return Summary{}, errors.New("replay is not available")
+	}
+
+	record, ok := i.Record(id)
+	if !ok || record.Exchange.Request == nil {
+		return Summary{}, fmt.Errorf("unknown exchange %d", id)
+	}
+	if record.RequestTruncated && !options.ReplaceBody {
+		return Summary{}, fmt.Errorf("the body of exchange %d was truncated to %d bytes and cannot be replayed, replace the body or raise --inspect-max-body",
+			id, i.maxBodySize)
+	}
+
+	request := record.Exchange.Request.Clone()
+	for name, value := range options.Headers {
+		request.Headers.Set(name, value)
+	}
+	for _, name := range options.RemoveHeaders {
+		request.Headers.Del(name)
+	}
+	if options.ReplaceBody {
+		request.Body = options.Body
+	}
+	if options.Port < 0 || options.Port > 65535 {
+		return Summary{}, fmt.Errorf("invalid port %d", options.Port)
+	}
+
+	exchange := replayer.ReplayHTTPRequest(request, options.Port)
+
+	// The replayer passes the exchange to the observers, the inspector included
+	for _, kept := range i.Records(Filter{}) {
+		if kept.Exchange.Request != nil && kept.Exchange.Request.ID == exchange.Request.ID {
+			return kept.Summary(), nil
+		}
+	}
+	return (&Record{Exchange: exchange}).Summary(), nil
+}
+
+// handleReplay replays a kept request: POST /api/exchanges/<id>/replay with ReplayOptions as body
+func (i *Inspector) handleReplay(w http.ResponseWriter, r *http.Request, id int64) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+	// A JSON content type cannot be sent by other web pages without a preflight request
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		writeError(w, http.StatusUnsupportedMediaType, "use Content-Type: application/json")
+		return
+	}
+
+	var options ReplayOptions
+	if err := json.NewDecoder(io.LimitReader(r.Body, 32<<20)).Decode(&options); err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid replay options: %v", err))
+		return
+	}
+	summary, err := i.Replay(id, options)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, summary)
+}
+
+// RequestReplay asks the inspector of a running tunnel at address to replay an exchange
+func RequestReplay(address string, id int64, options ReplayOptions) (Summary, error) {
+	data, err := json.Marshal(options)
+	if err != nil {
+		return Summary{}, err
+	}
+	client := &http.Client{Timeout: 5 * time.Minute}
+	resp, err := client.Post(fmt.Sprintf("http://%s/api/exchanges/%d/replay", address, id), "application/json", bytes.NewReader(data))
+	if err != nil {
+		return Summary{}, fmt.Errorf("failed to reach the inspector at %s (is `haxorport http --inspect` running?): %v", address, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&failure)
+		if failure.Error == "" {
+			failure.Error = resp.Status
+		}
+		return Summary{}, errors.New(failure.Error)
+	}
+	var summary Summary
+	if err := json.NewDecoder(resp.Body).Decode(&summary); err != nil {
+		return Summary{}, fmt.Errorf("invalid inspector response: %v", err)
+	}
+	return summary, nil
+}
@@ -0,0 +1,158 @@
+package inspector
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+)
+
+// testReplayer keeps the replayed requests and passes the exchanges to the inspector
+type testReplayer struct {
+	inspector *Inspector
+	requests  []*model.HTTPRequest
+	ports     []int
+}
+
+func (r *testReplayer) ReplayHTTPRequest(request *model.HTTPRequest, port int) *model.HTTPExchange {
+	r.requests = append(r.requests, request)
+	r.ports = append(r.ports, port)
+	replay := request.Clone()
+	replay.ID = "replay-1"
+	exchange := &model.HTTPExchange{
+		Request:  replay,
+		Response: &model.HTTPResponse{ID: replay.ID, StatusCode: http.StatusAccepted},
+		Started:  time.Now(),
+		Replay:   true,
+	}
+	r.inspector.ObserveHTTPExchange(exchange)
+	return exchange
+}
+
+// newTestReplay returns an inspector keeping bodies of up to 8 bytes with one captured request
+func newTestReplay(t *testing.T, body string) (*Inspector, *testReplayer) {
+	t.Helper()
+	inspector := NewInspector(0, 8, testLogger{})
+	replayer := &testReplayer{inspector: inspector}
+	inspector.SetReplayer(replayer)
+	exchange := testExchange("/hook", http.StatusOK, body, "")
+	exchange.Request.Headers.Set("X-Signature", "abc")
+	exchange.Request.Headers.Set("X-Debug", "0")
+	inspector.ObserveHTTPExchange(exchange)
+	return inspector, replayer
+}
+
+func TestReplayEditsRequest(t *testing.T) {
+	inspector, replayer := newTestReplay(t, "payload")
+	summary, err := inspector.Replay(1, ReplayOptions{
+		Headers:       map[string]string{"X-Debug": "1", "X-New": "yes"},
+		RemoveHeaders: []string{"x-signature"},
+		Port:          3001,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replayer.requests) != 1 {
+		t.Fatalf("%d requests replayed, want 1", len(replayer.requests))
+	}
+	request := replayer.requests[0]
+	if request.Headers.Get("X-Debug") != "1" || request.Headers.Get("X-New") != "yes" || request.Headers.Get("X-Signature") != "" {
+		t.Errorf("replayed headers = %v", request.Headers)
+	}
+	if string(request.Body) != "payload" || replayer.ports[0] != 3001 {
+		t.Errorf("replayed body %q to port %d, want payload to 3001", request.Body, replayer.ports[0])
+	}
+	// The summary is the one of the new record
+	if summary.ID != 2 || !summary.Replay || summary.Status != http.StatusAccepted {
+		t.Errorf("summary = %+v, want the replayed exchange", summary)
+	}
+
+	// The captured request is not changed by the edits
+	record, _ := inspector.Record(1)
+	if record.Exchange.Request.Headers.Get("X-Signature") != "abc" || record.Exchange.Request.Headers.Get("X-Debug") != "0" {
+		t.Errorf("captured headers were modified: %v", record.Exchange.Request.Headers)
+	}
+}
+
+func TestReplayRefusesInvalidRequests(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		id      int64
+		options ReplayOptions
+		wantErr string
+	}{
+		{"unknown exchange", "", 9, ReplayOptions{}, "unknown exchange"},
+		{"truncated body", "longer than eight", 1, ReplayOptions{}, "truncated"},
+		{"negative port", "", 1, ReplayOptions{Port: -1}, "invalid port"},
+		{"port out of range", "", 1, ReplayOptions{Port: 65536}, "invalid port"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inspector, replayer := newTestReplay(t, tt.body)
+			_, err := inspector.Replay(tt.id, tt.options)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Replay() error = %v, want %q", err, tt.wantErr)
+			}
+			if len(replayer.requests) != 0 {
+				t.Error("the request was replayed")
+			}
+		})
+	}
+}
+
+func TestReplayTruncatedBodyReplaced(t *testing.T) {
+	inspector, replayer := newTestReplay(t, "longer than eight")
+	if _, err := inspector.Replay(1, ReplayOptions{Body: []byte("{}"), ReplaceBody: true}); err != nil {
+		t.Fatal(err)
+	}
+	if len(replayer.requests) != 1 || string(replayer.requests[0].Body) != "{}" {
+		t.Errorf("replayed requests = %v, want the replacement body", replayer.requests)
+	}
+}
+
+func TestReplayWithoutReplayer(t *testing.T) {
+	inspector := NewInspector(0, 8, testLogger{})
+	inspector.ObserveHTTPExchange(testExchange("/hook", http.StatusOK, "", ""))
+	if _, err := inspector.Replay(1, ReplayOptions{}); err == nil {
+		t.Error("Replay() succeeded without a replayer")
+	}
+}
+
+func TestHandleReplay(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		body        string
+		want        int
+	}{
+		{"replay", http.MethodPost, "application/json", `{"headers": {"X-Debug": "1"}}`, http.StatusOK},
+		{"empty options", http.MethodPost, "application/json; charset=utf-8", "", http.StatusOK},
+		{"GET", http.MethodGet, "application/json", "", http.StatusMethodNotAllowed},
+		// Other web pages can post forms without a preflight request, but not JSON
+		{"form post", http.MethodPost, "application/x-www-form-urlencoded", "port=1", http.StatusUnsupportedMediaType},
+		{"text post", http.MethodPost, "text/plain", "{}", http.StatusUnsupportedMediaType},
+		{"invalid JSON", http.MethodPost, "application/json", "{", http.StatusBadRequest},
+		{"invalid port", http.MethodPost, "application/json", `{"port": 70000}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inspector, replayer := newTestReplay(t, "payload")
+			r := httptest.NewRequest(tt.method, "/api/exchanges/1/replay", bytes.NewReader([]byte(tt.body)))
+			r.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			inspector.handleExchange(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d %s, want %d", w.Code, w.Body, tt.want)
+			}
+			if replayed := len(replayer.requests) == 1; replayed != (tt.want == http.StatusOK) {
+				t.Errorf("replayed = %v, want %v", replayed, tt.want == http.StatusOK)
+			}
+		})
+	}
+}
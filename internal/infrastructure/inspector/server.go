@@ -0,0 +1,178 @@
+package inspector
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed ui.html
+var uiPage []byte
+
+// Start serves the web UI and API on address in the background
+func (i *Inspector) Start(address string) error {
+	// Captured requests may contain credentials, they are only served on loopback addresses
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("invalid inspector address %s: %v", address, err)
+	}
+	if !isLoopbackHost(host) {
+		return fmt.Errorf("the inspector address %s is not a loopback address, use for example %s", address, DefaultAddress)
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed to start inspector on %s: %v", address, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", i.handleUI)
+	mux.HandleFunc("/api/exchanges", i.handleList)
+	mux.HandleFunc("/api/exchanges/", i.handleExchange)
+	mux.HandleFunc("/api/events", i.handleEvents)
+
+	server := &http.Server{
+		Handler:           localOnly(mux),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	i.mutex.Lock()
+	i.server = server
+	i.mutex.Unlock()
+
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			i.logger.Error("Inspector stopped: %v", err)
+		}
+	}()
+	i.logger.Info("Inspector listening on http://%s", listener.Addr())
+	return nil
+}
+
+// Close stops the web UI
+func (i *Inspector) Close() error {
+	i.mutex.Lock()
+	server := i.server
+	i.server = nil
+	i.mutex.Unlock()
+	if server == nil {
+		return nil
+	}
+	return server.Close()
+}
+
+// localOnly rejects requests whose Host header is not a loopback address, so that
+// web pages cannot read the captured traffic through DNS rebinding
+func localOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if !isLoopbackHost(strings.Trim(host, "[]")) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isLoopbackHost reports whether host is localhost or a loopback IP address
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// handleUI serves the web page
+func (i *Inspector) handleUI(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(uiPage)
+}
+
+// handleList returns the summaries of the records matching the path and status query parameters
+func (i *Inspector) handleList(w http.ResponseWriter, r *http.Request) {
+	filter := Filter{Path: r.URL.Query().Get("path"), Status: r.URL.Query().Get("status")}
+	records := i.Records(filter)
+	summaries := make([]Summary, 0, len(records))
+	for _, record := range records {
+		summaries = append(summaries, record.Summary())
+	}
+	writeJSON(w, http.StatusOK, summaries)
+}
+
+// handleExchange returns the details of a record, or replays it
+func (i *Inspector) handleExchange(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/exchanges/")
+	replay := strings.HasSuffix(path, "/replay")
+	path = strings.TrimSuffix(path, "/replay")
+	id, err := strconv.ParseInt(path, 10, 64)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "unknown exchange")
+		return
+	}
+	if replay {
+		i.handleReplay(w, r, id)
+		return
+	}
+	record, ok := i.Record(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown exchange")
+		return
+	}
+	writeJSON(w, http.StatusOK, record.Detail())
+}
+
+// handleEvents streams the summaries of new records as server-sent events
+func (i *Inspector) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	events := i.subscribe()
+	defer i.unsubscribe(events)
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case summary := <-events:
+			data, _ := json.Marshal(summary)
+			fmt.Fprintf(w, "event: exchange\ndata: %s\n\n", data)
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// writeJSON writes value as a JSON response
+func writeJSON(w http.ResponseWriter, statusCode int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(value)
+}
+
+// writeError writes an error as a JSON response
+func writeError(w http.ResponseWriter, statusCode int, message string) {
+	writeJSON(w, statusCode, map[string]string{"error": message})
+}
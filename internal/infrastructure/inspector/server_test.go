@@ -0,0 +1,90 @@
+package inspector
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLocalOnly(t *testing.T) {
+	tests := []struct {
+		host string
+		want int
+	}{
+		{"127.0.0.1:4040", http.StatusOK},
+		{"127.0.0.2:4040", http.StatusOK},
+		{"localhost:4040", http.StatusOK},
+		{"LOCALHOST", http.StatusOK},
+		{"[::1]:4040", http.StatusOK},
+		{"[::1]", http.StatusOK},
+		{"192.168.1.10:4040", http.StatusForbidden},
+		// A rebound DNS name resolves to 127.0.0.1 but keeps its own Host header
+		{"attacker.example.net:4040", http.StatusForbidden},
+		{"localhost.attacker.example.net", http.StatusForbidden},
+		{"", http.StatusForbidden},
+	}
+	handler := localOnly(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/exchanges", nil)
+			r.Host = tt.host
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestStartRefusesRemoteAddresses(t *testing.T) {
+	tests := []string{
+		"0.0.0.0:4040",
+		":4040",
+		"[::]:4040",
+		"192.0.2.1:4040",
+		"inspector.example.net:4040",
+		"127.0.0.1",
+	}
+	for _, address := range tests {
+		t.Run(address, func(t *testing.T) {
+			inspector := NewInspector(0, DefaultMaxBodySize, testLogger{})
+			if err := inspector.Start(address); err == nil {
+				inspector.Close()
+				t.Error("Start() accepted an address that is not a loopback address")
+			}
+		})
+	}
+}
+
+func TestStartAcceptsLoopbackAddresses(t *testing.T) {
+	for _, address := range []string{"127.0.0.1:0", "localhost:0", "[::1]:0"} {
+		t.Run(address, func(t *testing.T) {
+			inspector := NewInspector(0, DefaultMaxBodySize, testLogger{})
+			if err := inspector.Start(address); err != nil {
+				if address == "[::1]:0" {
+					t.Skipf("no IPv6 loopback: %v", err)
+				}
+				t.Fatal(err)
+			}
+			inspector.Close()
+		})
+	}
+}
+
+func TestHandleList(t *testing.T) {
+	inspector := NewInspector(0, DefaultMaxBodySize, testLogger{})
+	inspector.ObserveHTTPExchange(testExchange("/ok", http.StatusOK, "", ""))
+	inspector.ObserveHTTPExchange(testExchange("/missing", http.StatusNotFound, "", ""))
+
+	w := httptest.NewRecorder()
+	inspector.handleList(w, httptest.NewRequest(http.MethodGet, "/api/exchanges?status=4xx", nil))
+	var summaries []Summary
+	if err := json.NewDecoder(w.Body).Decode(&summaries); err != nil {
+		t.Fatal(err)
+	}
+	if len(summaries) != 1 || summaries[0].URL != "/missing" {
+		t.Errorf("summaries = %+v, want /missing only", summaries)
+	}
+}
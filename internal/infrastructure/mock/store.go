@@ -0,0 +1,183 @@
+package mock
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+	"github.com/haxorport/haxorport-go-client/internal/infrastructure/har"
+)
+
+const (
+	// DefaultCapacity is the number of distinct requests kept by default
+	DefaultCapacity = 1000
+	// MaxBodySize is the size of the largest response body that is kept
+	MaxBodySize = 10 << 20
+	// Header marks responses served by the store
+	Header = "X-Haxorport-Mock"
+)
+
+// Store keeps the last response of the local service for each method, path and query,
+// and serves it when the local service cannot be reached. Server errors are not kept,
+// so a crashing service does not replace good responses with bad ones. As responses are
+// served to any visitor, those to requests with credentials are not kept and cookies
+// are never set.
+type Store struct {
+	capacity int
+
+	mutex     sync.Mutex
+	responses map[string]*model.HTTPResponse
+	// order holds the keys from oldest to newest, the oldest is dropped when full
+	order []string
+}
+
+// NewStore creates an empty store keeping up to capacity responses
+func NewStore(capacity int) *Store {
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+	return &Store{
+		capacity:  capacity,
+		responses: make(map[string]*model.HTTPResponse),
+	}
+}
+
+// LoadHAR adds the responses of a HAR file recorded with --har. Redacted headers are
+// left out, and so are responses to requests with credentials. It returns the number
+// of responses added.
+func (s *Store) LoadHAR(path string) (int, error) {
+	file, err := har.Load(path)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, entry := range file.Log.Entries {
+		u, err := url.Parse(entry.Request.URL)
+		if err != nil {
+			continue
+		}
+		requestHeaders := http.Header{}
+		for _, header := range entry.Request.Headers {
+			requestHeaders.Add(header.Name, header.Value)
+		}
+		if hasCredentials(requestHeaders) {
+			continue
+		}
+		body, err := entry.Response.Body()
+		if err != nil {
+			return count, fmt.Errorf("invalid response body for %s %s in %s: %v", entry.Request.Method, entry.Request.URL, path, err)
+		}
+		headers := http.Header{}
+		for _, header := range entry.Response.Headers {
+			if header.Value != har.Redacted {
+				headers.Add(header.Name, header.Value)
+			}
+		}
+		if s.put(Key(entry.Request.Method, u.RequestURI()), &model.HTTPResponse{
+			StatusCode: entry.Response.Status,
+			Headers:    headers,
+			Body:       body,
+		}) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// RecordHTTPResponse implements port.HTTPFallback. Responses to requests with cookies
+// or credentials may be specific to a visitor and are not kept.
+func (s *Store) RecordHTTPResponse(request *model.HTTPRequest, response *model.HTTPResponse) {
+	if hasCredentials(request.Headers) {
+		return
+	}
+	s.put(Key(request.Method, request.URL), response)
+}
+
+// FallbackHTTPResponse implements port.HTTPFallback. The returned response is a copy
+// marked with the X-Haxorport-Mock header.
+func (s *Store) FallbackHTTPResponse(request *model.HTTPRequest) (*model.HTTPResponse, bool) {
+	s.mutex.Lock()
+	recorded, ok := s.responses[Key(request.Method, request.URL)]
+	s.mutex.Unlock()
+	if !ok {
+		return nil, false
+	}
+	headers := recorded.Headers.Clone()
+	if headers == nil {
+		headers = http.Header{}
+	}
+	headers.Set(Header, "1")
+	return &model.HTTPResponse{
+		ID:         request.ID,
+		StatusCode: recorded.StatusCode,
+		Headers:    headers,
+		Body:       recorded.Body,
+	}, true
+}
+
+// Len returns the number of kept responses
+func (s *Store) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.responses)
+}
+
+// put keeps a copy of a response under key, reporting whether it was kept
+func (s *Store) put(key string, response *model.HTTPResponse) bool {
+	if response.Error != "" || response.StatusCode < 100 || response.StatusCode >= 500 || len(response.Body) > MaxBodySize {
+		return false
+	}
+	kept := &model.HTTPResponse{
+		StatusCode: response.StatusCode,
+		Headers:    response.Headers.Clone(),
+		Body:       append([]byte(nil), response.Body...),
+	}
+	// A session cookie must not be handed to other visitors
+	kept.Headers.Del("Set-Cookie")
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.responses[key]; ok {
+		// Move the key to the end, it is the newest now
+		for i, k := range s.order {
+			if k == key {
+				s.order = append(s.order[:i], s.order[i+1:]...)
+				break
+			}
+		}
+	} else if len(s.order) >= s.capacity {
+		delete(s.responses, s.order[0])
+		s.order = s.order[1:]
+	}
+	s.responses[key] = kept
+	s.order = append(s.order, key)
+	return true
+}
+
+// hasCredentials reports whether a request carries cookies or credentials
+func hasCredentials(headers http.Header) bool {
+	return headers.Get("Cookie") != "" || headers.Get("Authorization") != ""
+}
+
+// Key identifies a request by method, path and query. The query parameters are sorted
+// by name and value, so their order does not matter.
+func Key(method, requestURI string) string {
+	path, rawQuery, _ := strings.Cut(requestURI, "?")
+	if i := strings.IndexByte(rawQuery, '#'); i >= 0 {
+		rawQuery = rawQuery[:i]
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		// Keep malformed queries as they are, they still identify the request
+		return strings.ToUpper(method) + " " + path + "?" + rawQuery
+	}
+	for _, values := range query {
+		sort.Strings(values)
+	}
+	// Encode sorts by name
+	return strings.ToUpper(method) + " " + path + "?" + query.Encode()
+}
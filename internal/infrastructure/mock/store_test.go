@@ -0,0 +1,143 @@
+package mock
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+)
+
+func testRequest(method, url string, headers http.Header) *model.HTTPRequest {
+	if headers == nil {
+		headers = http.Header{}
+	}
+	return &model.HTTPRequest{ID: "1", Method: method, URL: url, Headers: headers}
+}
+
+func testResponse(statusCode int, body string) *model.HTTPResponse {
+	return &model.HTTPResponse{StatusCode: statusCode, Headers: http.Header{"Content-Type": {"text/plain"}}, Body: []byte(body)}
+}
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		requestURI string
+		want       string
+	}{
+		{"no query", "GET", "/items", "GET /items?"},
+		{"lower case method", "get", "/items", "GET /items?"},
+		{"sorted names", "GET", "/items?b=2&a=1", "GET /items?a=1&b=2"},
+		{"sorted values", "GET", "/items?a=2&a=1", "GET /items?a=1&a=2"},
+		{"escaped values", "GET", "/search?q=a+b", "GET /search?q=a+b"},
+		{"fragment dropped", "GET", "/items?a=1#top", "GET /items?a=1"},
+		{"malformed query kept", "GET", "/items?a=%zz&b", "GET /items?a=%zz&b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Key(tt.method, tt.requestURI); got != tt.want {
+				t.Errorf("Key() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStoreEvictsOldest(t *testing.T) {
+	store := NewStore(2)
+	store.RecordHTTPResponse(testRequest("GET", "/a", nil), testResponse(http.StatusOK, "a"))
+	store.RecordHTTPResponse(testRequest("GET", "/b", nil), testResponse(http.StatusOK, "b"))
+	// Recording /a again makes /b the oldest
+	store.RecordHTTPResponse(testRequest("GET", "/a", nil), testResponse(http.StatusOK, "a2"))
+	store.RecordHTTPResponse(testRequest("GET", "/c", nil), testResponse(http.StatusOK, "c"))
+
+	if store.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", store.Len())
+	}
+	tests := []struct {
+		url  string
+		kept bool
+		body string
+	}{
+		{"/a", true, "a2"},
+		{"/b", false, ""},
+		{"/c", true, "c"},
+	}
+	for _, tt := range tests {
+		response, ok := store.FallbackHTTPResponse(testRequest("GET", tt.url, nil))
+		if ok != tt.kept {
+			t.Errorf("%s kept = %v, want %v", tt.url, ok, tt.kept)
+			continue
+		}
+		if ok && string(response.Body) != tt.body {
+			t.Errorf("%s body = %q, want %q", tt.url, response.Body, tt.body)
+		}
+	}
+}
+
+func TestStoreSkipsResponses(t *testing.T) {
+	withHeader := func(name, value string) http.Header {
+		return http.Header{name: {value}}
+	}
+	tests := []struct {
+		name     string
+		request  *model.HTTPRequest
+		response *model.HTTPResponse
+	}{
+		{"server error", testRequest("GET", "/", nil), testResponse(http.StatusBadGateway, "down")},
+		{"forwarding error", testRequest("GET", "/", nil), &model.HTTPResponse{StatusCode: http.StatusOK, Error: "reset"}},
+		{"invalid status", testRequest("GET", "/", nil), testResponse(0, "")},
+		{"body too large", testRequest("GET", "/", nil), testResponse(http.StatusOK, string(bytes.Repeat([]byte("x"), MaxBodySize+1)))},
+		{"request with cookie", testRequest("GET", "/", withHeader("Cookie", "session=1")), testResponse(http.StatusOK, "mine")},
+		{"request with credentials", testRequest("GET", "/", withHeader("Authorization", "Basic dXNlcjpzZWNyZXQ=")), testResponse(http.StatusOK, "mine")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewStore(0)
+			store.RecordHTTPResponse(tt.request, tt.response)
+			if store.Len() != 0 {
+				t.Error("the response was kept")
+			}
+		})
+	}
+
+	// A server error does not replace a good response
+	store := NewStore(0)
+	store.RecordHTTPResponse(testRequest("GET", "/", nil), testResponse(http.StatusOK, "good"))
+	store.RecordHTTPResponse(testRequest("GET", "/", nil), testResponse(http.StatusInternalServerError, "bad"))
+	if response, ok := store.FallbackHTTPResponse(testRequest("GET", "/", nil)); !ok || string(response.Body) != "good" {
+		t.Errorf("fallback = %+v, %v, want the good response", response, ok)
+	}
+}
+
+func TestFallbackHTTPResponse(t *testing.T) {
+	store := NewStore(0)
+	recorded := testResponse(http.StatusOK, "cached")
+	recorded.Headers.Set("Set-Cookie", "session=alice")
+	store.RecordHTTPResponse(testRequest("GET", "/page?b=2&a=1", nil), recorded)
+
+	response, ok := store.FallbackHTTPResponse(&model.HTTPRequest{ID: "42", Method: "GET", URL: "/page?a=1&b=2"})
+	if !ok {
+		t.Fatal("no response for the same query in another order")
+	}
+	if response.ID != "42" || response.StatusCode != http.StatusOK || string(response.Body) != "cached" {
+		t.Errorf("fallback = %+v", response)
+	}
+	if response.Headers.Get(Header) != "1" {
+		t.Errorf("%s = %q, want 1", Header, response.Headers.Get(Header))
+	}
+	if response.Headers.Get("Set-Cookie") != "" {
+		t.Error("the cookie of the recorded response is replayed")
+	}
+	if response.Headers.Get("Content-Type") != "text/plain" {
+		t.Errorf("Content-Type = %q, want text/plain", response.Headers.Get("Content-Type"))
+	}
+
+	// The marker is not added to the recorded response, nor is the cookie removed from it
+	if recorded.Headers.Get(Header) != "" || recorded.Headers.Get("Set-Cookie") == "" {
+		t.Errorf("the recorded response was modified: %v", recorded.Headers)
+	}
+	if _, ok := store.FallbackHTTPResponse(testRequest("POST", "/page?a=1&b=2", nil)); ok {
+		t.Error("a response recorded for GET was served for POST")
+	}
+}
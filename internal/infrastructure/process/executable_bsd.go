@@ -0,0 +1,21 @@
+//go:build darwin || freebsd || netbsd || openbsd || dragonfly
+
+package process
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// runsExecutable reports whether process pid runs the program at path. Without /proc
+// the command name reported by ps is compared, which ps may truncate.
+func runsExecutable(pid int, path string) bool {
+	out, err := exec.Command("ps", "-o", "comm=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return false
+	}
+	name := filepath.Base(strings.TrimSpace(string(out)))
+	return name != "" && name != "." && strings.HasPrefix(filepath.Base(path), name)
+}
@@ -0,0 +1,18 @@
+package process
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// runsExecutable reports whether process pid runs the program at path
+func runsExecutable(pid int, path string) bool {
+	exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+	if err != nil {
+		// The processes of other users cannot be inspected, nor signalled
+		return false
+	}
+	// The program of a running tunnel may have been replaced by an upgrade
+	return strings.TrimSuffix(exe, " (deleted)") == path
+}
@@ -0,0 +1,181 @@
+package process
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+)
+
+// Instance describes a running tunnel process, so that other commands can find it
+type Instance struct {
+	PID       int       `json:"pid"`
+	Name      string    `json:"name,omitempty"`
+	Subdomain string    `json:"subdomain,omitempty"`
+	URL       string    `json:"url"`
+	LocalPort int       `json:"local_port"`
+	Started   time.Time `json:"started"`
+	// Maintenance is set while the tunnel is paused
+	Maintenance bool `json:"maintenance,omitempty"`
+	// Upstreams is the state of the upstreams of a balanced tunnel
+	Upstreams []model.UpstreamStatus `json:"upstreams,omitempty"`
+	// Executable is the program of the process, so that a PID reused by another
+	// program is never taken for the tunnel
+	Executable string `json:"executable,omitempty"`
+}
+
+// Registration is the run file of the current process
+type Registration struct {
+	path     string
+	mutex    sync.Mutex
+	instance Instance
+}
+
+// Matches reports whether the instance is the tunnel named by target: its name,
+// subdomain, URL or process ID
+func (i Instance) Matches(target string) bool {
+	return target == i.Name || target == i.Subdomain || target == i.URL || target == strconv.Itoa(i.PID)
+}
+
+// Register writes the run file of the current process
+func Register(instance Instance) (*Registration, error) {
+	dir, err := GetDefaultDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("error creating run directory: %v", err)
+	}
+
+	instance.PID = os.Getpid()
+	instance.Executable = currentExecutable()
+	r := &Registration{
+		path:     filepath.Join(dir, fmt.Sprintf("%d.json", instance.PID)),
+		instance: instance,
+	}
+	if err := r.write(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Update changes the run file
+func (r *Registration) Update(change func(instance *Instance)) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	change(&r.instance)
+	return r.write()
+}
+
+// Remove deletes the run file
+func (r *Registration) Remove() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	os.Remove(r.path)
+}
+
+// write replaces the run file atomically, so that other commands never read a partial
+// file. The caller must hold r.mutex or own r exclusively.
+func (r *Registration) write() error {
+	data, err := json.MarshalIndent(r.instance, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpFile, err := os.CreateTemp(filepath.Dir(r.path), ".run-*.tmp")
+	if err != nil {
+		return fmt.Errorf("error writing run file: %v", err)
+	}
+	tmpPath := tmpFile.Name()
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("error writing run file: %v", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("error writing run file: %v", err)
+	}
+	if err := os.Rename(tmpPath, r.path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("error writing run file: %v", err)
+	}
+	return nil
+}
+
+// Instances returns the running tunnel processes, oldest first. Run files of processes
+// that are gone are removed.
+func Instances() ([]Instance, error) {
+	dir, err := GetDefaultDir()
+	if err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var instances []Instance
+	for _, path := range paths {
+		pid, err := strconv.Atoi(strings.TrimSuffix(filepath.Base(path), ".json"))
+		if err != nil {
+			continue
+		}
+		if !alive(pid) {
+			os.Remove(path)
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var instance Instance
+		if err := json.Unmarshal(data, &instance); err != nil || instance.PID != pid {
+			continue
+		}
+		// The tunnel may have stopped without removing its run file and its PID been reused
+		if !instance.running() {
+			os.Remove(path)
+			continue
+		}
+		instances = append(instances, instance)
+	}
+	sort.Slice(instances, func(a, b int) bool {
+		return instances[a].Started.Before(instances[b].Started)
+	})
+	return instances, nil
+}
+
+// running reports whether the process of the instance is alive and still runs the
+// program that wrote the run file. Run files without a program are not trusted.
+func (i Instance) running() bool {
+	return i.Executable != "" && alive(i.PID) && runsExecutable(i.PID, i.Executable)
+}
+
+// currentExecutable returns the resolved path of the running program, or "" if unknown
+func currentExecutable() string {
+	path, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	return path
+}
+
+// GetDefaultDir returns the directory of the run files
+func GetDefaultDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("error getting home directory: %v", err)
+	}
+
+	return filepath.Join(homeDir, ".haxorport", "run"), nil
+}
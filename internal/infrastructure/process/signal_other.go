@@ -0,0 +1,31 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+
+package process
+
+import "fmt"
+
+// Pause is not supported on this platform, which has no user signals
+func Pause(instance Instance) error {
+	return fmt.Errorf("pause is not supported on this platform")
+}
+
+// Resume is not supported on this platform, which has no user signals
+func Resume(instance Instance) error {
+	return fmt.Errorf("resume is not supported on this platform")
+}
+
+// WatchMaintenance does nothing on this platform
+func WatchMaintenance(set func(on bool)) func() {
+	return func() {}
+}
+
+// alive cannot check processes on this platform, so run files are kept until the
+// process removes them
+func alive(pid int) bool {
+	return true
+}
+
+// runsExecutable cannot check programs on this platform
+func runsExecutable(pid int, path string) bool {
+	return true
+}
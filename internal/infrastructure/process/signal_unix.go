@@ -0,0 +1,58 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package process
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// Pause puts the tunnels of a running process into maintenance mode
+func Pause(instance Instance) error {
+	return signalInstance(instance, syscall.SIGUSR1)
+}
+
+// Resume ends the maintenance mode of a running process
+func Resume(instance Instance) error {
+	return signalInstance(instance, syscall.SIGUSR2)
+}
+
+// signalInstance sends sig to the process of instance once it is known to still be
+// the tunnel, as SIGUSR1 and SIGUSR2 terminate most other programs
+func signalInstance(instance Instance, sig syscall.Signal) error {
+	if !instance.running() {
+		return fmt.Errorf("process %d is no longer a haxorport tunnel", instance.PID)
+	}
+	return syscall.Kill(instance.PID, sig)
+}
+
+// WatchMaintenance calls set with true on SIGUSR1 and with false on SIGUSR2 until the
+// returned function is called
+func WatchMaintenance(set func(on bool)) func() {
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				set(sig == syscall.SIGUSR1)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
+
+// alive reports whether a process exists
+func alive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,152 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package process
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// startSleep starts another program that the tests must never signal
+func startSleep(t *testing.T) *exec.Cmd {
+	t.Helper()
+	cmd := exec.Command("sleep", "30")
+	if err := cmd.Start(); err != nil {
+		t.Skipf("cannot start sleep: %v", err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	return cmd
+}
+
+// writeRunFile writes the run file of instance into the run directory of HOME
+func writeRunFile(t *testing.T, instance Instance) string {
+	t.Helper()
+	dir, err := GetDefaultDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, strconv.Itoa(instance.PID)+".json")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestInstanceRunning(t *testing.T) {
+	self := currentExecutable()
+	if self == "" {
+		t.Skip("the test binary is unknown")
+	}
+	sleep := startSleep(t)
+	tests := []struct {
+		name     string
+		instance Instance
+		want     bool
+	}{
+		{"this process", Instance{PID: os.Getpid(), Executable: self}, true},
+		{"run file without program", Instance{PID: os.Getpid()}, false},
+		{"other program", Instance{PID: os.Getpid(), Executable: "/usr/local/bin/haxorport"}, false},
+		// The PID of a stopped tunnel was reused by another program
+		{"reused PID", Instance{PID: sleep.Process.Pid, Executable: self}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.instance.running(); got != tt.want {
+				t.Errorf("running() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInstancesRemovesStaleRunFiles(t *testing.T) {
+	self := currentExecutable()
+	if self == "" {
+		t.Skip("the test binary is unknown")
+	}
+	t.Setenv("HOME", t.TempDir())
+	sleep := startSleep(t)
+	exited := exec.Command("sleep", "0")
+	if err := exited.Run(); err != nil {
+		t.Skipf("cannot run sleep: %v", err)
+	}
+
+	kept := writeRunFile(t, Instance{PID: os.Getpid(), Executable: self, URL: "https://app.example.net", Started: time.Now()})
+	reused := writeRunFile(t, Instance{PID: sleep.Process.Pid, Executable: self, URL: "https://old.example.net"})
+	gone := writeRunFile(t, Instance{PID: exited.Process.Pid, Executable: self, URL: "https://gone.example.net"})
+
+	instances, err := Instances()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(instances) != 1 || instances[0].URL != "https://app.example.net" {
+		t.Errorf("Instances() = %+v, want this process only", instances)
+	}
+	for path, want := range map[string]bool{kept: true, reused: false, gone: false} {
+		if _, err := os.Stat(path); (err == nil) != want {
+			t.Errorf("run file %s kept = %v, want %v", filepath.Base(path), err == nil, want)
+		}
+	}
+}
+
+func TestPauseRefusesOtherPrograms(t *testing.T) {
+	self := currentExecutable()
+	if self == "" {
+		t.Skip("the test binary is unknown")
+	}
+	sleep := startSleep(t)
+	instance := Instance{PID: sleep.Process.Pid, Executable: self}
+	if err := Pause(instance); err == nil {
+		t.Error("Pause() signalled another program")
+	}
+	if err := Resume(instance); err == nil {
+		t.Error("Resume() signalled another program")
+	}
+	// SIGUSR1 would have terminated sleep
+	if err := syscall.Kill(sleep.Process.Pid, 0); err != nil {
+		t.Errorf("sleep was signalled: %v", err)
+	}
+}
+
+func TestPauseSignalsTunnel(t *testing.T) {
+	self := currentExecutable()
+	if self == "" {
+		t.Skip("the test binary is unknown")
+	}
+	changes := make(chan bool, 2)
+	stop := WatchMaintenance(func(on bool) { changes <- on })
+	defer stop()
+
+	instance := Instance{PID: os.Getpid(), Executable: self}
+	for _, step := range []struct {
+		action func(Instance) error
+		want   bool
+	}{{Pause, true}, {Resume, false}} {
+		if err := step.action(instance); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case on := <-changes:
+			if on != step.want {
+				t.Errorf("maintenance = %v, want %v", on, step.want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("the signal was not received")
+		}
+	}
+}
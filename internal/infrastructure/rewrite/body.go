@@ -0,0 +1,398 @@
+package rewrite
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// DefaultBodyContentTypes are the content types whose URLs are rewritten if the rules
+// do not list any
+var DefaultBodyContentTypes = []string{
+	"text/html",
+	"application/xhtml+xml",
+	"text/css",
+	"text/javascript",
+	"application/javascript",
+	"application/json",
+}
+
+// MaxBodySize is the largest body, after decompression, whose URLs are rewritten
+const MaxBodySize = 8 << 20
+
+// ErrBodyTooLarge is returned by Body for bodies larger than MaxBodySize, which are
+// passed through unchanged
+var ErrBodyTooLarge = errors.New("body too large to rewrite")
+
+// urlAttributes are the HTML attributes holding a single URL
+var urlAttributes = map[string]bool{
+	"action":     true,
+	"background": true,
+	"cite":       true,
+	"data":       true,
+	"formaction": true,
+	"href":       true,
+	"longdesc":   true,
+	"manifest":   true,
+	"poster":     true,
+	"src":        true,
+	"xlink:href": true,
+}
+
+// cssURLPattern matches url(...) and @import "..." in CSS
+var cssURLPattern = regexp.MustCompile(`(url\(\s*['"]?|@import\s+['"])([^'")\s]+)`)
+
+// Body rewrites the URLs pointing at the local service at upstream in a response body,
+// so that they point at the public URL. HTML is tokenized, so that only attributes,
+// scripts and styles are changed. Bodies compressed with gzip or deflate are
+// decompressed and compressed again. It returns the body unchanged if URL rewriting is
+// off, the content type is not listed or the encoding is not supported, and with
+// ErrBodyTooLarge if it is larger than MaxBodySize.
+func (r *Rules) Body(header http.Header, body []byte, variables Variables, upstream string) ([]byte, error) {
+	if !r.config.BodyURLs || len(body) == 0 || variables.PublicHost == "" {
+		return body, nil
+	}
+	if len(body) > MaxBodySize {
+		return body, ErrBodyTooLarge
+	}
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil || !r.rewritesContentType(mediaType) {
+		return body, nil
+	}
+
+	encoding := strings.ToLower(strings.TrimSpace(header.Get("Content-Encoding")))
+	var reader io.Reader
+	switch encoding {
+	case "", "identity":
+		reader = bytes.NewReader(body)
+	case "gzip", "x-gzip":
+		if reader, err = gzip.NewReader(bytes.NewReader(body)); err != nil {
+			return body, err
+		}
+	case "deflate":
+		// deflate is zlib-wrapped, but some servers send raw deflate data
+		if reader, err = zlib.NewReader(bytes.NewReader(body)); err != nil {
+			reader = flate.NewReader(bytes.NewReader(body))
+		}
+	default:
+		return body, nil
+	}
+
+	// Stop decompressing as soon as the limit is reached
+	reader = &limitedReader{reader: reader, remaining: MaxBodySize}
+
+	var buffer bytes.Buffer
+	var writer io.WriteCloser
+	switch encoding {
+	case "gzip", "x-gzip":
+		writer = gzip.NewWriter(&buffer)
+	case "deflate":
+		writer = zlib.NewWriter(&buffer)
+	default:
+		writer = nopWriteCloser{&buffer}
+	}
+
+	mapper := r.newURLMapper(variables, upstream)
+	switch {
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		err = mapper.html(writer, reader)
+	case mediaType == "text/css":
+		err = mapper.copyText(writer, reader, mapper.css)
+	default:
+		err = mapper.copyText(writer, reader, mapper.text)
+	}
+	if err == ErrBodyTooLarge {
+		return body, err
+	}
+	if err != nil {
+		return body, fmt.Errorf("failed to rewrite URLs in %s body: %v", mediaType, err)
+	}
+	if err := writer.Close(); err != nil {
+		return body, err
+	}
+	if header.Get("Content-Length") != "" {
+		header.Set("Content-Length", strconv.Itoa(buffer.Len()))
+	}
+	return buffer.Bytes(), nil
+}
+
+// rewritesContentType reports whether URLs in bodies of a media type are rewritten.
+// Configured types may end with /* to match all subtypes.
+func (r *Rules) rewritesContentType(mediaType string) bool {
+	contentTypes := r.config.BodyContentTypes
+	if len(contentTypes) == 0 {
+		contentTypes = DefaultBodyContentTypes
+	}
+	for _, contentType := range contentTypes {
+		contentType = strings.ToLower(contentType)
+		if contentType == mediaType || (strings.HasSuffix(contentType, "/*") && strings.HasPrefix(mediaType, contentType[:len(contentType)-1])) {
+			return true
+		}
+	}
+	return false
+}
+
+// urlMapper maps URLs of the local service to the public URL
+type urlMapper struct {
+	// origins are the local origins without scheme, such as //localhost:3000
+	origins []string
+	// public is the public URL the local origins are replaced with; relative is the
+	// same without scheme
+	public   string
+	relative string
+	prefix   string
+	// replacer replaces the local origins in text, also in their JSON-escaped form
+	replacer *strings.Replacer
+}
+
+// newURLMapper collects the origins under which the local service may refer to itself
+func (r *Rules) newURLMapper(variables Variables, upstream string) *urlMapper {
+	hosts := []string{upstream}
+	if host, port, err := net.SplitHostPort(upstream); err == nil && loopback(host) {
+		hosts = append(hosts, "localhost:"+port, "127.0.0.1:"+port, "[::1]:"+port)
+	}
+	if r.config.Host != "" {
+		hosts = append(hosts, variables.expand(r.config.Host))
+	}
+
+	m := &urlMapper{
+		public:   variables.Scheme + "://" + variables.PublicHost + variables.Prefix,
+		relative: "//" + variables.PublicHost + variables.Prefix,
+		prefix:   variables.Prefix,
+	}
+	var pairs []string
+	seen := make(map[string]bool)
+	for _, host := range hosts {
+		host = strings.ToLower(host)
+		if host == "" || seen[host] {
+			continue
+		}
+		seen[host] = true
+		m.origins = append(m.origins, "//"+host)
+		for _, scheme := range []string{"http:", "https:"} {
+			pairs = append(pairs, scheme+"//"+host, m.public)
+			escaped := strings.ReplaceAll(scheme+"//"+host, "/", `\/`)
+			pairs = append(pairs, escaped, strings.ReplaceAll(m.public, "/", `\/`))
+		}
+	}
+	m.replacer = strings.NewReplacer(pairs...)
+	return m
+}
+
+// url maps a single URL: absolute and protocol-relative URLs of the local service get
+// the public origin, and root-relative URLs get the prefix stripped by the route
+func (m *urlMapper) url(value string) string {
+	trimmed := strings.TrimSpace(value)
+	lower := strings.ToLower(trimmed)
+	for _, origin := range m.origins {
+		for _, scheme := range []string{"http:", "https:", ""} {
+			start := scheme + origin
+			if !strings.HasPrefix(lower, start) {
+				continue
+			}
+			rest := trimmed[len(start):]
+			if rest != "" && !strings.ContainsRune("/?#", rune(rest[0])) {
+				continue
+			}
+			if scheme == "" {
+				return m.relative + rest
+			}
+			return m.public + rest
+		}
+	}
+	if m.prefix != "" && strings.HasPrefix(trimmed, "/") && !strings.HasPrefix(trimmed, "//") &&
+		trimmed != m.prefix && !strings.HasPrefix(trimmed, m.prefix+"/") {
+		return m.prefix + trimmed
+	}
+	return value
+}
+
+// text replaces the local origins in scripts and JSON
+func (m *urlMapper) text(value string) string {
+	return m.replacer.Replace(value)
+}
+
+// css maps the URLs in url() and @import and replaces the local origins elsewhere
+func (m *urlMapper) css(value string) string {
+	value = cssURLPattern.ReplaceAllStringFunc(value, func(match string) string {
+		parts := cssURLPattern.FindStringSubmatch(match)
+		return parts[1] + m.url(parts[2])
+	})
+	return m.text(value)
+}
+
+// srcset maps the URLs of a srcset attribute, a list of "URL descriptor" candidates
+func (m *urlMapper) srcset(value string) string {
+	candidates := strings.Split(value, ",")
+	changed := false
+	for i, candidate := range candidates {
+		fields := strings.Fields(candidate)
+		if len(fields) == 0 {
+			continue
+		}
+		if mapped := m.url(fields[0]); mapped != fields[0] {
+			fields[0] = mapped
+			candidates[i] = strings.Join(fields, " ")
+			changed = true
+		}
+	}
+	if !changed {
+		return value
+	}
+	return strings.Join(candidates, ",")
+}
+
+// refresh maps the URL of a meta refresh, such as "5; url=/next"
+func (m *urlMapper) refresh(value string) string {
+	index := strings.Index(strings.ToLower(value), "url=")
+	if index < 0 {
+		return value
+	}
+	target := strings.Trim(value[index+4:], `'" `)
+	mapped := m.url(target)
+	if mapped == target {
+		return value
+	}
+	return value[:index+4] + mapped
+}
+
+// limitedReader reads at most remaining bytes and fails with ErrBodyTooLarge if the
+// reader has more
+type limitedReader struct {
+	reader    io.Reader
+	remaining int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.reader.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return 0, ErrBodyTooLarge
+	}
+	return n, err
+}
+
+// copyText reads a whole text body and writes it with its URLs mapped
+func (m *urlMapper) copyText(w io.Writer, r io.Reader, mapText func(string) string) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, mapText(string(data)))
+	return err
+}
+
+// html streams an HTML document through a tokenizer and maps the URLs in attributes,
+// scripts and styles. Tokens without URLs are written as they were read.
+func (m *urlMapper) html(w io.Writer, r io.Reader) error {
+	z := html.NewTokenizer(r)
+	rawText := ""
+	for {
+		tokenType := z.Next()
+		if tokenType == html.ErrorToken {
+			if z.Err() == io.EOF {
+				return nil
+			}
+			return z.Err()
+		}
+		// TagName and TagAttr change the raw bytes, so keep a copy
+		raw := append([]byte(nil), z.Raw()...)
+		inRawText := rawText
+		rawText = ""
+
+		switch tokenType {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := z.Token()
+			if tokenType == html.StartTagToken && (token.Data == "script" || token.Data == "style") {
+				rawText = token.Data
+			}
+			if m.attributes(&token) {
+				raw = []byte(tagString(token))
+			}
+		case html.TextToken:
+			switch inRawText {
+			case "script":
+				raw = []byte(m.text(string(raw)))
+			case "style":
+				raw = []byte(m.css(string(raw)))
+			}
+		}
+		if _, err := w.Write(raw); err != nil {
+			return err
+		}
+	}
+}
+
+// attributes maps the URLs in the attributes of a tag and reports whether any changed
+func (m *urlMapper) attributes(token *html.Token) bool {
+	refresh := false
+	for _, attr := range token.Attr {
+		if attr.Key == "http-equiv" && strings.EqualFold(attr.Val, "refresh") {
+			refresh = true
+		}
+	}
+	changed := false
+	for i, attr := range token.Attr {
+		value := attr.Val
+		switch {
+		case urlAttributes[attr.Key]:
+			value = m.url(value)
+		case attr.Key == "srcset" || attr.Key == "imagesrcset":
+			value = m.srcset(value)
+		case attr.Key == "style":
+			value = m.css(value)
+		case attr.Key == "content" && refresh:
+			value = m.refresh(value)
+		}
+		if value != attr.Val {
+			token.Attr[i].Val = value
+			changed = true
+		}
+	}
+	return changed
+}
+
+// tagString serializes a start or self-closing tag
+func tagString(token html.Token) string {
+	var b strings.Builder
+	b.WriteString("<")
+	b.WriteString(token.Data)
+	for _, attr := range token.Attr {
+		b.WriteString(" ")
+		if attr.Namespace != "" {
+			b.WriteString(attr.Namespace)
+			b.WriteString(":")
+		}
+		b.WriteString(attr.Key)
+		b.WriteString(`="`)
+		b.WriteString(html.EscapeString(attr.Val))
+		b.WriteString(`"`)
+	}
+	if token.Type == html.SelfClosingTagToken {
+		b.WriteString("/")
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
+// nopWriteCloser adds a Close method to an uncompressed writer
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,142 @@
+package rewrite
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+)
+
+func newBodyRules(t *testing.T) *Rules {
+	t.Helper()
+	rules, err := Compile(&model.TunnelRewrite{BodyURLs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rules
+}
+
+var bodyVariables = Variables{PublicHost: "app.example.net", Scheme: "https"}
+
+func TestBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		prefix      string
+		body        string
+		want        string
+	}{
+		{
+			name:        "html attributes",
+			contentType: "text/html; charset=utf-8",
+			body:        `<a href="http://localhost:3000/next">next</a><img src="/logo.png">`,
+			want:        `<a href="https://app.example.net/next">next</a><img src="/logo.png">`,
+		},
+		{
+			name:        "html with prefix",
+			contentType: "text/html",
+			prefix:      "/app",
+			body:        `<a href="/next">next</a><a href="https://example.org/">out</a>`,
+			want:        `<a href="/app/next">next</a><a href="https://example.org/">out</a>`,
+		},
+		{
+			name:        "script",
+			contentType: "text/html",
+			body:        `<script>fetch("http://127.0.0.1:3000/api")</script>`,
+			want:        `<script>fetch("https://app.example.net/api")</script>`,
+		},
+		{
+			name:        "css",
+			contentType: "text/css",
+			body:        `body { background: url(http://localhost:3000/bg.png) }`,
+			want:        `body { background: url(https://app.example.net/bg.png) }`,
+		},
+		{
+			name:        "escaped json",
+			contentType: "application/json",
+			body:        `{"url":"http:\/\/localhost:3000\/a"}`,
+			want:        `{"url":"https:\/\/app.example.net\/a"}`,
+		},
+		{
+			name:        "other host",
+			contentType: "text/html",
+			body:        `<a href="http://localhost:30000/">other</a>`,
+			want:        `<a href="http://localhost:30000/">other</a>`,
+		},
+		{
+			name:        "content type not listed",
+			contentType: "image/svg+xml",
+			body:        `<a href="http://localhost:3000/">svg</a>`,
+			want:        `<a href="http://localhost:3000/">svg</a>`,
+		},
+	}
+	rules := newBodyRules(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{"Content-Type": {tt.contentType}}
+			variables := bodyVariables
+			variables.Prefix = tt.prefix
+			got, err := rules.Body(header, []byte(tt.body), variables, "localhost:3000")
+			if err != nil {
+				t.Fatalf("Body() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Body() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBodyGzip(t *testing.T) {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write([]byte(`<a href="http://localhost:3000/">home</a>`))
+	writer.Close()
+
+	header := http.Header{
+		"Content-Type":     {"text/html"},
+		"Content-Encoding": {"gzip"},
+		"Content-Length":   {"1"},
+	}
+	got, err := newBodyRules(t).Body(header, compressed.Bytes(), bodyVariables, "localhost:3000")
+	if err != nil {
+		t.Fatalf("Body() error = %v", err)
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(got))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, _ := io.ReadAll(reader)
+	if want := `<a href="https://app.example.net/">home</a>`; string(plain) != want {
+		t.Errorf("Body() = %s, want %s", plain, want)
+	}
+	if header.Get("Content-Length") == "1" {
+		t.Error("Content-Length was not updated")
+	}
+}
+
+func TestBodyTooLarge(t *testing.T) {
+	page := "<p>" + strings.Repeat("http://localhost:3000/ ", MaxBodySize/20) + "</p>"
+
+	// A large body is passed through as it is
+	header := http.Header{"Content-Type": {"text/html"}}
+	got, err := newBodyRules(t).Body(header, []byte(page), bodyVariables, "localhost:3000")
+	if err != ErrBodyTooLarge || string(got) != page {
+		t.Errorf("Body() of %d bytes error = %v, changed = %v", len(page), err, string(got) != page)
+	}
+
+	// A small body that decompresses to a large one is not decompressed completely
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write([]byte(page))
+	writer.Close()
+	header = http.Header{"Content-Type": {"text/html"}, "Content-Encoding": {"gzip"}}
+	got, err = newBodyRules(t).Body(header, compressed.Bytes(), bodyVariables, "localhost:3000")
+	if err != ErrBodyTooLarge || !bytes.Equal(got, compressed.Bytes()) {
+		t.Errorf("Body() of compressed body error = %v", err)
+	}
+}
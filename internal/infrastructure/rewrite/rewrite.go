@@ -0,0 +1,184 @@
+package rewrite
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+)
+
+// Variables are the values of the variables rewrite rules can use
+type Variables struct {
+	// PublicHost is the host the visitor requested, with port if it has one
+	PublicHost string
+	// Scheme is the scheme the visitor used
+	Scheme string
+	// RemoteAddr is the IP of the visitor
+	RemoteAddr string
+	TunnelID   string
+	RequestID  string
+	// Prefix is the path prefix stripped by the route of the request; URLs in bodies get
+	// it back. It is not available as a variable.
+	Prefix string
+}
+
+// expand replaces the variables in a value
+func (v Variables) expand(value string) string {
+	if !strings.Contains(value, "${") {
+		return value
+	}
+	return model.RewriteVariablePattern.ReplaceAllStringFunc(value, func(match string) string {
+		switch match[2 : len(match)-1] {
+		case "public_host":
+			return v.PublicHost
+		case "scheme":
+			return v.Scheme
+		case "remote_addr":
+			return v.RemoteAddr
+		case "tunnel_id":
+			return v.TunnelID
+		case "request_id":
+			return v.RequestID
+		}
+		return match
+	})
+}
+
+// pathRule is a compiled path rewrite
+type pathRule struct {
+	expression *regexp.Regexp
+	replace    string
+}
+
+// Rules applies the rewrite rules of a tunnel
+type Rules struct {
+	config model.TunnelRewrite
+	paths  []pathRule
+}
+
+// Compile validates the rewrite rules of a tunnel. It returns nil if config is nil.
+func Compile(config *model.TunnelRewrite) (*Rules, error) {
+	if config == nil {
+		return nil, nil
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	rules := &Rules{config: *config}
+	for _, path := range config.Paths {
+		expression, err := path.Compile()
+		if err != nil {
+			return nil, err
+		}
+		rules.paths = append(rules.paths, pathRule{expression: expression, replace: path.Replace})
+	}
+	return rules, nil
+}
+
+// Request rewrites the path, Host and headers of a request to the local service
+func (r *Rules) Request(request *http.Request, variables Variables) {
+	path := request.URL.EscapedPath()
+	for _, rule := range r.paths {
+		if !rule.expression.MatchString(path) {
+			continue
+		}
+		rewritten, err := url.Parse(rule.expression.ReplaceAllString(path, rule.replace))
+		if err == nil {
+			request.URL.Path = rewritten.Path
+			request.URL.RawPath = rewritten.RawPath
+			if rewritten.ForceQuery || rewritten.RawQuery != "" {
+				request.URL.RawQuery = rewritten.RawQuery
+			}
+		}
+		break
+	}
+	if r.config.Host != "" {
+		request.Host = variables.expand(r.config.Host)
+	}
+	rewriteHeaders(request.Header, r.config.RequestHeaders, variables)
+}
+
+// Response rewrites the headers of a response of the local service at upstream
+func (r *Rules) Response(header http.Header, variables Variables, upstream string) {
+	if r.config.Location {
+		if location := header.Get("Location"); location != "" {
+			header.Set("Location", r.location(location, variables, upstream))
+		}
+	}
+	if r.config.CookieDomain != "" {
+		domain := variables.expand(r.config.CookieDomain)
+		if host, _, err := net.SplitHostPort(domain); err == nil {
+			domain = host
+		}
+		for i, cookie := range header["Set-Cookie"] {
+			header["Set-Cookie"][i] = cookieDomain(cookie, domain)
+		}
+	}
+	rewriteHeaders(header, r.config.ResponseHeaders, variables)
+}
+
+// location points an absolute Location at the local service to the public host
+func (r *Rules) location(location string, variables Variables, upstream string) string {
+	u, err := url.Parse(location)
+	if err != nil || !u.IsAbs() || u.Host == "" || variables.PublicHost == "" {
+		return location
+	}
+	host := strings.ToLower(u.Host)
+	if !sameHost(host, upstream) && (r.config.Host == "" || host != strings.ToLower(variables.expand(r.config.Host))) {
+		return location
+	}
+	u.Scheme = variables.Scheme
+	u.Host = variables.PublicHost
+	return u.String()
+}
+
+// sameHost reports whether two host:port addresses refer to the same local service,
+// treating the loopback names as equal
+func sameHost(a, b string) bool {
+	if a == b {
+		return true
+	}
+	hostA, portA, errA := net.SplitHostPort(a)
+	hostB, portB, errB := net.SplitHostPort(b)
+	return errA == nil && errB == nil && portA == portB && loopback(hostA) && loopback(hostB)
+}
+
+// loopback reports whether host names this machine
+func loopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// cookieDomain replaces the Domain attribute of a Set-Cookie value, if it has one
+func cookieDomain(cookie, domain string) string {
+	attributes := strings.Split(cookie, ";")
+	for i, attribute := range attributes {
+		name, _, _ := strings.Cut(strings.TrimSpace(attribute), "=")
+		if i > 0 && strings.EqualFold(name, "Domain") {
+			attributes[i] = " Domain=" + domain
+		}
+	}
+	return strings.Join(attributes, ";")
+}
+
+// rewriteHeaders removes, sets and adds headers
+func rewriteHeaders(header http.Header, rules *model.TunnelHeaderRewrite, variables Variables) {
+	if rules == nil {
+		return
+	}
+	for _, name := range rules.Remove {
+		header.Del(name)
+	}
+	for name, value := range rules.Set {
+		header.Set(name, variables.expand(value))
+	}
+	for name, value := range rules.Add {
+		header.Add(name, variables.expand(value))
+	}
+}
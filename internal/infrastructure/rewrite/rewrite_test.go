@@ -0,0 +1,213 @@
+package rewrite
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+)
+
+// compileRules compiles rewrite rules and fails the test on error
+func compileRules(t *testing.T, config model.TunnelRewrite) *Rules {
+	t.Helper()
+	rules, err := Compile(&config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rules
+}
+
+var responseVariables = Variables{PublicHost: "app.example.net", Scheme: "https", RequestID: "42"}
+
+func TestResponseLocation(t *testing.T) {
+	tests := []struct {
+		name     string
+		host     string
+		location string
+		want     string
+	}{
+		{"local service", "", "http://localhost:3000/login?next=/", "https://app.example.net/login?next=/"},
+		{"loopback alias", "", "http://127.0.0.1:3000/login", "https://app.example.net/login"},
+		{"other port", "", "http://localhost:3001/login", "http://localhost:3001/login"},
+		{"other host", "", "https://accounts.example.org/auth", "https://accounts.example.org/auth"},
+		{"relative", "", "/login", "/login"},
+		{"rewritten host", "internal.test", "http://internal.test/login", "https://app.example.net/login"},
+		{"rewritten host variable", "${public_host}", "http://app.example.net/login", "https://app.example.net/login"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := compileRules(t, model.TunnelRewrite{Location: true, Host: tt.host})
+			header := http.Header{"Location": {tt.location}}
+			rules.Response(header, responseVariables, "localhost:3000")
+			if got := header.Get("Location"); got != tt.want {
+				t.Errorf("Location = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	// Without the option the Location header is left alone
+	header := http.Header{"Location": {"http://localhost:3000/login"}}
+	compileRules(t, model.TunnelRewrite{}).Response(header, responseVariables, "localhost:3000")
+	if got := header.Get("Location"); got != "http://localhost:3000/login" {
+		t.Errorf("Location = %s without the location option", got)
+	}
+}
+
+func TestResponseCookieDomain(t *testing.T) {
+	tests := []struct {
+		name      string
+		domain    string
+		variables Variables
+		cookies   []string
+		want      []string
+	}{
+		{
+			name:      "domain attribute",
+			domain:    "${public_host}",
+			variables: responseVariables,
+			cookies:   []string{"session=1; Domain=localhost; Path=/; HttpOnly"},
+			want:      []string{"session=1; Domain=app.example.net; Path=/; HttpOnly"},
+		},
+		{
+			name:      "case insensitive attribute",
+			domain:    "example.net",
+			variables: responseVariables,
+			cookies:   []string{"a=1; domain=localhost", "b=2;DOMAIN=127.0.0.1;Secure"},
+			want:      []string{"a=1; Domain=example.net", "b=2; Domain=example.net;Secure"},
+		},
+		{
+			name:      "host-only cookie",
+			domain:    "${public_host}",
+			variables: responseVariables,
+			cookies:   []string{"session=1; Path=/"},
+			want:      []string{"session=1; Path=/"},
+		},
+		{
+			name:      "cookie named domain",
+			domain:    "example.net",
+			variables: responseVariables,
+			cookies:   []string{"domain=localhost; Path=/"},
+			want:      []string{"domain=localhost; Path=/"},
+		},
+		{
+			name:      "public host with port",
+			domain:    "${public_host}",
+			variables: Variables{PublicHost: "app.example.net:8443", Scheme: "https"},
+			cookies:   []string{"session=1; Domain=localhost"},
+			want:      []string{"session=1; Domain=app.example.net"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := compileRules(t, model.TunnelRewrite{CookieDomain: tt.domain})
+			header := http.Header{"Set-Cookie": append([]string{}, tt.cookies...)}
+			rules.Response(header, tt.variables, "localhost:3000")
+			if got := header["Set-Cookie"]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Set-Cookie = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  model.TunnelRewrite
+		url     string
+		path    string
+		query   string
+		host    string
+		headers http.Header
+	}{
+		{
+			name:   "path group",
+			config: model.TunnelRewrite{Paths: []model.TunnelPathRewrite{{Match: "^/old/(.*)", Replace: "/new/$1"}}},
+			url:    "/old/page?x=1",
+			path:   "/new/page",
+			query:  "x=1",
+			host:   "app.example.net",
+		},
+		{
+			name: "first matching path rule",
+			config: model.TunnelRewrite{Paths: []model.TunnelPathRewrite{
+				{Match: "^/api/v1/", Replace: "/v1/"},
+				{Match: "^/api/", Replace: "/latest/"},
+			}},
+			url:  "/api/v1/users",
+			path: "/v1/users",
+			host: "app.example.net",
+		},
+		{
+			name:   "replacement with query",
+			config: model.TunnelRewrite{Paths: []model.TunnelPathRewrite{{Match: "^/search$", Replace: "/find?engine=local"}}},
+			url:    "/search?q=go",
+			path:   "/find",
+			query:  "engine=local",
+			host:   "app.example.net",
+		},
+		{
+			name:   "no matching path rule",
+			config: model.TunnelRewrite{Paths: []model.TunnelPathRewrite{{Match: "^/old/", Replace: "/new/"}}},
+			url:    "/other",
+			path:   "/other",
+			host:   "app.example.net",
+		},
+		{
+			name:   "host",
+			config: model.TunnelRewrite{Host: "internal.test"},
+			url:    "/",
+			path:   "/",
+			host:   "internal.test",
+		},
+		{
+			name: "headers",
+			config: model.TunnelRewrite{RequestHeaders: &model.TunnelHeaderRewrite{
+				Remove: []string{"Cookie"},
+				Set:    map[string]string{"X-Forwarded-Host": "${public_host}"},
+				Add:    map[string]string{"X-Request-Id": "${request_id}"},
+			}},
+			url:  "/",
+			path: "/",
+			host: "app.example.net",
+			headers: http.Header{
+				"X-Forwarded-Host": {"app.example.net"},
+				"X-Request-Id":     {"0", "42"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := compileRules(t, tt.config)
+			request := httptest.NewRequest(http.MethodGet, "http://app.example.net"+tt.url, nil)
+			request.Header.Set("Cookie", "session=1")
+			request.Header.Set("X-Request-Id", "0")
+			rules.Request(request, responseVariables)
+
+			if request.URL.Path != tt.path || request.URL.RawQuery != tt.query {
+				t.Errorf("URL = %s, want path %s and query %s", request.URL, tt.path, tt.query)
+			}
+			if request.Host != tt.host {
+				t.Errorf("Host = %s, want %s", request.Host, tt.host)
+			}
+			for name, want := range tt.headers {
+				if got := request.Header.Values(name); !reflect.DeepEqual(got, want) {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+			if tt.config.RequestHeaders != nil && request.Header.Get("Cookie") != "" {
+				t.Error("the removed Cookie header is still sent")
+			}
+		})
+	}
+}
+
+func TestCompile(t *testing.T) {
+	if rules, err := Compile(nil); rules != nil || err != nil {
+		t.Errorf("Compile(nil) = %v, %v", rules, err)
+	}
+	if _, err := Compile(&model.TunnelRewrite{Paths: []model.TunnelPathRewrite{{Match: "(", Replace: "/"}}}); err == nil {
+		t.Error("Compile accepted an invalid path expression")
+	}
+}
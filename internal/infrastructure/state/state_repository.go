@@ -0,0 +1,104 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+	"github.com/haxorport/haxorport-go-client/internal/domain/port"
+)
+
+// StateRepository is an implementation of port.StateRepository that stores the state in a JSON file
+type StateRepository struct {
+	path string
+}
+
+// NewStateRepository creates a new StateRepository instance.
+// If path is empty, the default location is used.
+func NewStateRepository(path string) (*StateRepository, error) {
+	if path == "" {
+		var err error
+		path, err = GetDefaultPath()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &StateRepository{path: path}, nil
+}
+
+// Load loads the state from file. A missing file results in an empty state.
+func (r *StateRepository) Load() (*model.State, error) {
+	state := model.NewState()
+
+	data, err := os.ReadFile(r.path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading state file: %v", err)
+	}
+
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("error parsing state file %s: %v", r.path, err)
+	}
+	if state.Tunnels == nil {
+		state.Tunnels = make(map[string]model.TunnelState)
+	}
+
+	return state, nil
+}
+
+// Save saves the state to file. The file is replaced atomically so that
+// clients running at the same time never read a partially written file.
+func (r *StateRepository) Save(state *model.State) error {
+	dir := filepath.Dir(r.path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating state directory: %v", err)
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding state: %v", err)
+	}
+
+	tmpFile, err := os.CreateTemp(dir, ".state-*.json")
+	if err != nil {
+		return fmt.Errorf("error writing state file: %v", err)
+	}
+	tmpPath := tmpFile.Name()
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("error writing state file: %v", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("error writing state file: %v", err)
+	}
+	if err := os.Rename(tmpPath, r.path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("error writing state file: %v", err)
+	}
+
+	return nil
+}
+
+// Path returns the path of the state file
+func (r *StateRepository) Path() string {
+	return r.path
+}
+
+// GetDefaultPath returns the default path for the state file
+func GetDefaultPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("error getting home directory: %v", err)
+	}
+
+	return filepath.Join(homeDir, ".haxorport", "state.json"), nil
+}
+
+// Ensure StateRepository implements port.StateRepository
+var _ port.StateRepository = (*StateRepository)(nil)
@@ -0,0 +1,94 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+)
+
+func TestStateRepositoryLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		tunnels int
+		wantErr bool
+	}{
+		{"missing file", "", 0, false},
+		{"saved state", `{"tunnels": {"web": {"type": "http", "subdomain": "app"}}}`, 1, false},
+		{"no tunnels", `{}`, 0, false},
+		{"null tunnels", `{"tunnels": null}`, 0, false},
+		{"invalid JSON", `{"tunnels":`, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "state.json")
+			if tt.content != "" {
+				if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			repo, err := NewStateRepository(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			state, err := repo.Load()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if state.Tunnels == nil {
+				t.Fatal("Load() returned a nil tunnel map")
+			}
+			if len(state.Tunnels) != tt.tunnels {
+				t.Errorf("Load() returned %d tunnels, want %d", len(state.Tunnels), tt.tunnels)
+			}
+		})
+	}
+}
+
+func TestStateRepositorySave(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "nested", "state.json")
+	repo, err := NewStateRepository(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updated := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	state := model.NewState()
+	state.Tunnels["web"] = model.TunnelState{Type: model.TunnelTypeHTTP, Subdomain: "app", UpdatedAt: updated}
+	state.Tunnels["tcp:127.0.0.1:22"] = model.TunnelState{Type: model.TunnelTypeTCP, RemotePort: 4000, UpdatedAt: updated}
+	if err := repo.Save(state); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	loaded, err := repo.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range state.Tunnels {
+		got, ok := loaded.Tunnels[key]
+		if !ok || got.Type != want.Type || got.Subdomain != want.Subdomain || got.RemotePort != want.RemotePort || !got.UpdatedAt.Equal(want.UpdatedAt) {
+			t.Errorf("tunnel %s = %+v, want %+v", key, got, want)
+		}
+	}
+
+	// The file is replaced without leaving temporary files behind
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "state.json" {
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		t.Errorf("state directory contains %v", names)
+	}
+}
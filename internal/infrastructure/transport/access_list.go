@@ -0,0 +1,107 @@
+package transport
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// accessList restricts the visitors of a tunnel by source address. A visitor is
+// rejected if it matches a deny entry, or if allow entries exist and none matches.
+type accessList struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+// newAccessList parses the allowed and denied CIDRs of a tunnel. Plain IP addresses
+// are accepted as single-host networks. It returns nil if both lists are empty.
+func newAccessList(allowCIDRs, denyCIDRs []string) (*accessList, error) {
+	allow, err := parseCIDRs(allowCIDRs)
+	if err != nil {
+		return nil, err
+	}
+	deny, err := parseCIDRs(denyCIDRs)
+	if err != nil {
+		return nil, err
+	}
+	if len(allow) == 0 && len(deny) == 0 {
+		return nil, nil
+	}
+	return &accessList{allow: allow, deny: deny}, nil
+}
+
+// ValidateAccessList checks that all allowed and denied entries are valid CIDRs or IP addresses
+func ValidateAccessList(allowCIDRs, denyCIDRs []string) error {
+	_, err := newAccessList(allowCIDRs, denyCIDRs)
+	return err
+}
+
+// parseCIDRs parses a list of CIDRs or IP addresses
+func parseCIDRs(values []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid CIDR or IP address %q", value)
+			}
+			bits := 128
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %v", value, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// allows reports whether a visitor address ("ip" or "ip:port") may reach the tunnel.
+// A nil access list allows everyone; an unknown address is rejected by any access list.
+func (a *accessList) allows(addr string) bool {
+	if a == nil {
+		return true
+	}
+
+	ip := visitorIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, network := range a.deny {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	if len(a.allow) == 0 {
+		return true
+	}
+	for _, network := range a.allow {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// visitorIP extracts the IP address of a visitor address, with or without port
+func visitorIP(addr string) net.IP {
+	addr = strings.TrimSpace(addr)
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	addr = strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+	// Strip an IPv6 zone, it is not part of the address
+	if i := strings.LastIndex(addr, "%"); i >= 0 {
+		addr = addr[:i]
+	}
+	return net.ParseIP(addr)
+}
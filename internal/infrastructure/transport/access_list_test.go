@@ -0,0 +1,77 @@
+package transport
+
+import "testing"
+
+func TestAccessListAllows(t *testing.T) {
+	tests := []struct {
+		name  string
+		allow []string
+		deny  []string
+		addr  string
+		want  bool
+	}{
+		{"no list", nil, nil, "192.0.2.1:4000", true},
+		{"allowed network", []string{"192.0.2.0/24"}, nil, "192.0.2.1:4000", true},
+		{"other network", []string{"192.0.2.0/24"}, nil, "198.51.100.1:4000", false},
+		{"bare allowed IP", []string{"192.0.2.1"}, nil, "192.0.2.1", true},
+		{"bare IP is a single host", []string{"192.0.2.1"}, nil, "192.0.2.2:4000", false},
+		{"denied network", nil, []string{"192.0.2.0/24"}, "192.0.2.1:4000", false},
+		{"outside denied network", nil, []string{"192.0.2.0/24"}, "198.51.100.1:4000", true},
+		{"deny over allow", []string{"192.0.2.0/24"}, []string{"192.0.2.128/25"}, "192.0.2.200:4000", false},
+		{"allowed next to deny", []string{"192.0.2.0/24"}, []string{"192.0.2.128/25"}, "192.0.2.1:4000", true},
+		{"IPv6 network", []string{"2001:db8::/32"}, nil, "[2001:db8::1]:4000", true},
+		{"IPv6 without port", []string{"2001:db8::/32"}, nil, "2001:db8::1", true},
+		{"bracketed IPv6 without port", []string{"2001:db8::/32"}, nil, "[2001:db8::1]", true},
+		{"IPv6 with zone", []string{"fe80::/10"}, nil, "[fe80::1%eth0]:4000", true},
+		{"other IPv6 network", []string{"2001:db8::/32"}, nil, "[2001:db9::1]:4000", false},
+		{"bare IPv6 denied", nil, []string{"2001:db8::1"}, "[2001:db8::1]:4000", false},
+		{"IPv4-mapped IPv6", []string{"192.0.2.0/24"}, nil, "[::ffff:192.0.2.1]:4000", true},
+		{"IPv4 not in IPv6 list", []string{"2001:db8::/32"}, nil, "192.0.2.1:4000", false},
+		{"spaces around entries", []string{" 192.0.2.0/24 ", ""}, nil, "192.0.2.1:4000", true},
+		{"empty address", []string{"192.0.2.0/24"}, nil, "", false},
+		{"hostname", []string{"192.0.2.0/24"}, nil, "visitor.example.net:4000", false},
+		{"garbage", nil, []string{"192.0.2.0/24"}, "not an address", false},
+		{"port only", nil, []string{"192.0.2.0/24"}, ":4000", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			access, err := newAccessList(tt.allow, tt.deny)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := access.allows(tt.addr); got != tt.want {
+				t.Errorf("allows(%q) = %v, want %v", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewAccessListEmpty(t *testing.T) {
+	access, err := newAccessList([]string{"", " "}, nil)
+	if err != nil || access != nil {
+		t.Errorf("newAccessList() = %v, %v, want no list", access, err)
+	}
+}
+
+func TestValidateAccessList(t *testing.T) {
+	tests := []struct {
+		name    string
+		allow   []string
+		deny    []string
+		wantErr bool
+	}{
+		{"CIDRs and IPs", []string{"10.0.0.0/8", "192.0.2.1"}, []string{"2001:db8::/32", "::1"}, false},
+		{"empty", nil, nil, false},
+		{"invalid allowed IP", []string{"192.0.2.256"}, nil, true},
+		{"invalid denied CIDR", nil, []string{"192.0.2.0/33"}, true},
+		{"hostname", []string{"example.net"}, nil, true},
+		{"IP with port", nil, []string{"192.0.2.1:22"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateAccessList(tt.allow, tt.deny); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateAccessList() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,394 @@
+package transport
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+	"github.com/haxorport/haxorport-go-client/internal/domain/port"
+)
+
+const (
+	// defaultMaxFails is the number of connection errors in a row that eject an upstream
+	defaultMaxFails = 3
+	// defaultFailTimeout is how long an ejected upstream is left out
+	defaultFailTimeout = 30 * time.Second
+	// defaultHealthInterval is the time between health checks
+	defaultHealthInterval = 10 * time.Second
+	// defaultHealthTimeout limits a health check
+	defaultHealthTimeout = 2 * time.Second
+	// defaultHealthyThreshold is the number of passed checks that bring an upstream back
+	defaultHealthyThreshold = 2
+	// defaultUnhealthyThreshold is the number of failed checks that take an upstream out
+	defaultUnhealthyThreshold = 3
+	// stickyCookieName is the cookie that keeps visitors on an upstream
+	stickyCookieName = "haxorport_upstream"
+)
+
+// upstream is a local service of a balanced tunnel. The counters are guarded by the
+// mutex of the balancer.
+type upstream struct {
+	address string
+	// id identifies the upstream in the sticky cookie without revealing its address
+	id string
+
+	active   int
+	requests int64
+	failures int64
+	// fails counts connection errors in a row; ejectedUntil is set when it reaches maxFails
+	fails        int
+	ejectedUntil time.Time
+	// checkFailed is set while health checks fail; checkStreak counts the checks in a
+	// row whose result differs from it
+	checkFailed bool
+	checkStreak int
+	lastError   string
+}
+
+// balancer spreads the requests of a tunnel over its upstreams and takes unhealthy
+// upstreams out, actively with health checks and passively after connection errors
+type balancer struct {
+	strategy    model.LoadBalancingStrategy
+	upstreams   []*upstream
+	maxFails    int
+	failTimeout time.Duration
+	check       *model.TunnelHealthCheck
+	// cookiePath scopes the sticky cookie (/ if empty)
+	cookiePath string
+
+	mutex  sync.Mutex
+	next   int
+	logger port.Logger
+	done   chan struct{}
+}
+
+// newBalancer validates the upstreams and load balancing settings of a tunnel
+func newBalancer(addresses []string, config *model.TunnelLoadBalancing) (*balancer, error) {
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("no upstreams")
+	}
+	b := &balancer{
+		strategy:    model.LoadBalancingRoundRobin,
+		maxFails:    defaultMaxFails,
+		failTimeout: defaultFailTimeout,
+	}
+	seen := make(map[string]bool)
+	for _, value := range addresses {
+		address, err := model.NormalizeUpstream(value)
+		if err != nil {
+			return nil, err
+		}
+		if seen[address] {
+			return nil, fmt.Errorf("duplicate upstream %s", address)
+		}
+		seen[address] = true
+		sum := sha256.Sum256([]byte(address))
+		b.upstreams = append(b.upstreams, &upstream{address: address, id: hex.EncodeToString(sum[:8])})
+	}
+
+	if config == nil {
+		return b, nil
+	}
+	strategy, err := model.ParseLoadBalancingStrategy(string(config.Strategy))
+	if err != nil {
+		return nil, err
+	}
+	b.strategy = strategy
+	if config.MaxFails < 0 || config.FailTimeout < 0 {
+		return nil, fmt.Errorf("max_fails and fail_timeout must not be negative")
+	}
+	if config.MaxFails > 0 {
+		b.maxFails = config.MaxFails
+	}
+	if config.FailTimeout > 0 {
+		b.failTimeout = config.FailTimeout
+	}
+
+	if config.HealthCheck != nil {
+		check := *config.HealthCheck
+		if check.Path == "" || check.Path[0] != '/' {
+			return nil, fmt.Errorf("the health check path must start with /")
+		}
+		if check.Interval < 0 || check.Timeout < 0 || check.HealthyThreshold < 0 || check.UnhealthyThreshold < 0 {
+			return nil, fmt.Errorf("health check settings must not be negative")
+		}
+		if check.Interval == 0 {
+			check.Interval = defaultHealthInterval
+		}
+		if check.Timeout == 0 {
+			check.Timeout = defaultHealthTimeout
+		}
+		if check.HealthyThreshold == 0 {
+			check.HealthyThreshold = defaultHealthyThreshold
+		}
+		if check.UnhealthyThreshold == 0 {
+			check.UnhealthyThreshold = defaultUnhealthyThreshold
+		}
+		b.check = &check
+	}
+	return b, nil
+}
+
+// start runs the health checks in the background
+func (b *balancer) start(logger port.Logger) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.logger = logger
+	if b.check == nil || b.done != nil {
+		return
+	}
+	b.done = make(chan struct{})
+	go b.checkLoop(b.done)
+}
+
+// stop ends the health checks without waiting for checks in progress
+func (b *balancer) stop() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.done == nil {
+		return
+	}
+	close(b.done)
+	b.done = nil
+}
+
+// pick selects the upstream for a request and counts the request as in flight until
+// finish is called. Upstreams in skip are left out, so that a request can be retried
+// elsewhere. If all upstreams are out, the others are tried anyway. It returns nil if
+// every upstream was skipped.
+func (b *balancer) pick(request *model.HTTPRequest, skip map[*upstream]bool) *upstream {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	now := time.Now()
+	var candidates []*upstream
+	for _, u := range b.upstreams {
+		if !skip[u] && !u.checkFailed && !now.Before(u.ejectedUntil) {
+			candidates = append(candidates, u)
+		}
+	}
+	if len(candidates) == 0 {
+		for _, u := range b.upstreams {
+			if !skip[u] {
+				candidates = append(candidates, u)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	var chosen *upstream
+	switch b.strategy {
+	case model.LoadBalancingStickyCookie:
+		if id := stickyID(request); id != "" {
+			for _, u := range candidates {
+				if u.id == id {
+					chosen = u
+				}
+			}
+		}
+	case model.LoadBalancingIPHash:
+		hash := fnv.New32a()
+		hash.Write([]byte(remoteIP(request.RemoteAddr)))
+		sum := int(hash.Sum32() & 0x7fffffff)
+		// Prefer the upstream of the visitor among all, so that it does not change when others fail
+		preferred := b.upstreams[sum%len(b.upstreams)]
+		for _, u := range candidates {
+			if u == preferred {
+				chosen = u
+			}
+		}
+		if chosen == nil {
+			chosen = candidates[sum%len(candidates)]
+		}
+	case model.LoadBalancingLeastConnections:
+		for i := range candidates {
+			u := candidates[(b.next+i)%len(candidates)]
+			if chosen == nil || u.active < chosen.active {
+				chosen = u
+			}
+		}
+		b.next++
+	}
+	if chosen == nil {
+		// Rotate over all upstreams, so that the turns stay even while some are out
+		available := make(map[*upstream]bool, len(candidates))
+		for _, u := range candidates {
+			available[u] = true
+		}
+		for i := range b.upstreams {
+			index := (b.next + i) % len(b.upstreams)
+			if available[b.upstreams[index]] {
+				chosen = b.upstreams[index]
+				b.next = index + 1
+				break
+			}
+		}
+	}
+
+	chosen.active++
+	chosen.requests++
+	return chosen
+}
+
+// finish ends a request picked with pick. err is the connection error, if any; enough
+// errors in a row eject the upstream for a while.
+func (b *balancer) finish(u *upstream, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	u.active--
+	if err == nil {
+		u.fails = 0
+		return
+	}
+	u.failures++
+	u.fails++
+	u.lastError = err.Error()
+	if u.fails >= b.maxFails {
+		u.fails = 0
+		u.ejectedUntil = time.Now().Add(b.failTimeout)
+		if b.logger != nil {
+			b.logger.Warn("Upstream %s taken out for %v after %d connection errors", u.address, b.failTimeout, b.maxFails)
+		}
+	}
+}
+
+// stickyCookie returns the Set-Cookie value that keeps the visitor on u, or an empty
+// string if the request already carries it or the strategy does not use cookies
+func (b *balancer) stickyCookie(u *upstream, request *model.HTTPRequest) string {
+	if b.strategy != model.LoadBalancingStickyCookie || stickyID(request) == u.id {
+		return ""
+	}
+	path := b.cookiePath
+	if path == "" {
+		path = "/"
+	}
+	cookie := &http.Cookie{
+		Name:     stickyCookieName,
+		Value:    u.id,
+		Path:     path,
+		HttpOnly: true,
+		Secure:   request.Scheme == "https",
+		SameSite: http.SameSiteLaxMode,
+	}
+	return cookie.String()
+}
+
+// status returns the state of the upstreams
+func (b *balancer) status() []model.UpstreamStatus {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	now := time.Now()
+	statuses := make([]model.UpstreamStatus, 0, len(b.upstreams))
+	for _, u := range b.upstreams {
+		statuses = append(statuses, model.UpstreamStatus{
+			Address:   u.address,
+			Healthy:   !u.checkFailed && !now.Before(u.ejectedUntil),
+			Active:    u.active,
+			Requests:  u.requests,
+			Failures:  u.failures,
+			LastError: u.lastError,
+		})
+	}
+	return statuses
+}
+
+// checkLoop checks all upstreams right away and then at every interval
+func (b *balancer) checkLoop(done chan struct{}) {
+	client := &http.Client{
+		Timeout: b.check.Timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	ticker := time.NewTicker(b.check.Interval)
+	defer ticker.Stop()
+	for {
+		var wg sync.WaitGroup
+		for _, u := range b.upstreams {
+			wg.Add(1)
+			go func(u *upstream) {
+				defer wg.Done()
+				b.recordCheck(u, b.probe(client, u))
+			}(u)
+		}
+		wg.Wait()
+
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+	}
+}
+
+// probe requests the health check path of an upstream
+func (b *balancer) probe(client *http.Client, u *upstream) error {
+	resp, err := client.Get("http://" + u.address + b.check.Path)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("health check returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// recordCheck updates the health of an upstream after a check
+func (b *balancer) recordCheck(u *upstream, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if err == nil {
+		// A passing check ends an ejection after connection errors right away
+		u.ejectedUntil = time.Time{}
+		u.fails = 0
+	}
+	if (err != nil) == u.checkFailed {
+		u.checkStreak = 0
+		return
+	}
+	u.checkStreak++
+	if err != nil {
+		u.lastError = err.Error()
+		if u.checkStreak >= b.check.UnhealthyThreshold {
+			u.checkFailed = true
+			u.checkStreak = 0
+			if b.logger != nil {
+				b.logger.Warn("Upstream %s is unhealthy: %v", u.address, err)
+			}
+		}
+		return
+	}
+	if u.checkStreak >= b.check.HealthyThreshold {
+		u.checkFailed = false
+		u.checkStreak = 0
+		if b.logger != nil {
+			b.logger.Info("Upstream %s is healthy again", u.address)
+		}
+	}
+}
+
+// stickyID returns the upstream ID in the sticky cookie of a request
+func stickyID(request *model.HTTPRequest) string {
+	cookie, err := (&http.Request{Header: request.Headers}).Cookie(stickyCookieName)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// remoteIP returns the IP of a visitor address with or without port
+func remoteIP(address string) string {
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		return host
+	}
+	return address
+}
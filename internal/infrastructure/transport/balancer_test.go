@@ -0,0 +1,149 @@
+package transport
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+)
+
+func TestNewBalancer(t *testing.T) {
+	tests := []struct {
+		name      string
+		upstreams []string
+		config    *model.TunnelLoadBalancing
+		wantErr   bool
+	}{
+		{"defaults", []string{"3000", "localhost:3001"}, nil, false},
+		{"no upstreams", nil, nil, true},
+		{"duplicate upstream", []string{"3000", "localhost:3000"}, nil, true},
+		{"invalid strategy", []string{"3000"}, &model.TunnelLoadBalancing{Strategy: "random"}, true},
+		{"negative max fails", []string{"3000"}, &model.TunnelLoadBalancing{MaxFails: -1}, true},
+		{"relative check path", []string{"3000"}, &model.TunnelLoadBalancing{HealthCheck: &model.TunnelHealthCheck{Path: "health"}}, true},
+		{"health check", []string{"3000"}, &model.TunnelLoadBalancing{HealthCheck: &model.TunnelHealthCheck{Path: "/health"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newBalancer(tt.upstreams, tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("newBalancer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBalancerRoundRobinSkipsEjected(t *testing.T) {
+	b, err := newBalancer([]string{"3000", "3001"}, &model.TunnelLoadBalancing{MaxFails: 1, FailTimeout: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := &model.HTTPRequest{Headers: http.Header{}}
+
+	first := b.pick(request, nil)
+	b.finish(first, errors.New("connection refused"))
+	for i := 0; i < 3; i++ {
+		u := b.pick(request, nil)
+		if u == first {
+			t.Fatalf("pick %d returned the ejected upstream %s", i, u.address)
+		}
+		b.finish(u, nil)
+	}
+
+	// With every upstream skipped there is nothing left to try
+	if u := b.pick(request, map[*upstream]bool{b.upstreams[0]: true, b.upstreams[1]: true}); u != nil {
+		t.Errorf("pick with all upstreams skipped = %s, want nil", u.address)
+	}
+}
+
+func TestBalancerPassingCheckEndsEjection(t *testing.T) {
+	b, err := newBalancer([]string{"3000"}, &model.TunnelLoadBalancing{
+		MaxFails:    1,
+		FailTimeout: time.Hour,
+		HealthCheck: &model.TunnelHealthCheck{Path: "/health", HealthyThreshold: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := b.upstreams[0]
+	b.pick(&model.HTTPRequest{Headers: http.Header{}}, nil)
+	b.finish(u, errors.New("connection refused"))
+	if b.status()[0].Healthy {
+		t.Fatal("upstream is healthy after reaching max fails")
+	}
+
+	// The health checks never failed, so one passing check brings the upstream back
+	b.recordCheck(u, nil)
+	if !b.status()[0].Healthy {
+		t.Error("upstream is still ejected after a passing health check")
+	}
+}
+
+func TestBalancerCheckThresholds(t *testing.T) {
+	b, err := newBalancer([]string{"3000"}, &model.TunnelLoadBalancing{
+		HealthCheck: &model.TunnelHealthCheck{Path: "/health", HealthyThreshold: 2, UnhealthyThreshold: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := b.upstreams[0]
+	failed := errors.New("health check returned 500")
+
+	steps := []struct {
+		err     error
+		healthy bool
+	}{
+		{failed, true},
+		{nil, true},
+		{failed, true},
+		{failed, false},
+		{nil, false},
+		{nil, true},
+	}
+	for i, step := range steps {
+		b.recordCheck(u, step.err)
+		if healthy := b.status()[0].Healthy; healthy != step.healthy {
+			t.Fatalf("after check %d healthy = %v, want %v", i, healthy, step.healthy)
+		}
+	}
+}
+
+func TestBalancerStartStop(t *testing.T) {
+	b, err := newBalancer([]string{"127.0.0.1:1"}, &model.TunnelLoadBalancing{
+		HealthCheck: &model.TunnelHealthCheck{Path: "/health", Interval: time.Hour, Timeout: 100 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			b.start(testLogger{})
+			b.stop()
+		}
+	}()
+	b.start(testLogger{})
+	b.stop()
+	<-done
+	b.stop()
+}
+
+func TestBalancerIPHashIsStable(t *testing.T) {
+	b, err := newBalancer([]string{"3000", "3001", "3002"}, &model.TunnelLoadBalancing{Strategy: model.LoadBalancingIPHash})
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := &model.HTTPRequest{Headers: http.Header{}, RemoteAddr: "192.0.2.7:5000"}
+	first := b.pick(request, nil)
+	b.finish(first, nil)
+	for i := 0; i < 5; i++ {
+		request.RemoteAddr = "192.0.2.7:" + string(rune('1'+i)) + "000"
+		if u := b.pick(request, nil); u != first {
+			t.Fatalf("visitor moved from %s to %s", first.address, u.address)
+		} else {
+			b.finish(u, nil)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package transport
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+	"github.com/haxorport/haxorport-go-client/internal/domain/service"
+)
+
+// sessionRenewMargin is how long before expiry a session stops being used
+const sessionRenewMargin = 30 * time.Second
+
+// challengeAuthenticator answers server challenges with an HMAC derived from the token.
+// Once the server issues a short-lived session, later challenges are signed with the
+// session key so the long-lived token is not used again until the session expires.
+type challengeAuthenticator struct {
+	token   string
+	session *model.AuthSession
+	mutex   sync.Mutex
+}
+
+// newChallengeAuthenticator creates a new challengeAuthenticator for the given token
+func newChallengeAuthenticator(token string) *challengeAuthenticator {
+	return &challengeAuthenticator{token: token}
+}
+
+// Respond signs the server nonce for a connection with the given purpose
+func (a *challengeAuthenticator) Respond(purpose, serverNonce string) (*model.AuthResponsePayload, error) {
+	if a.token == "" {
+		return nil, fmt.Errorf("authentication token is empty")
+	}
+
+	clientNonce, err := service.NewNonce()
+	if err != nil {
+		return nil, err
+	}
+
+	keyID, secret := service.TokenKeyID(a.token), a.token
+	a.mutex.Lock()
+	if a.session != nil && time.Until(time.Unix(a.session.ExpiresAt, 0)) > sessionRenewMargin {
+		keyID, secret = a.session.ID, a.session.Key
+	}
+	a.mutex.Unlock()
+
+	signature, err := service.SignChallenge(secret, purpose, serverNonce, clientNonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.AuthResponsePayload{
+		KeyID:       keyID,
+		ClientNonce: clientNonce,
+		Signature:   signature,
+	}, nil
+}
+
+// SetSession stores the short-lived session issued by the server
+func (a *challengeAuthenticator) SetSession(session *model.AuthSession) {
+	if session == nil || session.ID == "" || session.Key == "" {
+		return
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.session = session
+}
+
+// ClearSession forgets the session so the next challenge is signed with the token
+func (a *challengeAuthenticator) ClearSession() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.session = nil
+}
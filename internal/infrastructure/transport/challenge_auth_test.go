@@ -0,0 +1,92 @@
+package transport
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+	"github.com/haxorport/haxorport-go-client/internal/domain/service"
+)
+
+func TestChallengeAuthenticatorSession(t *testing.T) {
+	serverNonce := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef"))
+	tokenKeyID := service.TokenKeyID("token")
+	session := func(expiresIn time.Duration) *model.AuthSession {
+		return &model.AuthSession{ID: "sess_1", Key: "session-key", ExpiresAt: time.Now().Add(expiresIn).Unix()}
+	}
+
+	tests := []struct {
+		name    string
+		session *model.AuthSession
+		clear   bool
+		wantKey string
+	}{
+		{"no session", nil, false, tokenKeyID},
+		{"valid session", session(time.Hour), false, "sess_1"},
+		{"session about to expire", session(sessionRenewMargin - time.Second), false, tokenKeyID},
+		{"expired session", session(-time.Minute), false, tokenKeyID},
+		{"cleared session", session(time.Hour), true, tokenKeyID},
+		{"session without key", &model.AuthSession{ID: "sess_1", ExpiresAt: time.Now().Add(time.Hour).Unix()}, false, tokenKeyID},
+		{"session without ID", &model.AuthSession{Key: "session-key", ExpiresAt: time.Now().Add(time.Hour).Unix()}, false, tokenKeyID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := newChallengeAuthenticator("token")
+			auth.SetSession(tt.session)
+			if tt.clear {
+				auth.ClearSession()
+			}
+
+			response, err := auth.Respond("control", serverNonce)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if response.KeyID != tt.wantKey {
+				t.Errorf("KeyID = %q, want %q", response.KeyID, tt.wantKey)
+			}
+			secret := "token"
+			if tt.wantKey == "sess_1" {
+				secret = "session-key"
+			}
+			want, err := service.SignChallenge(secret, "control", serverNonce, response.ClientNonce)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if response.Signature != want {
+				t.Errorf("Signature = %s, want the signature with the key of %s", response.Signature, tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestChallengeAuthenticatorReusesSession(t *testing.T) {
+	serverNonce := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef"))
+	auth := newChallengeAuthenticator("token")
+	auth.SetSession(&model.AuthSession{ID: "sess_1", Key: "session-key", ExpiresAt: time.Now().Add(time.Hour).Unix()})
+
+	first, err := auth.Respond("control", serverNonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := auth.Respond("data", serverNonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.KeyID != "sess_1" || second.KeyID != "sess_1" {
+		t.Errorf("key IDs = %q, %q, want the session for both", first.KeyID, second.KeyID)
+	}
+	// Every answer has its own client nonce, so no two signatures are the same
+	if first.ClientNonce == second.ClientNonce || first.Signature == second.Signature {
+		t.Error("answers share a client nonce or signature")
+	}
+}
+
+func TestChallengeAuthenticatorErrors(t *testing.T) {
+	if _, err := newChallengeAuthenticator("").Respond("control", base64.StdEncoding.EncodeToString([]byte("0123456789abcdef"))); err == nil {
+		t.Error("Respond() signed a challenge without a token")
+	}
+	if _, err := newChallengeAuthenticator("token").Respond("control", "short"); err == nil {
+		t.Error("Respond() signed an invalid server nonce")
+	}
+}
@@ -1,7 +1,6 @@
 package transport
 
 import (
-	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"net/url"
@@ -10,6 +9,7 @@ import (
 
 	"github.com/gorilla/websocket"
 	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+	"github.com/haxorport/haxorport-go-client/internal/infrastructure/httpauth"
 	"github.com/haxorport/haxorport-go-client/internal/domain/port"
 	"github.com/haxorport/haxorport-go-client/internal/domain/service"
 )
@@ -34,6 +34,16 @@ type Client struct {
 	subdomain    string 
 	config       *model.Config
 	userData     *model.AuthData 
+	// authenticator answers server challenges in challenge authentication mode
+	authenticator *challengeAuthenticator
+	// httpTunnels holds the client-side policies of registered tunnels by tunnel ID
+	httpTunnels map[string]*httpTunnel
+	// httpObservers are notified of every proxied HTTP exchange
+	httpObservers []port.HTTPObserver
+	// httpFallback answers HTTP requests when the local service cannot be reached
+	httpFallback port.HTTPFallback
+	// maintenance answers HTTP requests with the maintenance page instead of forwarding them
+	maintenance bool
 }
 
 
@@ -53,6 +63,8 @@ func NewClient(config *model.Config, logger port.Logger) *Client {
 		logger:       logger,
 		handlers:     make(map[model.MessageType]func(*model.Message) error),
 		config:       config,
+		authenticator: newChallengeAuthenticator(config.AuthToken),
+		httpTunnels:   make(map[string]*httpTunnel),
 	}
 }
 
@@ -105,26 +117,17 @@ func (c *Client) Connect() error {
 	// Determine protocol (ws or wss)
 	var protocol string
 
-	// Create dialer
-	dialer := websocket.DefaultDialer
+	// Create dialer (copy so the shared default dialer is not modified)
+	dialer := *websocket.DefaultDialer
 
 	// Enable TLS if configured
 	if c.tlsEnabled {
 		protocol = "wss"
 
-		// Create TLS config
-		tlsConfig := &tls.Config{}
-
-		// Load TLS certificate and key if provided
-		if c.tlsCert != "" && c.tlsKey != "" {
-			cert, err := tls.LoadX509KeyPair(c.tlsCert, c.tlsKey)
-			if err != nil {
-				return fmt.Errorf("failed to load TLS certificate: %v", err)
-			}
-			tlsConfig.Certificates = []tls.Certificate{cert}
-		} else {
-			// Skip TLS verification if no certificate is provided
-			tlsConfig.InsecureSkipVerify = true
+		// Create TLS config with the configured verification, CA and pinning options
+		tlsConfig, err := NewTLSConfig(c.config)
+		if err != nil {
+			return err
 		}
 
 		dialer.TLSClientConfig = tlsConfig
@@ -151,40 +154,130 @@ func (c *Client) Connect() error {
 	c.conn = conn
 	c.isConnected = true
 
-	// Create authentication message
-	authPayload := model.AuthPayload{
-		Token: c.authToken,
+	// Authenticate if authentication is enabled
+	if c.authEnabled {
+		if err := c.authenticate(); err != nil {
+			c.logger.Error("Failed to authenticate: %v", err)
+			// The mutex is held here, so close the connection directly instead of calling Close
+			c.conn.Close()
+			c.conn = nil
+			c.isConnected = false
+			return err
+		}
 	}
-	authMessage, err := model.NewMessage(model.MessageTypeAuth, authPayload)
+
+	// Start read pump
+	go c.readPump()
+
+	c.logger.Info("Connected to server: %s", serverURL)
+
+	return nil
+}
+
+// authenticate sends the authentication message on a freshly dialed connection.
+// In challenge mode the token itself is never sent: the server nonce is answered
+// with an HMAC instead. The caller must hold c.mutex.
+func (c *Client) authenticate() error {
+	if c.config.AuthMode != model.AuthModeChallenge {
+		// Create authentication message
+		authMessage, err := model.NewMessage(model.MessageTypeAuth, model.AuthPayload{
+			Token: c.authToken,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create authentication message: %v", err)
+		}
+		return c.writeMessageLocked(authMessage)
+	}
+
+	authMessage, err := model.NewMessage(model.MessageTypeAuth, model.AuthPayload{
+		Mode: model.AuthModeChallenge,
+	})
 	if err != nil {
-		c.Close()
 		return fmt.Errorf("failed to create authentication message: %v", err)
 	}
+	if err := c.writeMessageLocked(authMessage); err != nil {
+		return err
+	}
 
-	// Marshal authentication message to JSON
-	data, err := json.Marshal(authMessage)
+	// Wait for the server nonce
+	challengeMsg, err := c.readMessageLocked(model.MessageTypeAuthChallenge)
 	if err != nil {
-		c.Close()
-		return fmt.Errorf("failed to convert authentication message to JSON: %v", err)
+		return err
+	}
+	var challenge model.AuthChallengePayload
+	if err := challengeMsg.ParsePayload(&challenge); err != nil {
+		return fmt.Errorf("failed to parse authentication challenge: %v", err)
 	}
 
-	// Send authentication message if authentication is enabled
-	if c.authEnabled {
-		if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
-			c.logger.Error("Failed to send authentication message: %v", err)
-			c.Close()
-			return fmt.Errorf("failed to send authentication: %v", err)
-		}
+	answer, err := c.authenticator.Respond("websocket", challenge.Nonce)
+	if err != nil {
+		return fmt.Errorf("failed to answer authentication challenge: %v", err)
+	}
+	responseMsg, err := model.NewMessage(model.MessageTypeAuthResponse, answer)
+	if err != nil {
+		return fmt.Errorf("failed to create authentication response: %v", err)
+	}
+	if err := c.writeMessageLocked(responseMsg); err != nil {
+		return err
 	}
 
-	// Start read pump
-	go c.readPump()
+	// Wait for the verdict
+	resultMsg, err := c.readMessageLocked(model.MessageTypeAuthResult)
+	if err != nil {
+		return err
+	}
+	var result model.AuthResultPayload
+	if err := resultMsg.ParsePayload(&result); err != nil {
+		return fmt.Errorf("failed to parse authentication result: %v", err)
+	}
+	if !result.Success {
+		// A rejected session must not be used again
+		c.authenticator.ClearSession()
+		return fmt.Errorf("Authentication failed: %s", result.Error)
+	}
+	c.authenticator.SetSession(result.Session)
 
-	c.logger.Info("Connected to server: %s", serverURL)
+	c.logger.Info("Authenticated with challenge-response")
+	return nil
+}
 
+// writeMessageLocked sends a message on the connection. The caller must hold c.mutex.
+func (c *Client) writeMessageLocked(msg *model.Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to convert message to JSON: %v", err)
+	}
+	if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		return fmt.Errorf("failed to send message: %v", err)
+	}
 	return nil
 }
 
+// readMessageLocked reads the next message during the authentication exchange and
+// checks its type. The caller must hold c.mutex.
+func (c *Client) readMessageLocked(expected model.MessageType) (*model.Message, error) {
+	c.conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	defer c.conn.SetReadDeadline(time.Time{})
+
+	_, data, err := c.conn.ReadMessage()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read authentication message: %v", err)
+	}
+	var msg model.Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, fmt.Errorf("failed to parse authentication message: %v", err)
+	}
+	if msg.Type == model.MessageTypeError {
+		var errorPayload model.ErrorPayload
+		msg.ParsePayload(&errorPayload)
+		return nil, fmt.Errorf("error from server: %s - %s", errorPayload.Code, errorPayload.Message)
+	}
+	if msg.Type != expected {
+		return nil, fmt.Errorf("unexpected message type %s (expected %s)", msg.Type, expected)
+	}
+	return &msg, nil
+}
+
 // Close closes the client connection.
 func (c *Client) Close() {
 	c.mutex.Lock()
@@ -328,6 +421,12 @@ func (c *Client) readPump() {
 
 // SendRegisterTunnel sends a tunnel registration request to the server.
 func (c *Client) SendRegisterTunnel(config model.TunnelConfig) (*model.RegisterResponsePayload, error) {
+	// Validate the client-side policies before registering anything on the server
+	tunnel, err := newHTTPTunnel(config)
+	if err != nil {
+		return nil, err
+	}
+
 	c.subdomain = config.Subdomain
 
 	responseCh := make(chan *model.RegisterResponsePayload, 1)
@@ -361,7 +460,12 @@ func (c *Client) SendRegisterTunnel(config model.TunnelConfig) (*model.RegisterR
 		LocalAddr:  config.LocalAddr,
 		LocalPort:  config.LocalPort,
 		RemotePort: config.RemotePort,
-		Auth:       config.Auth,
+	}
+	// Auth the server cannot enforce by itself is only checked by the client
+	if httpauth.ServerEnforceable(config.Auth) {
+		payload.Auth = config.Auth
+	} else if config.Auth != nil {
+		c.logger.Info("Tunnel auth (%s) is enforced by the client only", config.Auth.Type)
 	}
 
 	msg, err := model.NewMessage(model.MessageTypeRegister, payload)
@@ -378,6 +482,7 @@ func (c *Client) SendRegisterTunnel(config model.TunnelConfig) (*model.RegisterR
 		if !response.Success {
 			return nil, fmt.Errorf("tunnel registration failed: %s", response.Error)
 		}
+		c.addHTTPTunnel(response.TunnelID, tunnel)
 		return response, nil
 	case err := <-errCh:
 		return nil, err
@@ -388,6 +493,8 @@ func (c *Client) SendRegisterTunnel(config model.TunnelConfig) (*model.RegisterR
 
 
 func (c *Client) SendUnregisterTunnel(tunnelID string) error {
+	c.removeHTTPTunnel(tunnelID)
+
 	payload := model.UnregisterPayload{
 		TunnelID: tunnelID,
 	}
@@ -2,12 +2,19 @@ package transport
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+	"github.com/haxorport/haxorport-go-client/internal/domain/port"
+	"github.com/haxorport/haxorport-go-client/internal/infrastructure/errorpage"
+	"github.com/haxorport/haxorport-go-client/internal/infrastructure/httpauth"
+	"github.com/haxorport/haxorport-go-client/internal/infrastructure/rewrite"
 )
 
 // HandleHTTPRequestMessage menangani pesan permintaan HTTP dari server
@@ -21,18 +28,194 @@ func (c *Client) HandleHTTPRequestMessage(msg *model.Message) error {
 
 	c.logger.Info("Received HTTP request: %s %s", request.Method, request.URL)
 
+	// Keep the request as received for observers, policies may change its headers
+	started := time.Now()
+	original := request.Clone()
+	response := c.handleHTTPRequest(request)
+	c.observeHTTPExchange(&model.HTTPExchange{
+		Request:  original,
+		Response: response,
+		Started:  started,
+		Duration: time.Since(started),
+	})
+
+	// Send response to server
+	return c.sendHTTPResponse(response)
+}
+
+// handleHTTPRequest applies the client-side policies of the tunnel to a request and
+// forwards it to the local service
+func (c *Client) handleHTTPRequest(request *model.HTTPRequest) *model.HTTPResponse {
+	// Fail closed: without a known tunnel its access list and auth cannot be applied
+	tunnel := c.getHTTPTunnel(request.TunnelID)
+	if tunnel == nil {
+		c.logger.Warn("Rejected HTTP request %s %s from %q: unknown tunnel %q",
+			request.Method, request.URL, request.RemoteAddr, request.TunnelID)
+		return httpStatusResponse(request.ID, http.StatusForbidden, nil)
+	}
+
+	// Reject visitors not allowed by the access list before contacting the local service
+	if !tunnel.access.allows(request.RemoteAddr) {
+		c.logger.Warn("Rejected HTTP request %s %s from %q: source address not allowed by the access list",
+			request.Method, request.URL, request.RemoteAddr)
+		return httpStatusResponse(request.ID, http.StatusForbidden, nil)
+	}
+
+	// Keep the tunnel registered but do not contact the local service in maintenance mode
+	if c.Maintenance() {
+		return c.maintenanceResponse(tunnel, request)
+	}
+
+	// Auth may set headers for the local service, such as JWT claims
+	if request.Headers == nil {
+		request.Headers = http.Header{}
+	}
+
+	// Verify the credentials as well, in case the server does not enforce them
+	if tunnel.auth != nil {
+		user, err := tunnel.auth.Verify(request.Headers)
+		if err != nil {
+			c.logger.Warn("Rejected HTTP request %s %s from %q: authentication failed for user %q: %v",
+				request.Method, request.URL, request.RemoteAddr, user, err)
+			return httpStatusResponse(request.ID, http.StatusUnauthorized, tunnel.auth.Challenge())
+		}
+		if user != "" {
+			c.logger.Debug("Authenticated user %s for HTTP request %s %s", user, request.Method, request.URL)
+		}
+	}
+
+	// Let the login gate answer requests of visitors without a session
+	if tunnel.gate != nil {
+		user, response, err := tunnel.gate.Authorize(gateRequest(request))
+		if err != nil {
+			c.logger.Warn("Rejected HTTP request %s %s from %q: login failed for user %q: %v",
+				request.Method, request.URL, request.RemoteAddr, user, err)
+		} else if response != nil && user != "" {
+			c.logger.Info("User %s logged in from %q", user, request.RemoteAddr)
+		}
+		if response != nil {
+			return &model.HTTPResponse{
+				ID:         request.ID,
+				StatusCode: response.StatusCode,
+				Headers:    response.Header,
+				Body:       response.Body,
+			}
+		}
+		if user != "" {
+			request.Headers.Set("X-Forwarded-User", user)
+		} else {
+			request.Headers.Del("X-Forwarded-User")
+		}
+	}
+
+	return c.forwardHTTPRequest(tunnel, request, false, 0)
+}
+
+// forwardHTTPRequest sends a request of a resolved tunnel to the local service and
+// returns its response. Live and replayed requests share it; log messages of replays
+// are marked. A port other than 0 sends the request straight to that local port.
+func (c *Client) forwardHTTPRequest(tunnel *httpTunnel, request *model.HTTPRequest, replay bool, port int) *model.HTTPResponse {
+	mark := ""
+	if replay {
+		mark = "[replay] "
+	}
+
 	// Create HTTP request to local service on client computer
 	// Always use HTTP for local connections, regardless of the scheme received from server
 	// This is because local services typically only support HTTP
 	scheme := "http"
 	
-	// Use localhost on client computer, not on server
-	targetURL := fmt.Sprintf("%s://localhost:%d%s", scheme, request.LocalPort, request.URL)
-	c.logger.Info("Sending request to local service: %s", targetURL)
+	// Reject requests that cannot be sent before contacting the local service
+	if _, err := http.NewRequest(request.Method, scheme+"://localhost"+request.URL, nil); err != nil {
+		c.logger.Error("%sFailed to create local HTTP request: %v", mark, err)
+		return c.httpPageResponse(tunnel, request, http.StatusBadRequest, errorpage.MessageBadRequest)
+	}
+
+	resp, body, err := c.sendLocalHTTPRequest(tunnel, request, scheme, mark, port)
+	if err != nil {
+		// Answer with a recorded response if the local service is down
+		if fallback := c.getHTTPFallback(); fallback != nil && !replay && isDialError(err) {
+			if response, ok := fallback.FallbackHTTPResponse(request); ok {
+				c.logger.Warn("Local service unreachable, serving recorded response %d for %s %s",
+					response.StatusCode, request.Method, request.URL)
+				response.ID = request.ID
+				return response
+			}
+		}
+		return c.upstreamErrorResponse(tunnel, request, err)
+	}
+
+	// Create HTTP response
+	response := &model.HTTPResponse{
+		ID:         request.ID,
+		StatusCode: resp.StatusCode,
+		Headers:    resp.Header,
+		Body:       body,
+	}
+	// Replays may be sent to another port and must not replace live responses
+	if fallback := c.getHTTPFallback(); fallback != nil && !replay {
+		fallback.RecordHTTPResponse(request, response)
+	}
+	return response
+}
+
+// sendLocalHTTPRequest sends a request to the local service, or to an upstream of a
+// balanced or routed tunnel, and reads the response. Connection errors are retried on
+// the other upstreams, as nothing was sent yet. A port other than 0 bypasses the routes
+// and balancers.
+func (c *Client) sendLocalHTTPRequest(tunnel *httpTunnel, request *model.HTTPRequest, scheme, mark string, port int) (*http.Response, []byte, error) {
+	// The variables of the rewrite rules describe the request of the visitor
+	variables := c.rewriteVariables(request)
+	if port > 0 {
+		return c.doLocalHTTPRequest(tunnel, request, scheme, fmt.Sprintf("localhost:%d", port), variables, mark)
+	}
+	pool := tunnel.balancer
+	if r := matchRoute(tunnel.routes, request); r != nil {
+		c.logger.Info("%sRequest %s %s matches route %s", mark, request.Method, request.URL, r.config)
+		pool = r.balancer
+		request = r.apply(request)
+		if r.config.StripPrefix {
+			variables.Prefix = strings.TrimSuffix(r.config.Path, "/")
+		}
+	}
+	if pool == nil {
+		address := fmt.Sprintf("localhost:%d", request.LocalPort)
+		return c.doLocalHTTPRequest(tunnel, request, scheme, address, variables, mark)
+	}
+
+	tried := make(map[*upstream]bool)
+	var lastErr error
+	for {
+		u := pool.pick(request, tried)
+		if u == nil {
+			return nil, nil, lastErr
+		}
+		tried[u] = true
+		resp, body, err := c.doLocalHTTPRequest(tunnel, request, scheme, u.address, variables, mark)
+		pool.finish(u, err)
+		if err != nil && isDialError(err) {
+			c.logger.Warn("%sUpstream %s unreachable, trying the next one", mark, u.address)
+			lastErr = err
+			continue
+		}
+		if err == nil {
+			if cookie := pool.stickyCookie(u, request); cookie != "" {
+				resp.Header.Add("Set-Cookie", cookie)
+			}
+		}
+		return resp, body, err
+	}
+}
+
+// doLocalHTTPRequest sends a request to a local address and reads the response. The
+// rewrite rules of the tunnel are applied to both.
+func (c *Client) doLocalHTTPRequest(tunnel *httpTunnel, request *model.HTTPRequest, scheme, address string, variables rewrite.Variables, mark string) (*http.Response, []byte, error) {
+	targetURL := fmt.Sprintf("%s://%s%s", scheme, address, request.URL)
+	c.logger.Info("%sSending request to local service: %s", mark, targetURL)
 	httpReq, err := http.NewRequest(request.Method, targetURL, bytes.NewReader(request.Body))
 	if err != nil {
-		c.logger.Error("Failed to create local HTTP request: %v", err)
-		return c.sendHTTPErrorResponse(request.ID, err)
+		c.logger.Error("%sFailed to create local HTTP request: %v", mark, err)
+		return nil, nil, err
 	}
 
 	// Copy headers
@@ -47,91 +230,54 @@ func (c *Client) HandleHTTPRequestMessage(msg *model.Message) error {
 	httpReq.Header.Set("X-Forwarded-Proto", scheme) // Use the scheme received from the server
 	httpReq.Header.Set("X-Forwarded-For", request.RemoteAddr)
 
+	// Apply the rewrite rules after the forwarding headers, so that rules can change them
+	if tunnel.rewrite != nil {
+		tunnel.rewrite.Request(httpReq, variables)
+	}
+
 	// Send request to local service via reverse connection
-	c.logger.Info("Making HTTP connection to local service with method %s", request.Method)
-	client := &http.Client{}
+	c.logger.Info("%sMaking HTTP connection to local service with method %s", mark, request.Method)
+	client := &http.Client{Timeout: tunnel.config.UpstreamTimeout}
 	resp, err := client.Do(httpReq)
 	if err != nil {
-		c.logger.Error("Failed to send local HTTP request: %v", err)
-		return c.sendHTTPErrorResponse(request.ID, err)
+		c.logger.Error("%sFailed to send local HTTP request: %v", mark, err)
+		return nil, nil, err
 	}
-	c.logger.Info("Successfully connected to local service, status: %d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	c.logger.Info("%sSuccessfully connected to local service, status: %d %s", mark, resp.StatusCode, http.StatusText(resp.StatusCode))
 	defer resp.Body.Close()
 
 	// Read response body
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		c.logger.Error("Failed to read response body: %v", err)
-		return c.sendHTTPErrorResponse(request.ID, err)
-	}
-
-	// Check Content-Type to determine if it's HTML
-	contentType := resp.Header.Get("Content-Type")
-	if strings.Contains(contentType, "text/html") {
-		// Replace local URLs with tunnel URLs in HTML response
-		localURLPrefix := fmt.Sprintf("http://localhost:%d", request.LocalPort)
-		localURLPrefixSecure := fmt.Sprintf("https://localhost:%d", request.LocalPort)
-		
-		// Create tunnel URL based on received scheme
-		tunnelScheme := "http"
-		if request.Scheme == "https" {
-			tunnelScheme = "https"
-		}
-		
-		// Extract hostname from Host header
-		hostname := ""
-		if host, ok := request.Headers["Host"]; ok && len(host) > 0 {
-			hostname = host[0]
-		}
-		
-		// If hostname is still empty, use X-Forwarded-Host
-		if hostname == "" {
-			if host, ok := request.Headers["X-Forwarded-Host"]; ok && len(host) > 0 {
-				hostname = host[0]
-			}
-		}
-		
-		// If hostname is still empty, extract subdomain from tunnel URL
-		if hostname == "" {
-			// Try to get subdomain from URL provided by user
-			subdomain := c.GetSubdomain()
-			if subdomain != "" {
-				hostname = subdomain + ".haxorport.online"
-			} else {
-				// Fallback to tunnel ID if subdomain is not available
-				hostname = request.TunnelID + ".haxorport.online"
-			}
+		c.logger.Error("%sFailed to read response body: %v", mark, err)
+		return nil, nil, err
+	}
+	if tunnel.rewrite != nil {
+		tunnel.rewrite.Response(resp.Header, variables, address)
+		if rewritten, err := tunnel.rewrite.Body(resp.Header, body, variables, address); err == rewrite.ErrBodyTooLarge {
+			c.logger.Debug("%sResponse body left unchanged: %v", mark, err)
+		} else if err != nil {
+			c.logger.Warn("%sResponse body left unchanged: %v", mark, err)
+		} else {
+			body = rewritten
 		}
-		
-		c.logger.Info(fmt.Sprintf("Using hostname: %s for URL replacement", hostname))
-		tunnelURLPrefix := fmt.Sprintf("%s://%s", tunnelScheme, hostname)
-		
-		// Replace local URLs with tunnel URLs in body
-		bodyStr := string(body)
-		bodyStr = strings.ReplaceAll(bodyStr, localURLPrefix, tunnelURLPrefix)
-		bodyStr = strings.ReplaceAll(bodyStr, localURLPrefixSecure, tunnelURLPrefix)
-		
-		// Replace relative URLs in href and src
-		// Example: href="/path" becomes href="https://subdomain.haxorport.online/path"
-		bodyStr = strings.ReplaceAll(bodyStr, "href=\"/", "href=\""+tunnelURLPrefix+"/")
-		bodyStr = strings.ReplaceAll(bodyStr, "src=\"/", "src=\""+tunnelURLPrefix+"/")
-		
-		// Update body with modified content
-		body = []byte(bodyStr)
-		
-		c.logger.Info("Local URLs in HTML response replaced with tunnel URLs")
 	}
+	return resp, body, nil
+}
 
-	// Create HTTP response
-	httpResp := &model.HTTPResponse{
-		ID:         request.ID,
-		StatusCode: resp.StatusCode,
-		Headers:    resp.Header,
-		Body:       body,
+// rewriteVariables returns the values of the rewrite variables for a request
+func (c *Client) rewriteVariables(request *model.HTTPRequest) rewrite.Variables {
+	scheme := "http"
+	if request.Scheme == "https" {
+		scheme = "https"
+	}
+	return rewrite.Variables{
+		PublicHost: c.publicHost(request),
+		Scheme:     scheme,
+		RemoteAddr: remoteIP(request.RemoteAddr),
+		TunnelID:   request.TunnelID,
+		RequestID:  request.ID,
 	}
-
-	// Send response to server
-	return c.sendHTTPResponse(httpResp)
 }
 
 // sendHTTPResponse sends HTTP response to server
@@ -147,16 +293,165 @@ func (c *Client) sendHTTPResponse(response *model.HTTPResponse) error {
 	return c.sendMessage(msg)
 }
 
-// sendHTTPErrorResponse sends HTTP error response to server
-func (c *Client) sendHTTPErrorResponse(requestID string, err error) error {
-	// Create HTTP error response
-	httpResp := &model.HTTPResponse{
+// ReplayHTTPRequest sends a captured request to the local service again, through the
+// same forwarding code as live traffic. Client-side auth and access lists are not
+// applied, as replays are started locally, but the headers a login gate controls are
+// removed as on live traffic. A port other than 0 sends the request to that local port
+// instead of the routes and upstreams of the tunnel. The exchange is passed to the
+// observers.
+func (c *Client) ReplayHTTPRequest(request *model.HTTPRequest, port int) *model.HTTPExchange {
+	replay := request.Clone()
+	replay.ID = fmt.Sprintf("replay-%d", time.Now().UnixNano())
+	if port > 0 {
+		replay.LocalPort = port
+	}
+	tunnel := c.getHTTPTunnel(replay.TunnelID)
+	if tunnel != nil && tunnel.gate != nil {
+		// The captured request still carries the session cookie and any X-Forwarded-User
+		// header sent by the visitor
+		httpauth.RemoveGateHeaders(replay.Headers)
+	}
+	c.logger.Info("[replay] Replaying HTTP request %s %s", replay.Method, replay.URL)
+
+	started := time.Now()
+	exchange := &model.HTTPExchange{
+		Request: replay.Clone(),
+		Started: started,
+		Replay:  true,
+	}
+	if tunnel != nil {
+		exchange.Response = c.forwardHTTPRequest(tunnel, replay, true, port)
+	} else {
+		c.logger.Warn("[replay] Rejected HTTP request %s %s: unknown tunnel %q", replay.Method, replay.URL, replay.TunnelID)
+		exchange.Response = httpStatusResponse(replay.ID, http.StatusForbidden, nil)
+	}
+	exchange.Duration = time.Since(started)
+	c.logger.Info("[replay] HTTP request %s %s answered with status %d in %v",
+		replay.Method, replay.URL, exchange.Response.StatusCode, exchange.Duration)
+
+	c.observeHTTPExchange(exchange)
+	return exchange
+}
+
+// httpStatusResponse returns a plain text response with the given status code
+func httpStatusResponse(requestID string, statusCode int, headers http.Header) *model.HTTPResponse {
+	if headers == nil {
+		headers = http.Header{}
+	}
+	headers.Set("Content-Type", "text/plain; charset=utf-8")
+	return &model.HTTPResponse{
 		ID:         requestID,
-		StatusCode: http.StatusInternalServerError,
-		Headers:    http.Header{},
-		Error:      err.Error(),
+		StatusCode: statusCode,
+		Headers:    headers,
+		Body:       []byte(http.StatusText(statusCode) + "\n"),
 	}
+}
 
-	// Send response to server
-	return c.sendHTTPResponse(httpResp)
+// upstreamErrorResponse returns the error page for a request the local service failed:
+// 504 if it timed out and 502 otherwise. The error itself is only logged.
+func (c *Client) upstreamErrorResponse(tunnel *httpTunnel, request *model.HTTPRequest, err error) *model.HTTPResponse {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return c.httpPageResponse(tunnel, request, http.StatusGatewayTimeout, errorpage.MessageTimeout)
+	}
+	return c.httpPageResponse(tunnel, request, http.StatusBadGateway, errorpage.MessageUnreachable)
+}
+
+// httpPageResponse renders an error page of the tunnel
+func (c *Client) httpPageResponse(tunnel *httpTunnel, request *model.HTTPRequest, statusCode int, message string) *model.HTTPResponse {
+	response, err := tunnelPages(tunnel).Error(request, statusCode, message)
+	if err != nil {
+		c.logger.Error("Failed to render error page, serving the built-in page: %v", err)
+	}
+	return response
+}
+
+// maintenanceResponse renders the maintenance page of the tunnel
+func (c *Client) maintenanceResponse(tunnel *httpTunnel, request *model.HTTPRequest) *model.HTTPResponse {
+	response, err := tunnelPages(tunnel).Maintenance(request)
+	if err != nil {
+		c.logger.Error("Failed to render maintenance page, serving the built-in page: %v", err)
+	}
+	return response
+}
+
+// tunnelPages returns the error pages of a tunnel, or the built-in pages
+func tunnelPages(tunnel *httpTunnel) *errorpage.Pages {
+	if tunnel != nil && tunnel.pages != nil {
+		return tunnel.pages
+	}
+	return errorpage.Default()
+}
+
+// SetMaintenance turns maintenance mode on or off. In maintenance mode the tunnels stay
+// registered, but visitors get a 503 maintenance page instead of the local service.
+func (c *Client) SetMaintenance(on bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.maintenance = on
+}
+
+// Maintenance reports whether maintenance mode is on
+func (c *Client) Maintenance() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.maintenance
+}
+
+// AddHTTPObserver registers an observer notified of every proxied HTTP exchange
+func (c *Client) AddHTTPObserver(observer port.HTTPObserver) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.httpObservers = append(c.httpObservers, observer)
+}
+
+// SetHTTPFallback sets the fallback answering HTTP requests when the local service
+// cannot be reached, and recording its responses otherwise
+func (c *Client) SetHTTPFallback(fallback port.HTTPFallback) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.httpFallback = fallback
+}
+
+// getHTTPFallback returns the fallback, or nil if none is set
+func (c *Client) getHTTPFallback() port.HTTPFallback {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.httpFallback
+}
+
+// isDialError reports whether a request failed because the local service could not
+// be connected to, rather than failing while it was answering
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// observeHTTPExchange passes an exchange to the registered observers
+func (c *Client) observeHTTPExchange(exchange *model.HTTPExchange) {
+	c.mutex.Lock()
+	observers := c.httpObservers
+	c.mutex.Unlock()
+	for _, observer := range observers {
+		observer.ObserveHTTPExchange(exchange)
+	}
+}
+
+// publicHost returns the host a visitor requested. If the server does not pass it on,
+// the host is derived from the subdomain, or the tunnel ID, and the base domain.
+func (c *Client) publicHost(request *model.HTTPRequest) string {
+	if host := request.Headers.Get("Host"); host != "" {
+		return host
+	}
+	if host := request.Headers.Get("X-Forwarded-Host"); host != "" {
+		return host
+	}
+	subdomain := c.GetSubdomain()
+	if subdomain == "" {
+		subdomain = request.TunnelID
+	}
+	if subdomain == "" || c.baseDomain == "" {
+		return ""
+	}
+	return subdomain + "." + c.baseDomain
 }
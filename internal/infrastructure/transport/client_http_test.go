@@ -0,0 +1,242 @@
+package transport
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+)
+
+// testLogger discards log messages
+type testLogger struct{}
+
+func (testLogger) Debug(string, ...interface{}) {}
+func (testLogger) Info(string, ...interface{})  {}
+func (testLogger) Warn(string, ...interface{})  {}
+func (testLogger) Error(string, ...interface{}) {}
+func (testLogger) SetLevel(string)              {}
+func (testLogger) Close() error                 { return nil }
+
+// newTestClient returns a client that is not connected to a server
+func newTestClient(t *testing.T) *Client {
+	t.Helper()
+	return NewClient(&model.Config{BaseDomain: "example.net"}, testLogger{})
+}
+
+// newTestService starts a local service answering 200 and counts its requests
+func newTestService(t *testing.T) (int, *int32) {
+	t.Helper()
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(server.Close)
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	number, _ := strconv.Atoi(port)
+	return number, &hits
+}
+
+// addTestTunnel registers the policies of a tunnel with the client
+func addTestTunnel(t *testing.T, c *Client, tunnelID string, config model.TunnelConfig) {
+	t.Helper()
+	tunnel, err := newHTTPTunnel(config)
+	if err != nil {
+		t.Fatalf("newHTTPTunnel: %v", err)
+	}
+	c.addHTTPTunnel(tunnelID, tunnel)
+	t.Cleanup(func() { c.removeHTTPTunnel(tunnelID) })
+}
+
+func TestHandleHTTPRequestUnknownTunnel(t *testing.T) {
+	port, hits := newTestService(t)
+	c := newTestClient(t)
+	protected := model.TunnelConfig{
+		LocalPort: port,
+		Auth:      &model.TunnelAuth{Type: model.AuthTypeBasic, Username: "user", Password: "secret"},
+	}
+	addTestTunnel(t, c, "protected", protected)
+	addTestTunnel(t, c, "restricted", model.TunnelConfig{LocalPort: port, AllowCIDRs: []string{"10.0.0.0/8"}})
+
+	tests := []struct {
+		name     string
+		tunnelID string
+		status   int
+	}{
+		{"unknown tunnel", "other", http.StatusForbidden},
+		{"empty tunnel", "", http.StatusForbidden},
+		{"protected without credentials", "protected", http.StatusUnauthorized},
+		{"restricted from other network", "restricted", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := &model.HTTPRequest{
+				ID:         "1",
+				TunnelID:   tt.tunnelID,
+				Method:     http.MethodGet,
+				URL:        "/",
+				Headers:    http.Header{},
+				RemoteAddr: "192.0.2.1:4000",
+				LocalPort:  port,
+			}
+			response := c.handleHTTPRequest(request)
+			if response.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", response.StatusCode, tt.status)
+			}
+		})
+	}
+	if n := atomic.LoadInt32(hits); n != 0 {
+		t.Errorf("local service got %d requests, want none", n)
+	}
+}
+
+func TestHandleHTTPRequestSingleTunnelFallback(t *testing.T) {
+	port, hits := newTestService(t)
+	c := newTestClient(t)
+	addTestTunnel(t, c, "only", model.TunnelConfig{
+		LocalPort: port,
+		Auth:      &model.TunnelAuth{Type: model.AuthTypeBasic, Username: "user", Password: "secret"},
+	})
+
+	// A request without a known tunnel ID gets the policies of the only tunnel
+	request := &model.HTTPRequest{ID: "1", TunnelID: "other", Method: http.MethodGet, URL: "/", Headers: http.Header{}, LocalPort: port}
+	if response := c.handleHTTPRequest(request); response.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", response.StatusCode, http.StatusUnauthorized)
+	}
+
+	headers := http.Header{}
+	headers.Set("Authorization", "Basic dXNlcjpzZWNyZXQ=")
+	request = &model.HTTPRequest{ID: "2", TunnelID: "only", Method: http.MethodGet, URL: "/", Headers: headers, LocalPort: port}
+	if response := c.handleHTTPRequest(request); response.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", response.StatusCode, http.StatusOK)
+	}
+	if n := atomic.LoadInt32(hits); n != 1 {
+		t.Errorf("local service got %d requests, want 1", n)
+	}
+}
+
+func TestReplayHTTPRequestPortBypassesUpstreams(t *testing.T) {
+	upstreamPort, upstreamHits := newTestService(t)
+	routePort, routeHits := newTestService(t)
+	replayPort, replayHits := newTestService(t)
+	c := newTestClient(t)
+	addTestTunnel(t, c, "balanced", model.TunnelConfig{
+		Upstreams: []string{strconv.Itoa(upstreamPort)},
+		Routes:    []model.TunnelRoute{{Path: "/api", Upstreams: []string{strconv.Itoa(routePort)}}},
+	})
+
+	for _, url := range []string{"/", "/api/items"} {
+		request := &model.HTTPRequest{ID: "1", TunnelID: "balanced", Method: http.MethodGet, URL: url, Headers: http.Header{}}
+		exchange := c.ReplayHTTPRequest(request, replayPort)
+		if exchange.Response.StatusCode != http.StatusOK {
+			t.Fatalf("replay of %s: status = %d, want %d", url, exchange.Response.StatusCode, http.StatusOK)
+		}
+		if exchange.Request.LocalPort != replayPort {
+			t.Errorf("replay of %s: local port = %d, want %d", url, exchange.Request.LocalPort, replayPort)
+		}
+	}
+	if n := atomic.LoadInt32(replayHits); n != 2 {
+		t.Errorf("replay port got %d requests, want 2", n)
+	}
+	if n := atomic.LoadInt32(upstreamHits) + atomic.LoadInt32(routeHits); n != 0 {
+		t.Errorf("upstreams got %d requests, want none", n)
+	}
+
+	// Without a port the replay is forwarded like live traffic
+	request := &model.HTTPRequest{ID: "2", TunnelID: "balanced", Method: http.MethodGet, URL: "/api/items", Headers: http.Header{}}
+	c.ReplayHTTPRequest(request, 0)
+	if n := atomic.LoadInt32(routeHits); n != 1 {
+		t.Errorf("route got %d requests, want 1", n)
+	}
+}
+
+// recordingFallback counts the responses recorded for the fallback
+type recordingFallback struct {
+	recorded int32
+}
+
+func (f *recordingFallback) RecordHTTPResponse(*model.HTTPRequest, *model.HTTPResponse) {
+	atomic.AddInt32(&f.recorded, 1)
+}
+
+func (f *recordingFallback) FallbackHTTPResponse(*model.HTTPRequest) (*model.HTTPResponse, bool) {
+	return nil, false
+}
+
+func TestReplayHTTPRequestNotRecorded(t *testing.T) {
+	port, _ := newTestService(t)
+	replayPort, _ := newTestService(t)
+	c := newTestClient(t)
+	fallback := &recordingFallback{}
+	c.SetHTTPFallback(fallback)
+	addTestTunnel(t, c, "app", model.TunnelConfig{LocalPort: port})
+
+	request := &model.HTTPRequest{ID: "1", TunnelID: "app", Method: http.MethodGet, URL: "/", Headers: http.Header{}, LocalPort: port}
+	c.ReplayHTTPRequest(request, replayPort)
+	c.ReplayHTTPRequest(request, 0)
+	if n := atomic.LoadInt32(&fallback.recorded); n != 0 {
+		t.Errorf("%d replayed responses were recorded, want none", n)
+	}
+
+	c.handleHTTPRequest(request.Clone())
+	if n := atomic.LoadInt32(&fallback.recorded); n != 1 {
+		t.Errorf("%d live responses were recorded, want 1", n)
+	}
+}
+
+func TestReplayHTTPRequestRemovesGateHeaders(t *testing.T) {
+	var received http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+	}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	localPort, _ := strconv.Atoi(port)
+
+	c := newTestClient(t)
+	addTestTunnel(t, c, "gated", model.TunnelConfig{
+		LocalPort: localPort,
+		Auth:      &model.TunnelAuth{Type: model.AuthTypeForm, Username: "user", Password: "secret"},
+	})
+	addTestTunnel(t, c, "open", model.TunnelConfig{LocalPort: localPort})
+
+	tests := []struct {
+		tunnelID   string
+		wantCookie string
+		wantUser   string
+	}{
+		// The session of the visitor and a forged user must not reach the local service
+		{"gated", "theme=dark", ""},
+		// Without a gate the cookies belong to the local service
+		{"open", "haxorport_session=abc; theme=dark; haxorport_oidc_state=xyz", "mallory"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tunnelID, func(t *testing.T) {
+			request := &model.HTTPRequest{ID: "1", TunnelID: tt.tunnelID, Method: http.MethodGet, URL: "/", LocalPort: localPort, Headers: http.Header{
+				"Cookie":           {"haxorport_session=abc; theme=dark; haxorport_oidc_state=xyz"},
+				"X-Forwarded-User": {"mallory"},
+			}}
+			exchange := c.ReplayHTTPRequest(request, 0)
+			if exchange.Response.StatusCode != http.StatusOK {
+				t.Fatalf("status = %d, want %d", exchange.Response.StatusCode, http.StatusOK)
+			}
+			if got := received.Get("Cookie"); got != tt.wantCookie {
+				t.Errorf("Cookie = %q, want %q", got, tt.wantCookie)
+			}
+			if got := received.Get("X-Forwarded-User"); got != tt.wantUser {
+				t.Errorf("X-Forwarded-User = %q, want %q", got, tt.wantUser)
+			}
+			// The observers see the request as it was sent
+			if got := exchange.Request.Headers.Get("Cookie"); got != tt.wantCookie {
+				t.Errorf("observed Cookie = %q, want %q", got, tt.wantCookie)
+			}
+			if request.Headers.Get("X-Forwarded-User") != "mallory" {
+				t.Error("the captured request was modified")
+			}
+		})
+	}
+}
@@ -0,0 +1,317 @@
+package transport
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+)
+
+const (
+	// defaultControlPoolMinIdle is the default number of idle control connections kept open
+	defaultControlPoolMinIdle = 2
+	// defaultControlPoolMaxIdle is the default upper bound of idle control connections
+	defaultControlPoolMaxIdle = 8
+	// controlPoolShrinkInterval is how long the pool must go without exhaustion before shrinking
+	controlPoolShrinkInterval = time.Minute
+)
+
+// controlPool keeps a number of idle, pre-authenticated control connections open so that
+// several visitors can be served at the same time. Every connection serves one visitor;
+// the pool dials a replacement as soon as an idle connection is taken.
+type controlPool struct {
+	tunnel  *DirectTunnel
+	minIdle int
+	maxIdle int
+
+	mutex   sync.Mutex
+	target  int
+	idle    int
+	active  int
+	dialing int
+	conns   map[net.Conn]struct{}
+	retryAt time.Time
+	stats   model.ControlPoolStats
+	// idleConns are the connections waiting for a visitor, which are closed when the
+	// pool shrinks
+	idleConns map[net.Conn]struct{}
+	// lastExhausted is when a visitor last took the last idle connection
+	lastExhausted time.Time
+	wake          chan struct{}
+	stopped       bool
+	// done is closed by close to end the refill loop of this pool; exited is closed
+	// when the loop has returned
+	done   chan struct{}
+	exited chan struct{}
+}
+
+// newControlPool creates a new controlPool for the tunnel
+func newControlPool(tunnel *DirectTunnel, minIdle, maxIdle int) *controlPool {
+	if minIdle <= 0 {
+		minIdle = defaultControlPoolMinIdle
+	}
+	if maxIdle < minIdle {
+		maxIdle = minIdle
+	}
+	return &controlPool{
+		tunnel:  tunnel,
+		minIdle: minIdle,
+		maxIdle: maxIdle,
+		target:  minIdle,
+		conns:   make(map[net.Conn]struct{}),
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		exited:  make(chan struct{}),
+
+		idleConns: make(map[net.Conn]struct{}),
+	}
+}
+
+// run refills the pool until it is closed
+func (p *controlPool) run() {
+	defer close(p.exited)
+	p.tunnel.logger.Info("Keeping %d-%d idle control connections to server on port %d", p.minIdle, p.maxIdle, p.tunnel.controlPort)
+
+	for {
+		select {
+		case <-p.done:
+			p.tunnel.logger.Info("Stopping control connection pool")
+			return
+		default:
+		}
+
+		p.mutex.Lock()
+		// Shrink back towards the minimum after a quiet period
+		if p.target > p.minIdle && time.Since(p.lastExhausted) > controlPoolShrinkInterval {
+			p.target--
+			p.lastExhausted = time.Now()
+		}
+		need := 0
+		if time.Now().After(p.retryAt) {
+			need = p.target - (p.idle + p.dialing)
+			if p.idle+p.dialing+need > p.maxIdle {
+				need = p.maxIdle - (p.idle + p.dialing)
+			}
+		}
+		if need > 0 {
+			p.dialing += need
+		}
+		// Close the idle connections above the target, which never exceeds maxIdle
+		var excess []net.Conn
+		for conn := range p.idleConns {
+			if p.idle <= p.target {
+				break
+			}
+			delete(p.idleConns, conn)
+			p.idle--
+			excess = append(excess, conn)
+		}
+		p.mutex.Unlock()
+
+		for i := 0; i < need; i++ {
+			go p.open()
+		}
+		if len(excess) > 0 {
+			p.tunnel.logger.Debug("Closing %d idle control connections above the pool target", len(excess))
+			for _, conn := range excess {
+				conn.Close()
+			}
+		}
+
+		select {
+		case <-p.wake:
+		case <-p.done:
+		case <-time.After(1 * time.Second):
+		}
+	}
+}
+
+// notify wakes up the refill loop
+func (p *controlPool) notify() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// open dials and registers a new control connection and waits for a visitor on it
+func (p *controlPool) open() {
+	t := p.tunnel
+
+	controlConn, err := t.dialServer()
+	if err == nil {
+		t.mutex.Lock()
+		requestedPort, reservationID := t.remotePort, t.reservationID
+		t.mutex.Unlock()
+
+		// The reservation keeps the remote port stable across control reconnects
+		var result *model.DirectHelloResultPayload
+		result, err = t.handshake(controlConn, model.DirectHelloPayload{
+			Mode:          model.DirectModeControl,
+			RemotePort:    requestedPort,
+			ReservationID: reservationID,
+		})
+		if err != nil {
+			controlConn.Close()
+		} else {
+			// Check if the server provides an alternative port for the control connection
+			t.mutex.Lock()
+			if result.RemotePort != t.remotePort {
+				t.logger.Warn("Server moved reserved port %d to %d", t.remotePort, result.RemotePort)
+			}
+			notify := t.applyServerPort(result.RemotePort)
+			t.mutex.Unlock()
+			if notify != nil {
+				notify()
+			}
+		}
+	}
+
+	if err != nil {
+		p.dialFailed(err)
+		return
+	}
+
+	p.mutex.Lock()
+	p.dialing--
+	if p.stopped {
+		p.mutex.Unlock()
+		controlConn.Close()
+		return
+	}
+	p.idle++
+	p.stats.Dialed++
+	p.conns[controlConn] = struct{}{}
+	p.idleConns[controlConn] = struct{}{}
+	p.mutex.Unlock()
+
+	p.serve(controlConn)
+}
+
+// dialFailed records a failed dial and delays the next refill
+func (p *controlPool) dialFailed(err error) {
+	t := p.tunnel
+
+	backoffTime := 5 * time.Second
+	switch {
+	case errors.Is(err, ErrAuthFailed) || errors.Is(err, ErrLimitReached):
+		t.logger.Error("Control connection rejected by server: %v", err)
+		backoffTime = 30 * time.Second
+	case strings.Contains(err.Error(), "connection refused") ||
+		strings.Contains(err.Error(), "no route to host") ||
+		strings.Contains(err.Error(), "network is unreachable"):
+		// Server mungkin tidak tersedia, menunggu lebih lama sebelum mencoba lagi
+		t.logger.Warn("Failed to establish control connection: %v. Server may be unavailable, retrying in 30s", err)
+		backoffTime = 30 * time.Second
+	default:
+		if !t.isStopped() {
+			t.logger.Error("Failed to establish control connection: %v. Retrying in %v", err, backoffTime)
+		}
+	}
+
+	p.mutex.Lock()
+	p.dialing--
+	p.stats.DialFailures++
+	if retryAt := time.Now().Add(backoffTime); retryAt.After(p.retryAt) {
+		p.retryAt = retryAt
+	}
+	p.mutex.Unlock()
+}
+
+// serve waits for a visitor request on an idle control connection and handles it
+func (p *controlPool) serve(controlConn net.Conn) {
+	t := p.tunnel
+
+	request, err := t.readConnectRequest(controlConn)
+
+	p.mutex.Lock()
+	if _, ok := p.idleConns[controlConn]; !ok {
+		// The refill loop closed the connection as an excess idle connection
+		delete(p.conns, controlConn)
+		p.mutex.Unlock()
+		controlConn.Close()
+		return
+	}
+	delete(p.idleConns, controlConn)
+	p.idle--
+	if err != nil {
+		delete(p.conns, controlConn)
+		p.mutex.Unlock()
+		controlConn.Close()
+		if !t.isStopped() {
+			t.logger.Info("Idle control connection lost: %v", err)
+		}
+		p.notify()
+		return
+	}
+
+	p.active++
+	p.stats.Served++
+	exhausted := p.idle == 0
+	if exhausted {
+		// The last idle connection was taken: grow the pool for the next burst
+		p.stats.Exhaustions++
+		p.lastExhausted = time.Now()
+		if p.target < p.maxIdle {
+			p.target *= 2
+			if p.target > p.maxIdle {
+				p.target = p.maxIdle
+			}
+		}
+	}
+	stats := p.snapshotLocked()
+	p.mutex.Unlock()
+
+	if exhausted {
+		t.logger.Warn("Control connection pool exhausted (%d active, %d exhaustions), growing to %d idle connections",
+			stats.Active, stats.Exhaustions, stats.Target)
+	}
+	p.notify()
+
+	t.handleControlConnection(controlConn, request)
+
+	p.mutex.Lock()
+	p.active--
+	delete(p.conns, controlConn)
+	p.mutex.Unlock()
+}
+
+// close ends the refill loop and closes all pooled control connections
+func (p *controlPool) close() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if !p.stopped {
+		p.stopped = true
+		close(p.done)
+	}
+	for conn := range p.conns {
+		conn.Close()
+	}
+}
+
+// wait waits until the refill loop started with run has returned after close
+func (p *controlPool) wait() {
+	<-p.exited
+}
+
+// Stats returns a snapshot of the pool metrics
+func (p *controlPool) Stats() model.ControlPoolStats {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.snapshotLocked()
+}
+
+// snapshotLocked returns the pool metrics. The caller must hold p.mutex.
+func (p *controlPool) snapshotLocked() model.ControlPoolStats {
+	stats := p.stats
+	stats.Idle = p.idle
+	stats.Active = p.active
+	stats.Dialing = p.dialing
+	stats.Target = p.target
+	stats.MinIdle = p.minIdle
+	stats.MaxIdle = p.maxIdle
+	return stats
+}
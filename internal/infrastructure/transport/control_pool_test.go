@@ -0,0 +1,128 @@
+package transport
+
+import (
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+)
+
+// waitForPool waits until the pool has idle connections and the server sees open
+// control connections
+func waitForPool(t *testing.T, pool *controlPool, open *int32, idle int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		stats := pool.Stats()
+		if stats.Idle == idle && stats.Dialing == 0 && int(atomic.LoadInt32(open)) == idle {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("pool has %d idle and %d dialing connections, server sees %d open, want %d",
+				stats.Idle, stats.Dialing, atomic.LoadInt32(open), idle)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestControlPoolClosesExcessIdleConnections(t *testing.T) {
+	var open int32
+	server := newTestDirectServer(t, func(conn net.Conn, hello model.DirectHelloPayload) {
+		if hello.Mode != model.DirectModeControl {
+			acceptHello(4000)(conn, hello)
+			return
+		}
+		atomic.AddInt32(&open, 1)
+		defer atomic.AddInt32(&open, -1)
+		acceptHello(4000)(conn, hello)
+	})
+	tunnel := newTestDirectTunnel(t, server, 4000)
+	tunnel.SetControlPoolSize(1, 4)
+	if err := tunnel.Start(); err != nil {
+		t.Fatal(err)
+	}
+	tunnel.mutex.Lock()
+	pool := tunnel.pool
+	tunnel.mutex.Unlock()
+	waitForPool(t, pool, &open, 1)
+
+	// Grow the pool as after a burst of visitors
+	pool.mutex.Lock()
+	pool.target = 4
+	pool.lastExhausted = time.Now()
+	pool.mutex.Unlock()
+	pool.notify()
+	waitForPool(t, pool, &open, 4)
+
+	// After the quiet period the pool shrinks and closes the idle connections it no
+	// longer needs, without dialing replacements
+	pool.mutex.Lock()
+	pool.target = 2
+	pool.lastExhausted = time.Now()
+	pool.mutex.Unlock()
+	pool.notify()
+	waitForPool(t, pool, &open, 2)
+	if stats := pool.Stats(); stats.Dialed != 4 {
+		t.Errorf("pool dialed %d connections, want 4", stats.Dialed)
+	}
+
+	tunnel.Stop()
+	waitForPool(t, pool, &open, 0)
+}
+
+func TestControlPoolForgetsClosedIdleConnections(t *testing.T) {
+	var open int32
+	conns := make(chan net.Conn, 8)
+	server := newTestDirectServer(t, func(conn net.Conn, hello model.DirectHelloPayload) {
+		writeDirectFrame(conn, model.DirectFrameHelloResult, model.DirectHelloResultPayload{
+			Status:     model.DirectStatusOK,
+			RemotePort: 4000,
+		})
+		if hello.Mode != model.DirectModeControl {
+			io.Copy(io.Discard, conn)
+			return
+		}
+		atomic.AddInt32(&open, 1)
+		defer atomic.AddInt32(&open, -1)
+		conns <- conn
+		io.Copy(io.Discard, conn)
+	})
+	tunnel := newTestDirectTunnel(t, server, 4000)
+	tunnel.SetControlPoolSize(1, 3)
+	if err := tunnel.Start(); err != nil {
+		t.Fatal(err)
+	}
+	tunnel.mutex.Lock()
+	pool := tunnel.pool
+	tunnel.mutex.Unlock()
+
+	pool.mutex.Lock()
+	pool.target = 3
+	pool.lastExhausted = time.Now()
+	pool.mutex.Unlock()
+	pool.notify()
+	waitForPool(t, pool, &open, 3)
+	pool.mutex.Lock()
+	pool.target = 1
+	pool.lastExhausted = time.Now()
+	pool.mutex.Unlock()
+	pool.notify()
+	waitForPool(t, pool, &open, 1)
+
+	// The connections closed by the pool are not counted as idle or active
+	if stats := pool.Stats(); stats.Idle != 1 || stats.Active != 0 || stats.Served != 0 {
+		t.Errorf("stats = %+v, want 1 idle connection", stats)
+	}
+	pool.mutex.Lock()
+	tracked := len(pool.conns)
+	pool.mutex.Unlock()
+	if tracked != 1 {
+		t.Errorf("pool tracks %d connections, want 1", tracked)
+	}
+	if len(conns) != 3 {
+		t.Errorf("server saw %d control connections, want 3", len(conns))
+	}
+}
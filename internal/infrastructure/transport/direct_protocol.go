@@ -0,0 +1,194 @@
+package transport
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+)
+
+// Direct TCP control protocol frame layout:
+//
+//	magic "HXP" (3 bytes) | version (1 byte) | type (1 byte) | length (4 bytes, big endian) | JSON payload
+const (
+	directFrameMagic      = "HXP"
+	directFrameHeaderSize = 9
+	maxDirectFrameSize    = 64 * 1024 // 64KB
+)
+
+var (
+	// ErrAuthFailed is returned when the server rejects the authentication token
+	ErrAuthFailed = errors.New("authentication failed")
+	// ErrPortTaken is returned when the requested remote port is already in use
+	ErrPortTaken = errors.New("remote port already in use")
+	// ErrLimitReached is returned when the subscription limit has been reached
+	ErrLimitReached = errors.New("subscription limit reached")
+)
+
+// HandshakeError is returned when the server answers a direct TCP handshake with a non-OK status
+type HandshakeError struct {
+	Status  model.DirectStatus
+	Message string
+}
+
+// Error implements the error interface
+func (e *HandshakeError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("handshake failed: %s", e.Status)
+	}
+	return fmt.Sprintf("handshake failed: %s: %s", e.Status, e.Message)
+}
+
+// Is allows errors.Is to match the sentinel error for the status code
+func (e *HandshakeError) Is(target error) bool {
+	switch target {
+	case ErrAuthFailed:
+		return e.Status == model.DirectStatusAuthFailed
+	case ErrPortTaken:
+		return e.Status == model.DirectStatusPortTaken
+	case ErrLimitReached:
+		return e.Status == model.DirectStatusLimitReached
+	}
+	return false
+}
+
+// directFrame is a single decoded frame of the direct TCP control protocol
+type directFrame struct {
+	Version uint8
+	Type    model.DirectFrameType
+	Payload []byte
+}
+
+// encodeDirectFrame encodes a frame with the given type and JSON payload
+func encodeDirectFrame(frameType model.DirectFrameType, payload interface{}) ([]byte, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert payload to JSON: %v", err)
+	}
+	if len(body) > maxDirectFrameSize {
+		return nil, fmt.Errorf("frame payload too large: %d bytes", len(body))
+	}
+
+	frame := make([]byte, directFrameHeaderSize+len(body))
+	copy(frame, directFrameMagic)
+	frame[3] = model.DirectProtocolVersion
+	frame[4] = byte(frameType)
+	binary.BigEndian.PutUint32(frame[5:directFrameHeaderSize], uint32(len(body)))
+	copy(frame[directFrameHeaderSize:], body)
+	return frame, nil
+}
+
+// writeDirectFrame writes a single frame to w
+func writeDirectFrame(w io.Writer, frameType model.DirectFrameType, payload interface{}) error {
+	frame, err := encodeDirectFrame(frameType, payload)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(frame); err != nil {
+		return fmt.Errorf("failed to write frame: %v", err)
+	}
+	return nil
+}
+
+// parseDirectFrameHeader validates a frame header and returns version, type and payload length
+func parseDirectFrameHeader(header []byte) (uint8, model.DirectFrameType, int, error) {
+	if len(header) < directFrameHeaderSize {
+		return 0, 0, 0, fmt.Errorf("frame header too short: %d bytes", len(header))
+	}
+	if string(header[:3]) != directFrameMagic {
+		return 0, 0, 0, fmt.Errorf("invalid frame magic: %q", header[:3])
+	}
+	version := header[3]
+	if version != model.DirectProtocolVersion {
+		return 0, 0, 0, &HandshakeError{
+			Status:  model.DirectStatusUnsupportedVersion,
+			Message: fmt.Sprintf("protocol version %d", version),
+		}
+	}
+	length := binary.BigEndian.Uint32(header[5:directFrameHeaderSize])
+	if length > maxDirectFrameSize {
+		return 0, 0, 0, fmt.Errorf("frame payload too large: %d bytes", length)
+	}
+	return version, model.DirectFrameType(header[4]), int(length), nil
+}
+
+// readDirectFrame reads a single frame from r, tolerating partial reads
+func readDirectFrame(r io.Reader) (*directFrame, error) {
+	header := make([]byte, directFrameHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	version, frameType, length, err := parseDirectFrameHeader(header)
+	if err != nil {
+		return nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, fmt.Errorf("failed to read frame payload: %v", err)
+	}
+	return &directFrame{Version: version, Type: frameType, Payload: payload}, nil
+}
+
+// decodeDirectFrame decodes a frame of the expected type into v
+func decodeDirectFrame(frame *directFrame, expected model.DirectFrameType, v interface{}) error {
+	if frame.Type != expected {
+		return fmt.Errorf("unexpected frame type %d (expected %d)", frame.Type, expected)
+	}
+	if err := json.Unmarshal(frame.Payload, v); err != nil {
+		return fmt.Errorf("failed to parse frame payload: %v", err)
+	}
+	return nil
+}
+
+// parseLegacyResponse parses a text reply of the legacy handshake ("CONNECTED[:port]" or "ERROR...")
+// and returns the port confirmed by the server, or 0 if the server did not name one
+func parseLegacyResponse(response string) (int, error) {
+	response = strings.TrimSpace(response)
+	if strings.HasPrefix(response, "ERROR") {
+		// The legacy server only answers ERROR when the requested port cannot be used
+		return 0, &HandshakeError{Status: model.DirectStatusPortTaken, Message: response}
+	}
+	if !strings.HasPrefix(response, "CONNECTED") {
+		return 0, fmt.Errorf("unexpected response from server: %s", response)
+	}
+	rest := strings.TrimPrefix(response, "CONNECTED")
+	if !strings.HasPrefix(rest, ":") {
+		return 0, nil
+	}
+	portStr := strings.SplitN(strings.TrimPrefix(rest, ":"), ":", 2)[0]
+	port, err := strconv.Atoi(strings.TrimSpace(portStr))
+	if err != nil || port <= 0 || port > 65535 {
+		return 0, fmt.Errorf("invalid port in server response: %s", response)
+	}
+	return port, nil
+}
+
+// parseLegacyConnectRequest parses a legacy "CONNECT:host:port" request.
+// The port is taken from the last separator so that IPv6 hosts are accepted.
+func parseLegacyConnectRequest(request string) (string, error) {
+	request = strings.TrimSpace(request)
+	if !strings.HasPrefix(request, "CONNECT:") {
+		return "", fmt.Errorf("unknown control request: %s", request)
+	}
+	rest := strings.TrimPrefix(request, "CONNECT:")
+	idx := strings.LastIndex(rest, ":")
+	if idx <= 0 || idx == len(rest)-1 {
+		return "", fmt.Errorf("invalid CONNECT request format: %s", request)
+	}
+	host := strings.Trim(rest[:idx], "[]")
+	port, err := strconv.Atoi(rest[idx+1:])
+	if err != nil || port <= 0 || port > 65535 {
+		return "", fmt.Errorf("invalid CONNECT request port: %s", request)
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	if _, _, err := net.SplitHostPort(addr); err != nil || host == "" {
+		return "", fmt.Errorf("invalid CONNECT request host: %s", request)
+	}
+	return addr, nil
+}
@@ -0,0 +1,257 @@
+package transport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+)
+
+// testFrame encodes a frame for the tests and fails the test on error
+func testFrame(t testing.TB, frameType model.DirectFrameType, payload interface{}) []byte {
+	t.Helper()
+	frame, err := encodeDirectFrame(frameType, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return frame
+}
+
+// frameHeader returns a frame header with the given version and payload length
+func frameHeader(version uint8, frameType model.DirectFrameType, length uint32) []byte {
+	header := make([]byte, directFrameHeaderSize)
+	copy(header, directFrameMagic)
+	header[3] = version
+	header[4] = byte(frameType)
+	binary.BigEndian.PutUint32(header[5:], length)
+	return header
+}
+
+// addFrameSeeds adds valid, truncated and malformed frames to the corpus of f
+func addFrameSeeds(f *testing.F) {
+	hello := testFrame(f, model.DirectFrameHello, model.DirectHelloPayload{Mode: model.DirectModeForward, RemotePort: 4000})
+	connect := testFrame(f, model.DirectFrameConnect, model.DirectConnectPayload{RemoteAddr: "192.0.2.1:5000"})
+	seeds := [][]byte{
+		hello,
+		connect,
+		append(append([]byte{}, hello...), connect...),
+		hello[:directFrameHeaderSize],
+		hello[:directFrameHeaderSize-1],
+		hello[:len(hello)-1],
+		nil,
+		[]byte("HXP"),
+		[]byte("CONNECTED:4000"),
+		frameHeader(model.DirectProtocolVersion, model.DirectFrameHello, maxDirectFrameSize),
+		frameHeader(model.DirectProtocolVersion, model.DirectFrameHello, maxDirectFrameSize+1),
+		frameHeader(model.DirectProtocolVersion, model.DirectFrameHello, 0xffffffff),
+		frameHeader(model.DirectProtocolVersion+1, model.DirectFrameHello, 2),
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+}
+
+func FuzzParseDirectFrameHeader(f *testing.F) {
+	addFrameSeeds(f)
+	f.Fuzz(func(t *testing.T, header []byte) {
+		version, frameType, length, err := parseDirectFrameHeader(header)
+		if err != nil {
+			return
+		}
+		if len(header) < directFrameHeaderSize || string(header[:3]) != directFrameMagic {
+			t.Fatalf("accepted invalid header %q", header)
+		}
+		if version != model.DirectProtocolVersion || frameType != model.DirectFrameType(header[4]) {
+			t.Fatalf("header %q parsed as version %d type %d", header, version, frameType)
+		}
+		if length < 0 || length > maxDirectFrameSize {
+			t.Fatalf("accepted payload length %d above the %d byte cap", length, maxDirectFrameSize)
+		}
+	})
+}
+
+func FuzzReadDirectFrame(f *testing.F) {
+	addFrameSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		frame, err := readDirectFrame(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		if len(frame.Payload) > maxDirectFrameSize {
+			t.Fatalf("read payload of %d bytes above the %d byte cap", len(frame.Payload), maxDirectFrameSize)
+		}
+		end := directFrameHeaderSize + len(frame.Payload)
+		if end > len(data) || !bytes.Equal(frame.Payload, data[directFrameHeaderSize:end]) {
+			t.Fatalf("payload %q does not match the input %q", frame.Payload, data)
+		}
+		var v interface{}
+		decodeDirectFrame(frame, frame.Type, &v)
+	})
+}
+
+func FuzzParseLegacyResponse(f *testing.F) {
+	for _, seed := range []string{"CONNECTED", "CONNECTED:4000", "CONNECTED:4000:extra", " CONNECTED:1\n", "CONNECTED:", "CONNECTED:0", "CONNECTED:65536", "CONNECTED:-1", "ERROR: port taken", "HXP"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, response string) {
+		port, err := parseLegacyResponse(response)
+		if err != nil {
+			if port != 0 {
+				t.Fatalf("error %v with port %d", err, port)
+			}
+			return
+		}
+		if !strings.HasPrefix(strings.TrimSpace(response), "CONNECTED") {
+			t.Fatalf("accepted response %q", response)
+		}
+		if port < 0 || port > 65535 {
+			t.Fatalf("response %q parsed as port %d", response, port)
+		}
+	})
+}
+
+func FuzzParseLegacyConnectRequest(f *testing.F) {
+	for _, seed := range []string{"CONNECT:127.0.0.1:22", "CONNECT:[::1]:22", "CONNECT:::1:22", "CONNECT:host:", "CONNECT::22", "CONNECT:host:-1", "CONNECT:host:+22", "CONNECT:host:99999", "CONNECT:0]0:1", "CONNECT:[]:22", "CONNECT", "CONNECTED:4000"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, request string) {
+		addr, err := parseLegacyConnectRequest(request)
+		if err != nil {
+			return
+		}
+		_, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			t.Fatalf("request %q parsed as invalid address %q: %v", request, addr, err)
+		}
+		if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+			t.Fatalf("request %q parsed as address %q with invalid port", request, addr)
+		}
+	})
+}
+
+func TestReadDirectFrame(t *testing.T) {
+	hello := testFrame(t, model.DirectFrameHello, model.DirectHelloPayload{Mode: model.DirectModeForward, RemotePort: 4000})
+	badMagic := append([]byte("HXQ"), hello[3:]...)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr bool
+		status  model.DirectStatus
+	}{
+		{"valid frame", hello, false, 0},
+		{"empty payload", frameHeader(model.DirectProtocolVersion, model.DirectFrameHello, 0), false, 0},
+		{"truncated header", hello[:directFrameHeaderSize-1], true, 0},
+		{"truncated payload", hello[:len(hello)-1], true, 0},
+		{"bad magic", badMagic, true, 0},
+		{"other version", frameHeader(model.DirectProtocolVersion+1, model.DirectFrameHello, 0), true, model.DirectStatusUnsupportedVersion},
+		{"payload above cap", frameHeader(model.DirectProtocolVersion, model.DirectFrameHello, maxDirectFrameSize+1), true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame, err := readDirectFrame(bytes.NewReader(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readDirectFrame() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.status != 0 {
+				handshakeErr, ok := err.(*HandshakeError)
+				if !ok || handshakeErr.Status != tt.status {
+					t.Errorf("readDirectFrame() error = %v, want status %s", err, tt.status)
+				}
+			}
+			if err != nil {
+				return
+			}
+			if frame.Type != model.DirectFrameHello || frame.Version != model.DirectProtocolVersion {
+				t.Errorf("frame = version %d type %d", frame.Version, frame.Type)
+			}
+		})
+	}
+
+	// Decoding checks the frame type
+	frame, err := readDirectFrame(bytes.NewReader(hello))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payload model.DirectHelloPayload
+	if err := decodeDirectFrame(frame, model.DirectFrameHello, &payload); err != nil || payload.RemotePort != 4000 {
+		t.Errorf("decodeDirectFrame() = %+v, %v", payload, err)
+	}
+	if err := decodeDirectFrame(frame, model.DirectFrameConnect, &payload); err == nil {
+		t.Error("decodeDirectFrame() accepted a frame of another type")
+	}
+}
+
+func TestEncodeDirectFrameCap(t *testing.T) {
+	if _, err := encodeDirectFrame(model.DirectFrameHello, strings.Repeat("x", maxDirectFrameSize)); err == nil {
+		t.Error("encodeDirectFrame() accepted a payload above the cap")
+	}
+}
+
+func TestParseLegacyResponse(t *testing.T) {
+	tests := []struct {
+		response string
+		port     int
+		wantErr  bool
+		taken    bool
+	}{
+		{"CONNECTED", 0, false, false},
+		{"CONNECTED:4000", 4000, false, false},
+		{"CONNECTED:4000:extra\n", 4000, false, false},
+		{"CONNECTED:0", 0, true, false},
+		{"CONNECTED:65536", 0, true, false},
+		{"CONNECTED:port", 0, true, false},
+		{"ERROR: port in use", 0, true, true},
+		{"HELLO", 0, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.response, func(t *testing.T) {
+			port, err := parseLegacyResponse(tt.response)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseLegacyResponse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if port != tt.port {
+				t.Errorf("parseLegacyResponse() = %d, want %d", port, tt.port)
+			}
+			if errors.Is(err, ErrPortTaken) != tt.taken {
+				t.Errorf("parseLegacyResponse() error = %v, want port taken %v", err, tt.taken)
+			}
+		})
+	}
+}
+
+func TestParseLegacyConnectRequest(t *testing.T) {
+	tests := []struct {
+		request string
+		want    string
+		wantErr bool
+	}{
+		{"CONNECT:127.0.0.1:22", "127.0.0.1:22", false},
+		{"CONNECT:localhost:8080\n", "localhost:8080", false},
+		{"CONNECT:[::1]:22", "[::1]:22", false},
+		{"CONNECT:::1:22", "[::1]:22", false},
+		{"CONNECT:host:", "", true},
+		{"CONNECT::22", "", true},
+		{"CONNECT:[]:22", "", true},
+		{"CONNECT:host:0", "", true},
+		{"CONNECT:host:65536", "", true},
+		{"CONNECT:host:ssh", "", true},
+		{"DISCONNECT:host:22", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.request, func(t *testing.T) {
+			got, err := parseLegacyConnectRequest(tt.request)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseLegacyConnectRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseLegacyConnectRequest() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package transport
 
 import (
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
@@ -11,36 +12,76 @@ import (
 	"sync"
 	"time"
 
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
 	"github.com/haxorport/haxorport-go-client/internal/domain/port"
 )
 
 // DirectTunnel adalah implementasi tunnel TCP langsung
 type DirectTunnel struct {
-	localAddr      string
+	// localListen is the optional local address forwarding to the target (empty to disable)
+	localListen    string
 	serverAddr     string
 	targetAddr     string
-	localPort      int
 	remotePort     int
 	controlPort    int
 	listener       net.Listener
 	// controlListener dihapus, menggunakan koneksi keluar saja
 	connection     net.Conn
 	stopped        bool
+	// starting is set while Start registers the tunnel without holding mutex
+	starting bool
 	mutex          sync.Mutex
 	logger         port.Logger
 	// Callback to update SSH Access information
 	portChangeCallback func(int)
 	authEnabled        bool
 	authToken          string
+	// legacyHandshake uses the old unframed text handshake for older servers
+	legacyHandshake bool
+	// reservationID identifies the remote port reserved by the server for this tunnel
+	reservationID string
+	// randomPort is set when the legacy handshake uses a port picked by the client
+	randomPort bool
+	// tlsConfig enables TLS for all connections to the server when not nil
+	tlsConfig *tls.Config
+	// authenticator answers server challenges instead of sending the token (nil for token mode)
+	authenticator *challengeAuthenticator
+	// pool keeps idle control connections ready for visitors
+	pool        *controlPool
+	poolMinIdle int
+	poolMaxIdle int
+	// relayListen enables relay mode: the relay opens back-connections to this address instead of the pool being used
+	relayListen    string
+	relayAdvertise string
+	relay          *relaySession
+	// p2pEnabled lets visitors that ask for it connect peer-to-peer instead of through the server
+	p2pEnabled bool
+	// privateName registers a private tunnel without a public port when not empty;
+	// visitors must know the secret privateKeys are derived from, which also encrypt
+	// their traffic end to end
+	privateName string
+	privateKeys *privateKeys
+	// proxyProtocol sends a PROXY protocol header with the visitor address to the target
+	proxyProtocol model.ProxyProtocolVersion
+	// access restricts visitors by source address (nil to allow all)
+	access *accessList
 }
 
-// NewDirectTunnel creates a new DirectTunnel instance
-func NewDirectTunnel(localAddr, serverAddr, targetAddr string, localPort, remotePort, controlPort int, logger port.Logger, authEnabled bool, authToken string) *DirectTunnel {
+const (
+	// maxPortRetries is the number of times a new random port is tried after a port conflict (legacy handshake only)
+	maxPortRetries = 5
+	// handshakeTimeout is the maximum time to wait for a handshake response
+	handshakeTimeout = 15 * time.Second
+)
+
+// NewDirectTunnel creates a new DirectTunnel instance.
+// localListen is an optional local address that also forwards to the target; pass an
+// empty string to only serve visitors coming through the server.
+func NewDirectTunnel(localListen, serverAddr, targetAddr string, remotePort, controlPort int, logger port.Logger, authEnabled bool, authToken string) *DirectTunnel {
 	return &DirectTunnel{
-		localAddr:      localAddr,
+		localListen:    localListen,
 		serverAddr:     serverAddr,
 		targetAddr:     targetAddr,
-		localPort:      localPort,
 		remotePort:     remotePort,
 		controlPort:    controlPort,
 		logger:         logger,
@@ -57,321 +98,540 @@ func (t *DirectTunnel) SetPortChangeCallback(callback func(int)) {
 	t.portChangeCallback = callback
 }
 
-// Start memulai tunnel
-func (t *DirectTunnel) Start() error {
+// SetLegacyHandshake enables the old unframed text handshake for servers
+// that do not support the framed control protocol yet
+func (t *DirectTunnel) SetLegacyHandshake(legacy bool) {
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
+	t.legacyHandshake = legacy
+}
 
-	if t.listener != nil || t.connection != nil {
-		return fmt.Errorf("tunnel sudah berjalan")
+// SetTLSConfig enables TLS for the registration connection and every control connection
+func (t *DirectTunnel) SetTLSConfig(tlsConfig *tls.Config) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.tlsConfig = tlsConfig
+}
+
+// SetAuthMode selects how the token is proven to the server.
+// In challenge mode the token is never sent; every connection answers a server nonce instead.
+func (t *DirectTunnel) SetAuthMode(mode model.AuthMode) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if mode == model.AuthModeChallenge {
+		t.authenticator = newChallengeAuthenticator(t.authToken)
+	} else {
+		t.authenticator = nil
 	}
-	
-	// Reset flag stopped
-	t.stopped = false
+}
 
-	// Create local listener for connections from local application
-	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", t.localPort))
+// SetControlPoolSize sets the minimum and maximum number of idle control connections
+func (t *DirectTunnel) SetControlPoolSize(minIdle, maxIdle int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.poolMinIdle = minIdle
+	t.poolMaxIdle = maxIdle
+}
+
+// SetP2PEnabled enables peer-to-peer connections for visitors that ask for them
+func (t *DirectTunnel) SetP2PEnabled(enabled bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.p2pEnabled = enabled
+}
+
+// SetPrivate registers the tunnel as a private tunnel with the given name. The server
+// gives out no public port; only visitors holding secret can connect.
+func (t *DirectTunnel) SetPrivate(name, secret string) error {
+	keys, err := derivePrivateKeys(name, secret)
 	if err != nil {
-		return fmt.Errorf("failed to start listener on port %d: %v", t.localPort, err)
+		return fmt.Errorf("private tunnel %s: %v", name, err)
 	}
 
-	// Create connection to server to register the tunnel
-	// Menggunakan net.JoinHostPort untuk mendukung IPv6
-	serverAddr := net.JoinHostPort(t.serverAddr, fmt.Sprintf("%d", t.controlPort))
-	serverConn, err := net.DialTimeout("tcp", serverAddr, 10*time.Second)
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.privateName = name
+	t.privateKeys = keys
+	return nil
+}
+
+// SetProxyProtocol sends a PROXY protocol header of the given version to the target on every connection
+func (t *DirectTunnel) SetProxyProtocol(version model.ProxyProtocolVersion) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.proxyProtocol = version
+}
+
+// SetAccessList restricts visitors to the allowed CIDRs and rejects the denied ones.
+// Visitors whose address is not supplied by the server are rejected if a list is set.
+func (t *DirectTunnel) SetAccessList(allowCIDRs, denyCIDRs []string) error {
+	access, err := newAccessList(allowCIDRs, denyCIDRs)
 	if err != nil {
-		listener.Close()
-		return fmt.Errorf("failed to connect to server: %v", err)
+		return err
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.access = access
+	return nil
+}
+
+// SetRelayMode enables relay mode. The client accepts back-connections from the relay on
+// listen and announces advertise to the relay (derived from the listener if empty).
+func (t *DirectTunnel) SetRelayMode(listen, advertise string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.relayListen = listen
+	t.relayAdvertise = advertise
+}
+
+// ControlPoolStats returns the metrics of the control connection pool
+func (t *DirectTunnel) ControlPoolStats() *model.ControlPoolStats {
+	t.mutex.Lock()
+	pool := t.pool
+	t.mutex.Unlock()
+	if pool == nil {
+		return nil
+	}
+	stats := pool.Stats()
+	return &stats
+}
+
+// Start memulai tunnel. The server is dialed and the tunnel registered without holding
+// t.mutex; the result is published under it and callbacks run after it is released.
+func (t *DirectTunnel) Start() error {
+	t.mutex.Lock()
+	if t.listener != nil || t.connection != nil || t.starting {
+		t.mutex.Unlock()
+		return fmt.Errorf("tunnel sudah berjalan")
+	}
+	if err := t.prepareStart(); err != nil {
+		t.mutex.Unlock()
+		return err
+	}
+	// Reset flag stopped
+	t.stopped = false
+	t.starting = true
+	localListen, relayListen, relayAdvertise := t.localListen, t.relayListen, t.relayAdvertise
+	t.mutex.Unlock()
+
+	// Create the optional local listener for connections from local applications
+	var listener net.Listener
+	var relay *relaySession
+	abort := func(err error) error {
+		closeListener(listener)
+		if relay != nil {
+			relay.close()
+		}
+		t.mutex.Lock()
+		t.starting = false
+		t.mutex.Unlock()
+		return err
+	}
+	if localListen != "" {
+		listenAddr, err := NormalizeListenAddr(localListen)
+		if err != nil {
+			return abort(err)
+		}
+		listener, err = net.Listen("tcp", listenAddr)
+		if err != nil {
+			return abort(fmt.Errorf("failed to start local listener on %s: %v", listenAddr, err))
+		}
+	}
+
+	// Create the listener for relay back-connections in relay mode
+	if relayListen != "" {
+		relayListener, err := net.Listen("tcp", relayListen)
+		if err != nil {
+			return abort(fmt.Errorf("failed to start relay listener on %s: %v", relayListen, err))
+		}
+		relay = newRelaySession(t, relayListener, relayAdvertise)
 	}
-	t.connection = serverConn
 
-	// Prepare data to send with auth token if enabled
-	var dataToSend string
 	if t.authEnabled && t.authToken != "" {
-		// Format with AUTH_TOKEN prefix
-		dataToSend = fmt.Sprintf("AUTH_TOKEN=%s:%s:%d:DIRECT_TCP_FORWARD", t.authToken, t.targetAddr, t.remotePort)
 		t.logger.Info("Establishing authenticated outbound control connection to server on port %d", t.controlPort)
 	} else {
-		// Format without auth token
-		dataToSend = fmt.Sprintf("%s:%d:DIRECT_TCP_FORWARD", t.targetAddr, t.remotePort)
 		t.logger.Info("Establishing outbound control connection to server on port %d", t.controlPort)
 	}
 
-	// Send data to server
-	_, err = t.connection.Write([]byte(dataToSend))
+	// Register the tunnel and reserve the remote port on the server
+	serverConn, result, err := t.register()
 	if err != nil {
-		return fmt.Errorf("failed to send data to server: %v", err)
+		return abort(err)
 	}
 
-	// Add log for debugging
+	t.mutex.Lock()
+	t.starting = false
+	if t.stopped {
+		// Stop was called while the tunnel was being registered
+		t.mutex.Unlock()
+		serverConn.Close()
+		closeListener(listener)
+		if relay != nil {
+			relay.close()
+		}
+		return fmt.Errorf("tunnel stopped while starting")
+	}
+	t.connection = serverConn
+	t.reservationID = result.ReservationID
+	notify := t.applyServerPort(result.RemotePort)
+	t.relay = relay
+	defer func() {
+		if notify != nil {
+			notify()
+		}
+	}()
+	defer t.mutex.Unlock()
 
-	// Read confirmation from server
-	// Use larger buffer for SSH
-	actualBufferSize := 4096
-	isSSH := strings.Contains(t.targetAddr, ":22") // Detect SSH based on port 22
-	if isSSH {
-		actualBufferSize = 65536 // 64KB for SSH, increased from 32KB
+	if t.privateName != "" {
+		t.logger.Info("Private tunnel active: %s -> %s (no public port)", t.privateName, t.targetAddr)
+	} else {
+		t.logger.Info("Tunnel active: %s:%d -> %s", t.serverAddr, t.remotePort, t.targetAddr)
 	}
-	buffer := make([]byte, actualBufferSize)
-	t.connection.SetReadDeadline(time.Now().Add(15 * time.Second)) // Increased timeout from 10 seconds to 15 seconds
-	n, err := t.connection.Read(buffer)
-	t.connection.SetReadDeadline(time.Time{})
-	if err != nil {
-		return fmt.Errorf("failed to read response from server: %v", err)
+	
+	// Tidak perlu membuat listener kontrol di client
+	// Semua komunikasi akan menggunakan koneksi keluar yang sudah ada
+	t.logger.Info("Using outbound connection for all server communications")
+
+	// Terima koneksi lokal
+	if listener != nil {
+		t.listener = listener
+		t.logger.Info("Local forwarding active: %s -> %s", listener.Addr(), t.targetAddr)
+		go func() {
+			for {
+				localConn, err := listener.Accept()
+				if err != nil {
+					if !t.isStopped() {
+						t.logger.Error("Failed to accept connection: %v", err)
+					}
+					break
+				}
+
+				go t.handleLocalConnection(localConn)
+			}
+		}()
 	}
 
-	// Log data awal dalam format hex untuk debugging
+	if t.reservationID != "" {
+		t.logger.Info("Remote port %d reserved by server (reservation %s)", t.remotePort, t.reservationID)
+	}
 
-	// Periksa apakah respons mengandung error atau konfirmasi dengan port alternatif
-	response := string(buffer[:n])
-	
-	// Jika respons mengandung error, coba dengan port baru
-	if strings.Contains(response, "ERROR") {
-		t.logger.Warn("Server error response: %s. Will try with a different port", strings.TrimSpace(response))
+	// In relay mode the relay connects back to the client for every visitor
+	if t.relay != nil {
+		go t.relay.run()
+		go t.relay.accept()
+		return nil
+	}
 
-		// Tutup koneksi saat ini
-		t.connection.Close()
+	// Keep a pool of control connections to the server for DIRECT_TCP_FORWARD mode
+	t.pool = newControlPool(t, t.poolMinIdle, t.poolMaxIdle)
+	go t.pool.run()
 
-		// Tunggu sebentar sebelum mencoba lagi
-		time.Sleep(500 * time.Millisecond)
+	return nil
+}
 
-		// Coba dengan port acak yang berbeda
-		rand.Seed(time.Now().UnixNano())
-		// Gunakan rentang port sesuai dengan konfigurasi server relay
+// prepareStart checks the settings of the tunnel before it is started and picks the
+// remote port for the legacy handshake. The caller must hold t.mutex.
+func (t *DirectTunnel) prepareStart() error {
+	// Without the framed protocol the server cannot pick a free port, so pick one here
+	if t.legacyHandshake && t.remotePort == 0 {
 		t.remotePort = 10000 + rand.Intn(20000) // Port acak antara 10000-30000
-		t.logger.Info("Trying with new random port: %d", t.remotePort)
-		return t.Start()
+		t.randomPort = true
+		t.logger.Info("Using random port %d for tunnel", t.remotePort)
 	}
-	
-	// Periksa apakah server memberikan port alternatif
-	if strings.HasPrefix(response, "CONNECTED:") {
-		parts := strings.Split(response, ":")
-		if len(parts) >= 2 {
-			actualPort, err := strconv.Atoi(parts[1])
-			if err == nil {
-				if actualPort != t.remotePort {
-					t.mutex.Lock()
-					oldPort := t.remotePort
-					t.logger.Info("Using alternative port: %d (requested: %d)", actualPort, t.remotePort)
-					t.remotePort = actualPort
-					
-					// Panggil callback jika ada
-					if t.portChangeCallback != nil {
-						t.portChangeCallback(actualPort)
-					}
-					t.mutex.Unlock()
-					
-					// Log dengan level lebih tinggi untuk memastikan terlihat
-					t.logger.Warn("IMPORTANT: Alternative port %d is used by server for main connection (previous: %d)", actualPort, oldPort)
-				} else {
-					// Server confirmed requested port: %d
-				}
-			} else {
-				t.logger.Warn("Gagal memparse port dari respons server: %s", response)
-			}
-		} else {
-			t.logger.Warn("Format respons server tidak valid: %s", response)
+
+	if t.access != nil && t.legacyHandshake {
+		t.logger.Warn("The legacy handshake does not supply visitor addresses, the access list will reject all visitors")
+	}
+
+	if t.privateName != "" && t.legacyHandshake {
+		return fmt.Errorf("private tunnels are not supported by the legacy handshake")
+	}
+
+	t.relay = nil
+	if t.relayListen != "" && t.legacyHandshake {
+		return fmt.Errorf("relay mode is not supported by the legacy handshake")
+	}
+	return nil
+}
+
+// register dials the server and registers the tunnel. The legacy handshake retries
+// with another random port after a conflict. It must be called without t.mutex.
+func (t *DirectTunnel) register() (net.Conn, *model.DirectHelloResultPayload, error) {
+	for attempt := 0; ; attempt++ {
+		serverConn, err := t.dialServer()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to connect to server: %v", err)
 		}
-	} else if !strings.Contains(response, "CONNECTED") {
-		// Respons tidak mengandung CONNECTED sama sekali
-		t.logger.Warn("Unexpected response from server: %s", strings.TrimSpace(response))
-		t.connection.Close()
-		return fmt.Errorf("unexpected response from server: %s", strings.TrimSpace(response))
+
+		t.mutex.Lock()
+		hello := model.DirectHelloPayload{
+			Mode:          model.DirectModeForward,
+			RemotePort:    t.remotePort,
+			ReservationID: t.reservationID,
+		}
+		if t.privateName != "" {
+			hello.Private = true
+			hello.TunnelName = t.privateName
+			hello.SecretID = t.privateKeys.secretID
+		}
+		t.mutex.Unlock()
+
+		result, err := t.handshake(serverConn, hello)
+		if err == nil {
+			return serverConn, result, nil
+		}
+		serverConn.Close()
+
+		// The legacy server cannot allocate ports, so a port picked by the client
+		// is replaced after a conflict. Everywhere else the server decides.
+		if t.legacyHandshake && t.randomPort && errors.Is(err, ErrPortTaken) && attempt < maxPortRetries {
+			t.mutex.Lock()
+			t.remotePort = 10000 + rand.Intn(20000) // Port acak antara 10000-30000
+			t.logger.Warn("Server error response: %v. Trying with new random port: %d", err, t.remotePort)
+			t.mutex.Unlock()
+			time.Sleep(500 * time.Millisecond)
+			continue
+		}
+
+		return nil, nil, describeRegistrationError(err, hello.RemotePort)
 	}
+}
 
-	// Konfirmasi sudah diperiksa di atas, jadi jika sampai di sini berarti sudah "CONNECTED"
-	// Server connection established
+// RemotePort returns the remote port of the tunnel. The server may move it while the
+// tunnel runs, when the control pool opens new connections.
+func (t *DirectTunnel) RemotePort() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.remotePort
+}
 
-	t.listener = listener
-	t.logger.Info("Tunnel active: localhost:%d -> %s:%d", t.localPort, t.serverAddr, t.remotePort)
-	
-	// Tidak perlu membuat listener kontrol di client
-	// Semua komunikasi akan menggunakan koneksi keluar yang sudah ada
-	t.logger.Info("Using outbound connection for all server communications")
+// LocalListenAddr returns the address of the local forwarding listener, or an empty string if it is disabled
+func (t *DirectTunnel) LocalListenAddr() string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.listener == nil {
+		return ""
+	}
+	return t.listener.Addr().String()
+}
 
-	// Terima koneksi lokal
-	go func() {
-		for {
-			localConn, err := listener.Accept()
-			if err != nil {
-				if !t.isStopped() {
-					t.logger.Error("Failed to accept connection: %v", err)
-				}
-				break
-			}
+// NormalizeListenAddr validates a local listen address. A bare port or an address
+// without a host is bound to loopback so that the target is not exposed on the LAN.
+func NormalizeListenAddr(addr string) (string, error) {
+	if !strings.Contains(addr, ":") {
+		addr = ":" + addr
+	}
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid local listen address %q: %v", addr, err)
+	}
+	listenPort, err := strconv.Atoi(portStr)
+	if err != nil || listenPort < 0 || listenPort > 65535 {
+		return "", fmt.Errorf("invalid local listen port %q", portStr)
+	}
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, portStr), nil
+}
+
+// closeRelay ends the relay session if relay mode is enabled. The caller must hold t.mutex.
+func (t *DirectTunnel) closeRelay() {
+	if t.relay != nil {
+		t.relay.close()
+		t.relay = nil
+	}
+}
+
+// closeListener closes the listener if it is not nil
+func closeListener(listener net.Listener) {
+	if listener != nil {
+		listener.Close()
+	}
+}
+
+// dialServer opens a new connection to the server control port, using TLS if configured.
+// Menggunakan net.JoinHostPort untuk mendukung IPv6
+func (t *DirectTunnel) dialServer() (net.Conn, error) {
+	serverAddr := net.JoinHostPort(t.serverAddr, fmt.Sprintf("%d", t.controlPort))
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if t.tlsConfig == nil {
+		return dialer.Dial("tcp", serverAddr)
+	}
 
-			go t.handleLocalConnection(localConn)
+	tlsConfig := t.tlsConfig.Clone()
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = t.serverAddr
+	}
+	return tls.DialWithDialer(dialer, "tcp", serverAddr, tlsConfig)
+}
+
+// handshake registers conn with the server and returns the server result. The target address
+// and credentials are filled in from the tunnel. A requested port of 0 asks the server to reserve
+// any free port; a non-empty reservation ID binds the connection to a port reserved earlier so it
+// is kept across reconnects.
+func (t *DirectTunnel) handshake(conn net.Conn, hello model.DirectHelloPayload) (*model.DirectHelloResultPayload, error) {
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	useChallenge := t.authEnabled && t.authenticator != nil
+	if t.legacyHandshake {
+		if useChallenge {
+			return nil, fmt.Errorf("challenge authentication is not supported by the legacy handshake")
 		}
-	}()
-	
-	// Tidak perlu menerima koneksi kontrol dari server
-	// Semua komunikasi akan menggunakan koneksi keluar yang sudah ada
+		if hello.Mode == model.DirectModeRelay {
+			return nil, fmt.Errorf("relay mode is not supported by the legacy handshake")
+		}
+		actualPort, err := t.legacyHandshakeExchange(conn, hello.Mode, hello.RemotePort)
+		if err != nil {
+			return nil, err
+		}
+		return &model.DirectHelloResultPayload{Status: model.DirectStatusOK, RemotePort: actualPort}, nil
+	}
 
-	// Create control connection to server for DIRECT_TCP_FORWARD mode
-	go func() {
-		// Gunakan koneksi keluar alih-alih listener masuk
-		// This avoids the need to open ports in client firewall
-		t.logger.Info("Establishing outbound control connection to server on port %d", t.controlPort)
+	hello.TargetAddr = t.targetAddr
+	if useChallenge {
+		hello.AuthMode = model.AuthModeChallenge
+	} else if t.authEnabled && t.authToken != "" {
+		hello.Token = t.authToken
+	}
+	if err := writeDirectFrame(conn, model.DirectFrameHello, hello); err != nil {
+		return nil, fmt.Errorf("failed to send data to server: %v", err)
+	}
 
-		// Create channel to signal when tunnel is stopped
-		stopCh := make(chan struct{})
+	frame, err := readDirectFrame(conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response from server: %v", err)
+	}
 
-		// Goroutine to detect when tunnel is stopped
-		go func() {
-			for {
-				if t.isStopped() {
-					close(stopCh)
-					return
-				}
-				time.Sleep(1 * time.Second)
-			}
-		}()
+	// Answer the server nonce before the result in challenge mode
+	if useChallenge && frame.Type == model.DirectFrameChallenge {
+		var challenge model.AuthChallengePayload
+		if err := decodeDirectFrame(frame, model.DirectFrameChallenge, &challenge); err != nil {
+			return nil, err
+		}
+		answer, err := t.authenticator.Respond(string(hello.Mode), challenge.Nonce)
+		if err != nil {
+			return nil, fmt.Errorf("failed to answer authentication challenge: %v", err)
+		}
+		if err := writeDirectFrame(conn, model.DirectFrameChallengeResponse, answer); err != nil {
+			return nil, fmt.Errorf("failed to send data to server: %v", err)
+		}
+		if frame, err = readDirectFrame(conn); err != nil {
+			return nil, fmt.Errorf("failed to read response from server: %v", err)
+		}
+	}
 
-		// Loop to retry connection if disconnected
-		for {
-			select {
-			case <-stopCh:
-				t.logger.Info("Stopping control connection loop")
-				return
-			default:
-				// Create control connection to server
-				// Using net.JoinHostPort to support IPv6
-				serverAddr := net.JoinHostPort(t.serverAddr, fmt.Sprintf("%d", t.controlPort))
-				controlConn, err := net.DialTimeout("tcp", serverAddr, 10*time.Second)
-				if err != nil {
-					// Jika server tidak dapat dihubungi, coba cek apakah tunnel masih berjalan
-					if t.isStopped() {
-						t.logger.Info("Tunnel sudah dihentikan, berhenti mencoba koneksi")
-						return
-					}
-					
-					// Use exponential backoff for retries
-					backoffTime := 5 * time.Second
-					t.logger.Error("Failed to establish control connection: %v. Retrying in %v", err, backoffTime)
-					
-					// Cek apakah error menunjukkan server tidak tersedia
-					if strings.Contains(err.Error(), "connection refused") || 
-					   strings.Contains(err.Error(), "no route to host") || 
-					   strings.Contains(err.Error(), "network is unreachable") {
-						t.logger.Warn("Server mungkin tidak tersedia, menunggu lebih lama sebelum mencoba lagi")
-						backoffTime = 30 * time.Second
-					}
-					
-					time.Sleep(backoffTime)
-					continue
-				}
+	var result model.DirectHelloResultPayload
+	if err := decodeDirectFrame(frame, model.DirectFrameHelloResult, &result); err != nil {
+		return nil, err
+	}
+	if result.Status != model.DirectStatusOK {
+		if useChallenge && result.Status == model.DirectStatusAuthFailed {
+			// A rejected session must not be used again
+			t.authenticator.ClearSession()
+		}
+		return nil, &HandshakeError{Status: result.Status, Message: result.Message}
+	}
+	if useChallenge {
+		t.authenticator.SetSession(result.Session)
+	}
+	if result.RemotePort == 0 {
+		result.RemotePort = hello.RemotePort
+	}
+	return &result, nil
+}
 
-				// Send registration message with CONTROL_CONNECTION flag
-				var dataToSend string
-				if t.authEnabled && t.authToken != "" {
-					// Tambahkan token autentikasi jika diaktifkan
-					dataToSend = fmt.Sprintf("AUTH_TOKEN=%s:%s:%d:CONTROL_CONNECTION", t.authToken, t.targetAddr, t.remotePort)
-				} else {
-					dataToSend = fmt.Sprintf("%s:%d:CONTROL_CONNECTION", t.targetAddr, t.remotePort)
-				}
-				_, err = controlConn.Write([]byte(dataToSend))
-				if err != nil {
-					t.logger.Error("Failed to send control registration: %v", err)
-					controlConn.Close()
-					time.Sleep(5 * time.Second)
-					continue
-				}
-				
-				// Baca respons dari server
-				buffer := make([]byte, 1024)
-				controlConn.SetReadDeadline(time.Now().Add(10 * time.Second))
-				n, err := controlConn.Read(buffer)
-				controlConn.SetReadDeadline(time.Time{})
-				
-				if err != nil {
-					if strings.Contains(err.Error(), "use of closed network connection") {
-						t.logger.Warn("Server closed connection, waiting before retry")
-						time.Sleep(10 * time.Second)
-					} else {
-						t.logger.Error("Failed to read response from server: %v", err)
-						time.Sleep(5 * time.Second)
-					}
-					controlConn.Close()
-					continue
-				}
-				
-				response := string(buffer[:n])
-				if !strings.Contains(response, "CONNECTED") {
-					t.logger.Warn("Unexpected response from server: %s", response)
-					controlConn.Close()
-					time.Sleep(5 * time.Second)
-					continue
-				}
+// legacyHandshakeExchange performs the old "AUTH_TOKEN=<token>:<target>:<port>:<mode>" text handshake
+func (t *DirectTunnel) legacyHandshakeExchange(conn net.Conn, mode model.DirectConnectionMode, requestedPort int) (int, error) {
+	var dataToSend string
+	if t.authEnabled && t.authToken != "" {
+		// Format with AUTH_TOKEN prefix
+		dataToSend = fmt.Sprintf("AUTH_TOKEN=%s:%s:%d:%s", t.authToken, t.targetAddr, requestedPort, mode)
+	} else {
+		// Format without auth token
+		dataToSend = fmt.Sprintf("%s:%d:%s", t.targetAddr, requestedPort, mode)
+	}
 
-				// Check if the server provides an alternative port for the control connection
-				if strings.HasPrefix(response, "CONNECTED:") {
-					parts := strings.Split(response, ":")
-					if len(parts) >= 2 {
-						actualPort, err := strconv.Atoi(parts[1])
-						if err == nil && actualPort != t.remotePort {
-							t.mutex.Lock()
-							oldPort := t.remotePort
-							t.logger.Info("Server assigned alternative port for control connection: %d (requested: %d)", actualPort, t.remotePort)
-							t.remotePort = actualPort
-							
-							// Call the callback if it exists
-							if t.portChangeCallback != nil {
-								t.portChangeCallback(actualPort)
-							}
-							t.mutex.Unlock()
-							
-							// Log with higher level to ensure visibility
-							t.logger.Warn("IMPORTANT: Server is using alternative port %d for control connection (previously: %d)", actualPort, oldPort)
-						}
-					}
-				}
-				
-				// Control connection established successfully
-				
-				// Handle the control connection
-				t.handleControlConnection(controlConn)
-				
-				// If we reach here, the connection has been closed
-				t.logger.Info("Control connection lost, reconnecting...")
-				time.Sleep(5 * time.Second)
-
-				// If the connection is lost and the tunnel is still active, try to reconnect
-				if !t.isStopped() {
-					t.logger.Info("Reconnecting control connection...")
-					time.Sleep(5 * time.Second)
-				} else {
-					return
-				}
-			}
+	if _, err := conn.Write([]byte(dataToSend)); err != nil {
+		return 0, fmt.Errorf("failed to send data to server: %v", err)
+	}
+
+	buffer := make([]byte, 4096)
+	n, err := conn.Read(buffer)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read response from server: %v", err)
+	}
+
+	actualPort, err := parseLegacyResponse(string(buffer[:n]))
+	if err != nil {
+		return 0, err
+	}
+	if actualPort == 0 {
+		return requestedPort, nil
+	}
+	return actualPort, nil
+}
+
+// applyServerPort records the remote port confirmed by the server. The caller must hold
+// t.mutex and call the returned function, if not nil, after releasing it; it notifies the
+// port change callback, which may call back into the tunnel.
+func (t *DirectTunnel) applyServerPort(actualPort int) func() {
+	if actualPort == 0 || actualPort == t.remotePort {
+		return nil
+	}
+
+	oldPort := t.remotePort
+	t.logger.Info("Using alternative port: %d (requested: %d)", actualPort, oldPort)
+	t.remotePort = actualPort
+
+	callback := t.portChangeCallback
+	return func() {
+		// Panggil callback jika ada
+		if callback != nil {
+			callback(actualPort)
 		}
-	}()
 
-	return nil
+		// Log dengan level lebih tinggi untuk memastikan terlihat
+		t.logger.Warn("IMPORTANT: Alternative port %d is used by server for main connection (previous: %d)", actualPort, oldPort)
+	}
 }
 
-// TODO: Fungsi ini akan digunakan untuk implementasi NAT traversal di masa depan
 // GetOutboundIP mendapatkan alamat IP yang digunakan untuk koneksi keluar
 // Ini akan mengembalikan alamat IP publik client yang dapat diakses oleh server
+// dan digunakan sebagai kandidat untuk NAT traversal (P2P)
 func (t *DirectTunnel) GetOutboundIP() string {
+	if ip, ok := outboundIP(t.connection); ok {
+		return ip
+	}
+
+	// Jika semua cara gagal, gunakan 127.0.0.1 sebagai fallback
+	t.logger.Warn("Failed to get outbound IP, using 127.0.0.1 as fallback")
+	return "127.0.0.1"
+}
+
+// outboundIP returns the local IP address used for outgoing connections,
+// preferring the local address of conn if it is not nil
+func outboundIP(conn net.Conn) (string, bool) {
 	// Coba dapatkan IP dari koneksi yang sudah ada ke server
-	if t.connection != nil {
-		localAddr := t.connection.LocalAddr().String()
+	if conn != nil {
+		localAddr := conn.LocalAddr().String()
 		host, _, err := net.SplitHostPort(localAddr)
 		if err == nil && host != "" && host != "::" && !strings.HasPrefix(host, "127.") {
-			return host
+			return host, true
 		}
 	}
 
 	// Jika tidak bisa mendapatkan dari koneksi yang ada, coba buat koneksi baru
 	// Kita tidak perlu benar-benar terhubung, hanya perlu mendapatkan alamat IP lokal
-	conn, err := net.Dial("udp", "8.8.8.8:53")
+	udpConn, err := net.Dial("udp", "8.8.8.8:53")
 	if err == nil {
-		defer conn.Close()
-		localAddr := conn.LocalAddr().String()
+		defer udpConn.Close()
+		localAddr := udpConn.LocalAddr().String()
 		var host string
 		host, _, err = net.SplitHostPort(localAddr)
 		if err == nil && host != "" && host != "::" && !strings.HasPrefix(host, "127.") {
-			return host
+			return host, true
 		}
 	}
 
@@ -381,32 +641,45 @@ func (t *DirectTunnel) GetOutboundIP() string {
 		for _, addr := range addrs {
 			if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
 				if ipnet.IP.To4() != nil {
-					return ipnet.IP.String()
+					return ipnet.IP.String(), true
 				}
 			}
 		}
 	}
 
-	// Jika semua cara gagal, gunakan 127.0.0.1 sebagai fallback
-	t.logger.Warn("Failed to get outbound IP, using 127.0.0.1 as fallback")
-	return "127.0.0.1"
+	return "", false
 }
 
 // Stop stops the tunnel and closes the connection
 func (t *DirectTunnel) Stop() {
 	t.mutex.Lock()
+	pool := t.pool
+	t.pool = nil
+	defer func() {
+		// Wait for the refill loop after unlocking, so that a new Start never runs
+		// next to the loop of the previous one
+		if pool != nil {
+			pool.wait()
+		}
+	}()
 	defer t.mutex.Unlock()
 
 	t.stopped = true
 
-	// Tutup listener jika ada``
+	// Tutup listener jika ada
 	if t.listener != nil {
-		// Stopping local listener on port %d
+		t.logger.Info("Stopping local listener on %s", t.listener.Addr())
 		t.listener.Close()
 		t.listener = nil
 	}
 
-	// Tidak perlu menutup control listener karena sudah tidak digunakan
+	// Tutup koneksi kontrol yang masih menunggu
+	if pool != nil {
+		pool.close()
+	}
+
+	// Akhiri sesi relay jika ada
+	t.closeRelay()
 
 	// Tutup koneksi ke server jika ada
 	if t.connection != nil {
@@ -444,9 +717,7 @@ func (t *DirectTunnel) bidirectionalCopy(conn1, conn2 net.Conn) {
 		}
 		
 		// Close the write side of conn2 to signal EOF
-		if tcpConn, ok := conn2.(*net.TCPConn); ok {
-			tcpConn.CloseWrite()
-		}
+		closeWrite(conn2)
 	}()
 	
 	// Copy dari conn2 ke conn1
@@ -464,68 +735,178 @@ func (t *DirectTunnel) bidirectionalCopy(conn1, conn2 net.Conn) {
 		}
 		
 		// Close the write side of conn1 to signal EOF
-		if tcpConn, ok := conn1.(*net.TCPConn); ok {
-			tcpConn.CloseWrite()
-		}
+		closeWrite(conn1)
 	}()
 	
 	// Tunggu kedua goroutine selesai
 	wg.Wait()
 }
 
-// handleControlConnection menangani koneksi kontrol dari server
-func (t *DirectTunnel) handleControlConnection(controlConn net.Conn) {
+// describeRegistrationError turns a handshake error into a message the user can act on
+func describeRegistrationError(err error, requestedPort int) error {
+	switch {
+	case errors.Is(err, ErrPortTaken) && requestedPort != 0:
+		return fmt.Errorf("remote port %d is already in use, choose another port or let the server pick one: %w", requestedPort, err)
+	case errors.Is(err, ErrPortTaken):
+		return fmt.Errorf("server has no free remote port available: %w", err)
+	case errors.Is(err, ErrLimitReached):
+		return fmt.Errorf("port limit of your subscription plan reached, close other TCP tunnels or upgrade your plan: %w", err)
+	case errors.Is(err, ErrAuthFailed):
+		return fmt.Errorf("server rejected the authentication token: %w", err)
+	}
+	return err
+}
+
+// closeWrite closes the write side of conn if supported (TCP and TLS connections)
+func closeWrite(conn net.Conn) {
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+	}
+}
+
+// handleControlConnection menangani permintaan koneksi dari server pada koneksi kontrol
+func (t *DirectTunnel) handleControlConnection(controlConn net.Conn, request *model.DirectConnectPayload) {
 	defer func() {
 		if r := recover(); r != nil {
 			t.logger.Error("Panic in handleControlConnection: %v", r)
 		}
 		controlConn.Close()
 	}()
-	
-	
-	// Baca permintaan dari server
-	buffer := make([]byte, 1024)
-	n, err := controlConn.Read(buffer)
+
+	t.mutex.Lock()
+	p2pEnabled, access, privateName := t.p2pEnabled, t.access, t.privateName
+	t.mutex.Unlock()
+
+	// Close connections of visitors not allowed by the access list before the target is contacted
+	if !access.allows(request.RemoteAddr) {
+		t.logger.Warn("Rejected visitor %q: source address not allowed by the access list", request.RemoteAddr)
+		return
+	}
+
+	// Try to serve the visitor directly if it asked for a peer-to-peer connection
+	if request.P2P != nil && p2pEnabled && t.serveP2P(controlConn, request.P2P) {
+		return
+	}
+
+	targetAddr := request.TargetAddr
+	if targetAddr == "" {
+		targetAddr = t.targetAddr
+	}
+
+	// Visitors of a private tunnel must complete the end-to-end handshake before the
+	// target is contacted. The server only relays the visitor after the OK, so it is
+	// sent first and a failing target just closes the encrypted session.
+	if privateName != "" {
+		if err := t.writeConnectResult(controlConn, model.DirectStatusOK, ""); err != nil {
+			t.logger.Error("Failed to confirm connection to server: %v", err)
+			return
+		}
+		visitorConn, err := t.secureVisitorConn(controlConn)
+		if err != nil {
+			t.logger.Warn("Rejected visitor of private tunnel %s: %v", privateName, err)
+			return
+		}
+		targetConn, err := t.dialTarget(targetAddr, request.RemoteAddr)
+		if err != nil {
+			t.logger.Error("Failed to connect to target %s: %v", targetAddr, err)
+			return
+		}
+		defer targetConn.Close()
+		t.bidirectionalCopy(visitorConn, targetConn)
+		return
+	}
+
+	// Create connection to target
+	t.logger.Info("Connecting to target %s as requested by server", targetAddr)
+	targetConn, err := t.dialTarget(targetAddr, request.RemoteAddr)
 	if err != nil {
-		t.logger.Error("Failed to read from control connection: %v", err)
+		t.logger.Error("Failed to connect to target %s: %v", targetAddr, err)
+		t.writeConnectResult(controlConn, model.DirectStatusTargetUnreachable, err.Error())
 		return
 	}
-	
-	// Parse permintaan
-	request := string(buffer[:n])
-	
-	// Periksa jenis permintaan
-	if strings.HasPrefix(request, "CONNECT:") {
-		// Format: CONNECT:targetAddr:targetPort
-		parts := strings.Split(request, ":")
-		if len(parts) >= 3 {
-			targetAddr := parts[1]
-			targetPort := parts[2]
-			
-			// Create connection to target
-			t.logger.Info("Connecting to target %s:%s as requested by server", targetAddr, targetPort)
-			targetAddrFull := net.JoinHostPort(targetAddr, targetPort)
-			targetConn, err := net.DialTimeout("tcp", targetAddrFull, 10*time.Second)
-			if err != nil {
-				t.logger.Error("Failed to connect to target %s: %v", targetAddrFull, err)
-				controlConn.Write([]byte(fmt.Sprintf("ERROR:%v", err)))
-				return
-			}
-			defer targetConn.Close()
-			
-			// Konfirmasi koneksi berhasil
-			controlConn.Write([]byte("OK"))
-			
-			// Forward data antara koneksi kontrol dan target
-			t.bidirectionalCopy(controlConn, targetConn)
-		} else {
-			t.logger.Error("Invalid CONNECT request format: %s", request)
-			controlConn.Write([]byte("ERROR:Invalid request format"))
+	defer targetConn.Close()
+
+	// Konfirmasi koneksi berhasil
+	if err := t.writeConnectResult(controlConn, model.DirectStatusOK, ""); err != nil {
+		t.logger.Error("Failed to confirm connection to server: %v", err)
+		return
+	}
+
+	// Forward data antara koneksi kontrol dan target
+	t.bidirectionalCopy(controlConn, targetConn)
+}
+
+// dialTarget connects to the target and announces the visitor address with a
+// PROXY protocol header if enabled. visitorAddr may be empty if it is unknown.
+func (t *DirectTunnel) dialTarget(targetAddr, visitorAddr string) (net.Conn, error) {
+	targetConn, err := net.DialTimeout("tcp", targetAddr, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mutex.Lock()
+	version := t.proxyProtocol
+	t.mutex.Unlock()
+	if err := writeProxyHeader(targetConn, version, visitorAddr, targetConn.RemoteAddr().String()); err != nil {
+		targetConn.Close()
+		return nil, err
+	}
+	return targetConn, nil
+}
+
+// secureVisitorConn performs the end-to-end handshake with a visitor of a private tunnel.
+// For public tunnels conn is returned unchanged.
+func (t *DirectTunnel) secureVisitorConn(conn net.Conn) (net.Conn, error) {
+	t.mutex.Lock()
+	keys := t.privateKeys
+	t.mutex.Unlock()
+	if keys == nil {
+		return conn, nil
+	}
+	return newSecureServerConn(conn, keys)
+}
+
+// readConnectRequest waits for the server to request a connection on a control connection
+func (t *DirectTunnel) readConnectRequest(controlConn net.Conn) (*model.DirectConnectPayload, error) {
+	if t.legacyHandshake {
+		buffer := make([]byte, 1024)
+		n, err := controlConn.Read(buffer)
+		if err != nil {
+			return nil, err
 		}
-	} else {
-		t.logger.Error("Unknown control request: %s", request)
-		controlConn.Write([]byte("ERROR:Unknown request"))
+		targetAddr, err := parseLegacyConnectRequest(string(buffer[:n]))
+		if err != nil {
+			return nil, err
+		}
+		return &model.DirectConnectPayload{TargetAddr: targetAddr}, nil
 	}
+
+	frame, err := readDirectFrame(controlConn)
+	if err != nil {
+		return nil, err
+	}
+	var request model.DirectConnectPayload
+	if err := decodeDirectFrame(frame, model.DirectFrameConnect, &request); err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+// writeConnectResult answers a connect request on a control connection
+func (t *DirectTunnel) writeConnectResult(controlConn net.Conn, status model.DirectStatus, message string) error {
+	if t.legacyHandshake {
+		reply := "OK"
+		if status != model.DirectStatusOK {
+			reply = "ERROR:" + message
+		}
+		_, err := controlConn.Write([]byte(reply))
+		return err
+	}
+
+	return writeDirectFrame(controlConn, model.DirectFrameConnectResult, model.DirectConnectResultPayload{
+		Status:  status,
+		Message: message,
+	})
 }
 
 // handleLocalConnection handles a connection from the local port
@@ -534,7 +915,7 @@ func (t *DirectTunnel) handleLocalConnection(localConn net.Conn) {
 
 	// Create a connection to the target (local SSH server)
 	// Connecting to target %s
-	targetConn, err := net.DialTimeout("tcp", t.targetAddr, 10*time.Second)
+	targetConn, err := t.dialTarget(t.targetAddr, localConn.RemoteAddr().String())
 	if err != nil {
 		t.logger.Error("Failed to connect to target %s: %v", t.targetAddr, err)
 		return
@@ -589,99 +970,46 @@ func (t *DirectTunnel) handleLocalConnection(localConn net.Conn) {
 	// Connection closed
 }
 
-// handleServerInitiatedConnection menangani koneksi kontrol yang diinisiasi oleh server relay
-// handleServerInitiatedConnection dihapus karena tidak digunakan lagi
-// Semua komunikasi sekarang menggunakan koneksi keluar yang diinisiasi oleh client
-
-// TODO: Fungsi ini akan digunakan untuk implementasi relay mode di masa depan
-// HandleRelayConnection menangani koneksi balik dari server relay
+// HandleRelayConnection handles a back-connection opened by the relay for a visitor.
+// The relay must present the current relay session ID and may only ask for the
+// configured upstream; anything else is rejected before the target is dialed.
 func (t *DirectTunnel) HandleRelayConnection(relayConn net.Conn) {
-	defer relayConn.Close()
-	
-	// Baca alamat target dari server relay dengan buffer yang lebih besar
-	buffer := make([]byte, 4096) // Meningkatkan buffer dari 1024 menjadi 4096 bytes
-	relayConn.SetReadDeadline(time.Now().Add(15*time.Second)) // Meningkatkan timeout dari 10 detik menjadi 15 detik
-	n, err := relayConn.Read(buffer)
-	relayConn.SetReadDeadline(time.Time{}) // Reset deadline
-	if err != nil {
-		t.logger.Error("Failed to read target address from relay: %v", err)
+	t.mutex.Lock()
+	relay := t.relay
+	t.mutex.Unlock()
+	if relay == nil {
+		t.logger.Warn("Rejected relay connection from %s: relay mode is not enabled", relayConn.RemoteAddr())
+		relayConn.Close()
 		return
 	}
-	
-	// Log data awal dalam format hex untuk debugging
-	
-	targetAddr := string(buffer[:n])
-	
-	// Create connection to target (local SSH server)
-	targetConn, err := net.DialTimeout("tcp", targetAddr, 10*time.Second)
+
+	relayConn.SetReadDeadline(time.Now().Add(relayRequestTimeout))
+	request, err := t.readConnectRequest(relayConn)
+	relayConn.SetReadDeadline(time.Time{})
 	if err != nil {
-		t.logger.Error("Failed to connect to target %s: %v", targetAddr, err)
+		t.logger.Error("Failed to read connect request from relay %s: %v", relayConn.RemoteAddr(), err)
+		relayConn.Close()
 		return
 	}
-	defer targetConn.Close()
-	
-	// Send confirmation to relay server - protocol simplification
-	_, err = relayConn.Write([]byte("READY"))
-	if err != nil {
-		t.logger.Error("Failed to send confirmation to relay: %v", err)
+
+	if !relay.validSession(request.RelaySessionID) {
+		t.logger.Warn("Rejected relay connection from %s: unknown relay session", relayConn.RemoteAddr())
+		t.writeConnectResult(relayConn, model.DirectStatusAuthFailed, "unknown relay session")
+		relayConn.Close()
 		return
 	}
-	
-	// Tambahkan delay kecil setelah mengirim konfirmasi untuk memastikan server menerima konfirmasi
-	time.Sleep(300 * time.Millisecond) // Meningkatkan delay dari 100ms menjadi 300ms
-	
-	// Optimize TCP connections
-	if tcpConn, ok := targetConn.(*net.TCPConn); ok {
-		tcpConn.SetNoDelay(true)
-		tcpConn.SetKeepAlive(true)
-		tcpConn.SetKeepAlivePeriod(30 * time.Second)
-		tcpConn.SetReadBuffer(256 * 1024)
-		tcpConn.SetWriteBuffer(256 * 1024)
-	}
-	
-	if tcpConn, ok := relayConn.(*net.TCPConn); ok {
-		tcpConn.SetNoDelay(true)
-		tcpConn.SetKeepAlive(true)
-		tcpConn.SetKeepAlivePeriod(30 * time.Second)
-		tcpConn.SetReadBuffer(256 * 1024)
-		tcpConn.SetWriteBuffer(256 * 1024)
+
+	if request.TargetAddr != "" && !matchesTarget(request.TargetAddr, t.targetAddr) {
+		t.logger.Warn("Rejected relay connection from %s: target %s is not the configured upstream %s",
+			relayConn.RemoteAddr(), request.TargetAddr, t.targetAddr)
+		t.writeConnectResult(relayConn, model.DirectStatusBadRequest, "target not allowed")
+		relayConn.Close()
+		return
 	}
-	
-	// Relay connection established
 
-	// Forward data between relay and target connections
-	done := make(chan struct{}, 2)
-	
-	// Copy data from relay connection to target connection
-	go func() {
-		_, err := io.Copy(targetConn, relayConn)
-		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
-			t.logger.Error("Error copying data from relay to target: %v", err)
-		}
-		
-		// Close the write side of the target connection to signal EOF
-		if tcpConn, ok := targetConn.(*net.TCPConn); ok {
-			tcpConn.CloseWrite()
-		}
-		done <- struct{}{}
-	}()
-	
-	// Copy data from target connection to relay connection
-	go func() {
-		_, err := io.Copy(relayConn, targetConn)
-		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
-			t.logger.Error("Error copying data from target to relay: %v", err)
-		}
-		
-		// Close the write side of the relay connection to signal EOF
-		if tcpConn, ok := relayConn.(*net.TCPConn); ok {
-			tcpConn.CloseWrite()
-		}
-		done <- struct{}{}
-	}()
-	
-	// Wait for both copy operations to complete
-	<-done
-	<-done
-	// Relay connection closed
+	// From here on a back-connection is served like a control connection
+	t.handleControlConnection(relayConn, &model.DirectConnectPayload{
+		TargetAddr: t.targetAddr,
+		RemoteAddr: request.RemoteAddr,
+	})
 }
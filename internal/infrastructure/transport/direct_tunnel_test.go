@@ -0,0 +1,297 @@
+package transport
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+)
+
+// testDirectServer is a direct TCP server stand-in. Every connection is registered
+// with its hello frame and then passed to handle, which answers it.
+type testDirectServer struct {
+	listener net.Listener
+	hellos   chan model.DirectHelloPayload
+}
+
+func newTestDirectServer(t *testing.T, handle func(conn net.Conn, hello model.DirectHelloPayload)) *testDirectServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testDirectServer{listener: listener, hellos: make(chan model.DirectHelloPayload, 64)}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				frame, err := readDirectFrame(conn)
+				if err != nil {
+					return
+				}
+				var hello model.DirectHelloPayload
+				if decodeDirectFrame(frame, model.DirectFrameHello, &hello) != nil {
+					return
+				}
+				select {
+				case s.hellos <- hello:
+				default:
+				}
+				handle(conn, hello)
+			}()
+		}
+	}()
+	return s
+}
+
+// port returns the port of the server
+func (s *testDirectServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+// acceptHello answers a hello with OK and the given remote port, then keeps the
+// connection open until the client closes it
+func acceptHello(remotePort int) func(net.Conn, model.DirectHelloPayload) {
+	return func(conn net.Conn, hello model.DirectHelloPayload) {
+		writeDirectFrame(conn, model.DirectFrameHelloResult, model.DirectHelloResultPayload{
+			Status:     model.DirectStatusOK,
+			RemotePort: remotePort,
+		})
+		io.Copy(io.Discard, conn)
+	}
+}
+
+func newTestDirectTunnel(t *testing.T, server *testDirectServer, remotePort int) *DirectTunnel {
+	t.Helper()
+	tunnel := NewDirectTunnel("", "127.0.0.1", "127.0.0.1:1", remotePort, server.port(), testLogger{}, false, "")
+	t.Cleanup(tunnel.Stop)
+	return tunnel
+}
+
+func TestDirectTunnelStartDoesNotHoldLock(t *testing.T) {
+	release := make(chan struct{})
+	server := newTestDirectServer(t, func(conn net.Conn, hello model.DirectHelloPayload) {
+		if hello.Mode == model.DirectModeForward {
+			<-release
+		}
+		acceptHello(4000)(conn, hello)
+	})
+	tunnel := newTestDirectTunnel(t, server, 0)
+
+	// The callback may call back into the tunnel
+	changed := make(chan int, 4)
+	tunnel.SetPortChangeCallback(func(port int) {
+		tunnel.LocalListenAddr()
+		changed <- port
+	})
+
+	started := make(chan error, 1)
+	go func() { started <- tunnel.Start() }()
+	<-server.hellos
+
+	// The tunnel answers while the server has not replied yet
+	answered := make(chan struct{})
+	go func() {
+		tunnel.ControlPoolStats()
+		tunnel.LocalListenAddr()
+		close(answered)
+	}()
+	select {
+	case <-answered:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the tunnel lock is held during the registration")
+	}
+	if err := tunnel.Start(); err == nil {
+		t.Error("a second Start during the registration succeeded")
+	}
+
+	close(release)
+	select {
+	case err := <-started:
+		if err != nil {
+			t.Fatalf("Start: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start did not return")
+	}
+	select {
+	case port := <-changed:
+		if port != 4000 {
+			t.Errorf("port change callback got %d, want 4000", port)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the port change callback was not called")
+	}
+}
+
+func TestDirectTunnelStopDuringStart(t *testing.T) {
+	release := make(chan struct{})
+	server := newTestDirectServer(t, func(conn net.Conn, hello model.DirectHelloPayload) {
+		<-release
+		acceptHello(4000)(conn, hello)
+	})
+	tunnel := newTestDirectTunnel(t, server, 4000)
+
+	started := make(chan error, 1)
+	go func() { started <- tunnel.Start() }()
+	<-server.hellos
+	tunnel.Stop()
+	close(release)
+
+	if err := <-started; err == nil {
+		t.Fatal("Start succeeded after Stop")
+	}
+	tunnel.mutex.Lock()
+	defer tunnel.mutex.Unlock()
+	if tunnel.connection != nil || tunnel.pool != nil || tunnel.starting {
+		t.Error("the tunnel kept state of the aborted start")
+	}
+}
+
+func TestDirectTunnelStartFailure(t *testing.T) {
+	server := newTestDirectServer(t, func(conn net.Conn, hello model.DirectHelloPayload) {
+		writeDirectFrame(conn, model.DirectFrameHelloResult, model.DirectHelloResultPayload{
+			Status:  model.DirectStatusPortTaken,
+			Message: "port " + strconv.Itoa(hello.RemotePort) + " is taken",
+		})
+	})
+	tunnel := newTestDirectTunnel(t, server, 4000)
+	if err := tunnel.Start(); err == nil {
+		t.Fatal("Start succeeded although the port is taken")
+	}
+	// A failed start can be retried
+	if err := tunnel.Start(); err == nil || err.Error() == "tunnel sudah berjalan" {
+		t.Errorf("second Start: %v", err)
+	}
+}
+
+func TestDirectTunnelRestartEndsPoolLoop(t *testing.T) {
+	server := newTestDirectServer(t, acceptHello(4000))
+	tunnel := newTestDirectTunnel(t, server, 4000)
+
+	var pools []*controlPool
+	for i := 0; i < 3; i++ {
+		if err := tunnel.Start(); err != nil {
+			t.Fatalf("Start %d: %v", i, err)
+		}
+		tunnel.mutex.Lock()
+		pools = append(pools, tunnel.pool)
+		tunnel.mutex.Unlock()
+		tunnel.Stop()
+	}
+	for i, pool := range pools {
+		select {
+		case <-pool.exited:
+		default:
+			t.Errorf("the refill loop of start %d is still running after Stop", i)
+		}
+	}
+}
+
+func TestPrivateTunnelHandshakeBeforeTarget(t *testing.T) {
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+	accepted := make(chan net.Conn, 4)
+	go func() {
+		for {
+			conn, err := target.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+
+	tunnel := NewDirectTunnel("", "127.0.0.1", target.Addr().String(), 0, 1, testLogger{}, false, "")
+	if err := tunnel.SetPrivate("db", "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		keys    *privateKeys
+		reached bool
+	}{
+		{"wrong secret", testPrivateKeys(t, "db", "wrong"), false},
+		{"right secret", testPrivateKeys(t, "db", "secret"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverSide, clientSide := net.Pipe()
+			defer serverSide.Close()
+			go tunnel.handleControlConnection(clientSide, &model.DirectConnectPayload{RemoteAddr: "192.0.2.1:5000"})
+
+			frame, err := readDirectFrame(serverSide)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var result model.DirectConnectResultPayload
+			if err := decodeDirectFrame(frame, model.DirectFrameConnectResult, &result); err != nil || result.Status != model.DirectStatusOK {
+				t.Fatalf("connect result %+v, error %v", result, err)
+			}
+
+			_, err = newSecureClientConn(serverSide, tt.keys)
+			if (err == nil) != tt.reached {
+				t.Fatalf("handshake error = %v", err)
+			}
+			select {
+			case conn := <-accepted:
+				conn.Close()
+				if !tt.reached {
+					t.Error("the target was contacted for a visitor that failed the handshake")
+				}
+			case <-time.After(500 * time.Millisecond):
+				if tt.reached {
+					t.Error("the target was not contacted after the handshake")
+				}
+			}
+		})
+	}
+}
+
+func TestDirectTunnelRepositoryReadsRemotePortDuringRefill(t *testing.T) {
+	// The server moves the reserved port on every control connection and drops it at
+	// once, so the pool keeps refilling and applying new ports
+	var moves int32
+	server := newTestDirectServer(t, func(conn net.Conn, hello model.DirectHelloPayload) {
+		remotePort := 4000
+		if hello.Mode == model.DirectModeControl {
+			remotePort += int(atomic.AddInt32(&moves, 1))
+		}
+		writeDirectFrame(conn, model.DirectFrameHelloResult, model.DirectHelloResultPayload{
+			Status:     model.DirectStatusOK,
+			RemotePort: remotePort,
+		})
+	})
+	repository, err := NewDirectTunnelRepository(&model.Config{ServerAddress: "127.0.0.1", ControlPort: server.port()}, testLogger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tunnel, err := repository.Register(model.TunnelConfig{Type: model.TunnelTypeTCP, LocalPort: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repository.Unregister(tunnel.ID)
+
+	for deadline := time.Now().Add(500 * time.Millisecond); time.Now().Before(deadline); {
+		repository.GetAll()
+		if _, err := repository.GetByID(tunnel.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if atomic.LoadInt32(&moves) == 0 {
+		t.Error("the control pool did not open a connection")
+	}
+}
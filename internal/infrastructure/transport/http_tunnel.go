@@ -0,0 +1,189 @@
+package transport
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+	"github.com/haxorport/haxorport-go-client/internal/infrastructure/errorpage"
+	"github.com/haxorport/haxorport-go-client/internal/infrastructure/httpauth"
+	"github.com/haxorport/haxorport-go-client/internal/infrastructure/rewrite"
+)
+
+// httpTunnel holds the client-side policies of a registered HTTP tunnel, which are
+// applied to every request before the local service is contacted
+type httpTunnel struct {
+	config model.TunnelConfig
+	// access restricts visitors by source address (nil to allow all)
+	access *accessList
+	// auth verifies the credentials of visitors (nil if the tunnel has no auth)
+	auth *httpauth.Verifier
+	// gate runs a login flow for visitors, such as OpenID Connect (nil if disabled)
+	gate httpauth.Gate
+	// pages renders the error and maintenance pages
+	pages *errorpage.Pages
+	// balancer spreads requests over several upstreams (nil to use the local port)
+	balancer *balancer
+	// routes send matching requests to other upstreams than the default ones
+	routes []*route
+	// rewrite changes requests to the local service and its responses (nil if no rules)
+	rewrite *rewrite.Rules
+}
+
+// newHTTPTunnel validates the client-side policies of a tunnel configuration
+func newHTTPTunnel(config model.TunnelConfig) (*httpTunnel, error) {
+	access, err := newAccessList(config.AllowCIDRs, config.DenyCIDRs)
+	if err != nil {
+		return nil, err
+	}
+	tunnel := &httpTunnel{
+		config: config,
+		access: access,
+	}
+	if config.Auth != nil && config.Auth.Type == model.AuthTypeForm {
+		// Form auth logs visitors in with a page served by the client
+		gate, err := httpauth.NewFormGate(config.Auth)
+		if err != nil {
+			return nil, err
+		}
+		tunnel.gate = gate
+	} else if tunnel.auth, err = httpauth.NewVerifier(config.Auth); err != nil {
+		return nil, err
+	}
+	if config.OIDC != nil {
+		if tunnel.gate != nil {
+			return nil, fmt.Errorf("OpenID Connect cannot be combined with form auth")
+		}
+		gate, err := httpauth.NewOIDCGate(config.OIDC)
+		if err != nil {
+			return nil, err
+		}
+		tunnel.gate = gate
+	}
+	if tunnel.pages, err = errorpage.Load(config.ErrorPages); err != nil {
+		return nil, err
+	}
+	if len(config.Upstreams) > 0 {
+		if tunnel.balancer, err = newBalancer(config.Upstreams, config.LoadBalancing); err != nil {
+			return nil, err
+		}
+	} else if config.LoadBalancing != nil && len(config.Routes) == 0 {
+		return nil, fmt.Errorf("load balancing requires upstreams or routes")
+	}
+	if tunnel.routes, err = newRoutes(config.Routes, config.LoadBalancing); err != nil {
+		return nil, err
+	}
+	if tunnel.rewrite, err = rewrite.Compile(config.Rewrite); err != nil {
+		return nil, err
+	}
+	return tunnel, nil
+}
+
+// gateRequest converts a request received from the server for a Gate. The headers are
+// shared, so cookies removed by the gate are not forwarded to the local service.
+func gateRequest(request *model.HTTPRequest) *http.Request {
+	u, err := url.ParseRequestURI(request.URL)
+	if err != nil {
+		u = &url.URL{Path: "/"}
+	}
+	u.Scheme = request.Scheme
+	host := request.Headers.Get("Host")
+	if host == "" {
+		host = request.Headers.Get("X-Forwarded-Host")
+	}
+	u.Host = host
+	return &http.Request{
+		Method:        request.Method,
+		URL:           u,
+		Header:        request.Headers,
+		Host:          host,
+		RemoteAddr:    request.RemoteAddr,
+		Body:          io.NopCloser(bytes.NewReader(request.Body)),
+		ContentLength: int64(len(request.Body)),
+	}
+}
+
+// addHTTPTunnel remembers the policies of a registered tunnel
+func (c *Client) addHTTPTunnel(tunnelID string, tunnel *httpTunnel) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.httpTunnels == nil {
+		c.httpTunnels = make(map[string]*httpTunnel)
+	}
+	if previous, ok := c.httpTunnels[tunnelID]; ok && previous != tunnel {
+		previous.close()
+	}
+	c.httpTunnels[tunnelID] = tunnel
+	for _, b := range tunnel.balancers() {
+		b.start(c.logger)
+	}
+}
+
+// removeHTTPTunnel forgets the policies of an unregistered tunnel
+func (c *Client) removeHTTPTunnel(tunnelID string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if tunnel, ok := c.httpTunnels[tunnelID]; ok {
+		tunnel.close()
+	}
+	delete(c.httpTunnels, tunnelID)
+}
+
+// close stops the background work of a tunnel, such as health checks
+func (t *httpTunnel) close() {
+	for _, b := range t.balancers() {
+		b.stop()
+	}
+}
+
+// balancers returns the balancer of the default upstreams, if any, and those of the routes
+func (t *httpTunnel) balancers() []*balancer {
+	var balancers []*balancer
+	if t.balancer != nil {
+		balancers = append(balancers, t.balancer)
+	}
+	for _, r := range t.routes {
+		balancers = append(balancers, r.balancer)
+	}
+	return balancers
+}
+
+// HTTPUpstreamStatus returns the state of the upstreams of a balanced or routed tunnel,
+// or nil if the tunnel forwards to a single local port
+func (c *Client) HTTPUpstreamStatus(tunnelID string) []model.UpstreamStatus {
+	tunnel := c.getHTTPTunnel(tunnelID)
+	if tunnel == nil {
+		return nil
+	}
+	var statuses []model.UpstreamStatus
+	if tunnel.balancer != nil {
+		statuses = append(statuses, tunnel.balancer.status()...)
+	}
+	for _, r := range tunnel.routes {
+		for _, status := range r.balancer.status() {
+			status.Route = r.config.String()
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses
+}
+
+// getHTTPTunnel returns the tunnel a request belongs to. If the server does not
+// send a known tunnel ID and only one tunnel is registered, that tunnel is used,
+// so that its policies are never skipped.
+func (c *Client) getHTTPTunnel(tunnelID string) *httpTunnel {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if tunnel, ok := c.httpTunnels[tunnelID]; ok {
+		return tunnel
+	}
+	if len(c.httpTunnels) == 1 {
+		for _, tunnel := range c.httpTunnels {
+			return tunnel
+		}
+	}
+	return nil
+}
@@ -0,0 +1,451 @@
+package transport
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+)
+
+const (
+	// p2pPunchTimeout is the maximum time spent on hole punching before falling back to the relay
+	p2pPunchTimeout = 5 * time.Second
+	// p2pDialInterval is the time between connection attempts to a peer candidate
+	p2pDialInterval = 250 * time.Millisecond
+	// p2pRoleVisitor is the role of the client connecting to a tunnel
+	p2pRoleVisitor = "visitor"
+	// p2pRoleOwner is the role of the client exposing the tunnel
+	p2pRoleOwner = "owner"
+)
+
+// listenP2P binds a local port that can be shared by a listener and outgoing
+// connections, which is required for TCP simultaneous open
+func listenP2P() (net.Listener, error) {
+	lc := net.ListenConfig{Control: reuseControl}
+	return lc.Listen(context.Background(), "tcp", ":0")
+}
+
+// p2pCandidates returns the local candidate endpoints for the port of listener. The
+// address used to reach the server is the best guess; the server adds the public
+// address it observes for this client.
+func p2pCandidates(listener net.Listener, serverConn net.Conn) []string {
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		return nil
+	}
+
+	var candidates []string
+	seen := make(map[string]bool)
+	add := func(host string) {
+		if host == "" || seen[host] {
+			return
+		}
+		seen[host] = true
+		candidates = append(candidates, net.JoinHostPort(host, port))
+	}
+
+	if serverConn != nil {
+		if host, _, err := net.SplitHostPort(serverConn.LocalAddr().String()); err == nil {
+			add(host)
+		}
+	}
+	if ip, ok := outboundIP(nil); ok {
+		add(ip)
+	}
+	return candidates
+}
+
+// p2pProof computes the proof of a role for a P2P nonce
+func p2pProof(nonce, role string) string {
+	mac := hmac.New(sha256.New, []byte(nonce))
+	fmt.Fprintf(mac, "haxorport-p2p-v1\n%s", role)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// holePunch establishes a direct connection to the peer. It accepts connections on
+// listener and at the same time dials every peer candidate from the same local port,
+// so that both NATs see outgoing traffic. The first connection on which both sides
+// prove the nonce wins.
+func holePunch(listener net.Listener, candidates []string, nonce, role string, timeout time.Duration) (net.Conn, error) {
+	if nonce == "" || len(candidates) == 0 {
+		return nil, fmt.Errorf("no peer candidates")
+	}
+
+	deadline := time.Now().Add(timeout)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	conns := make(chan net.Conn, len(candidates)+4)
+	offer := func(conn net.Conn) {
+		select {
+		case conns <- conn:
+		case <-ctx.Done():
+			conn.Close()
+		}
+	}
+
+	// Accept connections from the peer
+	if tcpListener, ok := listener.(*net.TCPListener); ok {
+		tcpListener.SetDeadline(deadline)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			offer(conn)
+		}
+	}()
+
+	// Dial every candidate from the shared local port
+	localAddr, _ := listener.Addr().(*net.TCPAddr)
+	for _, candidate := range candidates {
+		go func(candidate string) {
+			dialer := net.Dialer{
+				LocalAddr: &net.TCPAddr{Port: localAddr.Port},
+				Control:   reuseControl,
+				Timeout:   time.Second,
+			}
+			for ctx.Err() == nil {
+				conn, err := dialer.DialContext(ctx, "tcp", candidate)
+				if err == nil {
+					offer(conn)
+					return
+				}
+				select {
+				case <-ctx.Done():
+				case <-time.After(p2pDialInterval):
+				}
+			}
+		}(candidate)
+	}
+
+	// Verify every connection concurrently; the peers may have punched several
+	// connections and must not wait for each other on different ones
+	winner := make(chan net.Conn, 1)
+	var claimMutex sync.Mutex
+	claimed := false
+	claim := func() bool {
+		claimMutex.Lock()
+		defer claimMutex.Unlock()
+		if claimed {
+			return false
+		}
+		claimed = true
+		return true
+	}
+
+	for {
+		select {
+		case conn := <-conns:
+			go func(conn net.Conn) {
+				won := false
+				err := verifyPunch(conn, nonce, role, deadline, func() bool {
+					won = claim()
+					return won
+				})
+				if err != nil {
+					conn.Close()
+					if won {
+						// The chosen connection failed after the claim; no other can win any more
+						winner <- nil
+					}
+					return
+				}
+				winner <- conn
+			}(conn)
+		case conn := <-winner:
+			cancel()
+			if conn == nil {
+				return nil, fmt.Errorf("the punched connection failed")
+			}
+			// Close connections that were established in the meantime
+			go func() {
+				for {
+					select {
+					case extra := <-conns:
+						extra.Close()
+					case <-time.After(time.Second):
+						return
+					}
+				}
+			}()
+			return conn, nil
+		case <-ctx.Done():
+			if !claim() {
+				// A connection was verified just in time
+				if conn := <-winner; conn != nil {
+					return conn, nil
+				}
+				return nil, fmt.Errorf("the punched connection failed")
+			}
+			return nil, fmt.Errorf("hole punching timed out after %v", timeout)
+		}
+	}
+}
+
+// verifyPunch exchanges nonce proofs on a punched connection. claim is called once the
+// peer is verified and must return false if another connection has already been chosen.
+// The owner only answers on the connection it claims, so the visitor, which proves
+// first on every connection, ends up on the same one.
+func verifyPunch(conn net.Conn, nonce, role string, deadline time.Time, claim func() bool) error {
+	conn.SetDeadline(deadline)
+	defer conn.SetDeadline(time.Time{})
+
+	peerRole := p2pRoleOwner
+	if role == p2pRoleOwner {
+		peerRole = p2pRoleVisitor
+	}
+
+	send := func() error {
+		return writeDirectFrame(conn, model.DirectFrameP2PPunch, model.DirectP2PPunchPayload{
+			Role:  role,
+			Proof: p2pProof(nonce, role),
+		})
+	}
+	receive := func() error {
+		frame, err := readDirectFrame(conn)
+		if err != nil {
+			return err
+		}
+		var punch model.DirectP2PPunchPayload
+		if err := decodeDirectFrame(frame, model.DirectFrameP2PPunch, &punch); err != nil {
+			return err
+		}
+		if punch.Role != peerRole || !hmac.Equal([]byte(punch.Proof), []byte(p2pProof(nonce, peerRole))) {
+			return fmt.Errorf("invalid peer proof")
+		}
+		return nil
+	}
+
+	if role == p2pRoleVisitor {
+		if err := send(); err != nil {
+			return err
+		}
+		if err := receive(); err != nil {
+			return err
+		}
+		if !claim() {
+			return fmt.Errorf("another connection was chosen")
+		}
+		return nil
+	}
+	if err := receive(); err != nil {
+		return err
+	}
+	if !claim() {
+		return fmt.Errorf("another connection was chosen")
+	}
+	return send()
+}
+
+// serveP2P tries to serve a visitor over a punched peer-to-peer connection. It returns
+// false if no direct connection could be made, in which case the visitor must be
+// served on the control connection and the server relays the traffic.
+func (t *DirectTunnel) serveP2P(controlConn net.Conn, offer *model.DirectP2POfferPayload) bool {
+	listener, err := listenP2P()
+	if err != nil {
+		// Not answering the offer tells the server to relay
+		t.logger.Warn("P2P not available, relaying visitor through server: %v", err)
+		return false
+	}
+	defer listener.Close()
+
+	answer := model.DirectP2POfferPayload{Candidates: p2pCandidates(listener, controlConn)}
+	if err := writeDirectFrame(controlConn, model.DirectFrameP2PAnswer, answer); err != nil {
+		t.logger.Error("Failed to send P2P answer to server: %v", err)
+		return false
+	}
+
+	peerConn, err := holePunch(listener, offer.Candidates, offer.Nonce, p2pRoleOwner, p2pPunchTimeout)
+	if err != nil {
+		t.logger.Info("P2P connection failed, relaying visitor through server: %v", err)
+		writeDirectFrame(controlConn, model.DirectFrameP2PResult, model.DirectP2PResultPayload{
+			Status:  model.DirectStatusP2PFailed,
+			Message: err.Error(),
+		})
+		return false
+	}
+	defer peerConn.Close()
+
+	if err := writeDirectFrame(controlConn, model.DirectFrameP2PResult, model.DirectP2PResultPayload{Status: model.DirectStatusOK}); err != nil {
+		t.logger.Warn("Failed to report P2P result to server: %v", err)
+	}
+	t.logger.Info("P2P connection established with %s", peerConn.RemoteAddr())
+
+	// Visitors of a private tunnel must complete the end-to-end handshake before the target is contacted
+	visitorConn, err := t.secureVisitorConn(peerConn)
+	if err != nil {
+		t.logger.Warn("Rejected P2P visitor %s: %v", peerConn.RemoteAddr(), err)
+		return true
+	}
+
+	targetConn, err := t.dialTarget(t.targetAddr, peerConn.RemoteAddr().String())
+	if err != nil {
+		t.logger.Error("Failed to connect to target %s: %v", t.targetAddr, err)
+		return true
+	}
+	defer targetConn.Close()
+
+	t.bidirectionalCopy(visitorConn, targetConn)
+	return true
+}
+
+// Visitor connects local clients to a TCP tunnel through the server. With P2P enabled
+// it first tries to punch a direct connection to the tunnel owner and falls back to
+// the server relay if that fails. The server connection settings (address, TLS and
+// authentication) are taken from a DirectTunnel.
+type Visitor struct {
+	tunnel     *DirectTunnel
+	remotePort int
+	p2p        bool
+	// privateName selects a private tunnel by name instead of a remote port
+	privateName string
+	privateKeys *privateKeys
+}
+
+// NewVisitor creates a new Visitor for the tunnel on the given remote port
+func NewVisitor(tunnel *DirectTunnel, remotePort int, p2p bool) *Visitor {
+	return &Visitor{
+		tunnel:     tunnel,
+		remotePort: remotePort,
+		p2p:        p2p,
+	}
+}
+
+// NewPrivateVisitor creates a new Visitor for the private tunnel with the given name.
+// All traffic is encrypted end to end with keys derived from secret.
+func NewPrivateVisitor(tunnel *DirectTunnel, name, secret string, p2p bool) (*Visitor, error) {
+	keys, err := derivePrivateKeys(name, secret)
+	if err != nil {
+		return nil, fmt.Errorf("private tunnel %s: %v", name, err)
+	}
+	return &Visitor{
+		tunnel:      tunnel,
+		p2p:         p2p,
+		privateName: name,
+		privateKeys: keys,
+	}, nil
+}
+
+// String describes the tunnel the visitor connects to
+func (v *Visitor) String() string {
+	if v.privateName != "" {
+		return fmt.Sprintf("private tunnel %s", v.privateName)
+	}
+	return fmt.Sprintf("remote port %d", v.remotePort)
+}
+
+// Dial opens a connection to the tunnel. Connections to a private tunnel are encrypted end to end.
+func (v *Visitor) Dial() (net.Conn, error) {
+	conn, err := v.dial()
+	if err != nil || v.privateName == "" {
+		return conn, err
+	}
+
+	secureConn, err := newSecureClientConn(conn, v.privateKeys)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return secureConn, nil
+}
+
+// dial opens a connection to the tunnel, directly if possible, otherwise relayed by the server
+func (v *Visitor) dial() (net.Conn, error) {
+	t := v.tunnel
+
+	serverConn, err := t.dialServer()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to server: %v", err)
+	}
+
+	hello := model.DirectHelloPayload{
+		Mode:       model.DirectModeVisitor,
+		RemotePort: v.remotePort,
+	}
+	if v.privateName != "" {
+		hello.TunnelName = v.privateName
+		hello.SecretID = v.privateKeys.secretID
+	}
+	var listener net.Listener
+	if v.p2p {
+		listener, err = listenP2P()
+		if err != nil {
+			t.logger.Warn("P2P not available, using relay: %v", err)
+		} else {
+			defer listener.Close()
+			hello.P2P = &model.DirectP2POfferPayload{Candidates: p2pCandidates(listener, serverConn)}
+		}
+	}
+
+	result, err := t.handshake(serverConn, hello)
+	if err != nil {
+		serverConn.Close()
+		return nil, v.describeError(err)
+	}
+
+	// The owner did not accept the offer: the server relays on this connection
+	if listener == nil || result.P2P == nil {
+		return serverConn, nil
+	}
+
+	peerConn, err := holePunch(listener, result.P2P.Candidates, result.P2P.Nonce, p2pRoleVisitor, p2pPunchTimeout)
+	if err != nil {
+		t.logger.Info("P2P connection failed, using relay: %v", err)
+		if err := writeDirectFrame(serverConn, model.DirectFrameP2PResult, model.DirectP2PResultPayload{
+			Status:  model.DirectStatusP2PFailed,
+			Message: err.Error(),
+		}); err != nil {
+			serverConn.Close()
+			return nil, fmt.Errorf("failed to fall back to relay: %v", err)
+		}
+		return serverConn, nil
+	}
+
+	writeDirectFrame(serverConn, model.DirectFrameP2PResult, model.DirectP2PResultPayload{Status: model.DirectStatusOK})
+	serverConn.Close()
+	t.logger.Info("P2P connection established with %s", peerConn.RemoteAddr())
+	return peerConn, nil
+}
+
+// Serve accepts local connections on listener and forwards each of them to the tunnel
+func (v *Visitor) Serve(listener net.Listener) error {
+	for {
+		localConn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			defer localConn.Close()
+			tunnelConn, err := v.Dial()
+			if err != nil {
+				v.tunnel.logger.Error("Failed to connect to %s: %v", v, err)
+				return
+			}
+			defer tunnelConn.Close()
+			v.tunnel.bidirectionalCopy(localConn, tunnelConn)
+		}()
+	}
+}
+
+// describeError turns a visitor handshake error into a message the user can act on
+func (v *Visitor) describeError(err error) error {
+	var handshakeErr *HandshakeError
+	if errors.As(err, &handshakeErr) && handshakeErr.Status == model.DirectStatusTargetUnreachable {
+		return fmt.Errorf("no tunnel is serving %s: %w", v, err)
+	}
+	if v.privateName != "" && errors.Is(err, ErrAuthFailed) {
+		return fmt.Errorf("server rejected the token or the secret of %s: %w", v, err)
+	}
+	return describeRegistrationError(err, 0)
+}
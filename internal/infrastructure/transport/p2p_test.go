@@ -0,0 +1,253 @@
+package transport
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+)
+
+// tcpPair returns both ends of a loopback TCP connection
+func tcpPair(t *testing.T) (net.Conn, net.Conn) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	client, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := listener.Accept()
+	if err != nil {
+		client.Close()
+		t.Fatal(err)
+	}
+	return client, server
+}
+
+// readP2PResult reads the P2P result a client reports to the server
+func readP2PResult(conn net.Conn) (model.DirectStatus, error) {
+	frame, err := readDirectFrame(conn)
+	if err != nil {
+		return 0, err
+	}
+	var result model.DirectP2PResultPayload
+	if err := decodeDirectFrame(frame, model.DirectFrameP2PResult, &result); err != nil {
+		return 0, err
+	}
+	return result.Status, nil
+}
+
+// p2pRendezvous is a stand-in for the server side of a P2P connection. It passes the
+// offer of a visitor to the owner on a control connection, hands the candidates of
+// the owner to the visitor and relays the traffic if hole punching fails.
+type p2pRendezvous struct {
+	owner *DirectTunnel
+	// ownerNonce is the nonce given to the owner; a different nonce than the one
+	// of the visitor makes hole punching fail
+	ownerNonce string
+	// results receives the P2P results of the visitor and then of the owner
+	results chan model.DirectStatus
+}
+
+// handle serves a visitor connected to the server
+func (r *p2pRendezvous) handle(t *testing.T) func(net.Conn, model.DirectHelloPayload) {
+	return func(visitorConn net.Conn, hello model.DirectHelloPayload) {
+		if hello.Mode != model.DirectModeVisitor || hello.P2P == nil {
+			t.Errorf("hello %+v is not a P2P visitor", hello)
+			return
+		}
+
+		ownerConn, controlConn := tcpPair(t)
+		defer controlConn.Close()
+		go r.owner.handleControlConnection(ownerConn, &model.DirectConnectPayload{
+			RemoteAddr: visitorConn.RemoteAddr().String(),
+			P2P:        &model.DirectP2POfferPayload{Nonce: r.ownerNonce, Candidates: hello.P2P.Candidates},
+		})
+
+		frame, err := readDirectFrame(controlConn)
+		if err != nil {
+			t.Errorf("reading P2P answer: %v", err)
+			return
+		}
+		var answer model.DirectP2POfferPayload
+		if err := decodeDirectFrame(frame, model.DirectFrameP2PAnswer, &answer); err != nil {
+			t.Errorf("decoding P2P answer: %v", err)
+			return
+		}
+		writeDirectFrame(visitorConn, model.DirectFrameHelloResult, model.DirectHelloResultPayload{
+			Status: model.DirectStatusOK,
+			P2P:    &model.DirectP2POfferPayload{Nonce: "nonce", Candidates: answer.Candidates},
+		})
+
+		var statuses []model.DirectStatus
+		for _, conn := range []net.Conn{visitorConn, controlConn} {
+			status, err := readP2PResult(conn)
+			if err != nil {
+				t.Errorf("reading P2P result: %v", err)
+				return
+			}
+			statuses = append(statuses, status)
+			r.results <- status
+		}
+		if statuses[0] == model.DirectStatusOK {
+			return
+		}
+
+		// Relay: the owner confirms the connection on the control connection as usual
+		frame, err = readDirectFrame(controlConn)
+		if err != nil {
+			t.Errorf("reading connect result: %v", err)
+			return
+		}
+		var result model.DirectConnectResultPayload
+		if err := decodeDirectFrame(frame, model.DirectFrameConnectResult, &result); err != nil || result.Status != model.DirectStatusOK {
+			t.Errorf("connect result %+v, error %v", result, err)
+			return
+		}
+		go func() {
+			io.Copy(controlConn, visitorConn)
+			closeWrite(controlConn)
+		}()
+		io.Copy(visitorConn, controlConn)
+	}
+}
+
+func TestVisitorP2P(t *testing.T) {
+	tests := []struct {
+		name       string
+		ownerNonce string
+		private    bool
+		status     model.DirectStatus
+	}{
+		{"punched", "nonce", false, model.DirectStatusOK},
+		{"relay fallback", "other nonce", false, model.DirectStatusP2PFailed},
+		{"private tunnel punched", "nonce", true, model.DirectStatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := newTestEchoTarget(t)
+			owner := NewDirectTunnel("", "127.0.0.1", target.listener.Addr().String(), 0, 1, testLogger{}, false, "")
+			owner.SetP2PEnabled(true)
+
+			rendezvous := &p2pRendezvous{owner: owner, ownerNonce: tt.ownerNonce, results: make(chan model.DirectStatus, 2)}
+			server := newTestDirectServer(t, rendezvous.handle(t))
+			visitor := NewVisitor(newTestDirectTunnel(t, server, 0), 4000, true)
+			if tt.private {
+				if err := owner.SetPrivate("db", "secret"); err != nil {
+					t.Fatal(err)
+				}
+				var err error
+				if visitor, err = NewPrivateVisitor(newTestDirectTunnel(t, server, 0), "db", "secret", true); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			conn, err := visitor.Dial()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			for _, side := range []string{"visitor", "owner"} {
+				select {
+				case status := <-rendezvous.results:
+					if status != tt.status {
+						t.Errorf("%s reported %s, want %s", side, status, tt.status)
+					}
+				case <-time.After(2 * p2pPunchTimeout):
+					t.Fatalf("%s did not report the P2P result", side)
+				}
+			}
+			relayed := conn.RemoteAddr().(*net.TCPAddr).Port == server.port()
+			if relayed != (tt.status != model.DirectStatusOK) {
+				t.Errorf("visitor connected to %s, relayed %v", conn.RemoteAddr(), relayed)
+			}
+
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+			if _, err := conn.Write([]byte("ping")); err != nil {
+				t.Fatal(err)
+			}
+			reply := make([]byte, 4)
+			if _, err := io.ReadFull(conn, reply); err != nil || string(reply) != "ping" {
+				t.Errorf("echo = %q, %v", reply, err)
+			}
+		})
+	}
+}
+
+// writeFailConn is a connection on which every write fails
+type writeFailConn struct {
+	net.Conn
+}
+
+func (c writeFailConn) Write([]byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+// singleConnListener accepts conn once and then blocks until it is closed
+type singleConnListener struct {
+	conns  chan net.Conn
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newSingleConnListener(conn net.Conn) *singleConnListener {
+	l := &singleConnListener{conns: make(chan net.Conn, 1), closed: make(chan struct{})}
+	l.conns <- conn
+	return l
+}
+
+func (l *singleConnListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *singleConnListener) Close() error {
+	l.once.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *singleConnListener) Addr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}
+}
+
+func TestHolePunchClaimedConnectionFails(t *testing.T) {
+	ownerSide, visitorSide := net.Pipe()
+	defer visitorSide.Close()
+	listener := newSingleConnListener(writeFailConn{ownerSide})
+	defer listener.Close()
+
+	// The visitor proves the nonce; the answer of the owner on the claimed connection fails
+	go writeDirectFrame(visitorSide, model.DirectFrameP2PPunch, model.DirectP2PPunchPayload{
+		Role:  p2pRoleVisitor,
+		Proof: p2pProof("nonce", p2pRoleVisitor),
+	})
+
+	result := make(chan error, 1)
+	go func() {
+		conn, err := holePunch(listener, []string{"127.0.0.1:1"}, "nonce", p2pRoleOwner, time.Second)
+		if conn != nil {
+			conn.Close()
+		}
+		result <- err
+	}()
+	select {
+	case err := <-result:
+		if err == nil {
+			t.Error("holePunch() returned a connection whose answer failed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("holePunch() hangs after the claimed connection failed")
+	}
+}
@@ -0,0 +1,122 @@
+package transport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+)
+
+// proxyV2Signature is the fixed prefix of every PROXY protocol version 2 header
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// writeProxyHeader writes a PROXY protocol header to the local service before any
+// visitor data. source is the visitor address supplied by the server and destination
+// the address of the local service. If an address is unknown, a header without
+// addresses is sent so the service still sees a valid PROXY connection.
+func writeProxyHeader(conn net.Conn, version model.ProxyProtocolVersion, source, destination string) error {
+	var header []byte
+	switch version {
+	case model.ProxyProtocolNone:
+		return nil
+	case model.ProxyProtocolV1:
+		header = proxyHeaderV1(source, destination)
+	case model.ProxyProtocolV2:
+		header = proxyHeaderV2(source, destination)
+	default:
+		return fmt.Errorf("unsupported PROXY protocol version %q", version)
+	}
+
+	if _, err := conn.Write(header); err != nil {
+		return fmt.Errorf("failed to write PROXY protocol header: %v", err)
+	}
+	return nil
+}
+
+// proxyAddrs parses the source and destination addresses. Mixed IPv4 and IPv6
+// addresses are both reported as IPv6; ok is false if an address is unknown.
+func proxyAddrs(source, destination string) (src, dst *net.TCPAddr, ipv4, ok bool) {
+	src, ok = parseTCPAddr(source)
+	if !ok {
+		return nil, nil, false, false
+	}
+	dst, ok = parseTCPAddr(destination)
+	if !ok {
+		return nil, nil, false, false
+	}
+	ipv4 = src.IP.To4() != nil && dst.IP.To4() != nil
+	return src, dst, ipv4, true
+}
+
+// parseTCPAddr parses a host:port address with a literal IP
+func parseTCPAddr(addr string) (*net.TCPAddr, bool) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, false
+	}
+	ip := net.ParseIP(host)
+	port, err := strconv.Atoi(portStr)
+	if ip == nil || err != nil || port < 0 || port > 65535 {
+		return nil, false
+	}
+	return &net.TCPAddr{IP: ip, Port: port}, true
+}
+
+// proxyHeaderV1 builds a human-readable version 1 header
+func proxyHeaderV1(source, destination string) []byte {
+	src, dst, ipv4, ok := proxyAddrs(source, destination)
+	if !ok {
+		return []byte("PROXY UNKNOWN\r\n")
+	}
+	if ipv4 {
+		return []byte(fmt.Sprintf("PROXY TCP4 %s %s %d %d\r\n", src.IP.To4(), dst.IP.To4(), src.Port, dst.Port))
+	}
+	return []byte(fmt.Sprintf("PROXY TCP6 %s %s %d %d\r\n", ipv6String(src.IP), ipv6String(dst.IP), src.Port, dst.Port))
+}
+
+// ipv6String formats ip as an IPv6 address, mapping IPv4 addresses into IPv6
+func ipv6String(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return "::ffff:" + ip4.String()
+	}
+	return ip.String()
+}
+
+// proxyHeaderV2 builds a binary version 2 header
+func proxyHeaderV2(source, destination string) []byte {
+	var buf bytes.Buffer
+	buf.Write(proxyV2Signature)
+
+	src, dst, ipv4, ok := proxyAddrs(source, destination)
+	if !ok {
+		// LOCAL command without addresses
+		buf.Write([]byte{0x20, 0x00, 0x00, 0x00})
+		return buf.Bytes()
+	}
+
+	// Version 2, PROXY command
+	buf.WriteByte(0x21)
+	var addrs []byte
+	if ipv4 {
+		// AF_INET, STREAM
+		buf.WriteByte(0x11)
+		addrs = append(addrs, src.IP.To4()...)
+		addrs = append(addrs, dst.IP.To4()...)
+	} else {
+		// AF_INET6, STREAM
+		buf.WriteByte(0x21)
+		addrs = append(addrs, src.IP.To16()...)
+		addrs = append(addrs, dst.IP.To16()...)
+	}
+	ports := make([]byte, 4)
+	binary.BigEndian.PutUint16(ports[0:2], uint16(src.Port))
+	binary.BigEndian.PutUint16(ports[2:4], uint16(dst.Port))
+	addrs = append(addrs, ports...)
+
+	binary.Write(&buf, binary.BigEndian, uint16(len(addrs)))
+	buf.Write(addrs)
+	return buf.Bytes()
+}
@@ -0,0 +1,120 @@
+package transport
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+)
+
+// hexBytes decodes a hex string with optional spaces
+func hexBytes(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestProxyHeaderV1(t *testing.T) {
+	tests := []struct {
+		name        string
+		source      string
+		destination string
+		want        string
+	}{
+		// The TCP4 example of the PROXY protocol specification
+		{"TCP4", "192.168.0.1:56324", "192.168.0.11:443", "PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n"},
+		{"TCP6", "[2001:db8::1]:56324", "[::1]:22", "PROXY TCP6 2001:db8::1 ::1 56324 22\r\n"},
+		{"mixed families", "[2001:db8::1]:56324", "127.0.0.1:22", "PROXY TCP6 2001:db8::1 ::ffff:127.0.0.1 56324 22\r\n"},
+		{"IPv4-mapped source", "[::ffff:192.0.2.1]:1000", "127.0.0.1:22", "PROXY TCP4 192.0.2.1 127.0.0.1 1000 22\r\n"},
+		{"hostname source", "visitor.example.net:1000", "127.0.0.1:22", "PROXY UNKNOWN\r\n"},
+		{"missing source", "", "127.0.0.1:22", "PROXY UNKNOWN\r\n"},
+		{"source without port", "192.0.2.1", "127.0.0.1:22", "PROXY UNKNOWN\r\n"},
+		{"port out of range", "192.0.2.1:65536", "127.0.0.1:22", "PROXY UNKNOWN\r\n"},
+		{"hostname destination", "192.0.2.1:1000", "localhost:22", "PROXY UNKNOWN\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(proxyHeaderV1(tt.source, tt.destination))
+			if got != tt.want {
+				t.Errorf("proxyHeaderV1() = %q, want %q", got, tt.want)
+			}
+			// A version 1 header is at most 107 bytes including CRLF
+			if len(got) > 107 {
+				t.Errorf("header of %d bytes is longer than 107", len(got))
+			}
+		})
+	}
+}
+
+func TestProxyHeaderV2(t *testing.T) {
+	const signature = "0d0a0d0a000d0a515549540a"
+	tests := []struct {
+		name        string
+		source      string
+		destination string
+		want        string
+	}{
+		{"TCP4", "192.0.2.1:56324", "127.0.0.1:22",
+			signature + "21 11 000c c0000201 7f000001 dc04 0016"},
+		{"TCP6", "[2001:db8::1]:56324", "[::1]:443",
+			signature + "21 21 0024 20010db8000000000000000000000001 00000000000000000000000000000001 dc04 01bb"},
+		{"mixed families", "[2001:db8::1]:56324", "127.0.0.1:22",
+			signature + "21 21 0024 20010db8000000000000000000000001 00000000000000000000ffff7f000001 dc04 0016"},
+		{"unknown address", "visitor.example.net:1000", "127.0.0.1:22",
+			signature + "20 00 0000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := proxyHeaderV2(tt.source, tt.destination)
+			if want := hexBytes(t, tt.want); !bytes.Equal(got, want) {
+				t.Errorf("proxyHeaderV2() = %x, want %x", got, want)
+			}
+			if !bytes.HasPrefix(got, proxyV2Signature) || len(proxyV2Signature) != 12 {
+				t.Fatalf("header does not start with the 12 byte signature: %x", got)
+			}
+			// The length field covers exactly the bytes after the 16 byte fixed header
+			if length := int(got[14])<<8 | int(got[15]); length != len(got)-16 {
+				t.Errorf("length field = %d, want %d", length, len(got)-16)
+			}
+		})
+	}
+}
+
+func TestWriteProxyHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		version model.ProxyProtocolVersion
+		want    string
+		wantErr bool
+	}{
+		{"none", model.ProxyProtocolNone, "", false},
+		{"v1", model.ProxyProtocolV1, "PROXY TCP4 192.0.2.1 127.0.0.1 1000 22\r\n", false},
+		{"v2", model.ProxyProtocolV2, string(proxyHeaderV2("192.0.2.1:1000", "127.0.0.1:22")), false},
+		{"unsupported", model.ProxyProtocolVersion("v3"), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			written := make(chan []byte, 1)
+			go func() {
+				data, _ := io.ReadAll(server)
+				written <- data
+			}()
+			err := writeProxyHeader(client, tt.version, "192.0.2.1:1000", "127.0.0.1:22")
+			client.Close()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("writeProxyHeader() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := <-written; string(got) != tt.want {
+				t.Errorf("written = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package transport
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+)
+
+const (
+	// relayRetryInterval is the time to wait before registering a lost relay session again
+	relayRetryInterval = 5 * time.Second
+	// relayRequestTimeout is the maximum time a back-connection may take to send its connect request
+	relayRequestTimeout = 15 * time.Second
+)
+
+// relaySession keeps the client registered with the relay server and accepts the
+// back-connections the relay opens for every visitor. Back-connections must present
+// the ID of the current session, which is only known to the relay and the client.
+type relaySession struct {
+	tunnel    *DirectTunnel
+	listener  net.Listener
+	advertise string
+
+	mutex     sync.Mutex
+	sessionID string
+	conn      net.Conn
+	stopped   bool
+}
+
+// newRelaySession creates a new relaySession accepting back-connections on listener.
+// advertise is the address announced to the relay; if empty, it is derived from the listener.
+func newRelaySession(tunnel *DirectTunnel, listener net.Listener, advertise string) *relaySession {
+	return &relaySession{
+		tunnel:    tunnel,
+		listener:  listener,
+		advertise: advertise,
+	}
+}
+
+// run keeps the relay session registered until the tunnel is stopped
+func (s *relaySession) run() {
+	t := s.tunnel
+	t.logger.Info("Accepting relay back-connections on %s", s.listener.Addr())
+
+	for !s.isStopped() {
+		conn, err := s.register()
+		if err != nil {
+			if !s.isStopped() {
+				t.logger.Error("Failed to register relay session: %v. Retrying in %v", err, relayRetryInterval)
+				time.Sleep(relayRetryInterval)
+			}
+			continue
+		}
+
+		// The session lives as long as its registration connection
+		s.wait(conn)
+
+		s.mutex.Lock()
+		s.sessionID = ""
+		s.conn = nil
+		s.mutex.Unlock()
+		conn.Close()
+
+		if !s.isStopped() {
+			t.logger.Warn("Relay session lost, registering again in %v", relayRetryInterval)
+			time.Sleep(relayRetryInterval)
+		}
+	}
+}
+
+// register opens a registration connection and announces the back-connection address to the relay
+func (s *relaySession) register() (net.Conn, error) {
+	t := s.tunnel
+
+	conn, err := t.dialServer()
+	if err != nil {
+		return nil, err
+	}
+
+	t.mutex.Lock()
+	requestedPort, reservationID := t.remotePort, t.reservationID
+	t.mutex.Unlock()
+
+	result, err := t.handshake(conn, model.DirectHelloPayload{
+		Mode:          model.DirectModeRelay,
+		RemotePort:    requestedPort,
+		ReservationID: reservationID,
+		RelayAddr:     s.advertiseAddr(conn),
+	})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if result.RelaySessionID == "" {
+		conn.Close()
+		return nil, fmt.Errorf("server did not issue a relay session")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.stopped {
+		conn.Close()
+		return nil, fmt.Errorf("tunnel stopped")
+	}
+	s.sessionID = result.RelaySessionID
+	s.conn = conn
+	t.logger.Info("Relay session registered for remote port %d", result.RemotePort)
+
+	return conn, nil
+}
+
+// wait blocks until the registration connection is closed. The relay does not
+// send anything on it; keepalives detect a dead peer.
+func (s *relaySession) wait(conn net.Conn) {
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		tcpConn.SetKeepAlive(true)
+		tcpConn.SetKeepAlivePeriod(30 * time.Second)
+	}
+	for {
+		if _, err := readDirectFrame(conn); err != nil {
+			return
+		}
+	}
+}
+
+// advertiseAddr returns the address announced to the relay for back-connections.
+// When the listener is bound to all interfaces, the local address of the
+// registration connection is used as host, as it is the one the relay can reach.
+func (s *relaySession) advertiseAddr(conn net.Conn) string {
+	if s.advertise != "" {
+		return s.advertise
+	}
+
+	host, port, err := net.SplitHostPort(s.listener.Addr().String())
+	if err != nil {
+		return s.listener.Addr().String()
+	}
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		if localHost, _, err := net.SplitHostPort(conn.LocalAddr().String()); err == nil {
+			host = localHost
+		}
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// accept serves back-connections until the listener is closed
+func (s *relaySession) accept() {
+	t := s.tunnel
+	for {
+		relayConn, err := s.listener.Accept()
+		if err != nil {
+			if !s.isStopped() {
+				t.logger.Error("Failed to accept relay connection: %v", err)
+			}
+			return
+		}
+		go t.HandleRelayConnection(relayConn)
+	}
+}
+
+// validSession reports whether id is the ID of the current relay session
+func (s *relaySession) validSession(id string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.sessionID != "" && subtle.ConstantTimeCompare([]byte(s.sessionID), []byte(id)) == 1
+}
+
+// isStopped checks if the relay session has been closed
+func (s *relaySession) isStopped() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.stopped
+}
+
+// close ends the relay session and stops accepting back-connections
+func (s *relaySession) close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.stopped = true
+	s.listener.Close()
+	if s.conn != nil {
+		s.conn.Close()
+	}
+}
+
+// matchesTarget reports whether a target requested by the relay is the configured upstream.
+// Hosts must be equal, except that any two loopback hosts are considered the same.
+func matchesTarget(requested, configured string) bool {
+	requestedHost, requestedPort, err := net.SplitHostPort(requested)
+	if err != nil {
+		return false
+	}
+	configuredHost, configuredPort, err := net.SplitHostPort(configured)
+	if err != nil {
+		return false
+	}
+	if p1, err := strconv.Atoi(requestedPort); err != nil {
+		return false
+	} else if p2, err := strconv.Atoi(configuredPort); err != nil || p1 != p2 {
+		return false
+	}
+	if strings.EqualFold(requestedHost, configuredHost) {
+		return true
+	}
+	return isLoopbackHost(requestedHost) && isLoopbackHost(configuredHost)
+}
+
+// isLoopbackHost reports whether host is localhost or a loopback IP address
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
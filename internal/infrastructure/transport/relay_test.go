@@ -0,0 +1,200 @@
+package transport
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+)
+
+// testEchoTarget is a local service that echoes everything and counts its connections
+type testEchoTarget struct {
+	listener net.Listener
+	accepted chan struct{}
+}
+
+func newTestEchoTarget(t *testing.T) *testEchoTarget {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	target := &testEchoTarget{listener: listener, accepted: make(chan struct{}, 16)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			target.accepted <- struct{}{}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return target
+}
+
+// relayBackConnection opens a back-connection to the client like the relay does and
+// returns the connection with the answer to the connect request
+func relayBackConnection(t *testing.T, relayAddr string, request model.DirectConnectPayload) (net.Conn, model.DirectConnectResultPayload) {
+	t.Helper()
+	conn, err := net.DialTimeout("tcp", relayAddr, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if err := writeDirectFrame(conn, model.DirectFrameConnect, request); err != nil {
+		t.Fatal(err)
+	}
+	frame, err := readDirectFrame(conn)
+	if err != nil {
+		t.Fatalf("reading connect result: %v", err)
+	}
+	var result model.DirectConnectResultPayload
+	if err := decodeDirectFrame(frame, model.DirectFrameConnectResult, &result); err != nil {
+		t.Fatal(err)
+	}
+	return conn, result
+}
+
+// waitRelaySession waits until the relay session "session-1" is valid or, with valid false, lost
+func waitRelaySession(t *testing.T, relay *relaySession, valid bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for relay.validSession("session-1") != valid {
+		if time.Now().After(deadline) {
+			t.Fatalf("relay session valid = %v, want %v", !valid, valid)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRelayBackConnections(t *testing.T) {
+	target := newTestEchoTarget(t)
+	targetPort := target.listener.Addr().(*net.TCPAddr).Port
+
+	// The relay issues a session to the registration and keeps it until dropRelay is closed
+	dropRelay := make(chan struct{})
+	relayHellos := make(chan model.DirectHelloPayload, 4)
+	server := newTestDirectServer(t, func(conn net.Conn, hello model.DirectHelloPayload) {
+		if hello.Mode != model.DirectModeRelay {
+			acceptHello(4000)(conn, hello)
+			return
+		}
+		writeDirectFrame(conn, model.DirectFrameHelloResult, model.DirectHelloResultPayload{
+			Status:         model.DirectStatusOK,
+			RemotePort:     4000,
+			RelaySessionID: "session-1",
+		})
+		relayHellos <- hello
+		<-dropRelay
+	})
+	tunnel := NewDirectTunnel("", "127.0.0.1", target.listener.Addr().String(), 4000, server.port(), testLogger{}, false, "")
+	tunnel.SetRelayMode("127.0.0.1:0", "")
+	t.Cleanup(tunnel.Stop)
+	if err := tunnel.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	var relayAddr string
+	select {
+	case hello := <-relayHellos:
+		relayAddr = hello.RelayAddr
+	case <-time.After(5 * time.Second):
+		t.Fatal("the relay session was not registered")
+	}
+	tunnel.mutex.Lock()
+	relay := tunnel.relay
+	tunnel.mutex.Unlock()
+	waitRelaySession(t, relay, true)
+
+	tests := []struct {
+		name    string
+		request model.DirectConnectPayload
+		status  model.DirectStatus
+	}{
+		{"configured target", model.DirectConnectPayload{RelaySessionID: "session-1", TargetAddr: target.listener.Addr().String()}, model.DirectStatusOK},
+		{"default target", model.DirectConnectPayload{RelaySessionID: "session-1"}, model.DirectStatusOK},
+		{"loopback alias", model.DirectConnectPayload{RelaySessionID: "session-1", TargetAddr: "localhost:" + strconv.Itoa(targetPort)}, model.DirectStatusOK},
+		{"wrong session", model.DirectConnectPayload{RelaySessionID: "session-2"}, model.DirectStatusAuthFailed},
+		{"missing session", model.DirectConnectPayload{}, model.DirectStatusAuthFailed},
+		{"other port", model.DirectConnectPayload{RelaySessionID: "session-1", TargetAddr: "127.0.0.1:1"}, model.DirectStatusBadRequest},
+		{"other host", model.DirectConnectPayload{RelaySessionID: "session-1", TargetAddr: "192.0.2.1:" + strconv.Itoa(targetPort)}, model.DirectStatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, result := relayBackConnection(t, relayAddr, tt.request)
+			defer conn.Close()
+			if result.Status != tt.status {
+				t.Fatalf("status = %s (%s), want %s", result.Status, result.Message, tt.status)
+			}
+
+			if tt.status != model.DirectStatusOK {
+				// Rejected back-connections are closed without contacting the target
+				if _, err := conn.Read(make([]byte, 1)); err == nil {
+					t.Error("the rejected back-connection is still open")
+				}
+				select {
+				case <-target.accepted:
+					t.Error("the target was contacted for a rejected back-connection")
+				default:
+				}
+				return
+			}
+
+			select {
+			case <-target.accepted:
+			case <-time.After(5 * time.Second):
+				t.Fatal("the target was not contacted")
+			}
+			if _, err := conn.Write([]byte("ping")); err != nil {
+				t.Fatal(err)
+			}
+			reply := make([]byte, 4)
+			if _, err := io.ReadFull(conn, reply); err != nil || string(reply) != "ping" {
+				t.Errorf("echo = %q, %v", reply, err)
+			}
+		})
+	}
+
+	// A lost session is no longer accepted
+	close(dropRelay)
+	waitRelaySession(t, relay, false)
+	conn, result := relayBackConnection(t, relayAddr, model.DirectConnectPayload{RelaySessionID: "session-1"})
+	conn.Close()
+	if result.Status != model.DirectStatusAuthFailed {
+		t.Errorf("status after the session was lost = %s, want %s", result.Status, model.DirectStatusAuthFailed)
+	}
+}
+
+func TestMatchesTarget(t *testing.T) {
+	tests := []struct {
+		requested  string
+		configured string
+		want       bool
+	}{
+		{"127.0.0.1:22", "127.0.0.1:22", true},
+		{"localhost:22", "127.0.0.1:22", true},
+		{"[::1]:22", "localhost:22", true},
+		{"DB.example.net:5432", "db.example.net:5432", true},
+		{"127.0.0.1:022", "127.0.0.1:22", true},
+		{"127.0.0.1:23", "127.0.0.1:22", false},
+		{"10.0.0.1:22", "127.0.0.1:22", false},
+		{"db.example.net:5432", "127.0.0.1:5432", false},
+		{"127.0.0.1", "127.0.0.1:22", false},
+		{"127.0.0.1:ssh", "127.0.0.1:22", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.requested+" for "+tt.configured, func(t *testing.T) {
+			if got := matchesTarget(tt.requested, tt.configured); got != tt.want {
+				t.Errorf("matchesTarget() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
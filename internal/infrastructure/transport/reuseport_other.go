@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly && !windows
+
+package transport
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// reuseControl is not supported on this platform, so hole punching is always skipped
+func reuseControl(network, address string, c syscall.RawConn) error {
+	return fmt.Errorf("port reuse is not supported on this platform")
+}
@@ -0,0 +1,18 @@
+//go:build windows
+
+package transport
+
+import "syscall"
+
+// reuseControl sets SO_REUSEADDR so that a listener and several outgoing
+// connections can share the local port used for hole punching
+func reuseControl(network, address string, c syscall.RawConn) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(syscall.Handle(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
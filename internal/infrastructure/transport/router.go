@@ -0,0 +1,120 @@
+package transport
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+)
+
+// route sends matching requests of a tunnel to its own pool of upstreams
+type route struct {
+	config   model.TunnelRoute
+	host     string
+	balancer *balancer
+}
+
+// newRoutes validates the routes of a tunnel. Each route gets a balancer for its
+// upstreams that uses the load balancing settings of the tunnel.
+func newRoutes(configs []model.TunnelRoute, loadBalancing *model.TunnelLoadBalancing) ([]*route, error) {
+	routes := make([]*route, 0, len(configs))
+	seen := make(map[string]bool)
+	for _, config := range configs {
+		if err := config.Validate(); err != nil {
+			return nil, err
+		}
+		config.Host = strings.ToLower(config.Host)
+		if seen[config.String()] {
+			return nil, fmt.Errorf("duplicate route %s", config)
+		}
+		seen[config.String()] = true
+		b, err := newBalancer(config.Upstreams, loadBalancing)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %v", config, err)
+		}
+		if config.Path != "" {
+			// Keep the sticky cookies of the routes apart
+			b.cookiePath = config.Path
+		}
+		routes = append(routes, &route{config: config, host: config.Host, balancer: b})
+	}
+	return routes, nil
+}
+
+// matchRoute returns the most specific route matching a request, or nil. A route with
+// a host name is more specific than one with a host wildcard, which is more specific
+// than one without host; among those, the longest path wins.
+func matchRoute(routes []*route, request *model.HTTPRequest) *route {
+	host := requestHost(request)
+	path := request.URL
+	if index := strings.IndexAny(path, "?#"); index >= 0 {
+		path = path[:index]
+	}
+
+	var best *route
+	bestHost, bestPath := -1, -1
+	for _, r := range routes {
+		hostScore := matchHost(r.host, host)
+		if hostScore < 0 || !matchPath(r.config.Path, path) {
+			continue
+		}
+		if hostScore > bestHost || (hostScore == bestHost && len(r.config.Path) > bestPath) {
+			best, bestHost, bestPath = r, hostScore, len(r.config.Path)
+		}
+	}
+	return best
+}
+
+// matchHost returns how specifically a host pattern matches a host: 2 for a host
+// name, 1 for a wildcard, 0 for an empty pattern and -1 if it does not match
+func matchHost(pattern, host string) int {
+	switch {
+	case pattern == "":
+		return 0
+	case strings.HasPrefix(pattern, "*."):
+		if strings.HasSuffix(host, pattern[1:]) {
+			return 1
+		}
+	case pattern == host:
+		return 2
+	}
+	return -1
+}
+
+// matchPath reports whether a path starts with a route prefix at a segment boundary
+func matchPath(prefix, path string) bool {
+	if prefix == "" || prefix == path {
+		return true
+	}
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/'
+}
+
+// apply returns the request as it is sent to the upstreams of the route. The original
+// request is not changed, so that observers see what the visitor sent.
+func (r *route) apply(request *model.HTTPRequest) *model.HTTPRequest {
+	if !r.config.StripPrefix {
+		return request
+	}
+	prefix := strings.TrimSuffix(r.config.Path, "/")
+	routed := request.Clone()
+	routed.URL = "/" + strings.TrimLeft(strings.TrimPrefix(request.URL, prefix), "/")
+	// Let the local service build links that include the stripped prefix
+	routed.Headers.Set("X-Forwarded-Prefix", prefix)
+	return routed
+}
+
+// requestHost returns the host name a visitor requested, without port
+func requestHost(request *model.HTTPRequest) string {
+	host := request.Headers.Get("Host")
+	if host == "" {
+		host = request.Headers.Get("X-Forwarded-Host")
+	}
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	return strings.ToLower(host)
+}
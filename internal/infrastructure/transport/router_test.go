@@ -0,0 +1,118 @@
+package transport
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+)
+
+func testRoutes(t *testing.T, configs ...model.TunnelRoute) []*route {
+	t.Helper()
+	routes, err := newRoutes(configs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return routes
+}
+
+func testRouteRequest(host, url string) *model.HTTPRequest {
+	headers := http.Header{}
+	if host != "" {
+		headers.Set("Host", host)
+	}
+	return &model.HTTPRequest{Method: http.MethodGet, URL: url, Headers: headers}
+}
+
+func TestMatchRoute(t *testing.T) {
+	routes := testRoutes(t,
+		model.TunnelRoute{Path: "/api", Upstreams: []string{"8001"}},
+		model.TunnelRoute{Path: "/api/admin/", Upstreams: []string{"8002"}},
+		model.TunnelRoute{Host: "*.example.com", Upstreams: []string{"8003"}},
+		model.TunnelRoute{Host: "API.example.com", Upstreams: []string{"8004"}},
+		model.TunnelRoute{Host: "api.example.com", Path: "/v1", Upstreams: []string{"8005"}},
+	)
+
+	tests := []struct {
+		name  string
+		host  string
+		url   string
+		route string
+	}{
+		{"path prefix", "app.test", "/api", "/api"},
+		{"path below prefix", "app.test", "/api/users?x=1", "/api"},
+		{"longest path", "app.test", "/api/admin/users", "/api/admin/"},
+		{"no segment boundary", "app.test", "/apis", ""},
+		{"query is not path", "app.test", "/other?next=/api", ""},
+		{"host wildcard", "www.example.com", "/", "*.example.com"},
+		{"wildcard needs subdomain", "example.com", "/", ""},
+		{"host name beats wildcard", "api.example.com", "/", "api.example.com"},
+		{"host with port", "API.example.com:8443", "/", "api.example.com"},
+		{"host name with path", "api.example.com", "/v1/users", "api.example.com/v1"},
+		{"host beats path", "api.example.com", "/api", "api.example.com"},
+		{"no host header", "", "/api/x", "/api"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if r := matchRoute(routes, testRouteRequest(tt.host, tt.url)); r != nil {
+				got = r.config.String()
+			}
+			if got != tt.route {
+				t.Errorf("matchRoute() = %q, want %q", got, tt.route)
+			}
+		})
+	}
+}
+
+func TestRouteApply(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		strip  bool
+		url    string
+		want   string
+		prefix string
+	}{
+		{"without strip", "/api", false, "/api/users", "/api/users", ""},
+		{"strip", "/api", true, "/api/users?x=1", "/users?x=1", "/api"},
+		{"strip exact prefix", "/api", true, "/api", "/", "/api"},
+		{"strip prefix with slash", "/api/", true, "/api/users", "/users", "/api"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := testRoutes(t, model.TunnelRoute{Path: tt.path, Upstreams: []string{"8001"}, StripPrefix: tt.strip})[0]
+			request := testRouteRequest("app.test", tt.url)
+			routed := r.apply(request)
+			if routed.URL != tt.want {
+				t.Errorf("URL = %s, want %s", routed.URL, tt.want)
+			}
+			if got := routed.Headers.Get("X-Forwarded-Prefix"); got != tt.prefix {
+				t.Errorf("X-Forwarded-Prefix = %q, want %q", got, tt.prefix)
+			}
+			if request.URL != tt.url || (tt.strip && request.Headers.Get("X-Forwarded-Prefix") != "") {
+				t.Error("apply changed the original request")
+			}
+		})
+	}
+}
+
+func TestNewRoutes(t *testing.T) {
+	tests := []struct {
+		name    string
+		configs []model.TunnelRoute
+		wantErr bool
+	}{
+		{"valid", []model.TunnelRoute{{Path: "/a", Upstreams: []string{"8001"}}, {Host: "a.test", Upstreams: []string{"8002"}}}, false},
+		{"duplicate", []model.TunnelRoute{{Path: "/a", Upstreams: []string{"8001"}}, {Path: "/a", Upstreams: []string{"8002"}}}, true},
+		{"duplicate host in other case", []model.TunnelRoute{{Host: "a.test", Upstreams: []string{"8001"}}, {Host: "A.test", Upstreams: []string{"8002"}}}, true},
+		{"invalid route", []model.TunnelRoute{{Path: "a", Upstreams: []string{"8001"}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newRoutes(tt.configs, nil); (err != nil) != tt.wantErr {
+				t.Errorf("newRoutes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,364 @@
+package transport
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// e2eVersion is mixed into all derived keys and handshake MACs
+	e2eVersion = "haxorport-e2e-v2"
+	// e2eMaxRecord is the maximum plaintext size of one encrypted record
+	e2eMaxRecord = 16 * 1024
+	// e2eHandshakeTimeout is the maximum time for the end-to-end handshake
+	e2eHandshakeTimeout = 15 * time.Second
+	// e2eNonceSize is the size of the random handshake nonces
+	e2eNonceSize = 32
+)
+
+// Cost parameters of the scrypt derivation of the private tunnel keys. They make
+// guessing a secret from the identifier sent to the server expensive.
+const (
+	privateScryptN = 1 << 15
+	privateScryptR = 8
+	privateScryptP = 1
+)
+
+// privateKeys are the keys of a private tunnel, derived once from its name and secret
+type privateKeys struct {
+	// secretID is the public identifier the server matches visitors and tunnel with
+	secretID string
+	// psk authenticates the end-to-end handshake and is mixed into the session keys
+	psk []byte
+}
+
+// derivePrivateKeys derives the keys of a private tunnel with scrypt, salted with the
+// tunnel name, so the identifier sent to the server does not reveal the secret.
+func derivePrivateKeys(name, secret string) (*privateKeys, error) {
+	if secret == "" {
+		return nil, fmt.Errorf("private tunnel secret is empty")
+	}
+	master, err := scrypt.Key([]byte(secret), []byte(e2eVersion+"\n"+name), privateScryptN, privateScryptR, privateScryptP, 32)
+	if err != nil {
+		return nil, err
+	}
+	secretID, err := e2eExpand(master, nil, "secret-id", 16)
+	if err != nil {
+		return nil, err
+	}
+	psk, err := e2eExpand(master, nil, "psk", 32)
+	if err != nil {
+		return nil, err
+	}
+	return &privateKeys{secretID: hex.EncodeToString(secretID), psk: psk}, nil
+}
+
+// secureConn encrypts a connection between the two clients of a private tunnel with
+// AES-256-GCM, so the server only relays ciphertext. Every record is a 4-byte length
+// followed by the sealed data; the nonce is a per-direction counter. An empty record
+// marks the end of the stream, so a truncation by the relay is detected.
+type secureConn struct {
+	net.Conn
+
+	readMutex  sync.Mutex
+	readAEAD   cipher.AEAD
+	readSeq    uint64
+	readBuffer []byte
+	readEOF    bool
+
+	writeMutex sync.Mutex
+	writeAEAD  cipher.AEAD
+	writeSeq   uint64
+}
+
+// newSecureClientConn performs the end-to-end handshake as the visitor
+func newSecureClientConn(conn net.Conn, keys *privateKeys) (net.Conn, error) {
+	return secureHandshake(conn, keys, true)
+}
+
+// newSecureServerConn performs the end-to-end handshake as the tunnel owner
+func newSecureServerConn(conn net.Conn, keys *privateKeys) (net.Conn, error) {
+	return secureHandshake(conn, keys, false)
+}
+
+// e2eShare is the ephemeral X25519 key and nonce of one side of the handshake
+type e2eShare struct {
+	nonce     []byte
+	publicKey []byte
+}
+
+// secureHandshake exchanges ephemeral X25519 keys authenticated with the pre-shared key
+// of the tunnel, which proves knowledge of the secret in both directions. The session
+// keys are derived with HKDF from the X25519 shared secret mixed with the pre-shared
+// key, so recorded traffic stays confidential even if the secret leaks later.
+func secureHandshake(conn net.Conn, keys *privateKeys, visitor bool) (net.Conn, error) {
+	if keys == nil {
+		return nil, fmt.Errorf("private tunnel secret is empty")
+	}
+
+	conn.SetDeadline(time.Now().Add(e2eHandshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	private, own, err := newE2EShare()
+	if err != nil {
+		return nil, err
+	}
+
+	var visitorShare, ownerShare *e2eShare
+	if visitor {
+		visitorShare = own
+		if err := writeDirectFrame(conn, model.DirectFrameE2EHello, own.payload(e2eMAC(keys.psk, "visitor", own))); err != nil {
+			return nil, fmt.Errorf("failed to send end-to-end handshake: %v", err)
+		}
+
+		answer, err := readE2EHello(conn, model.DirectFrameE2EHelloResult)
+		if err != nil {
+			return nil, err
+		}
+		if ownerShare, err = parseE2EShare(answer); err != nil {
+			return nil, err
+		}
+		if !hmac.Equal([]byte(answer.MAC), []byte(e2eMAC(keys.psk, "owner", visitorShare, ownerShare))) {
+			return nil, fmt.Errorf("tunnel owner does not know the private tunnel secret")
+		}
+	} else {
+		hello, err := readE2EHello(conn, model.DirectFrameE2EHello)
+		if err != nil {
+			return nil, err
+		}
+		if visitorShare, err = parseE2EShare(hello); err != nil {
+			return nil, err
+		}
+		if !hmac.Equal([]byte(hello.MAC), []byte(e2eMAC(keys.psk, "visitor", visitorShare))) {
+			return nil, fmt.Errorf("visitor does not know the private tunnel secret")
+		}
+
+		ownerShare = own
+		if err := writeDirectFrame(conn, model.DirectFrameE2EHelloResult, own.payload(e2eMAC(keys.psk, "owner", visitorShare, ownerShare))); err != nil {
+			return nil, fmt.Errorf("failed to send end-to-end handshake: %v", err)
+		}
+	}
+
+	peer := ownerShare
+	if !visitor {
+		peer = visitorShare
+	}
+	shared, err := curve25519.X25519(private, peer.publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid end-to-end handshake key: %v", err)
+	}
+
+	toOwner, err := e2eAEAD(shared, keys.psk, "visitor->owner", visitorShare, ownerShare)
+	if err != nil {
+		return nil, err
+	}
+	toVisitor, err := e2eAEAD(shared, keys.psk, "owner->visitor", visitorShare, ownerShare)
+	if err != nil {
+		return nil, err
+	}
+
+	if visitor {
+		return &secureConn{Conn: conn, readAEAD: toVisitor, writeAEAD: toOwner}, nil
+	}
+	return &secureConn{Conn: conn, readAEAD: toOwner, writeAEAD: toVisitor}, nil
+}
+
+// newE2EShare generates a random nonce and an ephemeral X25519 key pair
+func newE2EShare() ([]byte, *e2eShare, error) {
+	nonce := make([]byte, e2eNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	private := make([]byte, curve25519.ScalarSize)
+	if _, err := rand.Read(private); err != nil {
+		return nil, nil, err
+	}
+	publicKey, err := curve25519.X25519(private, curve25519.Basepoint)
+	if err != nil {
+		return nil, nil, err
+	}
+	return private, &e2eShare{nonce: nonce, publicKey: publicKey}, nil
+}
+
+// parseE2EShare decodes the nonce and public key of the peer
+func parseE2EShare(hello *model.DirectE2EHelloPayload) (*e2eShare, error) {
+	nonce, err := base64.StdEncoding.DecodeString(hello.Nonce)
+	if err != nil || len(nonce) != e2eNonceSize {
+		return nil, fmt.Errorf("invalid end-to-end handshake nonce")
+	}
+	publicKey, err := base64.StdEncoding.DecodeString(hello.PublicKey)
+	if err != nil || len(publicKey) != curve25519.PointSize {
+		return nil, fmt.Errorf("invalid end-to-end handshake key")
+	}
+	return &e2eShare{nonce: nonce, publicKey: publicKey}, nil
+}
+
+// payload returns the handshake frame announcing the share with the given MAC
+func (s *e2eShare) payload(mac string) model.DirectE2EHelloPayload {
+	return model.DirectE2EHelloPayload{
+		Nonce:     base64.StdEncoding.EncodeToString(s.nonce),
+		PublicKey: base64.StdEncoding.EncodeToString(s.publicKey),
+		MAC:       mac,
+	}
+}
+
+// readE2EHello reads and decodes an end-to-end handshake frame of the expected type
+func readE2EHello(conn net.Conn, expected model.DirectFrameType) (*model.DirectE2EHelloPayload, error) {
+	frame, err := readDirectFrame(conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read end-to-end handshake: %v", err)
+	}
+	var hello model.DirectE2EHelloPayload
+	if err := decodeDirectFrame(frame, expected, &hello); err != nil {
+		return nil, err
+	}
+	return &hello, nil
+}
+
+// e2eMAC computes the handshake MAC of a role over the given shares
+func e2eMAC(psk []byte, role string, shares ...*e2eShare) string {
+	mac := hmac.New(sha256.New, psk)
+	fmt.Fprintf(mac, "%s\nhandshake\n%s", e2eVersion, role)
+	for _, share := range shares {
+		mac.Write(share.nonce)
+		mac.Write(share.publicKey)
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// e2eExpand derives size bytes for the given purpose from secret with HKDF-SHA256
+func e2eExpand(secret, salt []byte, purpose string, size int) ([]byte, error) {
+	key := make([]byte, size)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, []byte(e2eVersion+"\n"+purpose)), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// e2eAEAD derives the AES-256-GCM cipher of one direction from the X25519 shared
+// secret and the pre-shared key, salted with both handshake shares
+func e2eAEAD(shared, psk []byte, direction string, visitorShare, ownerShare *e2eShare) (cipher.AEAD, error) {
+	secret := append(append([]byte{}, shared...), psk...)
+	var salt []byte
+	for _, share := range []*e2eShare{visitorShare, ownerShare} {
+		salt = append(salt, share.nonce...)
+		salt = append(salt, share.publicKey...)
+	}
+	key, err := e2eExpand(secret, salt, "key\n"+direction, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// recordNonce returns the GCM nonce of the record with the given sequence number
+func recordNonce(aead cipher.AEAD, seq uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], seq)
+	return nonce
+}
+
+// Read decrypts the next records from the connection
+func (c *secureConn) Read(p []byte) (int, error) {
+	c.readMutex.Lock()
+	defer c.readMutex.Unlock()
+
+	for len(c.readBuffer) == 0 {
+		if c.readEOF {
+			return 0, io.EOF
+		}
+
+		var header [4]byte
+		if _, err := io.ReadFull(c.Conn, header[:]); err != nil {
+			if err == io.EOF {
+				return 0, io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		size := binary.BigEndian.Uint32(header[:])
+		if size > e2eMaxRecord+uint32(c.readAEAD.Overhead()) {
+			return 0, fmt.Errorf("encrypted record too large: %d bytes", size)
+		}
+		sealed := make([]byte, size)
+		if _, err := io.ReadFull(c.Conn, sealed); err != nil {
+			return 0, err
+		}
+
+		plaintext, err := c.readAEAD.Open(sealed[:0], recordNonce(c.readAEAD, c.readSeq), sealed, nil)
+		if err != nil {
+			return 0, fmt.Errorf("failed to decrypt record: %v", err)
+		}
+		c.readSeq++
+		if len(plaintext) == 0 {
+			c.readEOF = true
+		}
+		c.readBuffer = plaintext
+	}
+
+	n := copy(p, c.readBuffer)
+	c.readBuffer = c.readBuffer[n:]
+	return n, nil
+}
+
+// Write encrypts p in records of at most e2eMaxRecord bytes
+func (c *secureConn) Write(p []byte) (int, error) {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > e2eMaxRecord {
+			chunk = chunk[:e2eMaxRecord]
+		}
+		if err := c.writeRecord(chunk); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
+
+// writeRecord seals and writes one record. The caller must hold c.writeMutex.
+func (c *secureConn) writeRecord(plaintext []byte) error {
+	record := make([]byte, 4, 4+len(plaintext)+c.writeAEAD.Overhead())
+	record = c.writeAEAD.Seal(record, recordNonce(c.writeAEAD, c.writeSeq), plaintext, nil)
+	binary.BigEndian.PutUint32(record[:4], uint32(len(record)-4))
+	c.writeSeq++
+	_, err := c.Conn.Write(record)
+	return err
+}
+
+// CloseWrite sends the end-of-stream record and half-closes the underlying connection if possible
+func (c *secureConn) CloseWrite() error {
+	c.writeMutex.Lock()
+	err := c.writeRecord(nil)
+	c.writeMutex.Unlock()
+	if err != nil {
+		return err
+	}
+	closeWrite(c.Conn)
+	return nil
+}
@@ -0,0 +1,211 @@
+package transport
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+)
+
+// testPrivateKeys derives the keys of a private tunnel and fails the test on error
+func testPrivateKeys(t *testing.T, name, secret string) *privateKeys {
+	t.Helper()
+	keys, err := derivePrivateKeys(name, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+// secureConnPair runs the end-to-end handshake between a visitor and an owner over a pipe
+func secureConnPair(visitorKeys, ownerKeys *privateKeys) (visitor, owner net.Conn, visitorErr, ownerErr error) {
+	visitorSide, ownerSide := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		owner, ownerErr = newSecureServerConn(ownerSide, ownerKeys)
+		if ownerErr != nil {
+			ownerSide.Close()
+		}
+	}()
+	visitor, visitorErr = newSecureClientConn(visitorSide, visitorKeys)
+	if visitorErr != nil {
+		visitorSide.Close()
+	}
+	<-done
+	return visitor, owner, visitorErr, ownerErr
+}
+
+func TestDerivePrivateKeys(t *testing.T) {
+	keys := testPrivateKeys(t, "db", "secret")
+	if again := testPrivateKeys(t, "db", "secret"); again.secretID != keys.secretID || !bytes.Equal(again.psk, keys.psk) {
+		t.Error("the keys are not stable")
+	}
+	if strings.Contains(keys.secretID, "secret") || len(keys.secretID) != 32 {
+		t.Errorf("secret ID = %q", keys.secretID)
+	}
+
+	tests := []struct {
+		name       string
+		tunnelName string
+		secret     string
+	}{
+		{"other secret", "db", "other"},
+		{"other tunnel name", "cache", "secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			other := testPrivateKeys(t, tt.tunnelName, tt.secret)
+			if other.secretID == keys.secretID || bytes.Equal(other.psk, keys.psk) {
+				t.Error("different inputs derived the same keys")
+			}
+		})
+	}
+
+	if _, err := derivePrivateKeys("db", ""); err == nil {
+		t.Error("an empty secret was accepted")
+	}
+}
+
+func TestSecureHandshake(t *testing.T) {
+	keys := testPrivateKeys(t, "db", "secret")
+	visitor, owner, visitorErr, ownerErr := secureConnPair(keys, keys)
+	if visitorErr != nil || ownerErr != nil {
+		t.Fatalf("handshake: visitor %v, owner %v", visitorErr, ownerErr)
+	}
+	defer visitor.Close()
+	defer owner.Close()
+
+	// Larger than one record in both directions
+	message := bytes.Repeat([]byte("haxorport"), e2eMaxRecord/4)
+	for _, direction := range []struct {
+		name           string
+		writer, reader net.Conn
+	}{
+		{"visitor to owner", visitor, owner},
+		{"owner to visitor", owner, visitor},
+	} {
+		t.Run(direction.name, func(t *testing.T) {
+			go func() {
+				direction.writer.Write(message)
+			}()
+			received := make([]byte, len(message))
+			if _, err := io.ReadFull(direction.reader, received); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(received, message) {
+				t.Error("received data differs from the data sent")
+			}
+		})
+	}
+
+	// The end-of-stream record is delivered as EOF
+	go visitor.(*secureConn).CloseWrite()
+	if _, err := owner.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("read after CloseWrite: %v, want EOF", err)
+	}
+}
+
+func TestSecureHandshakeRejectsWrongSecret(t *testing.T) {
+	keys := testPrivateKeys(t, "db", "secret")
+	tests := []struct {
+		name                   string
+		visitorKeys, ownerKeys *privateKeys
+	}{
+		{"visitor with wrong secret", testPrivateKeys(t, "db", "wrong"), keys},
+		{"owner with wrong secret", keys, testPrivateKeys(t, "db", "wrong")},
+		{"other tunnel name", testPrivateKeys(t, "cache", "secret"), keys},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, visitorErr, ownerErr := secureConnPair(tt.visitorKeys, tt.ownerKeys)
+			if visitorErr == nil {
+				t.Error("visitor accepted an owner with another secret")
+			}
+			if ownerErr == nil {
+				t.Error("owner accepted a visitor with another secret")
+			}
+		})
+	}
+}
+
+func TestSecureHandshakeRejectsLowOrderKey(t *testing.T) {
+	keys := testPrivateKeys(t, "db", "secret")
+	visitorSide, ownerSide := net.Pipe()
+	defer visitorSide.Close()
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := newSecureServerConn(ownerSide, keys)
+		ownerSide.Close()
+		result <- err
+	}()
+
+	// A visitor knowing the secret but sending the all-zero point must not get a session
+	share := &e2eShare{nonce: make([]byte, e2eNonceSize), publicKey: make([]byte, 32)}
+	writeDirectFrame(visitorSide, model.DirectFrameE2EHello, share.payload(e2eMAC(keys.psk, "visitor", share)))
+	io.Copy(io.Discard, visitorSide)
+	if err := <-result; err == nil {
+		t.Error("the handshake accepted a low-order public key")
+	}
+}
+
+func TestSecureHandshakeRejectsMalformedHello(t *testing.T) {
+	keys := testPrivateKeys(t, "db", "secret")
+	share := &e2eShare{nonce: make([]byte, e2eNonceSize), publicKey: make([]byte, 32)}
+	valid := share.payload("")
+
+	tests := []struct {
+		name  string
+		hello model.DirectE2EHelloPayload
+	}{
+		{"short nonce", model.DirectE2EHelloPayload{Nonce: base64.StdEncoding.EncodeToString([]byte("short")), PublicKey: valid.PublicKey}},
+		{"invalid nonce", model.DirectE2EHelloPayload{Nonce: "!", PublicKey: valid.PublicKey}},
+		{"missing key", model.DirectE2EHelloPayload{Nonce: valid.Nonce}},
+		{"short key", model.DirectE2EHelloPayload{Nonce: valid.Nonce, PublicKey: base64.StdEncoding.EncodeToString([]byte("short"))}},
+		{"wrong MAC", model.DirectE2EHelloPayload{Nonce: valid.Nonce, PublicKey: valid.PublicKey, MAC: "00"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			visitorSide, ownerSide := net.Pipe()
+			defer visitorSide.Close()
+			result := make(chan error, 1)
+			go func() {
+				_, err := newSecureServerConn(ownerSide, keys)
+				ownerSide.Close()
+				result <- err
+			}()
+			writeDirectFrame(visitorSide, model.DirectFrameE2EHello, tt.hello)
+			io.Copy(io.Discard, visitorSide)
+			if err := <-result; err == nil {
+				t.Error("the handshake accepted a malformed hello")
+			}
+		})
+	}
+}
+
+func TestSecureConnDetectsTruncation(t *testing.T) {
+	keys := testPrivateKeys(t, "db", "secret")
+	visitor, owner, visitorErr, ownerErr := secureConnPair(keys, keys)
+	if visitorErr != nil || ownerErr != nil {
+		t.Fatalf("handshake: visitor %v, owner %v", visitorErr, ownerErr)
+	}
+	defer owner.Close()
+
+	// Closing the underlying connection without the end-of-stream record is not a clean EOF
+	go func() {
+		visitor.Write([]byte("data"))
+		visitor.(*secureConn).Conn.Close()
+	}()
+	buffer := make([]byte, 4)
+	if _, err := io.ReadFull(owner, buffer); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := owner.Read(buffer); err == nil || err == io.EOF {
+		t.Errorf("read of a truncated stream: %v, want an error other than EOF", err)
+	}
+}
@@ -0,0 +1,89 @@
+package transport
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+)
+
+// NewTLSConfig creates the TLS configuration shared by the WebSocket client and direct TCP tunnels.
+// It loads the client certificate, the CA bundle and the public key pins from the configuration.
+func NewTLSConfig(config *model.Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: config.TLSServerName,
+	}
+
+	// Load TLS client certificate and key if provided
+	if config.TLSCert != "" && config.TLSKey != "" {
+		cert, err := tls.LoadX509KeyPair(config.TLSCert, config.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	// Use a custom CA bundle instead of the system roots if provided
+	if config.TLSCA != "" {
+		caData, err := os.ReadFile(config.TLSCA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read TLS CA file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caData) {
+			return nil, fmt.Errorf("no valid certificates found in TLS CA file %s", config.TLSCA)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	pins, err := parsePins(config.TLSPinnedSHA256)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig.InsecureSkipVerify = config.TLSInsecureSkipVerify
+	if len(pins) > 0 {
+		// Pins are checked after (or, with InsecureSkipVerify, instead of) chain verification
+		tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+			return verifyPins(state.PeerCertificates, pins)
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// parsePins decodes base64 SHA-256 SPKI pins, accepting an optional "sha256/" prefix
+func parsePins(values []string) ([][]byte, error) {
+	pins := make([][]byte, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimPrefix(strings.TrimSpace(value), "sha256/")
+		if value == "" {
+			continue
+		}
+		pin, err := base64.StdEncoding.DecodeString(value)
+		if err != nil || len(pin) != sha256.Size {
+			return nil, fmt.Errorf("invalid TLS public key pin: %s", value)
+		}
+		pins = append(pins, pin)
+	}
+	return pins, nil
+}
+
+// verifyPins checks that at least one certificate presented by the server matches a pin
+func verifyPins(certs []*x509.Certificate, pins [][]byte) error {
+	for _, cert := range certs {
+		sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		for _, pin := range pins {
+			if string(sum[:]) == string(pin) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("server certificate does not match any pinned public key")
+}
@@ -0,0 +1,178 @@
+package transport
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/haxorport/haxorport-go-client/internal/domain/model"
+)
+
+// testCertificate is a certificate with its private key
+type testCertificate struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCertificate creates a certificate for name signed by parent, or a self-signed CA if parent is nil
+func newTestCertificate(t *testing.T, name string, parent *testCertificate) *testCertificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		template.DNSNames = []string{name}
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCertificate{cert: cert, key: key}
+}
+
+// pin returns the base64 SHA-256 hash of the certificate public key
+func (c *testCertificate) pin() string {
+	sum := sha256.Sum256(c.cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// writePEMFile writes PEM data to a file in a temporary directory and returns its path
+func writePEMFile(t *testing.T, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// certificatePEM encodes certificates as a PEM bundle
+func certificatePEM(certs ...*testCertificate) []byte {
+	var data []byte
+	for _, c := range certs {
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw})...)
+	}
+	return data
+}
+
+// tlsHandshake runs a handshake between a client with config and a server presenting leaf and its chain
+func tlsHandshake(t *testing.T, config *tls.Config, leaf *testCertificate, chain ...*testCertificate) error {
+	t.Helper()
+	serverCert := tls.Certificate{Certificate: [][]byte{leaf.cert.Raw}, PrivateKey: leaf.key}
+	for _, c := range chain {
+		serverCert.Certificate = append(serverCert.Certificate, c.cert.Raw)
+	}
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	go func() {
+		defer serverConn.Close()
+		tls.Server(serverConn, &tls.Config{Certificates: []tls.Certificate{serverCert}}).Handshake()
+	}()
+	clientConn.SetDeadline(time.Now().Add(5 * time.Second))
+	return tls.Client(clientConn, config).Handshake()
+}
+
+func TestNewTLSConfigVerifiesServer(t *testing.T) {
+	ca := newTestCertificate(t, "Test CA", nil)
+	server := newTestCertificate(t, "tunnel.example.net", ca)
+	otherCA := newTestCertificate(t, "Other CA", nil)
+	caFile := writePEMFile(t, certificatePEM(ca))
+
+	tests := []struct {
+		name   string
+		config model.Config
+		chain  []*testCertificate
+		valid  bool
+	}{
+		{"trusted CA", model.Config{TLSCA: caFile, TLSServerName: "tunnel.example.net"}, nil, true},
+		{"CA in a bundle", model.Config{TLSCA: writePEMFile(t, certificatePEM(otherCA, ca)), TLSServerName: "tunnel.example.net"}, nil, true},
+		{"other CA", model.Config{TLSCA: writePEMFile(t, certificatePEM(otherCA)), TLSServerName: "tunnel.example.net"}, nil, false},
+		{"system roots", model.Config{TLSServerName: "tunnel.example.net"}, nil, false},
+		{"other server name", model.Config{TLSCA: caFile, TLSServerName: "other.example.net"}, nil, false},
+		{"matching server pin", model.Config{TLSCA: caFile, TLSServerName: "tunnel.example.net", TLSPinnedSHA256: []string{server.pin()}}, nil, true},
+		{"pin with prefix", model.Config{TLSCA: caFile, TLSServerName: "tunnel.example.net", TLSPinnedSHA256: []string{"sha256/" + server.pin()}}, nil, true},
+		{"one of several pins", model.Config{TLSCA: caFile, TLSServerName: "tunnel.example.net", TLSPinnedSHA256: []string{otherCA.pin(), server.pin()}}, nil, true},
+		{"CA pin in the chain", model.Config{TLSCA: caFile, TLSServerName: "tunnel.example.net", TLSPinnedSHA256: []string{ca.pin()}}, []*testCertificate{ca}, true},
+		{"CA pin not sent", model.Config{TLSCA: caFile, TLSServerName: "tunnel.example.net", TLSPinnedSHA256: []string{ca.pin()}}, nil, false},
+		{"pin mismatch", model.Config{TLSCA: caFile, TLSServerName: "tunnel.example.net", TLSPinnedSHA256: []string{otherCA.pin()}}, nil, false},
+		{"insecure", model.Config{TLSInsecureSkipVerify: true}, nil, true},
+		// Pins are still enforced when chain verification is skipped
+		{"insecure with pin", model.Config{TLSInsecureSkipVerify: true, TLSPinnedSHA256: []string{server.pin()}}, nil, true},
+		{"insecure with pin mismatch", model.Config{TLSInsecureSkipVerify: true, TLSPinnedSHA256: []string{otherCA.pin()}}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := NewTLSConfig(&tt.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = tlsHandshake(t, config, server, tt.chain...)
+			if (err == nil) != tt.valid {
+				t.Errorf("handshake error = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestNewTLSConfigRejectsInvalidSettings(t *testing.T) {
+	tests := []struct {
+		name   string
+		config model.Config
+	}{
+		{"missing CA file", model.Config{TLSCA: filepath.Join(t.TempDir(), "missing.pem")}},
+		{"CA file without certificates", model.Config{TLSCA: writePEMFile(t, []byte("not a certificate"))}},
+		{"pin not base64", model.Config{TLSPinnedSHA256: []string{"not a pin!"}}},
+		{"pin of the wrong size", model.Config{TLSPinnedSHA256: []string{base64.StdEncoding.EncodeToString([]byte("short"))}}},
+		{"missing client key", model.Config{TLSCert: filepath.Join(t.TempDir(), "cert.pem"), TLSKey: filepath.Join(t.TempDir(), "key.pem")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewTLSConfig(&tt.config); err == nil {
+				t.Error("NewTLSConfig() accepted invalid settings")
+			}
+		})
+	}
+}
+
+func TestParsePins(t *testing.T) {
+	sum := sha256.Sum256([]byte("key"))
+	pin := base64.StdEncoding.EncodeToString(sum[:])
+	pins, err := parsePins([]string{"", " sha256/" + pin + " ", pin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != 2 || string(pins[0]) != string(sum[:]) || string(pins[1]) != string(sum[:]) {
+		t.Errorf("parsePins() = %x, want the hash twice", pins)
+	}
+}
@@ -3,6 +3,7 @@ package transport
 import (
 	"fmt"
 	"net"
+	"strconv"
 	"time"
 
 	"github.com/haxorport/haxorport-go-client/internal/domain/model"
@@ -56,59 +57,89 @@ type directTunnelRepository struct {
 }
 
 // CreateTunnel creates a new direct tunnel
-func (r *directTunnelRepository) CreateTunnel(localPort, remotePort int, targetHost string, targetPort int) (interface{}, error) {
-	targetAddr := fmt.Sprintf("%s:%d", targetHost, targetPort)
+// localListen is the optional local forwarding address (empty to disable)
+func (r *directTunnelRepository) CreateTunnel(localListen string, remotePort int, targetHost string, targetPort int) (interface{}, error) {
+	targetAddr := net.JoinHostPort(targetHost, strconv.Itoa(targetPort))
+	tunnel, err := newDirectTunnelFromConfig(r.config, r.logger, localListen, targetAddr, remotePort)
+	if err != nil {
+		return nil, err
+	}
+	tunnel.SetControlPoolSize(r.config.ControlPoolMinIdle, r.config.ControlPoolMaxIdle)
+	tunnel.SetP2PEnabled(r.config.DirectP2PEnabled)
+	if r.config.DirectRelayListen != "" {
+		tunnel.SetRelayMode(r.config.DirectRelayListen, r.config.DirectRelayAdvertise)
+	}
+	return tunnel, nil
+}
 
-	// If remotePort is 0, generate random port
-	if remotePort == 0 {
-		remotePort = generateRandomInt(10000, 30000)
-		r.logger.Info("Using random port %d for tunnel", remotePort)
+// NewVisitorFromConfig creates a Visitor for the tunnel on the given remote port,
+// using the server, TLS and authentication settings of the configuration
+func NewVisitorFromConfig(config *model.Config, logger port.Logger, remotePort int) (*Visitor, error) {
+	tunnel, err := newDirectTunnelFromConfig(config, logger, "", "", remotePort)
+	if err != nil {
+		return nil, err
 	}
+	return NewVisitor(tunnel, remotePort, config.DirectP2PEnabled), nil
+}
 
-	// In reverse tunnel, localAddr is not used for listening
-	// but we still store it for reference
-	localAddr := fmt.Sprintf("127.0.0.1:%d", localPort)
+// NewPrivateVisitorFromConfig creates a Visitor for the private tunnel with the given name,
+// using the server, TLS and authentication settings of the configuration
+func NewPrivateVisitorFromConfig(config *model.Config, logger port.Logger, name, secret string) (*Visitor, error) {
+	if secret == "" {
+		return nil, fmt.Errorf("a secret is required to connect to private tunnel %s", name)
+	}
+	tunnel, err := newDirectTunnelFromConfig(config, logger, "", "", 0)
+	if err != nil {
+		return nil, err
+	}
+	return NewPrivateVisitor(tunnel, name, secret, config.DirectP2PEnabled)
+}
 
+// newDirectTunnelFromConfig creates a DirectTunnel with the server, TLS and authentication settings of the configuration
+func newDirectTunnelFromConfig(config *model.Config, logger port.Logger, localListen, targetAddr string, remotePort int) (*DirectTunnel, error) {
 	// Use control port from configuration and auth settings
 	tunnel := NewDirectTunnel(
-		localAddr, 
-		r.config.ServerAddress, 
+		localListen, 
+		config.ServerAddress, 
 		targetAddr, 
-		localPort, 
 		remotePort, 
-		r.config.ControlPort, 
-		r.logger,
-		r.config.AuthEnabled,
-		r.config.AuthToken,
+		config.ControlPort, 
+		logger,
+		config.AuthEnabled,
+		config.AuthToken,
 	)
+	tunnel.SetLegacyHandshake(config.DirectLegacyHandshake)
+	tunnel.SetAuthMode(config.AuthMode)
+
+	// Encrypt the registration and control connections if enabled
+	if config.DirectTLSEnabled {
+		tlsConfig, err := NewTLSConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		tunnel.SetTLSConfig(tlsConfig)
+	}
 	return tunnel, nil
 }
 
 // Register mendaftarkan tunnel baru ke server
 func (r *directTunnelRepository) Register(config model.TunnelConfig) (*model.Tunnel, error) {
-	// If remote port is not specified, use random port in range 10000-30000
+	// If remote port is not specified, the server reserves a free port for the tunnel
 	if config.RemotePort == 0 {
-		// Use random port for direct TCP
-		minPort := 10000
-		maxPort := 30000
-		config.RemotePort = generateRandomInt(minPort, maxPort)
-		r.logger.Info("Using random port %d for tunnel", config.RemotePort)
+		r.logger.Info("No remote port requested, asking server to reserve a free port")
 	}
 
 	// Create tunnel model
 	tunnel := model.NewTunnel(generateID(), config)
 	tunnel.SetTCPInfo(config.RemotePort)
 
-	// Use local port with offset 6000 to avoid conflicts with ports already in use
-	localListenerPort := 6000 + config.LocalPort
-	if localListenerPort < 1024 || localListenerPort > 65535 {
-		localListenerPort = generateRandomInt(3000, 9000)
+	// Create direct tunnel, with a local listener only if explicitly requested
+	targetHost := config.LocalAddr
+	if targetHost == "" {
+		targetHost = "127.0.0.1"
 	}
-
-	// Create direct tunnel
-	targetHost := "127.0.0.1"
 	targetPort := config.LocalPort
-	directTunnel, err := r.CreateTunnel(localListenerPort, config.RemotePort, targetHost, targetPort)
+	directTunnel, err := r.CreateTunnel(config.LocalListen, config.RemotePort, targetHost, targetPort)
 	if err != nil {
 		return nil, err
 	}
@@ -118,24 +149,46 @@ func (r *directTunnelRepository) Register(config model.TunnelConfig) (*model.Tun
 	if !ok {
 		return nil, fmt.Errorf("unexpected tunnel type")
 	}
+	if config.Private {
+		if config.Name == "" {
+			return nil, fmt.Errorf("private tunnels require a name")
+		}
+		if err := dt.SetPrivate(config.Name, config.Secret); err != nil {
+			return nil, err
+		}
+	}
+	dt.SetProxyProtocol(config.ProxyProtocol)
+	if err := dt.SetAccessList(config.AllowCIDRs, config.DenyCIDRs); err != nil {
+		return nil, err
+	}
 
 	err = dt.Start()
 	if err != nil {
 		return nil, err
 	}
 
-	// Update RemotePort in model.Tunnel if server uses alternative port
-	if dt.remotePort != config.RemotePort {
-		r.logger.Warn("IMPORTANT: Server using alternative port %d (requested: %d), updating tunnel", dt.remotePort, config.RemotePort)
-		tunnel.RemotePort = dt.remotePort
-		tunnel.Config.RemotePort = dt.remotePort
+	// Update RemotePort in model.Tunnel with the port reserved by the server
+	remotePort := dt.RemotePort()
+	if config.Private {
+		r.logger.Info("Private tunnel %s registered without a public port", config.Name)
+	} else if config.RemotePort == 0 {
+		r.logger.Info("Server reserved port %d for tunnel", remotePort)
+		tunnel.RemotePort = remotePort
+		tunnel.Config.RemotePort = remotePort
+	} else if remotePort != config.RemotePort {
+		r.logger.Warn("IMPORTANT: Server using alternative port %d (requested: %d), updating tunnel", remotePort, config.RemotePort)
+		tunnel.RemotePort = remotePort
+		tunnel.Config.RemotePort = remotePort
 		
 		// Additional log to ensure alternative port is clearly visible
-		r.logger.Info("Tunnel will use alternative port %d for connection", dt.remotePort)
+		r.logger.Info("Tunnel will use alternative port %d for connection", remotePort)
 	} else {
-		r.logger.Info("Server is using the requested port: %d", dt.remotePort)
+		r.logger.Info("Server is using the requested port: %d", remotePort)
 	}
 
+	// Report the address of the local listener if enabled
+	tunnel.LocalListen = dt.LocalListenAddr()
+
 	// Simpan tunnel
 	r.tunnels[tunnel.ID] = directTunnel
 
@@ -169,23 +222,29 @@ func (r *directTunnelRepository) GetByID(tunnelID string) (*model.Tunnel, error)
 		}
 		
 		// Parse targetAddr to get host and port
-		host, _, err := net.SplitHostPort(tunnel.targetAddr)
+		host, targetPort, err := net.SplitHostPort(tunnel.targetAddr)
 		if err != nil {
 			r.logger.Warn("Gagal memparse targetAddr %s: %v", tunnel.targetAddr, err)
 			host = "127.0.0.1"
 		}
+		localPort, _ := strconv.Atoi(targetPort)
 		
 		// Buat model.Tunnel dari DirectTunnel
+		remotePort := tunnel.RemotePort()
 		modelTunnel := &model.Tunnel{
 			ID:         tunnelID,
-			RemotePort: tunnel.remotePort,
+			RemotePort: remotePort,
 			Active:     true,
 			Config: model.TunnelConfig{
-				LocalPort:  tunnel.localPort,
-				RemotePort: tunnel.remotePort,
+				LocalPort:  localPort,
+				RemotePort: remotePort,
 				LocalAddr:  host,
 				Type:       model.TunnelTypeTCP,
+				Name:       tunnel.privateName,
+				Private:    tunnel.privateName != "",
 			},
+			LocalListen: tunnel.LocalListenAddr(),
+			ControlPool: tunnel.ControlPoolStats(),
 		}
 		
 		return modelTunnel, nil
@@ -223,24 +282,30 @@ func (r *directTunnelRepository) GetAll() []*model.Tunnel {
 			continue
 		}
 		
-		// Parse targetAddr to get host
-		host, _, err := net.SplitHostPort(directTunnel.targetAddr)
+		// Parse targetAddr to get host and port
+		host, targetPort, err := net.SplitHostPort(directTunnel.targetAddr)
 		if err != nil {
 			r.logger.Warn("Failed to parse targetAddr %s: %v", directTunnel.targetAddr, err)
 			host = "127.0.0.1"
 		}
+		localPort, _ := strconv.Atoi(targetPort)
 		
 		// Buat model.Tunnel dari DirectTunnel
+		remotePort := directTunnel.RemotePort()
 		modelTunnel := &model.Tunnel{
 			ID:         id,
-			RemotePort: directTunnel.remotePort,
+			RemotePort: remotePort,
 			Active:     true,
 			Config: model.TunnelConfig{
-				LocalPort:  directTunnel.localPort,
-				RemotePort: directTunnel.remotePort,
+				LocalPort:  localPort,
+				RemotePort: remotePort,
 				LocalAddr:  host,
 				Type:       model.TunnelTypeTCP,
+				Name:       directTunnel.privateName,
+				Private:    directTunnel.privateName != "",
 			},
+			LocalListen: directTunnel.LocalListenAddr(),
+			ControlPool: directTunnel.ControlPoolStats(),
 		}
 		
 		tunnels = append(tunnels, modelTunnel)
@@ -272,8 +337,3 @@ func generateID() string {
 	return fmt.Sprintf("tunnel-%d", time.Now().UnixNano())
 }
 
-
-// generateRandomInt menghasilkan angka acak dalam rentang min-max
-func generateRandomInt(min, max int) int {
-	return min + int(time.Now().UnixNano() % int64(max-min+1))
-}
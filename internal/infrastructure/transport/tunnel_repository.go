@@ -20,6 +20,7 @@ type TunnelRepository struct {
 	logger      port.Logger
 	tunnels     map[string]*model.Tunnel
 	connections map[string]net.Conn
+	access      map[string]*accessList
 	mutex       sync.RWMutex
 	ctx         context.Context
 }
@@ -49,6 +50,7 @@ func NewTunnelRepository(client *Client, logger port.Logger) *TunnelRepository {
 		logger:      logger,
 		tunnels:     make(map[string]*model.Tunnel),
 		connections: make(map[string]net.Conn),
+		access:      make(map[string]*accessList),
 		mutex:       sync.RWMutex{},
 		ctx:         ctx,
 	}
@@ -68,6 +70,12 @@ func (r *TunnelRepository) Register(config model.TunnelConfig) (*model.Tunnel, e
 		}
 	}
 
+	// Parse the access list once, it is applied to every new connection
+	access, err := newAccessList(config.AllowCIDRs, config.DenyCIDRs)
+	if err != nil {
+		return nil, err
+	}
+
 	// Send register tunnel request to server
 	response, err := r.client.SendRegisterTunnel(config)
 	if err != nil {
@@ -92,6 +100,7 @@ func (r *TunnelRepository) Register(config model.TunnelConfig) (*model.Tunnel, e
 	// Store the tunnel in the repository
 	r.mutex.Lock()
 	r.tunnels[response.TunnelID] = tunnel
+	r.access[response.TunnelID] = access
 	r.mutex.Unlock()
 
 	// Start the tunnel listener if it's a TCP tunnel
@@ -119,6 +128,7 @@ func (r *TunnelRepository) Unregister(tunnelID string) error {
 	// Remove the tunnel from the repository
 	r.mutex.Lock()
 	delete(r.tunnels, tunnelID)
+	delete(r.access, tunnelID)
 	r.mutex.Unlock()
 
 	return nil
@@ -271,6 +281,19 @@ func (r *TunnelRepository) handleDataMessage(msg *model.Message) error {
 			return fmt.Errorf("tunnel not found: %v", err)
 		}
 
+		// Drop connections of visitors not allowed by the access list. Only the first
+		// data of a connection carries the visitor address, so later data is dropped too.
+		r.mutex.RLock()
+		access := r.access[payload.TunnelID]
+		r.mutex.RUnlock()
+		if !access.allows(payload.RemoteAddr) {
+			if payload.RemoteAddr != "" {
+				r.logger.Warn("Rejected connection %s from %q: source address not allowed by the access list",
+					payload.ConnectionID, payload.RemoteAddr)
+			}
+			return nil
+		}
+
 		localAddr := net.JoinHostPort(tunnel.Config.LocalAddr, fmt.Sprintf("%d", tunnel.Config.LocalPort))
 		r.logger.Info("Connecting to local service at %s for connection %s...", localAddr, payload.ConnectionID)
 
@@ -313,6 +336,13 @@ func (r *TunnelRepository) handleDataMessage(msg *model.Message) error {
 
 		r.logger.Info("Successfully connected to local service at %s for connection %s", localAddr, payload.ConnectionID)
 
+		// Announce the visitor address to the local service before any data
+		if err := writeProxyHeader(conn, tunnel.Config.ProxyProtocol, payload.RemoteAddr, conn.RemoteAddr().String()); err != nil {
+			r.logger.Error("Failed to send PROXY protocol header for connection %s: %v", payload.ConnectionID, err)
+			conn.Close()
+			return err
+		}
+
 		r.mutex.Lock()
 		r.connections[payload.ConnectionID] = conn
 		r.mutex.Unlock()